@@ -10,10 +10,19 @@ import (
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcastclients"
 	"github.com/offchainlabs/nitro/staker"
 	"github.com/offchainlabs/nitro/validator"
 )
 
+type FeedAPI struct {
+	clients *broadcastclients.BroadcastClients
+}
+
+func (a *FeedAPI) CheckFeedHealth(ctx context.Context) error {
+	return a.clients.Healthy(ctx)
+}
+
 type BlockValidatorAPI struct {
 	val *staker.BlockValidator
 }
@@ -688,6 +688,24 @@ func createNodeImpl(
 		if err != nil {
 			return nil, err
 		}
+		if inboxVerifier := broadcastClients.InboxVerifier(); inboxVerifier != nil {
+			txStreamer.SetInboxVerifier(inboxVerifier)
+		}
+		if l1client != nil {
+			if err := broadcastClients.SetRegistryCaller(l1client); err != nil {
+				return nil, err
+			}
+			if err := broadcastClients.SetBLSKeyRegistryCaller(l1client); err != nil {
+				return nil, err
+			}
+		}
+		if discovery := config.Feed.Input.Discovery; discovery.Enable() && discovery.Type == "coordinator" {
+			feedCoordinator, err := redisutil.NewRedisCoordinator(discovery.Record)
+			if err != nil {
+				return nil, err
+			}
+			broadcastClients.SetCoordinator(feedCoordinator)
+		}
 	}
 
 	if !config.ParentChainReader.Enable {
@@ -960,6 +978,15 @@ func CreateNode(
 		})
 	}
 
+	if currentNode.BroadcastClients != nil {
+		apis = append(apis, rpc.API{
+			Namespace: "arb",
+			Version:   "1.0",
+			Service:   &FeedAPI{clients: currentNode.BroadcastClients},
+			Public:    false,
+		})
+	}
+
 	apis = append(apis, rpc.API{
 		Namespace: "arb",
 		Version:   "1.0",
@@ -72,6 +72,7 @@ type SeqCoordinatorConfig struct {
 	// Max message per poll.
 	MsgPerPoll arbutil.MessageIndex       `koanf:"msg-per-poll"`
 	MyUrl      string                     `koanf:"my-url"`
+	MyFeedUrl  string                     `koanf:"my-feed-url"`
 	Signer     signature.SignVerifyConfig `koanf:"signer"`
 }
 
@@ -96,6 +97,7 @@ func SeqCoordinatorConfigAddOptions(prefix string, f *flag.FlagSet) {
 	f.Int(prefix+".release-retries", DefaultSeqCoordinatorConfig.ReleaseRetries, "the number of times to retry releasing the wants lockout and chosen one status on shutdown")
 	f.Uint64(prefix+".msg-per-poll", uint64(DefaultSeqCoordinatorConfig.MsgPerPoll), "will only be marked as wanting the lockout if not too far behind")
 	f.String(prefix+".my-url", DefaultSeqCoordinatorConfig.MyUrl, "url for this sequencer if it is the chosen")
+	f.String(prefix+".my-feed-url", DefaultSeqCoordinatorConfig.MyFeedUrl, "feed url for this sequencer, published for nodes following the chosen sequencer's feed")
 	signature.SignVerifyConfigAddOptions(prefix+".signer", f)
 }
 
@@ -113,6 +115,7 @@ var DefaultSeqCoordinatorConfig = SeqCoordinatorConfig{
 	RetryInterval:         50 * time.Millisecond,
 	MsgPerPoll:            2000,
 	MyUrl:                 redisutil.INVALID_URL,
+	MyFeedUrl:             "",
 	Signer:                signature.DefaultSignVerifyConfig,
 }
 
@@ -129,6 +132,7 @@ var TestSeqCoordinatorConfig = SeqCoordinatorConfig{
 	RetryInterval:     time.Millisecond * 3,
 	MsgPerPoll:        20,
 	MyUrl:             redisutil.INVALID_URL,
+	MyFeedUrl:         "",
 	Signer:            signature.DefaultSignVerifyConfig,
 }
 
@@ -371,6 +375,12 @@ func (c *SeqCoordinator) wantsLockoutUpdateWithMutex(ctx context.Context) error
 	}
 	pipe.Set(ctx, myWantsLockoutKey, redisutil.WANTS_LOCKOUT_VAL, initialDuration)
 	pipe.PExpireAt(ctx, myWantsLockoutKey, wantsLockoutUntil)
+	if c.config.MyFeedUrl != "" {
+		// Published along with wanting the lockout, so it's there once chosen
+		myFeedUrlKey := redisutil.FeedURLKeyFor(c.config.Url())
+		pipe.Set(ctx, myFeedUrlKey, c.config.MyFeedUrl, initialDuration)
+		pipe.PExpireAt(ctx, myFeedUrlKey, wantsLockoutUntil)
+	}
 	err := execTestPipe(pipe, ctx)
 	if err != nil {
 		return fmt.Errorf("failed to update wants lockout key in redis: %w", err)
@@ -32,6 +32,7 @@ import (
 	"github.com/offchainlabs/nitro/arbnode/execution"
 	"github.com/offchainlabs/nitro/arbos/arbostypes"
 	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcastclient"
 	"github.com/offchainlabs/nitro/broadcaster"
 	"github.com/offchainlabs/nitro/staker"
 	"github.com/offchainlabs/nitro/util/sharedmetrics"
@@ -66,6 +67,7 @@ type TransactionStreamer struct {
 	broadcastServer *broadcaster.Broadcaster
 	inboxReader     *InboxReader
 	delayedBridge   *DelayedBridge
+	inboxVerifier   *broadcastclient.InboxVerifier
 }
 
 type TransactionStreamerConfig struct {
@@ -159,6 +161,16 @@ func (s *TransactionStreamer) SetInboxReaders(inboxReader *InboxReader, delayedB
 	s.delayedBridge = delayedBridge
 }
 
+func (s *TransactionStreamer) SetInboxVerifier(inboxVerifier *broadcastclient.InboxVerifier) {
+	if s.Started() {
+		panic("trying to set inbox verifier after start")
+	}
+	if s.inboxVerifier != nil {
+		panic("trying to set inbox verifier when already set")
+	}
+	s.inboxVerifier = inboxVerifier
+}
+
 func (s *TransactionStreamer) ChainConfig() *params.ChainConfig {
 	return s.chainConfig
 }
@@ -563,6 +575,9 @@ func endBatch(batch ethdb.Batch) error {
 }
 
 func (s *TransactionStreamer) AddMessagesAndEndBatch(pos arbutil.MessageIndex, messagesAreConfirmed bool, messages []arbostypes.MessageWithMetadata, batch ethdb.Batch) error {
+	if messagesAreConfirmed && s.inboxVerifier != nil {
+		s.inboxVerifier.VerifyInboxMessages(pos, messages)
+	}
 	if messagesAreConfirmed {
 		s.reorgMutex.RLock()
 		dups, _, _, err := s.countDuplicateMessages(pos, messages, nil)
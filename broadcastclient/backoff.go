@@ -0,0 +1,93 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+// ReconnectConfig controls how the feed is reconnected to after the connection
+// is lost or couldn't be made
+type ReconnectConfig struct {
+	BackoffMultiplier    float64       `koanf:"backoff-multiplier" reload:"hot"`
+	ConnectRetryInterval time.Duration `koanf:"connect-retry-interval" reload:"hot"`
+	BackoffResetAfter    time.Duration `koanf:"backoff-reset-after" reload:"hot"`
+	MaxAttempts          int           `koanf:"max-attempts" reload:"hot"`
+	MaxDowntime          time.Duration `koanf:"max-downtime" reload:"hot"`
+}
+
+func ReconnectConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Float64(prefix+".backoff-multiplier", DefaultReconnectConfig.BackoffMultiplier, "factor the reconnect wait grows by after each failed attempt, each wait is randomly jittered down by up to half")
+	f.Duration(prefix+".connect-retry-interval", DefaultReconnectConfig.ConnectRetryInterval, "fixed interval between attempts to make the first connection to the feed (0 = back off like reconnects)")
+	f.Duration(prefix+".backoff-reset-after", DefaultReconnectConfig.BackoffResetAfter, "duration a connection must stay up and read from before the reconnect backoff and retry count start over (0 = once anything is read)")
+	f.Int(prefix+".max-attempts", DefaultReconnectConfig.MaxAttempts, "number of consecutive failed reconnect attempts after which the feed is given up on (0 = retry forever)")
+	f.Duration(prefix+".max-downtime", DefaultReconnectConfig.MaxDowntime, "duration without a feed connection after which the feed is given up on (0 = retry forever)")
+}
+
+var DefaultReconnectConfig = ReconnectConfig{
+	BackoffMultiplier:    2,
+	ConnectRetryInterval: 0,
+	BackoffResetAfter:    time.Minute,
+	MaxAttempts:          0,
+	MaxDowntime:          0,
+}
+
+var DefaultTestReconnectConfig = ReconnectConfig{
+	BackoffMultiplier:    2,
+	ConnectRetryInterval: 0,
+	BackoffResetAfter:    5 * time.Second,
+	MaxAttempts:          0,
+	MaxDowntime:          0,
+}
+
+func (c *ReconnectConfig) Validate() error {
+	if c.ConnectRetryInterval < 0 {
+		return errors.New("feed connect retry interval must not be negative")
+	}
+	if c.BackoffResetAfter < 0 {
+		return errors.New("feed backoff reset duration must not be negative")
+	}
+	return nil
+}
+
+// reconnectBackoff computes exponentially growing reconnect delays. Each delay
+// is jittered down by up to half so that clients disconnected at the same time
+// don't all reconnect to the relay at the same time.
+type reconnectBackoff struct {
+	current time.Duration
+}
+
+// next returns the delay before the next reconnect attempt
+func (b *reconnectBackoff) next(config *Config) time.Duration {
+	if b.current <= 0 {
+		b.current = config.ReconnectInitialBackoff
+	} else {
+		multiplier := config.Reconnect.BackoffMultiplier
+		if multiplier < 1 {
+			multiplier = 1
+		}
+		b.current = time.Duration(float64(b.current) * multiplier)
+	}
+	if b.current > config.ReconnectMaximumBackoff {
+		b.current = config.ReconnectMaximumBackoff
+	}
+	if b.current <= 0 {
+		return 0
+	}
+	half := b.current / 2
+	return half + time.Duration(rand.Int63n(int64(b.current-half)+1))
+}
+
+// connectRetry returns the delay before the next attempt to make the first
+// connection to the feed, Reconnect.ConnectRetryInterval if set
+func (b *reconnectBackoff) connectRetry(config *Config) time.Duration {
+	if config.Reconnect.ConnectRetryInterval > 0 {
+		return config.Reconnect.ConnectRetryInterval
+	}
+	return b.next(config)
+}
@@ -0,0 +1,145 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/offchainlabs/nitro/broadcaster"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+func TestReconnectBackoff(t *testing.T) {
+	config := DefaultConfig
+	config.ReconnectInitialBackoff = time.Second
+	config.ReconnectMaximumBackoff = 5 * time.Second
+	config.Reconnect.BackoffMultiplier = 2
+
+	var backoff reconnectBackoff
+	for _, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		wait := backoff.next(&config)
+		if wait < expected/2 || wait > expected {
+			t.Fatalf("expected backoff between %v and %v, got %v", expected/2, expected, wait)
+		}
+	}
+
+	// The first connection is retried at a fixed interval if one is set
+	config.Reconnect.ConnectRetryInterval = 3 * time.Second
+	var connectBackoff reconnectBackoff
+	for i := 0; i < 3; i++ {
+		if wait := connectBackoff.connectRetry(&config); wait != config.Reconnect.ConnectRetryInterval {
+			t.Fatalf("expected connect retry interval %v, got %v", config.Reconnect.ConnectRetryInterval, wait)
+		}
+	}
+
+	invalid := DefaultTestConfig
+	invalid.ReconnectInitialBackoff = 0
+	if err := invalid.Validate(); err == nil {
+		t.Fatal("expected zero reconnect initial backoff to be rejected")
+	}
+	invalid = DefaultTestConfig
+	invalid.ReconnectInitialBackoff = 2 * time.Second
+	invalid.ReconnectMaximumBackoff = time.Second
+	if err := invalid.Validate(); err == nil {
+		t.Fatal("expected reconnect maximum backoff below the initial backoff to be rejected")
+	}
+}
+
+func TestReconnectBackoffAfterReadError(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	settings := wsbroadcastserver.DefaultTestBroadcasterConfig
+	feedErrChan := make(chan error, 10)
+	chainId := uint64(8742)
+	b := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &settings }, chainId, feedErrChan, nil)
+	Require(t, b.Initialize())
+	Require(t, b.Start(ctx))
+	clock := NewManualClock(time.Unix(0, 0))
+	config := DefaultTestConfig
+	config.Verify.Dangerous.AcceptMissing = true
+	config.ReconnectInitialBackoff = time.Second
+	config.ReconnectMaximumBackoff = time.Minute
+	config.Reconnect.BackoffMultiplier = 2
+	connected := make(chan struct{}, 1)
+	broadcastClient, err := NewBroadcastClientWithOptions(
+		fmt.Sprintf("ws://%s/", b.ListenerAddr()),
+		WithConfig(func() *Config { return &config }),
+		WithChainId(chainId),
+		WithClock(clock),
+		WithConnectionListener(ConnectionListenerFuncs{
+			Connect: func(string) { connected <- struct{}{} },
+		}),
+	)
+	Require(t, err)
+	broadcastClient.Start(ctx)
+	defer broadcastClient.StopAndWait()
+	select {
+	case <-connected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("client did not connect")
+	}
+
+	// The feed going away fails the read, the client waits out a single
+	// initial backoff before its first attempt to reconnect
+	b.StopAndWait()
+	start := time.Now()
+	for {
+		if state, _ := broadcastClient.State(); state == Retrying && clock.Timers() > 0 {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("client is not waiting to reconnect")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(config.ReconnectInitialBackoff)
+	for broadcastClient.GetRetryCount() == 0 {
+		if time.Since(start) > 10*time.Second {
+			t.Fatalf("client did not try to reconnect after the initial backoff of %v", config.ReconnectInitialBackoff)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBroadcastClientResetsBackoffWhenHealthy(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	config := wsbroadcastserver.DefaultTestBroadcasterConfig
+	config.Ping = 50 * time.Millisecond
+	feedErrChan := make(chan error, 10)
+	chainId := uint64(8742)
+	b := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &config }, chainId, feedErrChan, nil)
+	Require(t, b.Initialize())
+	Require(t, b.Start(ctx))
+	defer b.StopAndWait()
+
+	clientConfig := DefaultTestConfig
+	clientConfig.Verify.Dangerous.AcceptMissing = true
+	clientConfig.Reconnect.BackoffResetAfter = 500 * time.Millisecond
+	broadcastClient, err := newTestBroadcastClient(clientConfig, b.ListenerAddr(), chainId, 0, nil, feedErrChan, nil)
+	Require(t, err)
+	// As left by an earlier incident
+	atomic.StoreInt64(&broadcastClient.retryCount, 5)
+	start := time.Now()
+	broadcastClient.Start(ctx)
+	defer broadcastClient.StopAndWait()
+
+	for broadcastClient.GetRetryCount() != 0 {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("retry count not reset while the connection stayed healthy")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if elapsed := time.Since(start); elapsed < clientConfig.Reconnect.BackoffResetAfter {
+		t.Fatalf("retry count reset after %v, before the connection was healthy for %v", elapsed, clientConfig.Reconnect.BackoffResetAfter)
+	}
+}
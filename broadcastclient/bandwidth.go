@@ -0,0 +1,58 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// Time over which the rate of bytes read is compared to the bandwidth budget
+const BANDWIDTH_WINDOW = time.Minute
+
+var (
+	bytesRateMeter    = metrics.NewRegisteredMeter("arb/feed/bytes/rate", nil)
+	overBudgetCounter = metrics.NewRegisteredCounter("arb/feed/bandwidth/over-budget", nil)
+)
+
+// countBytes accounts n bytes read from the feed at now to the connection and
+// the active URL, and warns once the rate over the last BANDWIDTH_WINDOW
+// exceeds Alarms.BandwidthBudget. Only called from the reader thread.
+func (bc *BroadcastClient) countBytes(n int64, now time.Time) {
+	bytesReceivedCounter.Inc(n)
+	bytesRateMeter.Mark(n)
+	url := bc.currentURL()
+	bc.updateStatus(func(status *clientStatus) {
+		status.connectionBytes += n
+		if status.urlBytes == nil {
+			status.urlBytes = make(map[string]int64)
+		}
+		status.urlBytes[url] += n
+	})
+
+	if bc.bandwidthWindowStart.IsZero() {
+		bc.bandwidthWindowStart = now
+	}
+	bc.bandwidthWindowBytes += n
+	elapsed := now.Sub(bc.bandwidthWindowStart)
+	if elapsed < BANDWIDTH_WINDOW {
+		return
+	}
+	rate := float64(bc.bandwidthWindowBytes) / elapsed.Seconds()
+	bc.bandwidthWindowStart = now
+	bc.bandwidthWindowBytes = 0
+	budget := bc.config().Alarms.BandwidthBudget
+	if budget > 0 && rate > float64(budget) {
+		overBudgetCounter.Inc(1)
+		if !bc.overBudget {
+			log.Warn("sequencer feed bandwidth above budget", "url", url, "bytesPerSecond", int64(rate), "budget", budget)
+			bc.overBudget = true
+		}
+	} else if bc.overBudget {
+		log.Info("sequencer feed bandwidth back within budget", "url", url, "bytesPerSecond", int64(rate), "budget", budget)
+		bc.overBudget = false
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBandwidthBudget(t *testing.T) {
+	config := DefaultTestConfig
+	config.Alarms.BandwidthBudget = 1000
+	broadcastClient, err := NewBroadcastClientWithOptions("ws://relay.example.com", WithConfig(func() *Config { return &config }))
+	Require(t, err)
+	broadcastClient.publishURLs()
+
+	start := time.Now()
+	broadcastClient.countBytes(30_000, start)
+	broadcastClient.countBytes(30_000, start.Add(BANDWIDTH_WINDOW/2))
+	if broadcastClient.overBudget {
+		t.Fatal("budget checked before the window elapsed")
+	}
+	// 90kB over a minute is 1.5kB/s
+	broadcastClient.countBytes(30_000, start.Add(BANDWIDTH_WINDOW))
+	if !broadcastClient.overBudget {
+		t.Fatal("warning not raised above the bandwidth budget")
+	}
+	broadcastClient.countBytes(30_000, start.Add(2*BANDWIDTH_WINDOW))
+	if broadcastClient.overBudget {
+		t.Fatal("warning not cleared within the bandwidth budget")
+	}
+
+	status := broadcastClient.Status()
+	if status.ConnectionBytes != 120_000 {
+		t.Fatalf("expected 120000 bytes read over the connection, got %d", status.ConnectionBytes)
+	}
+	if len(status.URLs) != 1 || status.URLs[0].BytesRead != 120_000 {
+		t.Fatalf("expected 120000 bytes read from the url, got %+v", status.URLs)
+	}
+}
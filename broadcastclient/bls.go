@@ -0,0 +1,314 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	flag "github.com/spf13/pflag"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/offchainlabs/nitro/blsSignatures"
+	"github.com/offchainlabs/nitro/broadcaster"
+)
+
+// The key registry contract returns the BLS public keys allowed to sign the
+// feed, serialized with their validity proofs
+const blsKeyRegistryABI = `[{"inputs":[],"name":"feedSigningKeys","outputs":[{"internalType":"bytes[]","name":"keys","type":"bytes[]"}],"stateMutability":"view","type":"function"}]`
+
+// How often the key registry may be read again when a signature doesn't
+// verify with the keys already read, in case the keys were rotated
+const blsKeyRefreshInterval = time.Minute
+
+var (
+	blsAggregateVerifiedCounter = metrics.NewRegisteredCounter("arb/feed/bls/aggregate/verified", nil)
+	blsAggregateFailuresCounter = metrics.NewRegisteredCounter("arb/feed/bls/aggregate/failures", nil)
+	blsKeyRefreshesCounter      = metrics.NewRegisteredCounter("arb/feed/bls/key-refreshes", nil)
+)
+
+var (
+	ErrMissingBLSSignature     = errors.New("missing BLS signature")
+	ErrBLSSignatureNotVerified = errors.New("BLS signature not verified")
+
+	errNoBLSPublicKeys     = errors.New("no BLS public keys to verify feed messages with")
+	errNoBLSRegistryCaller = errors.New("no chain client to read the BLS key registry contract with")
+)
+
+// BLSConfig configures verifying feed messages by their BLS signatures instead
+// of their ECDSA ones, for sequencers signing the feed with BLS. The signatures
+// of a batch are aggregated and verified at once.
+type BLSConfig struct {
+	Enable     bool     `koanf:"enable"`
+	PublicKeys []string `koanf:"public-keys" reload:"hot"`
+	Registry   string   `koanf:"registry"`
+}
+
+func BLSConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Bool(prefix+".enable", DefaultBLSConfig.Enable, "verify feed messages by their BLS signatures instead of their ECDSA signatures, aggregating the signatures of each batch")
+	f.StringSlice(prefix+".public-keys", DefaultBLSConfig.PublicKeys, "base64 encoded BLS public keys, with validity proofs, allowed to sign feed messages, can be reloaded to rotate the sequencer signing key")
+	f.String(prefix+".registry", DefaultBLSConfig.Registry, "address of a parent chain registry contract listing further BLS public keys allowed to sign feed messages (empty = disabled)")
+}
+
+var DefaultBLSConfig = BLSConfig{
+	Enable:     false,
+	PublicKeys: []string{},
+	Registry:   "",
+}
+
+func (c *BLSConfig) Validate() error {
+	if !c.Enable {
+		return nil
+	}
+	if c.Registry != "" && !common.IsHexAddress(c.Registry) {
+		return fmt.Errorf("invalid BLS key registry contract address %q", c.Registry)
+	}
+	keys, err := parseBLSPublicKeys(c.PublicKeys)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 && c.Registry == "" {
+		return errors.New("BLS feed verification needs public keys or a key registry")
+	}
+	return nil
+}
+
+// parseBLSPublicKeys decodes base64 encoded public keys, which aren't trusted
+// without their validity proofs
+func parseBLSPublicKeys(encoded []string) ([]blsSignatures.PublicKey, error) {
+	keys := make([]blsSignatures.PublicKey, 0, len(encoded))
+	for _, value := range encoded {
+		if value == "" {
+			continue
+		}
+		keyBytes, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding BLS public key %q: %w", value, err)
+		}
+		key, err := blsSignatures.PublicKeyFromBytes(keyBytes, false)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BLS public key %q: %w", value, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+type blsKeyRegistry interface {
+	feedSigningKeys(ctx context.Context) ([][]byte, error)
+}
+
+// contractBLSKeyRegistry reads the BLS public keys from a registry contract
+type contractBLSKeyRegistry struct {
+	caller  ethereum.ContractCaller
+	address common.Address
+	abi     abi.ABI
+}
+
+func newContractBLSKeyRegistry(caller ethereum.ContractCaller, address common.Address) (*contractBLSKeyRegistry, error) {
+	parsed, err := abi.JSON(strings.NewReader(blsKeyRegistryABI))
+	if err != nil {
+		return nil, err
+	}
+	return &contractBLSKeyRegistry{
+		caller:  caller,
+		address: address,
+		abi:     parsed,
+	}, nil
+}
+
+func (r *contractBLSKeyRegistry) feedSigningKeys(ctx context.Context) ([][]byte, error) {
+	data, err := r.abi.Pack("feedSigningKeys")
+	if err != nil {
+		return nil, err
+	}
+	result, err := r.caller.CallContract(ctx, ethereum.CallMsg{To: &r.address, Data: data}, nil)
+	if err != nil {
+		return nil, err
+	}
+	outputs, err := r.abi.Unpack("feedSigningKeys", result)
+	if err != nil {
+		return nil, err
+	}
+	if len(outputs) != 1 {
+		return nil, fmt.Errorf("unexpected number of outputs from BLS key registry: %d", len(outputs))
+	}
+	keys, ok := outputs[0].([][]byte)
+	if !ok {
+		return nil, fmt.Errorf("unexpected BLS key registry keys type %T", outputs[0])
+	}
+	return keys, nil
+}
+
+// SetBLSKeyRegistryCaller sets the chain client the BLS key registry contract
+// is read with when BLS verification uses a registry, must be called before Start.
+func (bc *BroadcastClient) SetBLSKeyRegistryCaller(caller ethereum.ContractCaller) error {
+	config := bc.config().BLS
+	if !config.Enable || config.Registry == "" {
+		return nil
+	}
+	registry, err := newContractBLSKeyRegistry(caller, common.HexToAddress(config.Registry))
+	if err != nil {
+		return err
+	}
+	bc.blsRegistry = registry
+	return nil
+}
+
+// blsPublicKeys returns the configured keys and those read from the registry.
+// With refresh the registry is read again if it wasn't read recently. Returns
+// whether the registry was read.
+func (bc *BroadcastClient) blsPublicKeys(ctx context.Context, refresh bool) ([]blsSignatures.PublicKey, bool, error) {
+	config := bc.config()
+	bc.blsKeysMutex.Lock()
+	defer bc.blsKeysMutex.Unlock()
+	if config != bc.blsKeysSource {
+		keys, err := parseBLSPublicKeys(config.BLS.PublicKeys)
+		if err != nil {
+			return nil, false, err
+		}
+		bc.blsConfigKeys = keys
+		bc.blsKeysSource = config
+	}
+	read := false
+	if config.BLS.Registry != "" {
+		if bc.blsRegistry == nil {
+			if len(bc.blsConfigKeys) == 0 {
+				return nil, false, errNoBLSRegistryCaller
+			}
+		} else if bc.blsRegistryRead.IsZero() || (refresh && time.Since(bc.blsRegistryRead) >= blsKeyRefreshInterval) {
+			keys, err := bc.readBLSRegistry(ctx)
+			bc.blsRegistryRead = time.Now()
+			if err != nil {
+				log.Warn("error reading BLS key registry", "err", err)
+			} else {
+				bc.blsRegistryKeys = keys
+				read = true
+				blsKeyRefreshesCounter.Inc(1)
+			}
+		}
+	}
+	keys := append(append([]blsSignatures.PublicKey{}, bc.blsConfigKeys...), bc.blsRegistryKeys...)
+	if len(keys) == 0 {
+		return nil, read, errNoBLSPublicKeys
+	}
+	return keys, read, nil
+}
+
+// readBLSRegistry reads the keys from the registry, skipping keys without a
+// valid validity proof
+func (bc *BroadcastClient) readBLSRegistry(ctx context.Context) ([]blsSignatures.PublicKey, error) {
+	entries, err := bc.blsRegistry.feedSigningKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]blsSignatures.PublicKey, 0, len(entries))
+	for _, entry := range entries {
+		key, err := blsSignatures.PublicKeyFromBytes(entry, false)
+		if err != nil {
+			log.Warn("ignoring invalid BLS key registry entry", "err", err)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// verifyBLSSignatures verifies the BLS signatures of a batch of messages,
+// returning an error for each message. A batch is normally signed by a single
+// key, so the aggregated signature of the batch is checked against each key
+// first, and only if none verifies it are the messages checked one by one.
+func (bc *BroadcastClient) verifyBLSSignatures(ctx context.Context, messages []*broadcaster.BroadcastFeedMessage) []error {
+	errs := make([]error, len(messages))
+	keys, _, err := bc.blsPublicKeys(ctx, false)
+	if err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+	signed := make([]int, 0, len(messages))
+	hashes := make([][]byte, 0, len(messages))
+	sigs := make([]blsSignatures.Signature, 0, len(messages))
+	for i, message := range messages {
+		hash, err := message.Hash(bc.chainId)
+		if err != nil {
+			errs[i] = fmt.Errorf("error getting message hash for sequence number %v: %w", message.SequenceNumber, err)
+			continue
+		}
+		if len(message.BlsSignature) == 0 {
+			errs[i] = ErrMissingBLSSignature
+			continue
+		}
+		sig, err := blsSignatures.SignatureFromBytes(message.BlsSignature)
+		if err != nil {
+			errs[i] = fmt.Errorf("%w: %v", ErrBLSSignatureNotVerified, err)
+			continue
+		}
+		signed = append(signed, i)
+		hashes = append(hashes, hash.Bytes())
+		sigs = append(sigs, sig)
+	}
+	if len(signed) == 0 {
+		return errs
+	}
+
+	aggregate := blsSignatures.AggregateSignatures(sigs)
+	pubKeys := make([]blsSignatures.PublicKey, len(hashes))
+	for _, key := range keys {
+		for i := range pubKeys {
+			pubKeys[i] = key
+		}
+		verified, err := blsSignatures.VerifyAggregatedSignatureDifferentMessages(aggregate, hashes, pubKeys)
+		if err == nil && verified {
+			blsAggregateVerifiedCounter.Inc(1)
+			return errs
+		}
+	}
+	blsAggregateFailuresCounter.Inc(1)
+
+	// Find the messages that don't verify, the signing key may have been
+	// rotated within the batch
+	failed := make([]int, 0, len(signed))
+	for j := range signed {
+		if !verifyBLSSignature(sigs[j], hashes[j], keys) {
+			failed = append(failed, j)
+		}
+	}
+	if len(failed) > 0 {
+		if refreshed, read, err := bc.blsPublicKeys(ctx, true); err == nil && read {
+			keys = refreshed
+			remaining := failed[:0]
+			for _, j := range failed {
+				if !verifyBLSSignature(sigs[j], hashes[j], keys) {
+					remaining = append(remaining, j)
+				}
+			}
+			failed = remaining
+		}
+	}
+	for _, j := range failed {
+		errs[signed[j]] = ErrBLSSignatureNotVerified
+	}
+	return errs
+}
+
+// verifyBLSSignature returns whether sig is a signature of hash by any of keys
+func verifyBLSSignature(sig blsSignatures.Signature, hash []byte, keys []blsSignatures.PublicKey) bool {
+	for _, key := range keys {
+		if verified, err := blsSignatures.VerifySignature(sig, hash, key); err == nil && verified {
+			return true
+		}
+	}
+	return false
+}
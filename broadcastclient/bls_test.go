@@ -0,0 +1,138 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/offchainlabs/nitro/arbos/arbostypes"
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/blsSignatures"
+	"github.com/offchainlabs/nitro/broadcaster"
+)
+
+// fakeContractCaller answers calls to the BLS key registry with keys
+type fakeContractCaller struct {
+	keys  [][]byte
+	calls []ethereum.CallMsg
+}
+
+func (c *fakeContractCaller) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	return []byte{1}, nil
+}
+
+func (c *fakeContractCaller) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	c.calls = append(c.calls, call)
+	parsed, err := abi.JSON(strings.NewReader(blsKeyRegistryABI))
+	if err != nil {
+		return nil, err
+	}
+	return parsed.Methods["feedSigningKeys"].Outputs.Pack(c.keys)
+}
+
+func TestBLSKeyRegistryCaller(t *testing.T) {
+	pub, _, err := blsSignatures.GenerateKeys()
+	Require(t, err)
+
+	config := DefaultTestConfig
+	config.BLS.Enable = true
+	config.BLS.Registry = "0x0000000000000000000000000000000000000b15"
+	Require(t, config.Validate())
+	broadcastClient, err := NewBroadcastClient(func() *Config { return &config }, nil, 0, 0, nil, nil, nil, func(_ int32) {}, nil)
+	Require(t, err)
+
+	if _, _, err := broadcastClient.blsPublicKeys(context.Background(), false); err == nil {
+		t.Fatal("expected an error without a registry caller")
+	}
+
+	caller := &fakeContractCaller{keys: [][]byte{blsSignatures.PublicKeyToBytes(pub)}}
+	Require(t, broadcastClient.SetBLSKeyRegistryCaller(caller))
+	keys, read, err := broadcastClient.blsPublicKeys(context.Background(), false)
+	Require(t, err)
+	if !read || len(keys) != 1 {
+		t.Fatalf("expected the registry key to be read, got %d keys", len(keys))
+	}
+	if len(caller.calls) != 1 || *caller.calls[0].To != common.HexToAddress(config.BLS.Registry) {
+		t.Fatalf("expected one call to the registry, got %v", caller.calls)
+	}
+}
+
+type fakeBLSKeyRegistry struct {
+	keys [][]byte
+}
+
+func (r *fakeBLSKeyRegistry) feedSigningKeys(ctx context.Context) ([][]byte, error) {
+	return r.keys, nil
+}
+
+func TestBLSBatchVerification(t *testing.T) {
+	ctx := context.Background()
+	chainId := uint64(9744)
+	sequencerPub, sequencerPriv, err := blsSignatures.GenerateKeys()
+	Require(t, err)
+	rotatedPub, rotatedPriv, err := blsSignatures.GenerateKeys()
+	Require(t, err)
+
+	config := DefaultTestConfig
+	config.BLS.Enable = true
+	config.BLS.PublicKeys = []string{base64.StdEncoding.EncodeToString(blsSignatures.PublicKeyToBytes(sequencerPub))}
+	Require(t, config.Validate())
+	broadcastClient, err := NewBroadcastClient(func() *Config { return &config }, nil, chainId, 0, nil, nil, nil, func(_ int32) {}, nil)
+	Require(t, err)
+
+	signedMessage := func(seqNum arbutil.MessageIndex, priv blsSignatures.PrivateKey) *broadcaster.BroadcastFeedMessage {
+		message := &broadcaster.BroadcastFeedMessage{
+			SequenceNumber: seqNum,
+			Message:        arbostypes.TestMessageWithMetadataAndRequestId,
+		}
+		if priv == nil {
+			return message
+		}
+		hash, err := message.Hash(chainId)
+		Require(t, err)
+		sig, err := blsSignatures.SignMessage(priv, hash.Bytes())
+		Require(t, err)
+		message.BlsSignature = blsSignatures.SignatureToBytes(sig)
+		return message
+	}
+	expectErrors := func(messages []*broadcaster.BroadcastFeedMessage, expected ...error) {
+		t.Helper()
+		errs := broadcastClient.verifyBLSSignatures(ctx, messages)
+		for i, err := range errs {
+			if !errors.Is(err, expected[i]) {
+				t.Errorf("message %d: expected error %v, got %v", i, expected[i], err)
+			}
+		}
+	}
+
+	expectErrors(
+		[]*broadcaster.BroadcastFeedMessage{signedMessage(1, sequencerPriv), signedMessage(2, sequencerPriv), signedMessage(3, sequencerPriv)},
+		nil, nil, nil,
+	)
+	expectErrors(
+		[]*broadcaster.BroadcastFeedMessage{signedMessage(4, sequencerPriv), signedMessage(5, rotatedPriv), signedMessage(6, nil)},
+		nil, ErrBLSSignatureNotVerified, ErrMissingBLSSignature,
+	)
+
+	// The rotated key is allowed once it's in the registry
+	registryConfig := config
+	registryConfig.BLS.Registry = "0x0000000000000000000000000000000000000b15"
+	Require(t, registryConfig.Validate())
+	broadcastClient, err = NewBroadcastClient(func() *Config { return &registryConfig }, nil, chainId, 0, nil, nil, nil, func(_ int32) {}, nil)
+	Require(t, err)
+	broadcastClient.blsRegistry = &fakeBLSKeyRegistry{keys: [][]byte{blsSignatures.PublicKeyToBytes(rotatedPub), {0}}}
+	expectErrors(
+		[]*broadcaster.BroadcastFeedMessage{signedMessage(4, sequencerPriv), signedMessage(5, rotatedPriv), signedMessage(6, rotatedPriv)},
+		nil, nil, nil,
+	)
+}
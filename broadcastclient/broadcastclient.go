@@ -4,14 +4,17 @@
 package broadcastclient
 
 import (
+	"bufio"
 	"context"
 	"crypto/tls"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
@@ -22,11 +25,14 @@ import (
 	"github.com/gobwas/ws"
 	"github.com/gobwas/ws/wsflate"
 	flag "github.com/spf13/pflag"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/metrics"
 
 	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/blsSignatures"
 	"github.com/offchainlabs/nitro/broadcaster"
 	"github.com/offchainlabs/nitro/util/contracts"
 	"github.com/offchainlabs/nitro/util/signature"
@@ -37,6 +43,15 @@ import (
 var (
 	sourcesConnectedGauge    = metrics.NewRegisteredGauge("arb/feed/sources/connected", nil)
 	sourcesDisconnectedGauge = metrics.NewRegisteredGauge("arb/feed/sources/disconnected", nil)
+	sourcesActiveIndexGauge  = metrics.NewRegisteredGauge("arb/feed/sources/active", nil)
+	sourcesConnectsCounter   = metrics.NewRegisteredCounter("arb/feed/sources/connects", nil)
+	sourcesReconnectsCounter = metrics.NewRegisteredCounter("arb/feed/sources/reconnects", nil)
+
+	messagesReceivedCounter   = metrics.NewRegisteredCounter("arb/feed/messages/received", nil)
+	bytesReceivedCounter      = metrics.NewRegisteredCounter("arb/feed/bytes/received", nil)
+	decodeErrorsCounter       = metrics.NewRegisteredCounter("arb/feed/messages/decode-errors", nil)
+	unsupportedVersionCounter = metrics.NewRegisteredCounter("arb/feed/messages/unsupported-version", nil)
+	heartbeatsReceivedCounter = metrics.NewRegisteredCounter("arb/feed/heartbeats/received", nil)
 )
 
 type FeedConfig struct {
@@ -45,6 +60,9 @@ type FeedConfig struct {
 }
 
 func (fc *FeedConfig) Validate() error {
+	if err := fc.Input.Validate(); err != nil {
+		return err
+	}
 	return fc.Output.Validate()
 }
 
@@ -65,16 +83,118 @@ var FeedConfigDefault = FeedConfig{
 type Config struct {
 	ReconnectInitialBackoff time.Duration            `koanf:"reconnect-initial-backoff" reload:"hot"`
 	ReconnectMaximumBackoff time.Duration            `koanf:"reconnect-maximum-backoff" reload:"hot"`
+	Reconnect               ReconnectConfig          `koanf:"reconnect" reload:"hot"`
 	RequireChainId          bool                     `koanf:"require-chain-id" reload:"hot"`
 	RequireFeedVersion      bool                     `koanf:"require-feed-version" reload:"hot"`
 	Timeout                 time.Duration            `koanf:"timeout" reload:"hot"`
+	Dial                    DialConfig               `koanf:"dial" reload:"hot"`
+	KeepAlive               KeepAliveConfig          `koanf:"keepalive" reload:"hot"`
+	Stop                    StopConfig               `koanf:"stop" reload:"hot"`
+	Panic                   PanicConfig              `koanf:"panic" reload:"hot"`
+	Confirmed               ConfirmedConfig          `koanf:"confirmed" reload:"hot"`
 	URL                     []string                 `koanf:"url"`
+	Endpoints               string                   `koanf:"endpoints" reload:"hot"`
+	Discovery               DiscoveryConfig          `koanf:"discovery"`
 	Verify                  signature.VerifierConfig `koanf:"verify"`
+	AllowedSigners          []string                 `koanf:"allowed-signers" reload:"hot"`
+	BLS                     BLSConfig                `koanf:"bls"`
 	EnableCompression       bool                     `koanf:"enable-compression" reload:"hot"`
+	PreferTLS               bool                     `koanf:"prefer-tls" reload:"hot"`
+	RequireTLS              bool                     `koanf:"require-tls" reload:"hot"`
+	Failover                FailoverConfig           `koanf:"failover" reload:"hot"`
+	Quorum                  int                      `koanf:"quorum"`
+	TLS                     TLSConfig                `koanf:"tls" reload:"hot"`
+	Handshake               HandshakeConfig          `koanf:"handshake" reload:"hot"`
+	Transport               TransportConfig          `koanf:"transport" reload:"hot"`
+	Decode                  DecodeConfig             `koanf:"decode" reload:"hot"`
+	Delivery                DeliveryConfig           `koanf:"delivery" reload:"hot"`
+	Alarms                  AlarmConfig              `koanf:"alarms" reload:"hot"`
+	Sink                    SinkConfig               `koanf:"sink" reload:"hot"`
+	Filter                  FilterConfig             `koanf:"filter" reload:"hot"`
+	Health                  HealthConfig             `koanf:"health" reload:"hot"`
+	Record                  RecordConfig             `koanf:"record" reload:"hot"`
+	ReplaySpeed             float64                  `koanf:"replay-speed" reload:"hot"`
+	VerifyInbox             bool                     `koanf:"verify-inbox"`
+	CheckpointFile          string                   `koanf:"checkpoint-file"`
+	StatusAddr              string                   `koanf:"status-addr"`
+}
+
+func (c *Config) Validate() error {
+	if err := c.Handshake.Validate(); err != nil {
+		return err
+	}
+	endpoints, err := c.endpointConfigs()
+	if err != nil {
+		return err
+	}
+	for _, feedURL := range c.URL {
+		if feedURL == "" {
+			continue
+		}
+		requireTLS := c.RequireTLS
+		if endpoint, found := endpoints[feedURL]; found {
+			requireTLS = endpoint.RequireTLS
+		}
+		if err := validateFeedURL(feedURL, requireTLS, c.Transport.WebTransport); err != nil {
+			return err
+		}
+	}
+	if err := c.Discovery.Validate(); err != nil {
+		return err
+	}
+	if err := c.BLS.Validate(); err != nil {
+		return err
+	}
+	if err := c.Confirmed.Validate(); err != nil {
+		return err
+	}
+	// A reconnect without any wait would spin on a feed that's down
+	if c.ReconnectInitialBackoff <= 0 {
+		return errors.New("feed reconnect initial backoff must be positive")
+	}
+	if c.ReconnectMaximumBackoff < c.ReconnectInitialBackoff {
+		return fmt.Errorf("feed reconnect maximum backoff %v is below the initial backoff %v", c.ReconnectMaximumBackoff, c.ReconnectInitialBackoff)
+	}
+	if err := c.Reconnect.Validate(); err != nil {
+		return err
+	}
+	if err := c.Dial.Validate(); err != nil {
+		return err
+	}
+	if err := c.Delivery.Validate(); err != nil {
+		return err
+	}
+	if err := c.Alarms.Validate(); err != nil {
+		return err
+	}
+	if err := c.Panic.Validate(); err != nil {
+		return err
+	}
+	if c.ReplaySpeed < 0 {
+		return errors.New("feed replay speed must not be negative")
+	}
+	if err := c.Failover.Validate(); err != nil {
+		return err
+	}
+	if c.StatusAddr != "" {
+		if _, _, err := net.SplitHostPort(c.StatusAddr); err != nil {
+			return fmt.Errorf("invalid feed status address %q: %w", c.StatusAddr, err)
+		}
+	}
+	if err := c.Sink.Validate(); err != nil {
+		return err
+	}
+	if err := c.Filter.Validate(); err != nil {
+		return err
+	}
+	if err := c.Record.Validate(); err != nil {
+		return err
+	}
+	return c.TLS.Validate()
 }
 
 func (c *Config) Enable() bool {
-	return len(c.URL) > 0 && c.URL[0] != ""
+	return (len(c.URL) > 0 && c.URL[0] != "") || c.Discovery.Enable()
 }
 
 type ConfigFetcher func() *Config
@@ -82,34 +202,116 @@ type ConfigFetcher func() *Config
 func ConfigAddOptions(prefix string, f *flag.FlagSet) {
 	f.Duration(prefix+".reconnect-initial-backoff", DefaultConfig.ReconnectInitialBackoff, "initial duration to wait before reconnect")
 	f.Duration(prefix+".reconnect-maximum-backoff", DefaultConfig.ReconnectMaximumBackoff, "maximum duration to wait before reconnect")
+	ReconnectConfigAddOptions(prefix+".reconnect", f)
 	f.Bool(prefix+".require-chain-id", DefaultConfig.RequireChainId, "require chain id to be present on connect")
 	f.Bool(prefix+".require-feed-version", DefaultConfig.RequireFeedVersion, "require feed version to be present on connect")
-	f.Duration(prefix+".timeout", DefaultConfig.Timeout, "duration to wait before timing out connection to sequencer feed")
+	f.Duration(prefix+".timeout", DefaultConfig.Timeout, "duration to wait for data from the sequencer feed before timing out the connection")
+	DialConfigAddOptions(prefix+".dial", f)
+	KeepAliveConfigAddOptions(prefix+".keepalive", f)
+	StopConfigAddOptions(prefix+".stop", f)
+	PanicConfigAddOptions(prefix+".panic", f)
+	ConfirmedConfigAddOptions(prefix+".confirmed", f)
 	f.StringSlice(prefix+".url", DefaultConfig.URL, "URL of sequencer feed source")
+	f.String(prefix+".endpoints", DefaultConfig.Endpoints, "JSON list of per-URL overrides of the connection settings, e.g. [{\"url\":\"wss://feed\",\"timeout\":\"30s\",\"prefer-tls\":true,\"require-tls\":true,\"tls\":{\"ca-cert-file\":\"ca.pem\"},\"auth-token\":\"token\",\"priority\":1}], URLs with a lower priority are failed over to first")
+	DiscoveryConfigAddOptions(prefix+".discovery", f)
 	signature.FeedVerifierConfigAddOptions(prefix+".verify", f)
+	f.StringSlice(prefix+".allowed-signers", DefaultConfig.AllowedSigners, "additional addresses allowed to sign feed messages, can be reloaded to rotate the sequencer signing key")
+	BLSConfigAddOptions(prefix+".bls", f)
 	f.Bool(prefix+".enable-compression", DefaultConfig.EnableCompression, "enable per message deflate compression support")
+	f.Bool(prefix+".prefer-tls", DefaultConfig.PreferTLS, "connect to ws:// feed urls with wss:// first, falling back to ws:// if the feed doesn't support TLS")
+	f.Bool(prefix+".require-tls", DefaultConfig.RequireTLS, "refuse to connect to plaintext ws:// feed urls")
+	FailoverConfigAddOptions(prefix+".failover", f)
+	f.Int(prefix+".quorum", DefaultConfig.Quorum, "number of feed URLs that must deliver identical content for a sequence number before it is forwarded, with an alarm raised when feeds disagree (0 = forward from whichever feed is first)")
+	TLSConfigAddOptions(prefix+".tls", f)
+	HandshakeConfigAddOptions(prefix+".handshake", f)
+	TransportConfigAddOptions(prefix+".transport", f)
+	DecodeConfigAddOptions(prefix+".decode", f)
+	DeliveryConfigAddOptions(prefix+".delivery", f)
+	AlarmConfigAddOptions(prefix+".alarms", f)
+	SinkConfigAddOptions(prefix+".sink", f)
+	FilterConfigAddOptions(prefix+".filter", f)
+	HealthConfigAddOptions(prefix+".health", f)
+	RecordConfigAddOptions(prefix+".record", f)
+	f.Float64(prefix+".replay-speed", DefaultConfig.ReplaySpeed, "speed to replay feed recordings given as file:// urls at relative to how they were received, e.g. 10 for ten times as fast (0 = as fast as they can be read)")
+	f.Bool(prefix+".verify-inbox", DefaultConfig.VerifyInbox, "compare the messages posted to the parent chain with the messages received from the feed, and report any divergence")
+	f.String(prefix+".checkpoint-file", DefaultConfig.CheckpointFile, "file to record the highest contiguous sequence number received from the feed in, so that after a restart the feed resumes from it (empty = disabled)")
+	f.String(prefix+".status-addr", DefaultConfig.StatusAddr, "address to serve the live status of the feed clients at as JSON, and readiness probes at /health, e.g. 127.0.0.1:9643, which should not be reachable from outside (empty = disabled)")
 }
 
 var DefaultConfig = Config{
 	ReconnectInitialBackoff: time.Second * 1,
 	ReconnectMaximumBackoff: time.Second * 64,
+	Reconnect:               DefaultReconnectConfig,
 	RequireChainId:          false,
 	RequireFeedVersion:      false,
-	Verify:                  signature.DefultFeedVerifierConfig,
-	URL:                     []string{""},
 	Timeout:                 20 * time.Second,
+	Dial:                    DefaultDialConfig,
+	KeepAlive:               DefaultKeepAliveConfig,
+	Stop:                    DefaultStopConfig,
+	Panic:                   DefaultPanicConfig,
+	Confirmed:               DefaultConfirmedConfig,
+	URL:                     []string{""},
+	Endpoints:               "",
+	Discovery:               DefaultDiscoveryConfig,
+	Verify:                  signature.DefultFeedVerifierConfig,
+	BLS:                     DefaultBLSConfig,
 	EnableCompression:       true,
+	PreferTLS:               false,
+	RequireTLS:              false,
+	Failover:                DefaultFailoverConfig,
+	Quorum:                  0,
+	TLS:                     DefaultTLSConfig,
+	Handshake:               DefaultHandshakeConfig,
+	Transport:               DefaultTransportConfig,
+	Decode:                  DefaultDecodeConfig,
+	Delivery:                DefaultDeliveryConfig,
+	Alarms:                  DefaultAlarmConfig,
+	Sink:                    DefaultSinkConfig,
+	Filter:                  DefaultFilterConfig,
+	Health:                  DefaultHealthConfig,
+	Record:                  DefaultRecordConfig,
+	ReplaySpeed:             1,
+	VerifyInbox:             false,
+	CheckpointFile:          "",
+	StatusAddr:              "",
 }
 
 var DefaultTestConfig = Config{
-	ReconnectInitialBackoff: 0,
-	ReconnectMaximumBackoff: 0,
+	ReconnectInitialBackoff: 50 * time.Millisecond,
+	ReconnectMaximumBackoff: time.Second,
+	Reconnect:               DefaultTestReconnectConfig,
 	RequireChainId:          false,
 	RequireFeedVersion:      false,
-	Verify:                  signature.DefultFeedVerifierConfig,
-	URL:                     []string{""},
 	Timeout:                 200 * time.Millisecond,
+	Dial:                    DefaultTestDialConfig,
+	KeepAlive:               DefaultTestKeepAliveConfig,
+	Stop:                    DefaultTestStopConfig,
+	Panic:                   DefaultTestPanicConfig,
+	Confirmed:               DefaultConfirmedConfig,
+	URL:                     []string{""},
+	Endpoints:               "",
+	Discovery:               DefaultDiscoveryConfig,
+	Verify:                  signature.DefultFeedVerifierConfig,
+	BLS:                     DefaultBLSConfig,
 	EnableCompression:       true,
+	PreferTLS:               false,
+	RequireTLS:              false,
+	Failover:                DefaultTestFailoverConfig,
+	Quorum:                  0,
+	TLS:                     DefaultTLSConfig,
+	Handshake:               DefaultHandshakeConfig,
+	Transport:               DefaultTransportConfig,
+	Decode:                  DefaultDecodeConfig,
+	Delivery:                DefaultDeliveryConfig,
+	Alarms:                  DefaultAlarmConfig,
+	Sink:                    DefaultTestSinkConfig,
+	Filter:                  DefaultFilterConfig,
+	Health:                  DefaultHealthConfig,
+	Record:                  DefaultRecordConfig,
+	ReplaySpeed:             1,
+	VerifyInbox:             false,
+	CheckpointFile:          "",
+	StatusAddr:              "",
 }
 
 type TransactionStreamerInterface interface {
@@ -119,58 +321,220 @@ type TransactionStreamerInterface interface {
 type BroadcastClient struct {
 	stopwaiter.StopWaiter
 
-	config       ConfigFetcher
-	websocketUrl string
-	nextSeqNum   arbutil.MessageIndex
-	sigVerifier  *signature.Verifier
+	config     ConfigFetcher
+	nextSeqNum arbutil.MessageIndex
+
+	// Sequencing state, only accessed by the reader thread, or the processing
+	// thread when decoding in workers
+	delivered      bool
+	suppressReplay bool
+	latencyAlarmed bool
+	// Bytes read since the start of the current bandwidth window
+	bandwidthWindowStart time.Time
+	bandwidthWindowBytes int64
+	overBudget           bool
+	reorderBuffer        *reorderBuffer
+
+	// Set before Start
+	filter MessageFilter
+	// Rebuilt whenever the config is reloaded, accessed with the sequencing state
+	configFilter       MessageFilter
+	configFilterSource *Config
+
+	// Frames decoded by the reader waiting for the delivery thread
+	deliveryChan chan deliveryBatch
+
+	// Set in Start when decoding in workers, under statusMutex
+	decodeQueue  chan *frameJob
+	processQueue chan *frameJob
+	// Set once the feed failed the handshake, use atomic access
+	rejected int32
+	// Frames read but not yet forwarded, plus one while the feed is read, use
+	// atomic access
+	undelivered int64
+
+	// Only accessed by the delivery thread
+	checkpointSeqNum  arbutil.MessageIndex
+	checkpointWritten bool
+	// Only accessed by the delivery thread
+	pruned        bool
+	prunedThrough arbutil.MessageIndex
+	// Only accessed by the delivery thread
+	delayedChecked       bool
+	delayedCheckedSeqNum arbutil.MessageIndex
+	delayedRead          uint64
+
+	// Rebuilt whenever the config is reloaded, so the allowed signers can be rotated
+	sigVerifierMutex  sync.Mutex
+	sigVerifier       *signature.Verifier
+	sigVerifierSource *Config
+	bpVerifier        contracts.BatchPosterVerifierInterface
+
+	// BLS public keys, the configured ones are parsed again whenever the
+	// config is reloaded and the registry ones are read again when a signature
+	// doesn't verify
+	blsKeysMutex    sync.Mutex
+	blsKeysSource   *Config
+	blsConfigKeys   []blsSignatures.PublicKey
+	blsRegistryKeys []blsSignatures.PublicKey
+	blsRegistryRead time.Time
+	// Set before Start
+	blsRegistry blsKeyRegistry
+
+	// Feed URLs in priority order, only accessed by the connection threads
+	urls      []*feedURL
+	activeURL int
+
+	// Per-URL configs, rebuilt whenever the config is reloaded
+	endpointsMutex  sync.Mutex
+	endpoints       map[string]*Config
+	endpointsSource *Config
 
 	chainId uint64
 
-	// Protects conn and shuttingDown
+	// Set before Start, only read by the connection threads
+	dialerFactory DialerFactory
+	idleTimeout   time.Duration
+	clock         Clock
+
+	// Restarts of threads after panics, accessed atomically
+	panicRestarts int64
+	// Set by checkIdle when closing the connection, accessed atomically
+	idleClosed int32
+
+	// Last URLs found by discovery, only accessed by the discovery thread
+	discoveredURLs []string
+	// Set before Start
+	registry    feedRegistry
+	coordinator FeedCoordinator
+
+	// Protects conn, transport, shuttingDown, pendingURLs, returnToPrimary
+	// and stopReading
 	connMutex sync.Mutex
 	conn      net.Conn
+	// Set with conn, how the feed is read from it
+	transport   feedTransport
+	pendingURLs []string
+	// Set to reconnect to the primary URL, the first one by priority
+	returnToPrimary bool
+	// Cancels the context the connection threads read the feed with
+	stopReading context.CancelFunc
+
+	// Serializes the frames the client sends on conn
+	writeMutex sync.Mutex
+
+	// Keepalive state, pingSentAt is only accessed by the keepalive thread.
+	// lastFrameUnixNano is when any frame, data or control, was last read from
+	// the feed, use atomic access.
+	pingSentAt        time.Time
+	lastFrameUnixNano int64
+
+	// Stall detection state, use atomic access
+	receivedCount        uint64
+	lastProgressUnixNano int64
+	// Set before Start
+	chainHead ChainHeadFunc
+
+	// Broadcast time of the newest message received, use atomic access
+	newestTimestampMilli int64
+	// Only accessed by the lag thread
+	lagAlarmed bool
+	// Set before Start
+	lagAlarm LagAlarmFunc
+	frameTee FrameTee
+	recorder *recorder
+
+	// Since when the primary URL answered every probe, only accessed by the
+	// primary thread
+	primaryHealthySince time.Time
 
 	retryCount int64
 
-	retrying                        bool
-	shuttingDown                    bool
-	confirmedSequenceNumberListener chan arbutil.MessageIndex
-	txStreamer                      TransactionStreamerInterface
-	fatalErrChan                    chan error
-	adjustCount                     func(int32)
+	shuttingDown bool
+	fatalErrChan chan error
+	adjustCount  func(int32)
+	unreachable  func(error)
+
+	listenersMutex sync.Mutex
+	listeners      []ConnectionListener
+
+	handlersMutex  sync.Mutex
+	handlers       []BroadcastMessageHandler
+	pruneCallbacks []PruneFunc
+	sinks          []*streamerSink
+
+	subscribersMutex   sync.Mutex
+	subscribers        map[<-chan arbutil.MessageIndex]chan arbutil.MessageIndex
+	messageSubscribers map[chan *broadcaster.BroadcastFeedMessage]struct{}
+
+	// Non-nil while paused, closed on resume
+	pauseMutex sync.Mutex
+	resumeChan chan struct{}
+
+	errorChan  chan *FeedError
+	lastError  atomic.Pointer[FeedError]
+	connState  atomic.Pointer[connectionState]
+	errorCount int64
+	// When a message last failed to decode, use atomic access
+	lastDecodeErrorUnixNano int64
+
+	statusMutex sync.Mutex
+	status      clientStatus
+
+	// Names of the threads running, or busy for iterative ones
+	threadsMutex sync.Mutex
+	threads      map[string]int
 }
 
 var ErrIncorrectFeedServerVersion = errors.New("incorrect feed server version")
 var ErrIncorrectChainId = errors.New("incorrect chain id")
 var ErrMissingChainId = errors.New("missing chain id")
 var ErrMissingFeedServerVersion = errors.New("missing feed server version")
+var ErrFeedUnreachable = errors.New("sequencer feed unreachable")
+var ErrIncompatibleFeedMessageVersion = errors.New("incompatible feed message version")
+var errShuttingDown = errors.New("broadcast client shutting down")
 
+// feedURL holds the retry state of a single feed source
+type feedURL struct {
+	url                 string
+	consecutiveFailures int
+	lastFailure         time.Time
+	// Set once dialing the URL upgraded to TLS failed
+	tlsUnsupported bool
+}
+
+// NewBroadcastClient creates a client failing over between websocketUrls in
+// order, see NewBroadcastClientWithOptions for the optional settings
 func NewBroadcastClient(
 	config ConfigFetcher,
-	websocketUrl string,
+	websocketUrls []string,
 	chainId uint64,
 	currentMessageCount arbutil.MessageIndex,
 	txStreamer TransactionStreamerInterface,
-	confirmedSequencerNumberListener chan arbutil.MessageIndex,
 	fatalErrChan chan error,
 	bpVerifier contracts.BatchPosterVerifierInterface,
 	adjustCount func(int32),
+	unreachable func(error),
 ) (*BroadcastClient, error) {
-	sigVerifier, err := signature.NewVerifier(&config().Verify, bpVerifier)
-	if err != nil {
-		return nil, err
+	var url string
+	if len(websocketUrls) > 0 {
+		url = websocketUrls[0]
+		websocketUrls = websocketUrls[1:]
+	}
+	opts := []Option{
+		WithConfig(config),
+		WithFallbackURLs(websocketUrls...),
+		WithChainId(chainId),
+		WithMessageCount(currentMessageCount),
+		WithTransactionStreamer(txStreamer),
+		WithFatalErrChan(fatalErrChan),
+		WithBatchPosterVerifier(bpVerifier),
+		WithUnreachableHook(unreachable),
+	}
+	if adjustCount != nil {
+		opts = append(opts, WithConnectedCountHook(adjustCount))
 	}
-	return &BroadcastClient{
-		config:                          config,
-		websocketUrl:                    websocketUrl,
-		chainId:                         chainId,
-		nextSeqNum:                      currentMessageCount,
-		txStreamer:                      txStreamer,
-		confirmedSequenceNumberListener: confirmedSequencerNumberListener,
-		fatalErrChan:                    fatalErrChan,
-		sigVerifier:                     sigVerifier,
-		adjustCount:                     adjustCount,
-	}, err
+	return NewBroadcastClientWithOptions(url, opts...)
 }
 
 func (bc *BroadcastClient) Start(ctxIn context.Context) {
@@ -179,254 +543,676 @@ func (bc *BroadcastClient) Start(ctxIn context.Context) {
 		log.Info("broadcast client has already been stopped, not starting")
 		return
 	}
-	bc.LaunchThread(func(ctx context.Context) {
-		backoffDuration := bc.config().ReconnectInitialBackoff
-		for {
-			earlyFrameData, err := bc.connect(ctx, bc.nextSeqNum)
+	bc.callIteratively("keepalive", bc.keepalive)
+	bc.callIteratively("stall check", bc.checkStall)
+	if _, ok := bc.clock.(systemClock); !ok {
+		bc.callIteratively("idle check", bc.checkIdle)
+	}
+	bc.callIteratively("lag check", bc.checkLag)
+	bc.callIteratively("primary probe", bc.checkPrimary)
+	if workers := bc.config().Decode.Workers; workers > 0 {
+		bc.startDecodeWorkers(workers)
+	}
+	if bc.config().Discovery.Enable() {
+		bc.callIteratively("discovery", bc.discover)
+	}
+	bc.startDelivery()
+	// Reading stops before the other threads on shutdown, so that what was
+	// already read can still be forwarded
+	readCtx, stopReading := context.WithCancel(bc.GetContext())
+	bc.connMutex.Lock()
+	bc.stopReading = stopReading
+	bc.connMutex.Unlock()
+	bc.startReading()
+	// Kept across restarts of the thread after panics
+	readerStarted := false
+	var backoff reconnectBackoff
+	downSince := bc.clock.Now()
+	bc.launchThreadThen("connect", func(ctx context.Context) {
+		for attempts := 1; ; attempts++ {
+			if attempts > 1 {
+				sourcesReconnectsCounter.Inc(1)
+			} else {
+				bc.setState(Connecting)
+			}
+			err := bc.connect(readCtx, bc.resumeSeqNum())
+			if err != nil && bc.isShuttingDown() {
+				return
+			}
+			if err != nil {
+				bc.reportError(connectErrorCategory(err), err)
+			}
 			if errors.Is(err, ErrMissingChainId) ||
 				errors.Is(err, ErrIncorrectChainId) ||
 				errors.Is(err, ErrMissingFeedServerVersion) ||
-				errors.Is(err, ErrIncorrectFeedServerVersion) {
+				errors.Is(err, ErrIncorrectFeedServerVersion) ||
+				errors.Is(err, ErrIncompatibleFeedMessageVersion) {
 				bc.fatalErrChan <- err
 				return
 			}
 			if err == nil {
-				bc.startBackgroundReader(earlyFrameData)
+				url := bc.currentURL()
+				bc.notifyListeners(func(l ConnectionListener) { l.OnConnect(url) })
+				bc.startBackgroundReader(readCtx)
+				readerStarted = true
 				break
 			}
-			log.Warn("failed connect to sequencer broadcast, waiting and retrying", "url", bc.websocketUrl, "err", err)
-			timer := time.NewTimer(backoffDuration)
-			if backoffDuration < bc.config().ReconnectMaximumBackoff {
-				backoffDuration *= 2
+			log.Warn("failed connect to sequencer broadcast, waiting and retrying", "url", bc.currentURL(), "err", err)
+			bc.recordURLFailure()
+			if err := bc.config().checkReconnectLimits(attempts, bc.clock.Now().Sub(downSince)); err != nil {
+				bc.giveUp(err)
+				return
 			}
-			select {
-			case <-ctx.Done():
-				timer.Stop()
+			bc.setState(Retrying)
+			if !bc.sleep(readCtx, backoff.connectRetry(bc.config())) {
 				return
-			case <-timer.C:
 			}
 		}
+	}, func() {
+		if !readerStarted {
+			bc.doneReading()
+		}
 	})
 }
 
-func (bc *BroadcastClient) connect(ctx context.Context, nextSeqNum arbutil.MessageIndex) (io.Reader, error) {
-	if len(bc.websocketUrl) == 0 {
-		// Nothing to do
-		return nil, nil
+// SetURLs replaces the feed URLs without restarting the client. The current
+// connection is closed and the client reconnects to the first of the new URLs
+// straight away, the switch doesn't count as a failure of the old URL.
+func (bc *BroadcastClient) SetURLs(urls []string) {
+	bc.connMutex.Lock()
+	defer bc.connMutex.Unlock()
+	bc.pendingURLs = append([]string{}, urls...)
+	bc.closeForSwitch("feed urls changed")
+}
+
+// closeForSwitch closes the connection for the reader to reconnect to another
+// feed URL, connMutex must be held
+func (bc *BroadcastClient) closeForSwitch(reason string) {
+	if bc.conn == nil {
+		return
 	}
+	// Let the feed know the disconnect is intentional, the reader notices the
+	// closed connection and reconnects. Plain HTTP connections, gRPC streams
+	// and replays are just closed.
+	if !bc.transport.readOnly() {
+		bc.writeMutex.Lock()
+		_ = bc.conn.SetWriteDeadline(time.Now().Add(time.Second))
+		closeFrame := ws.NewCloseFrame(ws.NewCloseFrameBody(ws.StatusNormalClosure, reason))
+		if err := ws.WriteFrame(bc.conn, ws.MaskFrame(closeFrame)); err != nil {
+			log.Warn("error sending close frame to sequencer feed", "err", err)
+		}
+		bc.writeMutex.Unlock()
+	}
+	if err := bc.conn.Close(); err != nil {
+		log.Warn("error closing sequencer feed connection", "err", err)
+	}
+}
 
-	header := ws.HandshakeHeaderHTTP(http.Header{
-		wsbroadcastserver.HTTPHeaderFeedClientVersion:       []string{strconv.Itoa(wsbroadcastserver.FeedClientVersion)},
-		wsbroadcastserver.HTTPHeaderRequestedSequenceNumber: []string{strconv.FormatUint(uint64(nextSeqNum), 10)},
-	})
+func (bc *BroadcastClient) hasPendingURLs() bool {
+	bc.connMutex.Lock()
+	defer bc.connMutex.Unlock()
+	return bc.pendingURLs != nil
+}
+
+// hasPendingSwitch is whether the reader is to reconnect to other feed URLs
+// or back to the primary URL
+func (bc *BroadcastClient) hasPendingSwitch() bool {
+	bc.connMutex.Lock()
+	defer bc.connMutex.Unlock()
+	return bc.pendingURLs != nil || bc.returnToPrimary
+}
 
-	log.Info("connecting to arbitrum inbox message broadcaster", "url", bc.websocketUrl)
-	var foundChainId bool
-	var foundFeedServerVersion bool
-	var chainId uint64
-	var feedServerVersion uint64
+// applyPendingURLs switches to the URLs passed to SetURLs, if any, or back to
+// the primary URL. Only called from the connection threads.
+func (bc *BroadcastClient) applyPendingURLs() {
+	bc.connMutex.Lock()
+	pending := bc.pendingURLs
+	returnToPrimary := bc.returnToPrimary
+	bc.pendingURLs = nil
+	bc.returnToPrimary = false
+	bc.connMutex.Unlock()
+	if pending == nil {
+		if returnToPrimary {
+			bc.applyReturnToPrimary()
+		}
+		return
+	}
+	urls := make([]*feedURL, 0, len(pending))
+	for _, url := range pending {
+		urls = append(urls, &feedURL{url: url})
+	}
+	bc.config().sortByPriority(urls)
+	log.Info("switching sequencer feed urls", "from", bc.currentURL(), "to", pending)
+	bc.urls = urls
+	bc.activeURL = 0
+	sourcesActiveIndexGauge.Update(0)
+	bc.publishURLs()
+}
 
-	config := bc.config()
-	var extensions []httphead.Option
-	deflateExt := wsflate.DefaultParameters.Option()
-	if config.EnableCompression {
-		extensions = []httphead.Option{deflateExt}
+func (bc *BroadcastClient) currentURL() string {
+	if len(bc.urls) == 0 {
+		return ""
 	}
-	timeoutDialer := ws.Dialer{
-		Header: header,
-		OnHeader: func(key, value []byte) (err error) {
-			headerName := string(key)
-			headerValue := string(value)
-			if headerName == wsbroadcastserver.HTTPHeaderFeedServerVersion {
-				foundFeedServerVersion = true
-				feedServerVersion, err = strconv.ParseUint(headerValue, 0, 64)
-				if err != nil {
-					return err
-				}
-				if feedServerVersion != wsbroadcastserver.FeedServerVersion {
-					log.Error(
-						"incorrect feed server version",
-						"expectedFeedServerVersion",
-						wsbroadcastserver.FeedServerVersion,
-						"actualFeedServerVersion",
-						feedServerVersion,
-					)
-					return ErrIncorrectFeedServerVersion
-				}
-			} else if headerName == wsbroadcastserver.HTTPHeaderChainId {
-				foundChainId = true
-				chainId, err = strconv.ParseUint(headerValue, 0, 64)
-				if err != nil {
-					return err
-				}
-				if chainId != bc.chainId {
-					log.Error(
-						"incorrect chain id when connecting to server feed",
-						"expectedChainId",
-						bc.chainId,
-						"actualChainId",
-						chainId,
-					)
-					return ErrIncorrectChainId
-				}
+	return bc.urls[bc.activeURL].url
+}
+
+// recordURLSuccess clears the failure count of the active feed URL.
+func (bc *BroadcastClient) recordURLSuccess() {
+	if len(bc.urls) == 0 {
+		return
+	}
+	bc.urls[bc.activeURL].consecutiveFailures = 0
+	bc.publishURLs()
+}
+
+// recordURLFailure counts a failed connection attempt or stall against the active feed URL,
+// and fails over to the next URL in priority order once the failover threshold is reached.
+func (bc *BroadcastClient) recordURLFailure() {
+	if len(bc.urls) == 0 {
+		return
+	}
+	defer bc.publishURLs()
+	active := bc.urls[bc.activeURL]
+	active.consecutiveFailures++
+	active.lastFailure = bc.clock.Now()
+	threshold := bc.config().Failover.Threshold
+	if len(bc.urls) < 2 || threshold <= 0 || active.consecutiveFailures < threshold {
+		return
+	}
+	bc.failoverURL()
+}
+
+// feedNetDial returns the function to open the network connection to dialURL
+// with, nil for the default dialer, and the URL to send the handshake to
+func (bc *BroadcastClient) feedNetDial(config *Config, dialURL string) (NetDialFunc, string, error) {
+	var netDial NetDialFunc
+	if bc.dialerFactory != nil {
+		var err error
+		netDial, err = bc.dialerFactory(dialURL)
+		if err != nil {
+			return nil, "", fmt.Errorf("feed dialer factory failed: %w", err)
+		}
+	}
+	// The websocket handshake is the same over a unix socket, the host only
+	// fills in the Host header
+	handshakeURL := dialURL
+	if socketPath, ok := unixSocketPath(dialURL); ok {
+		handshakeURL = "ws://localhost/"
+		if netDial == nil {
+			netDial = unixNetDial(socketPath)
+		}
+	}
+	// The websocket handshake is sent over a stream of a WebTransport
+	// session instead of a TCP connection
+	if sessionURL, ok := webTransportURL(dialURL); ok {
+		u, err := url.Parse(sessionURL)
+		if err != nil {
+			return nil, "", err
+		}
+		return webTransportNetDial(config, sessionURL), "ws://" + u.Host + u.RequestURI(), nil
+	}
+	if netDial == nil {
+		proxyURL, err := config.proxyURL(dialURL)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid feed proxy: %w", err)
+		}
+		if proxyURL != nil {
+			netDial, err = proxyNetDial(proxyURL)
+			if err != nil {
+				return nil, "", err
 			}
-			return nil
-		},
-		Timeout: 10 * time.Second,
-		TLSConfig: &tls.Config{
-			MinVersion: tls.VersionTLS12,
-		},
-		Extensions: extensions,
+		} else {
+			netDial = directNetDial(config)
+		}
 	}
+	return netDial, handshakeURL, nil
+}
 
-	if bc.isShuttingDown() {
-		return nil, nil
+// feedHandshake collects what the feed announced in the headers of its
+// handshake response
+type feedHandshake struct {
+	expectedChainId        uint64
+	foundChainId           bool
+	foundFeedServerVersion bool
+	chainId                uint64
+	feedServerVersion      uint64
+	serverMessageVersions  []int
+}
+
+func newFeedHandshake(expectedChainId uint64) *feedHandshake {
+	return &feedHandshake{
+		expectedChainId: expectedChainId,
+		// Servers that don't advertise their message versions only send version 1
+		serverMessageVersions: []int{1},
 	}
+}
 
-	conn, br, _, err := timeoutDialer.Dial(ctx, bc.websocketUrl)
-	if errors.Is(err, ErrIncorrectFeedServerVersion) || errors.Is(err, ErrIncorrectChainId) {
-		return nil, err
+func (h *feedHandshake) onHeader(key, value []byte) (err error) {
+	headerName := string(key)
+	headerValue := string(value)
+	if headerName == wsbroadcastserver.HTTPHeaderFeedServerVersion {
+		h.foundFeedServerVersion = true
+		h.feedServerVersion, err = strconv.ParseUint(headerValue, 0, 64)
+		if err != nil {
+			return err
+		}
+		if h.feedServerVersion != wsbroadcastserver.FeedServerVersion {
+			log.Error(
+				"incorrect feed server version",
+				"expectedFeedServerVersion",
+				wsbroadcastserver.FeedServerVersion,
+				"actualFeedServerVersion",
+				h.feedServerVersion,
+			)
+			return ErrIncorrectFeedServerVersion
+		}
+	} else if headerName == wsbroadcastserver.HTTPHeaderFeedMessageVersions {
+		h.serverMessageVersions, err = wsbroadcastserver.ParseFeedMessageVersions(headerValue)
+		if err != nil {
+			return err
+		}
+	} else if headerName == wsbroadcastserver.HTTPHeaderChainId {
+		h.foundChainId = true
+		h.chainId, err = strconv.ParseUint(headerValue, 0, 64)
+		if err != nil {
+			return err
+		}
+		if h.chainId != h.expectedChainId {
+			log.Error(
+				"incorrect chain id when connecting to server feed",
+				"expectedChainId",
+				h.expectedChainId,
+				"actualChainId",
+				h.chainId,
+			)
+			return ErrIncorrectChainId
+		}
+	}
+	return nil
+}
+
+// headerMismatch is whether the feed announced another chain id or feed
+// server version, which no other way of reaching it changes
+func headerMismatch(err error) bool {
+	return errors.Is(err, ErrIncorrectFeedServerVersion) || errors.Is(err, ErrIncorrectChainId)
+}
+
+// connect connects to the active feed URL and sets the connection the feed is
+// read from. A feed dialed over TLS because of PreferTLS is dialed again in
+// plaintext if that fails.
+func (bc *BroadcastClient) connect(ctx context.Context, nextSeqNum arbutil.MessageIndex) error {
+	bc.applyPendingURLs()
+	url := bc.currentURL()
+	bc.updateStatus(func(status *clientStatus) { status.url = url })
+	config := bc.urlConfig(bc.config(), url)
+	if len(url) == 0 {
+		if config.Discovery.Enable() {
+			return errNoDiscoveredURLs
+		}
+		// Nothing to do
+		return nil
+	}
+	// Discovered URLs and those passed to SetURLs haven't been validated yet
+	if err := validateFeedURL(url, config.RequireTLS, config.Transport.WebTransport); err != nil {
+		return err
+	}
+	if path, ok := replayPath(url); ok {
+		return bc.connectReplay(config, path)
+	}
+
+	httpHeader, err := config.handshakeHeader(nextSeqNum)
+	if err != nil {
+		return err
+	}
+	tlsConfig, err := config.TLS.tlsConfig()
+	if err != nil {
+		return err
+	}
+	var conn net.Conn
+	var transport feedTransport
+	var handshake *feedHandshake
+	for {
+		dialURL, upgradedTLS := bc.dialURL(config)
+		handshake = newFeedHandshake(bc.chainId)
+		conn, transport, err = bc.dialFeed(ctx, config, dialURL, nextSeqNum, httpHeader, tlsConfig, handshake)
+		if err == nil || !upgradedTLS || ctx.Err() != nil || headerMismatch(err) || errors.Is(err, errShuttingDown) {
+			break
+		}
+		bc.tlsUpgradeFailed(dialURL, err)
+	}
+	if headerMismatch(err) || errors.Is(err, errShuttingDown) {
+		return err
 	}
 	if err != nil {
-		return nil, fmt.Errorf("broadcast client unable to connect: %w", err)
+		return fmt.Errorf("broadcast client unable to connect: %w", err)
 	}
-	if config.RequireChainId && !foundChainId {
+	messageVersion, ok := wsbroadcastserver.NegotiateFeedMessageVersion(wsbroadcastserver.SupportedFeedMessageVersions, handshake.serverMessageVersions)
+	if !ok {
+		log.Error(
+			"feed server sends no supported message version",
+			"supportedMessageVersions", wsbroadcastserver.SupportedFeedMessageVersions,
+			"serverMessageVersions", handshake.serverMessageVersions,
+		)
 		err := conn.Close()
 		if err != nil {
-			return nil, fmt.Errorf("error closing connection when missing chain id: %w", err)
+			return fmt.Errorf("error closing connection with incompatible feed message version: %w", err)
 		}
-		return nil, ErrMissingChainId
+		return ErrIncompatibleFeedMessageVersion
 	}
-	if config.RequireFeedVersion && !foundFeedServerVersion {
+	if config.RequireChainId && !handshake.foundChainId {
 		err := conn.Close()
 		if err != nil {
-			return nil, fmt.Errorf("error closing connection when missing feed server version: %w", err)
+			return fmt.Errorf("error closing connection when missing chain id: %w", err)
 		}
-		return nil, ErrMissingFeedServerVersion
+		return ErrMissingChainId
 	}
-
-	var earlyFrameData io.Reader
-	if br != nil {
-		// Depending on how long the client takes to read the response, there may be
-		// data after the WebSocket upgrade response in a single read from the socket,
-		// ie WebSocket frames sent by the server. If this happens, Dial returns
-		// a non-nil bufio.Reader so that data isn't lost. But beware, this buffered
-		// reader is still hooked up to the socket; trying to read past what had already
-		// been buffered will do a blocking read on the socket, so we have to wrap it
-		// in a LimitedReader.
-		earlyFrameData = io.LimitReader(br, int64(br.Buffered()))
+	if config.RequireFeedVersion && !handshake.foundFeedServerVersion {
+		err := conn.Close()
+		if err != nil {
+			return fmt.Errorf("error closing connection when missing feed server version: %w", err)
+		}
+		return ErrMissingFeedServerVersion
 	}
 
 	bc.connMutex.Lock()
+	if bc.shuttingDown {
+		bc.connMutex.Unlock()
+		_ = conn.Close()
+		return errShuttingDown
+	}
 	bc.conn = conn
+	bc.transport = transport
 	bc.connMutex.Unlock()
-	log.Info("Feed connected", "feedServerVersion", feedServerVersion, "chainId", chainId, "requestedSeqNum", nextSeqNum)
+	now := bc.clock.Now().UnixNano()
+	atomic.StoreInt64(&bc.lastProgressUnixNano, now)
+	atomic.StoreInt64(&bc.lastFrameUnixNano, now)
+	bc.updateStatus(func(status *clientStatus) {
+		status.connectedSince = bc.clock.Now()
+		status.connectionBytes = 0
+	})
+	bc.setState(Connected)
+	sourcesConnectsCounter.Inc(1)
+	log.Info("Feed connected", "feedServerVersion", handshake.feedServerVersion, "messageVersion", messageVersion, "chainId", handshake.chainId, "requestedSeqNum", nextSeqNum, "transport", transport.name())
+	return nil
+}
+
+// dialFeed dials the feed at dialURL over websocket, falling back to
+// server-sent events or long polling if enabled and the upgrade is refused,
+// or subscribes to it over gRPC for grpc:// and grpcs:// URLs. Websocket is
+// spoken over WebTransport for https:// and quic:// URLs.
+// The response headers are checked with handshake. Returns the connection and
+// the transport to read the feed from it with.
+func (bc *BroadcastClient) dialFeed(
+	ctx context.Context,
+	config *Config,
+	dialURL string,
+	nextSeqNum arbutil.MessageIndex,
+	httpHeader http.Header,
+	tlsConfig *tls.Config,
+	handshake *feedHandshake,
+) (net.Conn, feedTransport, error) {
+	log.Info("connecting to arbitrum inbox message broadcaster", "url", dialURL)
+	if grpcFeedURL(dialURL) {
+		return bc.dialGRPC(ctx, config, dialURL, httpHeader, tlsConfig, handshake)
+	}
+	var extensions []httphead.Option
+	if config.EnableCompression {
+		extensions = []httphead.Option{wsflate.DefaultParameters.Option()}
+	}
+	var protocols []string
+	if config.Transport.Binary {
+		protocols = []string{wsbroadcastserver.BinaryFeedSubprotocol}
+	}
+	netDial, handshakeURL, err := bc.feedNetDial(config, dialURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	timeoutDialer := ws.Dialer{
+		Header:     ws.HandshakeHeaderHTTP(httpHeader),
+		OnHeader:   handshake.onHeader,
+		Timeout:    config.Dial.Timeout,
+		TLSConfig:  tlsConfig,
+		NetDial:    netDial,
+		Protocols:  protocols,
+		Extensions: extensions,
+	}
+
+	if bc.isShuttingDown() {
+		return nil, nil, errShuttingDown
+	}
 
-	return earlyFrameData, nil
+	// The dialer's timeout only covers opening the connection, the handshakes
+	// are bounded by the context
+	dialCtx, cancelDial := context.WithTimeout(ctx, config.Dial.Timeout+config.Dial.HandshakeTimeout)
+	defer cancelDial()
+	conn, br, _, err := timeoutDialer.Dial(dialCtx, resumeURL(handshakeURL, nextSeqNum))
+	if err == nil {
+		if _, ok := webTransportURL(dialURL); ok {
+			return conn, &webTransportTransport{newWSTransport(br)}, nil
+		}
+		return conn, newWSTransport(br), nil
+	}
+	if !upgradeRefused(err) || ctx.Err() != nil {
+		return nil, nil, err
+	}
+	if config.Transport.EventStreamFallback {
+		log.Warn("sequencer feed refused websocket upgrade, falling back to event stream", "url", dialURL, "err", err)
+		eventStreamFallbacksCounter.Inc(1)
+		var body *bufio.Reader
+		conn, body, err = dialEventStream(dialCtx, config, resumeURL(handshakeURL, nextSeqNum), netDial, tlsConfig, httpHeader, handshake.onHeader)
+		if err == nil {
+			return conn, &eventStreamTransport{body: body}, nil
+		}
+	}
+	if config.Transport.LongPollFallback && !headerMismatch(err) && ctx.Err() == nil {
+		log.Warn("sequencer feed refused websocket upgrade, falling back to long polling", "url", dialURL, "err", err)
+		longPollFallbacksCounter.Inc(1)
+		poll := &longPoll{
+			client:    bc,
+			feedURL:   handshakeURL,
+			netDial:   netDial,
+			tlsConfig: tlsConfig,
+			header:    httpHeader,
+			onHeader:  handshake.onHeader,
+		}
+		// Polls may wait for new messages longer than the handshake timeout
+		conn, err = bc.poll(ctx, config, poll)
+		if err == nil {
+			return conn, poll, nil
+		}
+	}
+	return nil, nil, err
 }
 
-func (bc *BroadcastClient) startBackgroundReader(earlyFrameData io.Reader) {
-	bc.LaunchThread(func(ctx context.Context) {
-		connected := false
-		sourcesDisconnectedGauge.Inc(1)
-		backoffDuration := bc.config().ReconnectInitialBackoff
-		flateReader := wsbroadcastserver.NewFlateReader()
+// startBackgroundReader launches the thread reading the feed until readCtx is
+// cancelled, frames already read are handed off with the thread's context
+func (bc *BroadcastClient) startBackgroundReader(readCtx context.Context) {
+	// Kept across restarts of the thread after panics
+	connected := false
+	sourcesDisconnectedGauge.Inc(1)
+	// The backoff carries over reconnects until a connection stays up
+	// for Reconnect.BackoffResetAfter
+	var backoff reconnectBackoff
+	connectedAt := bc.clock.Now()
+	healthy := false
+	// Replays of delivered messages are dropped after every connect
+	afterConnect := true
+	bc.launchThreadThen("reader", func(ctx context.Context) {
 		for {
 			select {
-			case <-ctx.Done():
+			case <-readCtx.Done():
 				return
 			default:
 			}
+			if !bc.waitWhilePaused(readCtx) {
+				return
+			}
 
-			var msg []byte
-			var op ws.OpCode
-			var err error
-			config := bc.config()
-			msg, op, err = wsbroadcastserver.ReadData(ctx, bc.conn, earlyFrameData, config.Timeout, ws.StateClientSide, config.EnableCompression, flateReader)
+			var frame feedFrame
+			config := bc.urlConfig(bc.config(), bc.currentURL())
+			consume := func(op ws.OpCode, data io.Reader) error {
+				// Decode workers decode the frame instead, and the tee needs
+				// the frame as read
+				stream := config.Decode.Stream && bc.decodeQueue == nil && !bc.teeing()
+				return frame.read(op, data, stream, int64(config.Decode.MaxFrameSize))
+			}
+			transport := bc.currentTransport()
+			if transport == nil {
+				// No feed URL to read from
+				return
+			}
+			op, resent, err := transport.readFrame(readCtx, bc.currentConn(), config, bc.readTimeout(config), consume)
+			if resent {
+				// Each poll may resend messages already received
+				afterConnect = true
+			}
+			if atomic.LoadInt32(&bc.rejected) != 0 {
+				frame.release()
+				return
+			}
 			if err != nil {
+				frame.release()
 				if bc.isShuttingDown() {
 					return
 				}
-				if strings.Contains(err.Error(), "i/o timeout") {
-					log.Error("Server connection timed out without receiving data", "url", bc.websocketUrl, "err", err)
+				err = readError(err, atomic.SwapInt32(&bc.idleClosed, 0) != 0)
+				switchingURLs := bc.hasPendingSwitch()
+				action, closed, isClose := closeFrameAction(err)
+				if switchingURLs {
+					log.Info("reconnecting to switch sequencer feed url", "url", bc.currentURL())
+				} else if isClose {
+					closeFramesCounter.Inc(1)
+					log.Warn("sequencer feed closed the connection", "url", bc.currentURL(), "code", int(closed.Code), "reason", closed.Reason, "action", action)
+				} else if errors.Is(err, ErrFrameTooLarge) {
+					oversizedFramesCounter.Inc(1)
+					log.Error("sequencer feed sent a frame above the maximum size, reconnecting", "url", bc.currentURL(), "maxFrameSize", config.Decode.MaxFrameSize, "err", err)
+				} else if errors.Is(err, ErrIdleTimeout) {
+					log.Error("Server connection timed out without receiving data", "url", bc.currentURL(), "err", err)
 				} else if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
-					log.Warn("readData returned EOF", "url", bc.websocketUrl, "opcode", int(op), "err", err)
+					log.Warn("readData returned EOF", "url", bc.currentURL(), "opcode", int(op), "err", err)
 				} else {
-					log.Error("error calling readData", "url", bc.websocketUrl, "opcode", int(op), "err", err)
+					log.Error("error calling readData", "url", bc.currentURL(), "opcode", int(op), "err", err)
+				}
+				url := bc.currentURL()
+				if !switchingURLs {
+					bc.reportError(ConnectionError, err)
+					if action == closeFailover {
+						bc.failoverURL()
+						bc.publishURLs()
+					} else {
+						bc.recordURLFailure()
+					}
 				}
+				bc.notifyListeners(func(l ConnectionListener) { l.OnDisconnect(url, err) })
+				bc.updateStatus(func(status *clientStatus) { status.connectedSince = time.Time{} })
+				bc.setState(Disconnected)
 				if connected {
 					connected = false
 					bc.adjustCount(-1)
 					sourcesConnectedGauge.Dec(1)
 					sourcesDisconnectedGauge.Inc(1)
 				}
+				bc.connMutex.Lock()
+				if bc.shuttingDown {
+					// Closed by StopAndWait already
+					bc.connMutex.Unlock()
+					return
+				}
 				_ = bc.conn.Close()
-				timer := time.NewTimer(backoffDuration)
-				if backoffDuration < bc.config().ReconnectMaximumBackoff {
-					backoffDuration *= 2
+				bc.connMutex.Unlock()
+				if action == closeTerminal && !switchingURLs {
+					bc.giveUp(fmt.Errorf("%w: %v", ErrFeedRejected, err))
+					return
 				}
-				select {
-				case <-ctx.Done():
-					timer.Stop()
+				downSince := bc.clock.Now()
+				if switchingURLs || action == closeFailover {
+					bc.setState(Connecting)
+					err = bc.connect(readCtx, bc.resumeSeqNum())
+					if bc.isShuttingDown() {
+						return
+					}
+					if err == nil {
+						afterConnect = true
+						connectedAt = bc.clock.Now()
+						healthy = false
+						newURL := bc.currentURL()
+						bc.notifyListeners(func(l ConnectionListener) { l.OnConnect(newURL) })
+						continue
+					}
+					log.Warn("failed connect to new sequencer feed url, waiting and retrying", "url", bc.currentURL(), "err", err)
+					bc.reportError(connectErrorCategory(err), err)
+					bc.recordURLFailure()
+				}
+				// retryConnect waits out the backoff before each attempt
+				err = bc.retryConnect(readCtx, downSince, &backoff)
+				if err != nil {
+					if errors.Is(err, ErrFeedUnreachable) {
+						bc.giveUp(err)
+					}
 					return
-				case <-timer.C:
 				}
-				earlyFrameData = bc.retryConnect(ctx)
+				afterConnect = true
+				connectedAt = bc.clock.Now()
+				healthy = false
 				continue
 			}
-			backoffDuration = bc.config().ReconnectInitialBackoff
-
-			if msg != nil {
-				res := broadcaster.BroadcastMessage{}
-				err = json.Unmarshal(msg, &res)
-				if err != nil {
-					log.Error("error unmarshalling message", "msg", msg, "err", err)
-					continue
+			if !healthy && bc.clock.Now().Sub(connectedAt) >= bc.config().Reconnect.BackoffResetAfter {
+				healthy = true
+				backoff = reconnectBackoff{}
+				if atomic.SwapInt64(&bc.retryCount, 0) != 0 {
+					log.Debug("sequencer feed connection healthy, resetting reconnect backoff", "url", bc.currentURL())
 				}
+			}
+			if !frame.received && !op.IsControl() {
+				continue
+			}
 
-				if !connected {
-					connected = true
-					sourcesDisconnectedGauge.Dec(1)
-					sourcesConnectedGauge.Inc(1)
-					bc.adjustCount(1)
-				}
-				if len(res.Messages) > 0 {
-					log.Debug("received batch item", "count", len(res.Messages), "first seq", res.Messages[0].SequenceNumber)
-				} else if res.ConfirmedSequenceNumberMessage != nil {
-					log.Debug("confirmed sequence number", "seq", res.ConfirmedSequenceNumberMessage.SequenceNumber)
-				} else {
-					log.Debug("received broadcast with no messages populated", "length", len(msg))
+			// Any frame, including pings and pongs, shows the feed is alive
+			atomic.StoreInt64(&bc.lastFrameUnixNano, bc.clock.Now().UnixNano())
+			bc.recordURLSuccess()
+			if !connected {
+				connected = true
+				sourcesDisconnectedGauge.Dec(1)
+				sourcesConnectedGauge.Inc(1)
+				bc.adjustCount(1)
+			}
+			switch op {
+			case ws.OpPing:
+				heartbeatsReceivedCounter.Inc(1)
+				log.Trace("received ping from sequencer feed", "url", bc.currentURL())
+			case ws.OpPong:
+				log.Trace("received pong from sequencer feed", "url", bc.currentURL())
+			}
+
+			if frame.received {
+				bc.frameRead()
+				bc.countBytes(frame.size, bc.clock.Now())
+				url := bc.currentURL()
+				recording := bc.teeFrame(url, op == ws.OpBinary, &frame)
+				batchCtx, batchSpan := tracer.Start(ctx, "feed.batch", trace.WithTimestamp(frame.start), trace.WithAttributes(
+					attribute.String("feed.url", url),
+					attribute.Int64("feed.bytes", frame.size),
+				))
+				job := &frameJob{
+					ctx:          batchCtx,
+					span:         batchSpan,
+					op:           op,
+					frame:        frame,
+					url:          url,
+					afterConnect: afterConnect,
+					recording:    recording,
 				}
-				if res.Version == 1 {
-					if len(res.Messages) > 0 {
-						for _, message := range res.Messages {
-							if message == nil {
-								log.Warn("ignoring nil feed message")
-								continue
-							}
-
-							err := bc.isValidSignature(ctx, message)
-							if err != nil {
-								log.Error("error validating feed signature", "error", err, "sequence number", message.SequenceNumber)
-								bc.fatalErrChan <- fmt.Errorf("error validating feed signature %v: %w", message.SequenceNumber, err)
-								continue
-							}
-
-							bc.nextSeqNum = message.SequenceNumber + 1
-						}
-						if err := bc.txStreamer.AddBroadcastMessages(res.Messages); err != nil {
-							log.Error("Error adding message from Sequencer Feed", "err", err)
-						}
-					}
-					if res.ConfirmedSequenceNumberMessage != nil && bc.confirmedSequenceNumberListener != nil {
-						bc.confirmedSequenceNumberListener <- res.ConfirmedSequenceNumberMessage.SequenceNumber
-					}
+				afterConnect = false
+				if !bc.handleFrame(ctx, job) {
+					return
 				}
 			}
 		}
-	})
+	}, bc.doneReading)
 }
 
+// GetRetryCount returns the number of reconnect attempts since a connection
+// last stayed up for Reconnect.BackoffResetAfter
 func (bc *BroadcastClient) GetRetryCount() int64 {
 	return atomic.LoadInt64(&bc.retryCount)
 }
@@ -437,50 +1223,258 @@ func (bc *BroadcastClient) isShuttingDown() bool {
 	return bc.shuttingDown
 }
 
-func (bc *BroadcastClient) retryConnect(ctx context.Context) io.Reader {
-	maxWaitDuration := 15 * time.Second
-	waitDuration := 500 * time.Millisecond
-	bc.retrying = true
+// retryConnect reconnects to the feed, continuing the backoff schedule of the
+// reader
+func (bc *BroadcastClient) retryConnect(ctx context.Context, downSince time.Time, backoff *reconnectBackoff) error {
+	bc.setState(Retrying)
 
-	for !bc.isShuttingDown() {
-		timer := time.NewTimer(waitDuration)
-		select {
-		case <-ctx.Done():
-			timer.Stop()
-			return nil
-		case <-timer.C:
+	for attempts := 1; !bc.isShuttingDown(); attempts++ {
+		if !bc.sleep(ctx, backoff.next(bc.config())) {
+			return ctx.Err()
 		}
 
 		atomic.AddInt64(&bc.retryCount, 1)
-		earlyFrameData, err := bc.connect(ctx, bc.nextSeqNum)
+		sourcesReconnectsCounter.Inc(1)
+		err := bc.connect(ctx, bc.resumeSeqNum())
+		if bc.isShuttingDown() {
+			break
+		}
 		if err == nil {
-			bc.retrying = false
-			return earlyFrameData
+			url := bc.currentURL()
+			bc.notifyListeners(func(l ConnectionListener) {
+				l.OnConnect(url)
+				l.OnReconnect(url, attempts)
+			})
+			return nil
+		}
+		bc.reportError(connectErrorCategory(err), err)
+		bc.recordURLFailure()
+		if err := bc.config().checkReconnectLimits(attempts, bc.clock.Now().Sub(downSince)); err != nil {
+			return err
+		}
+	}
+	return errShuttingDown
+}
+
+// verifyHello checks the chain id announced in the feed server's hello
+// message. This catches connecting to the wrong chain's feed even when a proxy
+// stripped the chain id handshake header. Servers that predate the hello
+// message are only checked through the handshake header.
+func (bc *BroadcastClient) verifyHello(url string, hello *broadcaster.HelloMessage) error {
+	if hello == nil {
+		return nil
+	}
+	if hello.ChainId != bc.chainId {
+		return fmt.Errorf("%w: feed %s is for chain %d, expected chain %d", ErrIncorrectChainId, url, hello.ChainId, bc.chainId)
+	}
+	return nil
+}
+
+// resumeURL adds the sequence number to resume from to the feed URL, besides
+// the handshake header, for proxies in front of the feed that strip unknown
+// headers. Without it the feed replays its whole cache on every reconnect.
+func resumeURL(feedURL string, nextSeqNum arbutil.MessageIndex) string {
+	u, err := url.Parse(feedURL)
+	if err != nil {
+		return feedURL
+	}
+	query := u.Query()
+	query.Set(wsbroadcastserver.RequestedSequenceNumberQueryParameter, strconv.FormatUint(uint64(nextSeqNum), 10))
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// HandshakeConfig sets the HTTP headers sent when connecting to the feed
+type HandshakeConfig struct {
+	AuthToken     string   `koanf:"auth-token" reload:"hot"`
+	AuthTokenFile string   `koanf:"auth-token-file" reload:"hot"`
+	ClientId      string   `koanf:"client-id" reload:"hot"`
+	ExtraHeaders  []string `koanf:"extra-headers" reload:"hot"`
+}
+
+func HandshakeConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.String(prefix+".auth-token", DefaultHandshakeConfig.AuthToken, "bearer token to send in the Authorization header when connecting to the feed")
+	f.String(prefix+".auth-token-file", DefaultHandshakeConfig.AuthTokenFile, "file to read the bearer token from, re-read on every reconnect (overrides auth-token)")
+	f.String(prefix+".client-id", DefaultHandshakeConfig.ClientId, "identifier sent to the feed server, e.g. the node name and version, so relay operators can tell which nodes are lagging or misbehaving (empty = not sent)")
+	f.StringSlice(prefix+".extra-headers", DefaultHandshakeConfig.ExtraHeaders, "additional HTTP headers to send when connecting to the feed, e.g. for relays fronted by a CDN or API gateway, in \"Name: value\" form")
+}
+
+var DefaultHandshakeConfig = HandshakeConfig{
+	AuthToken:     "",
+	AuthTokenFile: "",
+	ClientId:      "",
+	ExtraHeaders:  []string{},
+}
+
+func (c *HandshakeConfig) Validate() error {
+	_, err := parseExtraHeaders(c.ExtraHeaders)
+	return err
+}
+
+// handshakeHeader returns the HTTP headers for the websocket upgrade request.
+// The auth token file is read on every call so the token can be rotated
+// without restarting the node.
+func (c *Config) handshakeHeader(nextSeqNum arbutil.MessageIndex) (http.Header, error) {
+	header, err := parseExtraHeaders(c.Handshake.ExtraHeaders)
+	if err != nil {
+		return nil, err
+	}
+	token := c.Handshake.AuthToken
+	if c.Handshake.AuthTokenFile != "" {
+		contents, err := os.ReadFile(c.Handshake.AuthTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read feed auth token file: %w", err)
 		}
+		token = strings.TrimSpace(string(contents))
+	}
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	header.Set(wsbroadcastserver.HTTPHeaderFeedClientVersion, strconv.Itoa(wsbroadcastserver.FeedClientVersion))
+	header.Set(wsbroadcastserver.HTTPHeaderFeedMessageVersions, wsbroadcastserver.FormatFeedMessageVersions(wsbroadcastserver.SupportedFeedMessageVersions))
+	header.Set(wsbroadcastserver.HTTPHeaderRequestedSequenceNumber, strconv.FormatUint(uint64(nextSeqNum), 10))
+	if c.Handshake.ClientId != "" {
+		header.Set(wsbroadcastserver.HTTPHeaderFeedClientId, c.Handshake.ClientId)
+	}
+	if c.Transport.BulkCatchup {
+		header.Set(wsbroadcastserver.HTTPHeaderFeedBulkCatchup, wsbroadcastserver.BulkCatchupGzip)
+	}
+	return header, nil
+}
+
+// reservedHeaders are set by the client for the handshake itself, configuring
+// them as extra headers would break it
+var reservedHeaders = map[string]bool{
+	"Host":                     true,
+	"Upgrade":                  true,
+	"Connection":               true,
+	"Sec-Websocket-Key":        true,
+	"Sec-Websocket-Version":    true,
+	"Sec-Websocket-Protocol":   true,
+	"Sec-Websocket-Extensions": true,
+	wsbroadcastserver.HTTPHeaderFeedClientVersion:       true,
+	wsbroadcastserver.HTTPHeaderFeedMessageVersions:     true,
+	wsbroadcastserver.HTTPHeaderRequestedSequenceNumber: true,
+	wsbroadcastserver.HTTPHeaderFeedClientId:            true,
+	wsbroadcastserver.HTTPHeaderFeedBulkCatchup:         true,
+}
 
-		if waitDuration < maxWaitDuration {
-			waitDuration += 500 * time.Millisecond
+// parseExtraHeaders parses headers configured in "Name: value" form. A name
+// may be repeated to send several values.
+func parseExtraHeaders(extraHeaders []string) (http.Header, error) {
+	header := http.Header{}
+	for _, extraHeader := range extraHeaders {
+		name, value, found := strings.Cut(extraHeader, ":")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			return nil, fmt.Errorf("invalid feed extra header %q, expected \"Name: value\"", extraHeader)
+		}
+		if strings.ContainsAny(name, " \t\r\n") || strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("invalid feed extra header %q, names can't contain whitespace and values can't contain line breaks", extraHeader)
+		}
+		name = textproto.CanonicalMIMEHeaderKey(name)
+		if reservedHeaders[name] {
+			return nil, fmt.Errorf("feed extra header %s is set by the client itself", name)
+		}
+		header.Add(name, strings.TrimSpace(value))
+	}
+	return header, nil
+}
+
+// checkReconnectLimits returns ErrFeedUnreachable once either the reconnect
+// attempt limit or the downtime limit has been exceeded.
+func (c *Config) checkReconnectLimits(attempts int, downtime time.Duration) error {
+	if c.Reconnect.MaxAttempts > 0 && attempts >= c.Reconnect.MaxAttempts {
+		return fmt.Errorf("%w: failed %d reconnect attempts", ErrFeedUnreachable, attempts)
+	}
+	if c.Reconnect.MaxDowntime > 0 {
+		if downtime >= c.Reconnect.MaxDowntime {
+			return fmt.Errorf("%w: disconnected for %v", ErrFeedUnreachable, downtime)
 		}
 	}
 	return nil
 }
 
+// giveUp stops reconnecting and reports the terminal error, leaving it to the
+// owner of the client to decide whether to fall back to the parent chain or alert.
+func (bc *BroadcastClient) giveUp(err error) {
+	log.Error("giving up on sequencer feed", "url", bc.currentURL(), "err", err)
+	bc.setState(Unreachable)
+	if bc.unreachable != nil {
+		bc.unreachable(err)
+	}
+}
+
+// StopAndWait stops reading the feed, waits up to Stop.DrainTimeout for the
+// messages already read to be forwarded, then stops the client, waiting up to
+// Stop.Timeout for its threads to exit
 func (bc *BroadcastClient) StopAndWait() {
 	log.Debug("closing broadcaster client connection")
-	bc.StopWaiter.StopAndWait()
 	bc.connMutex.Lock()
-	defer bc.connMutex.Unlock()
-
 	if !bc.shuttingDown {
 		bc.shuttingDown = true
+		bc.setState(Stopped)
 		if bc.conn != nil {
 			_ = bc.conn.Close()
 		}
 	}
+	stopReading := bc.stopReading
+	bc.connMutex.Unlock()
+	if stopReading != nil {
+		stopReading()
+	}
+	bc.drain()
+	bc.stopThreads()
+	bc.closeSubscriptions()
+	if bc.recorder != nil {
+		bc.recorder.close()
+	}
+}
+
+// verifierConfig returns the verify config with the reloadable allowed signers merged in
+func (c *Config) verifierConfig() *signature.VerifierConfig {
+	verifierConfig := c.Verify
+	verifierConfig.AllowedAddresses = append(append([]string{}, c.Verify.AllowedAddresses...), c.AllowedSigners...)
+	return &verifierConfig
+}
+
+// verifier returns the signature verifier for the current config,
+// rebuilding it if the config has been reloaded since it was last built.
+func (bc *BroadcastClient) verifier() (*signature.Verifier, error) {
+	config := bc.config()
+	bc.sigVerifierMutex.Lock()
+	defer bc.sigVerifierMutex.Unlock()
+	if config == bc.sigVerifierSource {
+		return bc.sigVerifier, nil
+	}
+	sigVerifier, err := signature.NewVerifier(config.verifierConfig(), bc.bpVerifier)
+	if err != nil {
+		return nil, err
+	}
+	bc.sigVerifier = sigVerifier
+	bc.sigVerifierSource = config
+	return sigVerifier, nil
+}
+
+// verifySignatures verifies the signatures of a batch of messages, returning
+// an error for each message
+func (bc *BroadcastClient) verifySignatures(ctx context.Context, messages []*broadcaster.BroadcastFeedMessage) []error {
+	if bc.config().BLS.Enable {
+		return bc.verifyBLSSignatures(ctx, messages)
+	}
+	errs := make([]error, len(messages))
+	for i, message := range messages {
+		errs[i] = bc.isValidSignature(ctx, message)
+	}
+	return errs
 }
 
 func (bc *BroadcastClient) isValidSignature(ctx context.Context, message *broadcaster.BroadcastFeedMessage) error {
-	if bc.config().Verify.Dangerous.AcceptMissing && bc.sigVerifier == nil {
+	sigVerifier, err := bc.verifier()
+	if err != nil {
+		return err
+	}
+	if bc.config().Verify.Dangerous.AcceptMissing && sigVerifier == nil {
 		// Verifier disabled
 		return nil
 	}
@@ -488,5 +1482,5 @@ func (bc *BroadcastClient) isValidSignature(ctx context.Context, message *broadc
 	if err != nil {
 		return fmt.Errorf("error getting message hash for sequence number %v: %w", message.SequenceNumber, err)
 	}
-	return bc.sigVerifier.VerifyHash(ctx, message.Signature, hash)
+	return sigVerifier.VerifyHash(ctx, message.Signature, hash)
 }
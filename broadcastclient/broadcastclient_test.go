@@ -8,17 +8,23 @@ import (
 	"crypto/ecdsa"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/gobwas/ws"
+	"github.com/golang-jwt/jwt/v4"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/metrics"
 
 	"github.com/offchainlabs/nitro/arbos/arbostypes"
 	"github.com/offchainlabs/nitro/arbutil"
@@ -146,7 +152,6 @@ func TestInvalidSignature(t *testing.T) {
 		chainId,
 		0,
 		ts,
-		nil,
 		fatalErrChan,
 		&badSequencerAddr,
 	)
@@ -177,6 +182,368 @@ func TestInvalidSignature(t *testing.T) {
 	}
 }
 
+func TestSignatureVerifierRotation(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	chainId := uint64(9743)
+	oldKey, err := crypto.GenerateKey()
+	Require(t, err)
+	newKey, err := crypto.GenerateKey()
+	Require(t, err)
+	oldSigner := crypto.PubkeyToAddress(oldKey.PublicKey)
+	newSigner := crypto.PubkeyToAddress(newKey.PublicKey)
+
+	config := DefaultTestConfig
+	config.Verify = signature.TestingFeedVerifierConfig
+	config.AllowedSigners = []string{oldSigner.Hex()}
+	currentConfig := &config
+	broadcastClient, err := NewBroadcastClient(func() *Config { return currentConfig }, nil, chainId, 0, nil, nil, nil, func(_ int32) {}, nil)
+	Require(t, err)
+
+	signedMessage := func(dataSigner signature.DataSignerFunc) *broadcaster.BroadcastFeedMessage {
+		message := &broadcaster.BroadcastFeedMessage{
+			SequenceNumber: 1,
+			Message:        arbostypes.TestMessageWithMetadataAndRequestId,
+		}
+		hash, err := message.Hash(chainId)
+		Require(t, err)
+		message.Signature, err = dataSigner(hash.Bytes())
+		Require(t, err)
+		return message
+	}
+	oldMessage := signedMessage(signature.DataSignerFromPrivateKey(oldKey))
+	newMessage := signedMessage(signature.DataSignerFromPrivateKey(newKey))
+
+	Require(t, broadcastClient.isValidSignature(ctx, oldMessage))
+	if err := broadcastClient.isValidSignature(ctx, newMessage); !errors.Is(err, signature.ErrSignerNotApproved) {
+		t.Fatalf("expected new signer to be rejected before rotation, got %v", err)
+	}
+
+	// Reload the config with the rotated signer
+	rotatedConfig := config
+	rotatedConfig.AllowedSigners = []string{newSigner.Hex()}
+	currentConfig = &rotatedConfig
+
+	Require(t, broadcastClient.isValidSignature(ctx, newMessage))
+	if err := broadcastClient.isValidSignature(ctx, oldMessage); !errors.Is(err, signature.ErrSignerNotApproved) {
+		t.Fatalf("expected old signer to be rejected after rotation, got %v", err)
+	}
+}
+
+// countMetric replaces *metric with counting until the test ends. Metrics
+// registered with metrics disabled, as they are in tests, don't count.
+func countMetric[T any](t *testing.T, metric *T, counting T) T {
+	t.Helper()
+	previous := *metric
+	*metric = counting
+	t.Cleanup(func() { *metric = previous })
+	return counting
+}
+
+func TestClientMetrics(t *testing.T) {
+	connects := countMetric[metrics.Counter](t, &sourcesConnectsCounter, &metrics.StandardCounter{})
+	received := countMetric[metrics.Counter](t, &messagesReceivedCounter, &metrics.StandardCounter{})
+	bytesReceived := countMetric[metrics.Counter](t, &bytesReceivedCounter, &metrics.StandardCounter{})
+	lastSequence := countMetric[metrics.Gauge](t, &lastSequenceGauge, &metrics.StandardGauge{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	settings := wsbroadcastserver.DefaultTestBroadcasterConfig
+	feedErrChan := make(chan error, 10)
+	chainId := uint64(8742)
+	b := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &settings }, chainId, feedErrChan, nil)
+	Require(t, b.Initialize())
+	Require(t, b.Start(ctx))
+	defer b.StopAndWait()
+	for i := 0; i < 3; i++ {
+		Require(t, b.BroadcastSingle(arbostypes.EmptyTestMessageWithMetadata, arbutil.MessageIndex(i)))
+	}
+
+	config := DefaultTestConfig
+	config.Verify.Dangerous.AcceptMissing = true
+	handler := &recordingHandler{make(chan arbutil.MessageIndex, 10), make(chan arbutil.MessageIndex, 10)}
+	broadcastClient, err := NewBroadcastClientWithOptions(
+		"ws://"+b.ListenerAddr().String()+"/",
+		WithConfig(func() *Config { return &config }),
+		WithChainId(chainId),
+		WithHandler(handler),
+	)
+	Require(t, err)
+	broadcastClient.Start(ctx)
+	defer broadcastClient.StopAndWait()
+	for i := 0; i < 3; i++ {
+		select {
+		case <-handler.messages:
+		case err := <-feedErrChan:
+			t.Fatalf("feed error: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("message %d not received", i)
+		}
+	}
+
+	if count := connects.Count(); count != 1 {
+		t.Fatalf("expected 1 connect, got %d", count)
+	}
+	if count := received.Count(); count != 3 {
+		t.Fatalf("expected 3 messages received, got %d", count)
+	}
+	if bytesReceived.Count() == 0 {
+		t.Fatal("bytes received not counted")
+	}
+	if last := lastSequence.Value(); last != 2 {
+		t.Fatalf("expected last sequence number 2, got %d", last)
+	}
+}
+
+func TestBulkCatchup(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	settings := wsbroadcastserver.DefaultTestBroadcasterConfig
+	settings.BulkCatchup = 3
+	feedErrChan := make(chan error, 10)
+	chainId := uint64(8742)
+	b := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &settings }, chainId, feedErrChan, nil)
+	Require(t, b.Initialize())
+	Require(t, b.Start(ctx))
+	defer b.StopAndWait()
+	for seqNum := arbutil.MessageIndex(0); seqNum < 5; seqNum++ {
+		Require(t, b.BroadcastSingle(arbostypes.EmptyTestMessageWithMetadata, seqNum))
+	}
+
+	for _, binary := range []bool{false, true} {
+		for _, stream := range []bool{false, true} {
+			config := DefaultTestConfig
+			config.Verify.Dangerous.AcceptMissing = true
+			config.Transport.Binary = binary
+			config.Decode.Stream = stream
+			handler := &recordingHandler{make(chan arbutil.MessageIndex, 10), make(chan arbutil.MessageIndex, 10)}
+			bulkBefore := bulkFramesCounter.Count()
+			broadcastClient, err := NewBroadcastClientWithOptions(
+				LoopbackURL,
+				WithConfig(func() *Config { return &config }),
+				WithChainId(chainId),
+				WithHandler(handler),
+				WithLoopback(b),
+			)
+			Require(t, err)
+			broadcastClient.Start(ctx)
+			for expected := arbutil.MessageIndex(0); expected < 5; expected++ {
+				select {
+				case seqNum := <-handler.messages:
+					if seqNum != expected {
+						t.Fatalf("binary %v stream %v: received message %d, expected %d", binary, stream, seqNum, expected)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatalf("binary %v stream %v: message %d not caught up", binary, stream, expected)
+				}
+			}
+			if bulkFramesCounter.Count() == bulkBefore {
+				t.Fatalf("binary %v stream %v: catchup not sent in bulk", binary, stream)
+			}
+			broadcastClient.StopAndWait()
+		}
+	}
+}
+
+func TestBroadcastServerAuth(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	keysFile := filepath.Join(dir, "keys.json")
+	Require(t, os.WriteFile(keysFile, []byte(`[{"name":"partner","key":"partner-key","rateClass":"premium"}]`), 0o600))
+	secret := common.BytesToHash([]byte("feed jwt secret"))
+	secretFile := filepath.Join(dir, "jwt.hex")
+	Require(t, os.WriteFile(secretFile, []byte(secret.Hex()), 0o600))
+	settings := wsbroadcastserver.DefaultTestBroadcasterConfig
+	settings.Auth = wsbroadcastserver.AuthConfig{Enable: true, JWTSecretFile: secretFile, KeysFile: keysFile}
+	Require(t, settings.Validate())
+	feedErrChan := make(chan error, 10)
+	chainId := uint64(8742)
+	b := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &settings }, chainId, feedErrChan, nil)
+	Require(t, b.Initialize())
+	Require(t, b.Start(ctx))
+	defer b.StopAndWait()
+	addr := b.ListenerAddr().String()
+
+	claims := jwt.RegisteredClaims{Subject: "node", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret.Bytes())
+	Require(t, err)
+	expired := jwt.RegisteredClaims{Subject: "node", ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Hour))}
+	expiredSigned, err := jwt.NewWithClaims(jwt.SigningMethodHS256, expired).SignedString(secret.Bytes())
+	Require(t, err)
+
+	for _, token := range []string{"partner-key", signed} {
+		config := DefaultTestConfig
+		config.Verify.Dangerous.AcceptMissing = true
+		config.Handshake.AuthToken = token
+		handler := &recordingHandler{make(chan arbutil.MessageIndex, 10), make(chan arbutil.MessageIndex, 10)}
+		broadcastClient, err := NewBroadcastClientWithOptions(
+			"ws://"+addr+"/",
+			WithConfig(func() *Config { return &config }),
+			WithChainId(chainId),
+			WithHandler(handler),
+		)
+		Require(t, err)
+		broadcastClient.Start(ctx)
+		Require(t, b.BroadcastSingle(arbostypes.EmptyTestMessageWithMetadata, 0))
+		select {
+		case <-handler.messages:
+		case <-time.After(5 * time.Second):
+			t.Fatal("authenticated client not served")
+		}
+		broadcastClient.StopAndWait()
+	}
+
+	for _, authorization := range []string{"", "Bearer other-key", "Bearer " + expiredSigned} {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+addr+wsbroadcastserver.EventStreamPath, nil)
+		Require(t, err)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		res, err := http.DefaultClient.Do(req)
+		Require(t, err)
+		_ = res.Body.Close()
+		if res.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("got status %d with authorization %q, expected %d", res.StatusCode, authorization, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestBroadcastServerMaxClients(t *testing.T) {
+	t.Parallel()
+	for _, policy := range []string{wsbroadcastserver.AdmissionReject, wsbroadcastserver.AdmissionEvictLagged} {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		settings := wsbroadcastserver.DefaultTestBroadcasterConfig
+		settings.MaxClients = 1
+		settings.AdmissionPolicy = policy
+		Require(t, settings.Validate())
+		b := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &settings }, 8742, make(chan error, 10), nil)
+		Require(t, b.Initialize())
+		Require(t, b.Start(ctx))
+		defer b.StopAndWait()
+		url := "http://" + b.ListenerAddr().String() + wsbroadcastserver.EventStreamPath
+
+		first, err := http.Get(url)
+		Require(t, err)
+		defer first.Body.Close()
+		for start := time.Now(); b.ClientCount() < 1; time.Sleep(time.Millisecond) {
+			if time.Since(start) > 5*time.Second {
+				t.Fatal("first client not registered")
+			}
+		}
+		second, err := http.Get(url)
+		Require(t, err)
+		defer second.Body.Close()
+		if policy == wsbroadcastserver.AdmissionReject {
+			if second.StatusCode != http.StatusServiceUnavailable {
+				t.Fatalf("got status %d for client over max-clients, expected %d", second.StatusCode, http.StatusServiceUnavailable)
+			}
+			continue
+		}
+		if second.StatusCode != http.StatusOK {
+			t.Fatalf("got status %d for client evicting another, expected %d", second.StatusCode, http.StatusOK)
+		}
+		evicted := make(chan error, 1)
+		go func() {
+			_, err := io.Copy(io.Discard, first.Body)
+			evicted <- err
+		}()
+		select {
+		case <-evicted:
+		case <-time.After(5 * time.Second):
+			t.Fatal("first client not evicted")
+		}
+	}
+}
+
+func TestHandshakeHeaderAuthToken(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	Require(t, os.WriteFile(tokenFile, []byte("first\n"), 0600))
+
+	config := DefaultTestConfig
+	config.Handshake.AuthTokenFile = tokenFile
+	config.Handshake.ExtraHeaders = []string{"X-Relay-Tenant: nitro"}
+	header, err := config.handshakeHeader(0)
+	Require(t, err)
+	if header.Get("Authorization") != "Bearer first" {
+		t.Fatalf("unexpected Authorization header %q", header.Get("Authorization"))
+	}
+	if header.Get("X-Relay-Tenant") != "nitro" {
+		t.Fatalf("unexpected extra header %q", header.Get("X-Relay-Tenant"))
+	}
+
+	// The token file is re-read on every reconnect
+	Require(t, os.WriteFile(tokenFile, []byte("second"), 0600))
+	header, err = config.handshakeHeader(0)
+	Require(t, err)
+	if header.Get("Authorization") != "Bearer second" {
+		t.Fatalf("rotated token not picked up, got %q", header.Get("Authorization"))
+	}
+}
+
+func TestHandshakeHeaderClientId(t *testing.T) {
+	config := DefaultTestConfig
+	header, err := config.handshakeHeader(0)
+	Require(t, err)
+	if _, found := header[wsbroadcastserver.HTTPHeaderFeedClientId]; found {
+		t.Fatal("client id sent without being configured")
+	}
+	config.Handshake.ClientId = "archive-3 v2.1.0"
+	header, err = config.handshakeHeader(0)
+	Require(t, err)
+	if header.Get(wsbroadcastserver.HTTPHeaderFeedClientId) != config.Handshake.ClientId {
+		t.Fatalf("unexpected client id header %q", header.Get(wsbroadcastserver.HTTPHeaderFeedClientId))
+	}
+	config.Handshake.ExtraHeaders = []string{wsbroadcastserver.HTTPHeaderFeedClientId + ": other"}
+	if err := config.Validate(); err == nil {
+		t.Fatal("client id accepted as an extra header")
+	}
+
+	// The server keeps what is safe to log
+	if id := wsbroadcastserver.SanitizeClientId(" node\x1b[31m-1\n"); id != "node[31m-1" {
+		t.Fatalf("unexpected sanitized client id %q", id)
+	}
+	if id := wsbroadcastserver.SanitizeClientId(strings.Repeat("é", wsbroadcastserver.MaxClientIdLength)); len(id) != wsbroadcastserver.MaxClientIdLength {
+		t.Fatalf("expected client id truncated to %d bytes, got %d", wsbroadcastserver.MaxClientIdLength, len(id))
+	}
+}
+
+func TestExtraHeaders(t *testing.T) {
+	header, err := parseExtraHeaders([]string{"x-api-key: secret", "X-Route: a", "X-Route: b", "X-Empty:"})
+	Require(t, err)
+	if header.Get("X-Api-Key") != "secret" {
+		t.Fatalf("unexpected X-Api-Key header %q", header.Get("X-Api-Key"))
+	}
+	if routes := header.Values("X-Route"); len(routes) != 2 || routes[0] != "a" || routes[1] != "b" {
+		t.Fatalf("repeated header values not kept, got %v", routes)
+	}
+	for _, invalid := range []string{
+		"no separator",
+		": no name",
+		"Bad Name: value",
+		"Upgrade: h2c",
+		"sec-websocket-key: abc",
+		"Host: relay.example.com",
+		wsbroadcastserver.HTTPHeaderRequestedSequenceNumber + ": 5",
+	} {
+		if _, err := parseExtraHeaders([]string{invalid}); err == nil {
+			t.Errorf("expected extra header %q to be rejected", invalid)
+		}
+	}
+
+	config := DefaultTestConfig
+	config.Handshake.ExtraHeaders = []string{"Connection: close"}
+	if err := config.Validate(); err == nil {
+		t.Fatal("expected reserved extra header to fail validation")
+	}
+}
+
 type dummyTransactionStreamer struct {
 	messageReceiver chan broadcaster.BroadcastFeedMessage
 	chainId         uint64
@@ -198,7 +565,7 @@ func (ts *dummyTransactionStreamer) AddBroadcastMessages(feedMessages []*broadca
 	return nil
 }
 
-func newTestBroadcastClient(config Config, listenerAddress net.Addr, chainId uint64, currentMessageCount arbutil.MessageIndex, txStreamer TransactionStreamerInterface, confirmedSequenceNumberListener chan arbutil.MessageIndex, feedErrChan chan error, validAddr *common.Address) (*BroadcastClient, error) {
+func newTestBroadcastClient(config Config, listenerAddress net.Addr, chainId uint64, currentMessageCount arbutil.MessageIndex, txStreamer TransactionStreamerInterface, feedErrChan chan error, validAddr *common.Address) (*BroadcastClient, error) {
 	port := listenerAddress.(*net.TCPAddr).Port
 	var bpv contracts.BatchPosterVerifierInterface
 	if validAddr != nil {
@@ -207,7 +574,7 @@ func newTestBroadcastClient(config Config, listenerAddress net.Addr, chainId uin
 	} else {
 		config.Verify.AcceptSequencer = false
 	}
-	return NewBroadcastClient(func() *Config { return &config }, fmt.Sprintf("ws://127.0.0.1:%d/", port), chainId, currentMessageCount, txStreamer, confirmedSequenceNumberListener, feedErrChan, bpv, func(_ int32) {})
+	return NewBroadcastClient(func() *Config { return &config }, []string{fmt.Sprintf("ws://127.0.0.1:%d/", port)}, chainId, currentMessageCount, txStreamer, feedErrChan, bpv, func(_ int32) {}, nil)
 }
 
 func startMakeBroadcastClient(ctx context.Context, t *testing.T, clientConfig Config, addr net.Addr, index int, expectedCount int, chainId uint64, wg *sync.WaitGroup, sequencerAddr *common.Address) {
@@ -219,7 +586,6 @@ func startMakeBroadcastClient(ctx context.Context, t *testing.T, clientConfig Co
 		chainId,
 		0,
 		ts,
-		nil,
 		feedErrChan,
 		sequencerAddr,
 	)
@@ -293,7 +659,6 @@ func TestServerClientDisconnect(t *testing.T) {
 		chainId,
 		0,
 		ts,
-		nil,
 		feedErrChan,
 		&sequencerAddr,
 	)
@@ -356,7 +721,6 @@ func TestBroadcastClientConfirmedMessage(t *testing.T) {
 	Require(t, b.Start(ctx))
 	defer b.StopAndWait()
 
-	confirmedSequenceNumberListener := make(chan arbutil.MessageIndex, 10)
 	ts := NewDummyTransactionStreamer(chainId, nil)
 	broadcastClient, err := newTestBroadcastClient(
 		DefaultTestConfig,
@@ -364,11 +728,11 @@ func TestBroadcastClientConfirmedMessage(t *testing.T) {
 		chainId,
 		0,
 		ts,
-		confirmedSequenceNumberListener,
 		feedErrChan,
 		&sequencerAddr,
 	)
 	Require(t, err)
+	confirmedSequenceNumberListener := broadcastClient.SubscribeConfirmedSeq(10)
 	broadcastClient.Start(ctx)
 
 	t.Log("broadcasting seq 0 message")
@@ -407,6 +771,7 @@ func TestBroadcastClientConfirmedMessage(t *testing.T) {
 
 	broadcastClient.StopAndWait()
 }
+
 func TestServerIncorrectChainId(t *testing.T) {
 	t.Parallel()
 	ctx, cancel := context.WithCancel(context.Background())
@@ -436,7 +801,6 @@ func TestServerIncorrectChainId(t *testing.T) {
 		chainId+1,
 		0,
 		ts,
-		nil,
 		badFeedErrChan,
 		&sequencerAddr,
 	)
@@ -495,7 +859,6 @@ func TestServerMissingChainId(t *testing.T) {
 		chainId,
 		0,
 		ts,
-		nil,
 		badFeedErrChan,
 		&sequencerAddr,
 	)
@@ -518,6 +881,55 @@ func TestServerMissingChainId(t *testing.T) {
 	}
 }
 
+func TestServerHelloIncorrectChainId(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	settings := wsbroadcastserver.DefaultTestBroadcasterConfig
+	settings.Ping = 1 * time.Second
+
+	chainId := uint64(8742)
+	feedErrChan := make(chan error, 10)
+	b := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &settings }, chainId, feedErrChan, nil)
+
+	// Without the chain id header only the hello message reveals the mismatch
+	header := ws.HandshakeHeaderHTTP(http.Header{
+		wsbroadcastserver.HTTPHeaderFeedServerVersion: []string{strconv.Itoa(wsbroadcastserver.FeedServerVersion)},
+	})
+
+	Require(t, b.Initialize())
+	Require(t, b.StartWithHeader(ctx, header))
+	defer b.StopAndWait()
+
+	ts := NewDummyTransactionStreamer(chainId, nil)
+	badFeedErrChan := make(chan error, 10)
+	badBroadcastClient, err := newTestBroadcastClient(
+		DefaultTestConfig,
+		b.ListenerAddr(),
+		chainId+1,
+		0,
+		ts,
+		badFeedErrChan,
+		nil,
+	)
+	Require(t, err)
+	badBroadcastClient.Start(ctx)
+	defer badBroadcastClient.StopAndWait()
+	badTimer := time.NewTimer(5 * time.Second)
+	defer badTimer.Stop()
+	select {
+	case err := <-feedErrChan:
+		t.Errorf("Unexpected error %v", err)
+	case err := <-badFeedErrChan:
+		if !errors.Is(err, ErrIncorrectChainId) {
+			t.Errorf("Unexpected error %v", err)
+		}
+	case <-badTimer.C:
+		t.Fatal("Client channel did not send error as expected")
+	}
+}
+
 func TestServerIncorrectFeedServerVersion(t *testing.T) {
 	t.Parallel()
 	ctx, cancel := context.WithCancel(context.Background())
@@ -552,7 +964,6 @@ func TestServerIncorrectFeedServerVersion(t *testing.T) {
 		chainId,
 		0,
 		ts,
-		nil,
 		badFeedErrChan,
 		&sequencerAddr,
 	)
@@ -575,6 +986,55 @@ func TestServerIncorrectFeedServerVersion(t *testing.T) {
 	}
 }
 
+func TestServerIncompatibleFeedMessageVersion(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	settings := wsbroadcastserver.DefaultTestBroadcasterConfig
+	settings.Ping = 1 * time.Second
+
+	chainId := uint64(8742)
+	feedErrChan := make(chan error, 10)
+	b := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &settings }, chainId, feedErrChan, nil)
+
+	header := ws.HandshakeHeaderHTTP(http.Header{
+		wsbroadcastserver.HTTPHeaderChainId:             []string{strconv.FormatUint(chainId, 10)},
+		wsbroadcastserver.HTTPHeaderFeedServerVersion:   []string{strconv.Itoa(wsbroadcastserver.FeedServerVersion)},
+		wsbroadcastserver.HTTPHeaderFeedMessageVersions: []string{strconv.Itoa(wsbroadcastserver.FeedMessageVersion + 1)},
+	})
+
+	Require(t, b.Initialize())
+	Require(t, b.StartWithHeader(ctx, header))
+	defer b.StopAndWait()
+
+	ts := NewDummyTransactionStreamer(chainId, nil)
+	badFeedErrChan := make(chan error, 10)
+	badBroadcastClient, err := newTestBroadcastClient(
+		DefaultTestConfig,
+		b.ListenerAddr(),
+		chainId,
+		0,
+		ts,
+		badFeedErrChan,
+		nil,
+	)
+	Require(t, err)
+	badBroadcastClient.Start(ctx)
+	badTimer := time.NewTimer(5 * time.Second)
+	defer badTimer.Stop()
+	select {
+	case err := <-feedErrChan:
+		t.Errorf("Unexpected error %v", err)
+	case err := <-badFeedErrChan:
+		if !errors.Is(err, ErrIncompatibleFeedMessageVersion) {
+			t.Errorf("Unexpected error %v", err)
+		}
+	case <-badTimer.C:
+		t.Fatal("Client channel did not send error as expected")
+	}
+}
+
 func TestServerMissingFeedServerVersion(t *testing.T) {
 	t.Parallel()
 	ctx, cancel := context.WithCancel(context.Background())
@@ -611,7 +1071,6 @@ func TestServerMissingFeedServerVersion(t *testing.T) {
 		chainId,
 		0,
 		ts,
-		nil,
 		badFeedErrChan,
 		&sequencerAddr,
 	)
@@ -662,7 +1121,6 @@ func TestBroadcastClientReconnectsOnServerDisconnect(t *testing.T) {
 		chainId,
 		0,
 		nil,
-		nil,
 		feedErrChan,
 		&sequencerAddr,
 	)
@@ -685,6 +1143,296 @@ func TestBroadcastClientReconnectsOnServerDisconnect(t *testing.T) {
 	}
 }
 
+func TestBroadcastClientReportsDialErrors(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Nothing is listening on the address once the listener is closed
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Require(t, err)
+	addr := listener.Addr()
+	Require(t, listener.Close())
+
+	broadcastClient, err := newTestBroadcastClient(DefaultTestConfig, addr, 8742, 0, nil, nil, nil)
+	Require(t, err)
+	broadcastClient.Start(ctx)
+	defer broadcastClient.StopAndWait()
+
+	select {
+	case feedErr := <-broadcastClient.Errors():
+		if feedErr.Category != DialError {
+			t.Fatalf("expected dial error, got %v", feedErr)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no error reported")
+	}
+	if broadcastClient.LastError() == nil || broadcastClient.ErrorCount() == 0 {
+		t.Fatal("last error and error count not updated")
+	}
+}
+
+func TestBroadcastClientHandshakeTimeout(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Accepts connections but never answers the websocket upgrade
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Require(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	config := DefaultTestConfig
+	config.Dial.HandshakeTimeout = 100 * time.Millisecond
+	broadcastClient, err := newTestBroadcastClient(config, listener.Addr(), 8742, 0, nil, nil, nil)
+	Require(t, err)
+	start := time.Now()
+	broadcastClient.Start(ctx)
+	defer broadcastClient.StopAndWait()
+
+	select {
+	case feedErr := <-broadcastClient.Errors():
+		if feedErr.Category != DialError {
+			t.Fatalf("expected dial error, got %v", feedErr)
+		}
+		if elapsed := time.Since(start); elapsed > config.Dial.Timeout+config.Dial.HandshakeTimeout+time.Second {
+			t.Fatalf("handshake timed out after %v", elapsed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("handshake did not time out")
+	}
+}
+
+func TestBroadcastClientFailsOverToNextURL(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	settings := wsbroadcastserver.DefaultTestBroadcasterConfig
+
+	privateKey, err := crypto.GenerateKey()
+	Require(t, err)
+	sequencerAddr := crypto.PubkeyToAddress(privateKey.PublicKey)
+	dataSigner := signature.DataSignerFromPrivateKey(privateKey)
+
+	feedErrChan := make(chan error, 10)
+	chainId := uint64(8745)
+	b := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &settings }, chainId, feedErrChan, dataSigner)
+
+	Require(t, b.Initialize())
+	Require(t, b.Start(ctx))
+	defer b.StopAndWait()
+
+	// Reserve a port with nothing listening on it to act as the unreachable primary
+	unusedListener, err := net.Listen("tcp", "127.0.0.1:0")
+	Require(t, err)
+	unreachableURL := fmt.Sprintf("ws://127.0.0.1:%d/", unusedListener.Addr().(*net.TCPAddr).Port)
+	Require(t, unusedListener.Close())
+	backupURL := fmt.Sprintf("ws://127.0.0.1:%d/", b.ListenerAddr().(*net.TCPAddr).Port)
+
+	config := DefaultTestConfig
+	config.Failover.Enable = true
+	config.Failover.Threshold = 1
+	config.Verify.AcceptSequencer = true
+	ts := NewDummyTransactionStreamer(chainId, nil)
+	broadcastClient, err := NewBroadcastClient(
+		func() *Config { return &config },
+		[]string{unreachableURL, backupURL},
+		chainId,
+		0,
+		ts,
+		feedErrChan,
+		contracts.NewMockBatchPosterVerifier(sequencerAddr),
+		func(_ int32) {},
+		nil,
+	)
+	Require(t, err)
+	broadcastClient.Start(ctx)
+	defer broadcastClient.StopAndWait()
+
+	Require(t, b.BroadcastSingle(arbostypes.EmptyTestMessageWithMetadata, 0))
+
+	timer := time.NewTimer(5 * time.Second)
+	defer timer.Stop()
+	select {
+	case err := <-feedErrChan:
+		t.Errorf("Broadcaster error: %s\n", err.Error())
+	case receivedMsg := <-ts.messageReceiver:
+		t.Logf("Received Message from backup url: %v\n", receivedMsg)
+	case <-timer.C:
+		t.Fatal("Client did not fail over to backup url")
+	}
+}
+
+func TestBroadcastClientSetURLs(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	settings := wsbroadcastserver.DefaultTestBroadcasterConfig
+	feedErrChan := make(chan error, 10)
+	chainId := uint64(8746)
+	var urls []string
+	for i := 0; i < 2; i++ {
+		b := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &settings }, chainId, feedErrChan, nil)
+		Require(t, b.Initialize())
+		Require(t, b.Start(ctx))
+		defer b.StopAndWait()
+		urls = append(urls, fmt.Sprintf("ws://127.0.0.1:%d/", b.ListenerAddr().(*net.TCPAddr).Port))
+	}
+
+	config := DefaultTestConfig
+	broadcastClient, err := NewBroadcastClient(
+		func() *Config { return &config },
+		urls[:1],
+		chainId,
+		0,
+		nil,
+		feedErrChan,
+		nil,
+		func(_ int32) {},
+		nil,
+	)
+	Require(t, err)
+	connects := make(chan string, 100)
+	broadcastClient.AddConnectionListener(ConnectionListenerFuncs{
+		Connect: func(url string) { connects <- url },
+	})
+	broadcastClient.Start(ctx)
+	defer broadcastClient.StopAndWait()
+
+	timeout := time.After(5 * time.Second)
+	switched := false
+	for {
+		select {
+		case url := <-connects:
+			if url == urls[1] {
+				return
+			}
+			if !switched {
+				broadcastClient.SetURLs(urls[1:])
+				switched = true
+			}
+		case err := <-feedErrChan:
+			t.Fatalf("Broadcaster error: %s", err.Error())
+		case <-timeout:
+			t.Fatal("client did not connect to new url")
+		}
+	}
+}
+
+func TestBroadcastClientGivesUpAfterMaxReconnectAttempts(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Reserve a port with nothing listening on it
+	unusedListener, err := net.Listen("tcp", "127.0.0.1:0")
+	Require(t, err)
+	unreachableURL := fmt.Sprintf("ws://127.0.0.1:%d/", unusedListener.Addr().(*net.TCPAddr).Port)
+	Require(t, unusedListener.Close())
+
+	config := DefaultTestConfig
+	config.Reconnect.MaxAttempts = 2
+	feedErrChan := make(chan error, 10)
+	unreachableChan := make(chan error, 1)
+	broadcastClient, err := NewBroadcastClient(
+		func() *Config { return &config },
+		[]string{unreachableURL},
+		8746,
+		0,
+		nil,
+		feedErrChan,
+		nil,
+		func(_ int32) {},
+		func(err error) { unreachableChan <- err },
+	)
+	Require(t, err)
+	broadcastClient.Start(ctx)
+	defer broadcastClient.StopAndWait()
+
+	timer := time.NewTimer(5 * time.Second)
+	defer timer.Stop()
+	select {
+	case err := <-feedErrChan:
+		t.Fatalf("unexpected fatal error: %v", err)
+	case err := <-unreachableChan:
+		if !errors.Is(err, ErrFeedUnreachable) {
+			t.Fatalf("expected ErrFeedUnreachable, got %v", err)
+		}
+	case <-timer.C:
+		t.Fatal("client did not give up after max reconnect attempts")
+	}
+	if state, since := broadcastClient.State(); state != Unreachable || since.IsZero() {
+		t.Fatalf("expected unreachable client, got %v since %v", state, since)
+	}
+	broadcastClient.StopAndWait()
+	if state, _ := broadcastClient.State(); state != Stopped {
+		t.Fatalf("expected stopped client, got %v", state)
+	}
+}
+
+func TestResumeURL(t *testing.T) {
+	for feedURL, expected := range map[string]string{
+		"wss://arb1.arbitrum.io/feed":                    "wss://arb1.arbitrum.io/feed?requestedSequenceNumber=42",
+		"ws://127.0.0.1:9642/?key=value":                 "ws://127.0.0.1:9642/?key=value&requestedSequenceNumber=42",
+		"ws://127.0.0.1:9642/?requestedSequenceNumber=1": "ws://127.0.0.1:9642/?requestedSequenceNumber=42",
+	} {
+		if got := resumeURL(feedURL, 42); got != expected {
+			t.Errorf("resume url for %s is %s, expected %s", feedURL, got, expected)
+		}
+	}
+}
+
+func TestBroadcastClientResumesFromCursor(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	settings := wsbroadcastserver.DefaultTestBroadcasterConfig
+	feedErrChan := make(chan error, 10)
+	chainId := uint64(8742)
+	b := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &settings }, chainId, feedErrChan, nil)
+	Require(t, b.Initialize())
+	Require(t, b.Start(ctx))
+	defer b.StopAndWait()
+	for i := 0; i < 10; i++ {
+		Require(t, b.BroadcastSingle(arbostypes.EmptyTestMessageWithMetadata, arbutil.MessageIndex(i)))
+	}
+
+	// The feed only sends the cached messages from the cursor on
+	config := DefaultTestConfig
+	config.Verify.Dangerous.AcceptMissing = true
+	broadcastClient, err := newTestBroadcastClient(config, b.ListenerAddr(), chainId, 5, nil, feedErrChan, nil)
+	Require(t, err)
+	handler := &recordingHandler{make(chan arbutil.MessageIndex, 10), make(chan arbutil.MessageIndex, 1)}
+	broadcastClient.AddHandler(handler)
+	broadcastClient.Start(ctx)
+	defer broadcastClient.StopAndWait()
+
+	for expected := arbutil.MessageIndex(5); expected < 10; expected++ {
+		select {
+		case seqNum := <-handler.messages:
+			if seqNum != expected {
+				t.Fatalf("received sequence number %d, expected %d", seqNum, expected)
+			}
+		case err := <-feedErrChan:
+			t.Fatalf("feed error: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("sequence number %d was not received", expected)
+		}
+	}
+}
+
 func TestBroadcasterSendsCachedMessagesOnClientConnect(t *testing.T) {
 	t.Parallel()
 	/* Uncomment to enable logging
@@ -774,7 +1522,6 @@ func connectAndGetCachedMessages(ctx context.Context, addr net.Addr, chainId uin
 		chainId,
 		0,
 		ts,
-		nil,
 		feedErrChan,
 		sequencerAddr,
 	)
@@ -0,0 +1,69 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/log"
+
+	"github.com/offchainlabs/nitro/arbutil"
+)
+
+// loadCheckpoint reads the highest contiguous sequence number delivered by a
+// previous run. Returns false if no checkpoint has been written yet.
+func loadCheckpoint(path string) (arbutil.MessageIndex, bool, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	seqNum, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("malformed feed checkpoint file %s: %w", path, err)
+	}
+	return arbutil.MessageIndex(seqNum), true, nil
+}
+
+// writeCheckpoint atomically replaces the checkpoint file so a crash never
+// leaves a partially written checkpoint behind
+func writeCheckpoint(path string, seqNum arbutil.MessageIndex) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(strconv.FormatUint(uint64(seqNum), 10) + "\n"); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// saveCheckpoint records the last sequence number delivered if it changed.
+// Only called from the delivery thread.
+func (bc *BroadcastClient) saveCheckpoint(seqNum arbutil.MessageIndex) {
+	path := bc.config().CheckpointFile
+	if path == "" {
+		return
+	}
+	if bc.checkpointWritten && bc.checkpointSeqNum == seqNum {
+		return
+	}
+	if err := writeCheckpoint(path, seqNum); err != nil {
+		log.Warn("error writing sequencer feed checkpoint", "path", path, "seqNum", seqNum, "err", err)
+		return
+	}
+	bc.checkpointSeqNum = seqNum
+	bc.checkpointWritten = true
+}
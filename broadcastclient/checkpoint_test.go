@@ -0,0 +1,33 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/offchainlabs/nitro/arbutil"
+)
+
+func TestCheckpointResumesFeed(t *testing.T) {
+	config := DefaultTestConfig
+	config.CheckpointFile = filepath.Join(t.TempDir(), "feed-checkpoint")
+	newClient := func(currentMessageCount arbutil.MessageIndex) *BroadcastClient {
+		broadcastClient, err := NewBroadcastClient(func() *Config { return &config }, nil, 0, currentMessageCount, nil, nil, nil, func(_ int32) {}, nil)
+		Require(t, err)
+		return broadcastClient
+	}
+
+	// Nothing to resume from before the first checkpoint
+	broadcastClient := newClient(5)
+	if broadcastClient.nextSeqNum != 5 {
+		t.Fatalf("expected next sequence number 5, got %d", broadcastClient.nextSeqNum)
+	}
+	broadcastClient.saveCheckpoint(6)
+
+	broadcastClient = newClient(3)
+	if broadcastClient.nextSeqNum != 7 {
+		t.Fatalf("expected to resume from checkpoint at next sequence number 7, got %d", broadcastClient.nextSeqNum)
+	}
+}
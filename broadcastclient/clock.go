@@ -0,0 +1,141 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is the time source of the client's reconnect backoff, downtime limit,
+// idle timeout and stall detection, see WithClock
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a time.Timer of a Clock
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) NewTimer(d time.Duration) Timer { return systemTimer{time.NewTimer(d)} }
+
+type systemTimer struct {
+	*time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time { return t.Timer.C }
+
+// sleep waits for d by the client's clock, returning false if ctx is done first
+func (bc *BroadcastClient) sleep(ctx context.Context, d time.Duration) bool {
+	timer := bc.clock.NewTimer(d)
+	select {
+	case <-ctx.Done():
+		timer.Stop()
+		return false
+	case <-timer.C():
+		return true
+	}
+}
+
+// ManualClock is a Clock that only moves when advanced, so tests can run
+// through hours of reconnects and timeouts in milliseconds
+type ManualClock struct {
+	mutex  sync.Mutex
+	now    time.Time
+	timers []*manualTimer
+}
+
+type manualTimer struct {
+	clock *ManualClock
+	when  time.Time
+	c     chan time.Time
+}
+
+// NewManualClock creates a ManualClock starting at now
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+func (c *ManualClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *ManualClock) NewTimer(d time.Duration) Timer {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	timer := &manualTimer{clock: c, when: c.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		timer.c <- c.now
+	} else {
+		c.timers = append(c.timers, timer)
+	}
+	return timer
+}
+
+// Advance moves the clock forward by d, firing the timers that became due
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.advance(d)
+}
+
+// advance is Advance with the mutex held
+func (c *ManualClock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+	pending := c.timers[:0]
+	for _, timer := range c.timers {
+		if timer.when.After(c.now) {
+			pending = append(pending, timer)
+		} else {
+			timer.c <- c.now
+		}
+	}
+	c.timers = pending
+}
+
+// AdvanceToNext moves the clock forward to the earliest pending timer and
+// fires it, returning false if there is none
+func (c *ManualClock) AdvanceToNext() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(c.timers) == 0 {
+		return false
+	}
+	sort.Slice(c.timers, func(i, j int) bool { return c.timers[i].when.Before(c.timers[j].when) })
+	c.advance(c.timers[0].when.Sub(c.now))
+	return true
+}
+
+// Timers returns the number of pending timers, e.g. to wait until the client
+// blocks on one before advancing
+func (c *ManualClock) Timers() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.timers)
+}
+
+func (t *manualTimer) C() <-chan time.Time { return t.c }
+
+func (t *manualTimer) Stop() bool {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+	for i, timer := range t.clock.timers {
+		if timer == t {
+			t.clock.timers = append(t.clock.timers[:i], t.clock.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
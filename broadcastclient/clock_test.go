@@ -0,0 +1,122 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/offchainlabs/nitro/broadcaster"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+func TestManualClock(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Hours of reconnect backoff against a feed that refuses connections
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Require(t, err)
+	feedURL := fmt.Sprintf("ws://%s/", listener.Addr())
+	Require(t, listener.Close())
+	clock := NewManualClock(time.Unix(0, 0))
+	config := DefaultTestConfig
+	config.Verify.Dangerous.AcceptMissing = true
+	config.ReconnectMaximumBackoff = time.Minute
+	config.Reconnect.MaxDowntime = 3 * time.Hour
+	unreachable := make(chan error, 1)
+	broadcastClient, err := NewBroadcastClientWithOptions(
+		feedURL,
+		WithConfig(func() *Config { return &config }),
+		WithClock(clock),
+		WithUnreachableHook(func(err error) { unreachable <- err }),
+	)
+	Require(t, err)
+	broadcastClient.Start(ctx)
+	start := time.Now()
+	for done := false; !done; {
+		select {
+		case err := <-unreachable:
+			if !errors.Is(err, ErrFeedUnreachable) {
+				t.Fatalf("unexpected error giving up: %v", err)
+			}
+			done = true
+		default:
+			if time.Since(start) > 10*time.Second {
+				t.Fatal("client did not give up on the feed")
+			}
+			clock.Advance(time.Minute)
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if elapsed := clock.Now().Sub(time.Unix(0, 0)); elapsed < config.Reconnect.MaxDowntime {
+		t.Fatalf("client gave up after %v, before the max downtime", elapsed)
+	}
+	// So do the failures of the URL in the status
+	urls := broadcastClient.Status().URLs
+	if len(urls) != 1 || urls[0].LastFailure.IsZero() || urls[0].LastFailure.After(clock.Now()) {
+		t.Fatalf("unexpected url status %+v at %v", urls, clock.Now())
+	}
+	broadcastClient.StopAndWait()
+
+	// The idle timeout follows the clock too
+	settings := wsbroadcastserver.DefaultTestBroadcasterConfig
+	feedErrChan := make(chan error, 10)
+	chainId := uint64(8742)
+	b := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &settings }, chainId, feedErrChan, nil)
+	Require(t, b.Initialize())
+	Require(t, b.Start(ctx))
+	defer b.StopAndWait()
+	idleConfig := config
+	idleConfig.Timeout = time.Hour
+	connected := make(chan struct{}, 10)
+	disconnected := make(chan error, 10)
+	idleClient, err := NewBroadcastClientWithOptions(
+		LoopbackURL,
+		WithConfig(func() *Config { return &idleConfig }),
+		WithChainId(chainId),
+		WithLoopback(b),
+		WithClock(clock),
+		WithConnectionListener(ConnectionListenerFuncs{
+			Connect:    func(string) { connected <- struct{}{} },
+			Disconnect: func(_ string, err error) { disconnected <- err },
+		}),
+	)
+	Require(t, err)
+	idleClient.Start(ctx)
+	defer idleClient.StopAndWait()
+	select {
+	case <-connected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("client did not connect")
+	}
+	connectedAt := clock.Now()
+	if connectedSince := idleClient.Status().ConnectedSince; !connectedSince.Equal(connectedAt) {
+		t.Fatalf("connected since %v by the system clock, not %v by the client's", connectedSince, connectedAt)
+	}
+	start = time.Now()
+	for done := false; !done; {
+		select {
+		case err := <-disconnected:
+			if !errors.Is(err, ErrIdleTimeout) {
+				t.Fatalf("idle connection closed with %v", err)
+			}
+			done = true
+		default:
+			if time.Since(start) > 5*time.Second {
+				t.Fatal("client did not time out the idle connection")
+			}
+			clock.Advance(time.Minute)
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if idleFor := clock.Now().Sub(connectedAt); idleFor < idleConfig.Timeout {
+		t.Fatalf("idle connection closed after %v", idleFor)
+	}
+}
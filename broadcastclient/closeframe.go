@@ -0,0 +1,78 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"errors"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+var closeFramesCounter = metrics.NewRegisteredCounter("arb/feed/close-frames", nil)
+
+// ErrFeedRejected is a feed that closed the connection for a policy violation,
+// e.g. because the client isn't allowed to read it, so reconnecting won't help
+var ErrFeedRejected = errors.New("sequencer feed rejected the client")
+
+// closeAction is how the client reacts to the feed closing the connection
+type closeAction int
+
+const (
+	// closeBackoff reconnects after the reconnect backoff, like after any
+	// lost connection
+	closeBackoff closeAction = iota
+	// closeFailover reconnects right away, to the next feed URL if there
+	// are several, as the feed is only going away
+	closeFailover
+	// closeTerminal gives up on the feed
+	closeTerminal
+)
+
+func (a closeAction) String() string {
+	switch a {
+	case closeFailover:
+		return "failover"
+	case closeTerminal:
+		return "give up"
+	default:
+		return "backoff"
+	}
+}
+
+// closeFrameAction tells how to react to the reader error err, returns false
+// if it isn't the feed closing the connection with a close frame
+func closeFrameAction(err error) (closeAction, wsutil.ClosedError, bool) {
+	var closed wsutil.ClosedError
+	if !errors.As(err, &closed) {
+		return closeBackoff, closed, false
+	}
+	switch closed.Code {
+	case ws.StatusGoingAway, wsbroadcastserver.StatusServiceRestart:
+		return closeFailover, closed, true
+	case ws.StatusPolicyViolation:
+		return closeTerminal, closed, true
+	default:
+		// Including try again later
+		return closeBackoff, closed, true
+	}
+}
+
+// failoverURL moves on to the next feed URL in priority order, if there are
+// several. Only called from the connection threads, which publish the URLs.
+func (bc *BroadcastClient) failoverURL() {
+	if len(bc.urls) < 2 {
+		return
+	}
+	from := bc.currentURL()
+	bc.urls[bc.activeURL].consecutiveFailures = 0
+	bc.activeURL = (bc.activeURL + 1) % len(bc.urls)
+	sourcesActiveIndexGauge.Update(int64(bc.activeURL))
+	log.Warn("failing over to next sequencer feed url", "from", from, "to", bc.currentURL())
+}
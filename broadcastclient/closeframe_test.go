@@ -0,0 +1,59 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gobwas/ws"
+
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+func TestCloseFrameAction(t *testing.T) {
+	for _, test := range []struct {
+		code   ws.StatusCode
+		action closeAction
+	}{
+		{ws.StatusNormalClosure, closeBackoff},
+		{ws.StatusGoingAway, closeFailover},
+		{wsbroadcastserver.StatusServiceRestart, closeFailover},
+		{wsbroadcastserver.StatusTryAgainLater, closeBackoff},
+		{ws.StatusPolicyViolation, closeTerminal},
+	} {
+		// Read the way the reader does, with the client answering the close
+		client, server := net.Pipe()
+		echoed := make(chan ws.StatusCode, 1)
+		go func() {
+			defer server.Close()
+			_ = ws.WriteFrame(server, ws.NewCloseFrame(ws.NewCloseFrameBody(test.code, "test")))
+			frame, err := ws.ReadFrame(server)
+			if err != nil {
+				echoed <- 0
+				return
+			}
+			code, _ := ws.ParseCloseFrameData(ws.UnmaskFrameInPlace(frame).Payload)
+			echoed <- code
+		}()
+		_, err := wsbroadcastserver.ReadDataFunc(context.Background(), client, nil, time.Second, ws.StateClientSide, false, nil, func(ws.OpCode, io.Reader) error { return nil })
+		_ = client.Close()
+		action, closed, ok := closeFrameAction(err)
+		if !ok || closed.Code != test.code || closed.Reason != "test" {
+			t.Fatalf("expected close frame with code %d, got %v", test.code, err)
+		}
+		if action != test.action {
+			t.Fatalf("expected close code %d to %s, got %s", test.code, test.action, action)
+		}
+		if code := <-echoed; code != test.code {
+			t.Fatalf("expected close code %d echoed, got %d", test.code, code)
+		}
+	}
+	if _, _, ok := closeFrameAction(io.EOF); ok {
+		t.Fatal("connection error taken for a close frame")
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/offchainlabs/nitro/broadcaster"
+)
+
+var (
+	contentHashMismatchesCounter = metrics.NewRegisteredCounter("arb/feed/content-hash/mismatches", nil)
+	contentHashMissingCounter    = metrics.NewRegisteredCounter("arb/feed/content-hash/missing", nil)
+)
+
+var ErrContentHashMismatch = errors.New("feed message doesn't match its content hash")
+
+// verifyContentHash checks a message against the content hash set by the
+// broadcaster, catching messages corrupted in transit before their signature
+// is verified, which would be fatal. Messages from broadcasters that don't
+// hash them pass. Called from the reader thread or a decode worker.
+func (bc *BroadcastClient) verifyContentHash(message *broadcaster.BroadcastFeedMessage) error {
+	if len(message.ContentHash) == 0 {
+		contentHashMissingCounter.Inc(1)
+		return nil
+	}
+	hash, err := message.Hash(bc.chainId)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(hash.Bytes(), message.ContentHash) {
+		contentHashMismatchesCounter.Inc(1)
+		return fmt.Errorf("%w: sequence number %d", ErrContentHashMismatch, message.SequenceNumber)
+	}
+	return nil
+}
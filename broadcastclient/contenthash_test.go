@@ -0,0 +1,71 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/offchainlabs/nitro/arbos/arbostypes"
+	"github.com/offchainlabs/nitro/broadcaster"
+	"github.com/offchainlabs/nitro/util/signature"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+func TestBroadcastClientVerifiesContentHash(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	settings := wsbroadcastserver.DefaultTestBroadcasterConfig
+	settings.ContentHash = true
+	privateKey, err := crypto.GenerateKey()
+	Require(t, err)
+	sequencerAddr := crypto.PubkeyToAddress(privateKey.PublicKey)
+	dataSigner := signature.DataSignerFromPrivateKey(privateKey)
+
+	feedErrChan := make(chan error, 10)
+	chainId := uint64(8748)
+	b := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &settings }, chainId, feedErrChan, dataSigner)
+	Require(t, b.Initialize())
+	Require(t, b.Start(ctx))
+	defer b.StopAndWait()
+
+	config := DefaultTestConfig
+	config.Decode.VerifyContentHash = true
+	ts := NewDummyTransactionStreamer(chainId, nil)
+	broadcastClient, err := newTestBroadcastClient(config, b.ListenerAddr(), chainId, 0, ts, feedErrChan, &sequencerAddr)
+	Require(t, err)
+	broadcastClient.Start(ctx)
+	defer broadcastClient.StopAndWait()
+
+	Require(t, b.BroadcastSingle(arbostypes.EmptyTestMessageWithMetadata, 0))
+	timer := time.NewTimer(5 * time.Second)
+	defer timer.Stop()
+	select {
+	case err := <-feedErrChan:
+		t.Fatalf("Broadcaster error: %s", err.Error())
+	case <-ts.messageReceiver:
+	case <-timer.C:
+		t.Fatal("Client did not receive hashed message")
+	}
+
+	message, err := b.NewBroadcastFeedMessage(arbostypes.TestMessageWithMetadataAndRequestId, 1)
+	Require(t, err)
+	if err := broadcastClient.verifyContentHash(message); err != nil {
+		t.Fatalf("message without content hash rejected: %v", err)
+	}
+	hash, err := message.Hash(chainId)
+	Require(t, err)
+	message.ContentHash = hash.Bytes()
+	Require(t, broadcastClient.verifyContentHash(message))
+	message.Message.DelayedMessagesRead++
+	if err := broadcastClient.verifyContentHash(message); !errors.Is(err, ErrContentHashMismatch) {
+		t.Fatalf("expected corrupted message to fail content hash verification, got %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	errNoCoordinator   = errors.New("no sequencer coordinator to look the chosen sequencer's feed url up with")
+	errNoChosenFeedURL = errors.New("no sequencer chosen, or the chosen sequencer published no feed url")
+)
+
+// FeedCoordinator is the sequencer coordinator the sequencers publish their
+// feed URLs to
+type FeedCoordinator interface {
+	// ChosenFeedURL returns the feed URL of the chosen sequencer, empty if no
+	// sequencer is chosen or it published none
+	ChosenFeedURL(ctx context.Context) (string, error)
+}
+
+// SetCoordinator sets the sequencer coordinator to follow the chosen
+// sequencer's feed with if the coordinator discovery type is used. Must be
+// called before Start.
+func (bc *BroadcastClient) SetCoordinator(coordinator FeedCoordinator) {
+	bc.coordinator = coordinator
+}
+
+// coordinatorFeedURLs returns the feed URL of the chosen sequencer, so that a
+// change of leadership switches to the new sequencer's feed
+func (bc *BroadcastClient) coordinatorFeedURLs(ctx context.Context) ([]string, error) {
+	if bc.coordinator == nil {
+		return nil, errNoCoordinator
+	}
+	url, err := bc.coordinator.ChosenFeedURL(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if url == "" {
+		return nil, errNoChosenFeedURL
+	}
+	return []string{url}, nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type fakeFeedCoordinator struct {
+	url string
+	err error
+}
+
+func (c *fakeFeedCoordinator) ChosenFeedURL(ctx context.Context) (string, error) {
+	return c.url, c.err
+}
+
+func TestFeedCoordinatorDiscovery(t *testing.T) {
+	config := DefaultTestConfig
+	config.Discovery.Type = "coordinator"
+	config.Discovery.Record = "redis://coordinator:6379"
+	Require(t, config.Validate())
+	broadcastClient, err := NewBroadcastClient(func() *Config { return &config }, nil, 0, 0, nil, nil, nil, func(_ int32) {}, nil)
+	Require(t, err)
+	ctx := context.Background()
+
+	// Without a coordinator nothing can be discovered
+	broadcastClient.discover(ctx)
+	if broadcastClient.hasPendingURLs() {
+		t.Fatal("feed urls discovered without a coordinator")
+	}
+
+	coordinator := &fakeFeedCoordinator{url: "wss://sequencer-a.example.com/feed"}
+	broadcastClient.SetCoordinator(coordinator)
+	broadcastClient.discover(ctx)
+	if !reflect.DeepEqual(broadcastClient.pendingURLs, []string{coordinator.url}) {
+		t.Fatalf("expected the chosen sequencer's feed url, got %v", broadcastClient.pendingURLs)
+	}
+	broadcastClient.applyPendingURLs()
+
+	// Without a chosen sequencer, or while the coordinator is unreachable,
+	// the current feed is kept
+	coordinator.url = ""
+	broadcastClient.discover(ctx)
+	coordinator.url, coordinator.err = "wss://sequencer-b.example.com/feed", errors.New("connection refused")
+	broadcastClient.discover(ctx)
+	if broadcastClient.hasPendingURLs() || broadcastClient.currentURL() != "wss://sequencer-a.example.com/feed" {
+		t.Fatal("feed url changed without a chosen sequencer")
+	}
+
+	// A change of leadership switches feeds
+	coordinator.err = nil
+	broadcastClient.discover(ctx)
+	if !reflect.DeepEqual(broadcastClient.pendingURLs, []string{coordinator.url}) {
+		t.Fatalf("expected the new chosen sequencer's feed url, got %v", broadcastClient.pendingURLs)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/offchainlabs/nitro/broadcaster"
+)
+
+var delayedRegressionsCounter = metrics.NewRegisteredCounter("arb/feed/delayed/regressions", nil)
+
+// ErrDelayedMessagesRegressed is a feed message that read fewer delayed
+// messages than a message sequenced before it, which the transaction streamer
+// can't apply
+var ErrDelayedMessagesRegressed = errors.New("feed message delayed message count regressed")
+
+// checkDelayedMessagesRead returns the messages whose delayed message count
+// doesn't go below that of the messages delivered before them, and an error
+// wrapping ErrDelayedMessagesRegressed for those it dropped. A message at or
+// below the last checked sequence number starts over, as the feed reorged.
+// Only called from the delivery thread.
+func (bc *BroadcastClient) checkDelayedMessagesRead(messages []*broadcaster.BroadcastFeedMessage) ([]*broadcaster.BroadcastFeedMessage, error) {
+	var errs []error
+	valid := messages[:0:0]
+	for _, message := range messages {
+		delayedRead := message.Message.DelayedMessagesRead
+		if bc.delayedChecked && message.SequenceNumber > bc.delayedCheckedSeqNum && delayedRead < bc.delayedRead {
+			delayedRegressionsCounter.Inc(1)
+			log.Error(
+				"dropping feed message with regressed delayed message count",
+				"url", bc.statusURL(),
+				"sequenceNumber", message.SequenceNumber,
+				"delayedMessagesRead", delayedRead,
+				"previousSequenceNumber", bc.delayedCheckedSeqNum,
+				"previousDelayedMessagesRead", bc.delayedRead,
+			)
+			errs = append(errs, fmt.Errorf("%w: message %d read %d delayed messages, message %d read %d", ErrDelayedMessagesRegressed, message.SequenceNumber, delayedRead, bc.delayedCheckedSeqNum, bc.delayedRead))
+			continue
+		}
+		bc.delayedChecked = true
+		bc.delayedCheckedSeqNum = message.SequenceNumber
+		bc.delayedRead = delayedRead
+		valid = append(valid, message)
+	}
+	return valid, errors.Join(errs...)
+}
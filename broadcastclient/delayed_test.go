@@ -0,0 +1,52 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/offchainlabs/nitro/arbos/arbostypes"
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+)
+
+func TestCheckDelayedMessagesRead(t *testing.T) {
+	broadcastClient, err := NewBroadcastClientWithOptions("", WithConfig(func() *Config { return &DefaultTestConfig }))
+	Require(t, err)
+	message := func(seqNum arbutil.MessageIndex, delayedRead uint64) *broadcaster.BroadcastFeedMessage {
+		return &broadcaster.BroadcastFeedMessage{
+			SequenceNumber: seqNum,
+			Message:        arbostypes.MessageWithMetadata{DelayedMessagesRead: delayedRead},
+		}
+	}
+	seqNums := func(messages []*broadcaster.BroadcastFeedMessage) []arbutil.MessageIndex {
+		result := []arbutil.MessageIndex{}
+		for _, message := range messages {
+			result = append(result, message.SequenceNumber)
+		}
+		return result
+	}
+
+	valid, err := broadcastClient.checkDelayedMessagesRead([]*broadcaster.BroadcastFeedMessage{message(0, 1), message(1, 1), message(2, 2)})
+	Require(t, err)
+	if len(valid) != 3 {
+		t.Fatalf("expected all messages kept, got %v", seqNums(valid))
+	}
+	// The regression is caught across batches too
+	valid, err = broadcastClient.checkDelayedMessagesRead([]*broadcaster.BroadcastFeedMessage{message(3, 1), message(4, 2), message(5, 3)})
+	if !errors.Is(err, ErrDelayedMessagesRegressed) {
+		t.Fatalf("expected delayed message count regression, got %v", err)
+	}
+	if !reflect.DeepEqual(seqNums(valid), []arbutil.MessageIndex{4, 5}) {
+		t.Fatalf("expected only the regressed message dropped, kept %v", seqNums(valid))
+	}
+	// A reorg starts over
+	valid, err = broadcastClient.checkDelayedMessagesRead([]*broadcaster.BroadcastFeedMessage{message(2, 1)})
+	Require(t, err)
+	if len(valid) != 1 {
+		t.Fatal("reorged message dropped")
+	}
+}
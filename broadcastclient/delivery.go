@@ -0,0 +1,168 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	flag "github.com/spf13/pflag"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+)
+
+// DELIVERY_QUEUE_SIZE is the number of feed frames the reader can get ahead of
+// the handlers before it blocks
+const DELIVERY_QUEUE_SIZE = 64
+
+var coalescedFramesCounter = metrics.NewRegisteredCounter("arb/feed/delivery/coalesced", nil)
+
+// DeliveryConfig controls how messages read from the feed are handed on
+type DeliveryConfig struct {
+	HoldOnGap         bool          `koanf:"hold-on-gap" reload:"hot"`
+	ReorderBufferSize int           `koanf:"reorder-buffer-size" reload:"hot"`
+	BatchSize         int           `koanf:"batch-size" reload:"hot"`
+	MessageRate       float64       `koanf:"message-rate" reload:"hot"`
+	ByteRate          int64         `koanf:"byte-rate" reload:"hot"`
+	MaxMessageAge     time.Duration `koanf:"max-message-age" reload:"hot"`
+}
+
+func DeliveryConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Bool(prefix+".hold-on-gap", DefaultDeliveryConfig.HoldOnGap, "hold back messages received after a gap in sequence numbers and request the missing messages from the feed, instead of forwarding them out of sequence")
+	f.Int(prefix+".reorder-buffer-size", DefaultDeliveryConfig.ReorderBufferSize, "maximum number of messages held back waiting for a sequence gap to be filled, after which they are forwarded out of sequence")
+	f.Int(prefix+".batch-size", DefaultDeliveryConfig.BatchSize, "maximum number of messages from consecutive feed frames merged into a single delivery when the client falls behind")
+	f.Float64(prefix+".message-rate", DefaultDeliveryConfig.MessageRate, "maximum number of feed messages per second handed to the transaction streamer, so that catching up after downtime doesn't starve block execution (0 = unlimited)")
+	f.Int64(prefix+".byte-rate", DefaultDeliveryConfig.ByteRate, "maximum number of bytes read from the feed per second whose messages are handed to the transaction streamer (0 = unlimited)")
+	f.Duration(prefix+".max-message-age", DefaultDeliveryConfig.MaxMessageAge, "drop feed messages whose timestamp is older than this, they are picked up from the parent chain instead (0 = disabled)")
+}
+
+var DefaultDeliveryConfig = DeliveryConfig{
+	HoldOnGap:         false,
+	ReorderBufferSize: 4096,
+	BatchSize:         1024,
+	MessageRate:       0,
+	ByteRate:          0,
+	MaxMessageAge:     0,
+}
+
+func (c *DeliveryConfig) Validate() error {
+	if c.MessageRate < 0 || c.ByteRate < 0 {
+		return errors.New("feed delivery rates must not be negative")
+	}
+	return nil
+}
+
+// deliveryBatch is what the reader decoded from a single feed frame
+type deliveryBatch struct {
+	// Trace context of the frame's batch span
+	ctx          context.Context
+	messages     []*broadcaster.BroadcastFeedMessage
+	confirmedSeq *arbutil.MessageIndex
+	// Number of feed frames merged into the batch, and their size
+	frames int64
+	bytes  int64
+}
+
+// queueDelivery hands a frame over to the delivery thread, blocking while the
+// handlers are behind. Returns false if the context was cancelled first.
+func (bc *BroadcastClient) queueDelivery(ctx context.Context, batch deliveryBatch) bool {
+	select {
+	case bc.deliveryChan <- batch:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// startDelivery launches the thread passing queued frames on to the handlers.
+// Consecutive queued frames are merged into a single delivery of up to
+// Delivery.BatchSize messages, so a client that fell behind catches up in
+// fewer, larger writes, unless the deliveries are throttled.
+func (bc *BroadcastClient) startDelivery() {
+	bc.launchThread("delivery", func(ctx context.Context) {
+		// A frame that didn't fit into the previous delivery
+		var carry *deliveryBatch
+		var throttle deliveryThrottle
+		for {
+			var batch deliveryBatch
+			if carry != nil {
+				batch = *carry
+				carry = nil
+			} else {
+				select {
+				case <-ctx.Done():
+					return
+				case batch = <-bc.deliveryChan:
+				}
+			}
+			batch, carry = bc.coalesce(batch)
+			if len(batch.messages) > 0 && !throttle.wait(ctx, bc.config(), &batch) {
+				return
+			}
+			bc.deliver(batch)
+		}
+	})
+}
+
+// coalesce merges the frames already queued behind batch into it, stopping at
+// the first confirmation so that confirmations stay ordered after the
+// messages received before them. Returns the merged batch and the next frame
+// if it didn't fit.
+func (bc *BroadcastClient) coalesce(batch deliveryBatch) (deliveryBatch, *deliveryBatch) {
+	maxSize := bc.config().Delivery.BatchSize
+	for batch.confirmedSeq == nil && len(batch.messages) < maxSize {
+		var next deliveryBatch
+		select {
+		case next = <-bc.deliveryChan:
+		default:
+			return batch, nil
+		}
+		if len(batch.messages)+len(next.messages) > maxSize {
+			return batch, &next
+		}
+		merged := make([]*broadcaster.BroadcastFeedMessage, 0, len(batch.messages)+len(next.messages))
+		merged = append(merged, batch.messages...)
+		batch.messages = append(merged, next.messages...)
+		batch.confirmedSeq = next.confirmedSeq
+		batch.frames += next.frames
+		batch.bytes += next.bytes
+		coalescedFramesCounter.Inc(1)
+	}
+	return batch, nil
+}
+
+func (bc *BroadcastClient) deliver(batch deliveryBatch) {
+	defer bc.framesDone(batch.frames)
+	if len(batch.messages) > 0 {
+		var err error
+		batch.messages, err = bc.checkDelayedMessagesRead(batch.messages)
+		if err != nil {
+			bc.reportError(DecodeError, err)
+		}
+	}
+	if len(batch.messages) > 0 {
+		_, addSpan := tracer.Start(batch.ctx, "feed.add-messages")
+		setBatchAttributes(addSpan, batch.messages)
+		buffered, err := bc.deliverMessages(batch.messages)
+		endSpanWithError(addSpan, err)
+		bc.publishMessages(batch.messages)
+		if err != nil {
+			bc.reportError(SinkError, err)
+			log.Error("Error adding message from Sequencer Feed", "err", err)
+		} else {
+			messagesLatency(batch.messages, deliverLatencyHistogram)
+			if !buffered {
+				bc.saveCheckpoint(batch.messages[len(batch.messages)-1].SequenceNumber)
+			}
+		}
+	}
+	if batch.confirmedSeq != nil {
+		bc.deliverConfirmedSeq(*batch.confirmedSeq)
+	}
+}
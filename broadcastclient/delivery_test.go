@@ -0,0 +1,60 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"testing"
+
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+)
+
+func TestDeliveryCoalescesQueuedFrames(t *testing.T) {
+	config := DefaultTestConfig
+	config.Delivery.BatchSize = 3
+	broadcastClient, err := NewBroadcastClient(func() *Config { return &config }, nil, 0, 0, nil, nil, nil, func(_ int32) {}, nil)
+	Require(t, err)
+	frame := func(seqNums ...arbutil.MessageIndex) deliveryBatch {
+		batch := deliveryBatch{ctx: context.Background()}
+		for _, seqNum := range seqNums {
+			batch.messages = append(batch.messages, &broadcaster.BroadcastFeedMessage{SequenceNumber: seqNum})
+		}
+		return batch
+	}
+	checkMessages := func(batch deliveryBatch, expected ...arbutil.MessageIndex) {
+		t.Helper()
+		if len(batch.messages) != len(expected) {
+			t.Fatalf("expected %d messages, got %d", len(expected), len(batch.messages))
+		}
+		for i, message := range batch.messages {
+			if message.SequenceNumber != expected[i] {
+				t.Fatalf("expected sequence number %d at position %d, got %d", expected[i], i, message.SequenceNumber)
+			}
+		}
+	}
+
+	confirmed := frame(3)
+	confirmedSeq := arbutil.MessageIndex(2)
+	confirmed.confirmedSeq = &confirmedSeq
+	for _, queued := range []deliveryBatch{frame(1), frame(2, 3), confirmed, frame(4)} {
+		broadcastClient.deliveryChan <- queued
+	}
+
+	// The second frame doesn't fit within the batch size
+	merged, carry := broadcastClient.coalesce(frame(0))
+	checkMessages(merged, 0, 1)
+	if carry == nil {
+		t.Fatal("expected the frame exceeding the batch size to be carried over")
+	}
+	checkMessages(*carry, 2, 3)
+	// Merging stops at a confirmation, which keeps its place after the messages
+	merged, carry = broadcastClient.coalesce(frame())
+	checkMessages(merged, 3)
+	if carry != nil || merged.confirmedSeq == nil || *merged.confirmedSeq != 2 {
+		t.Fatalf("expected merging to stop at the confirmation, got %v", merged.confirmedSeq)
+	}
+	merged, _ = broadcastClient.coalesce(<-broadcastClient.deliveryChan)
+	checkMessages(merged, 4)
+}
@@ -0,0 +1,98 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+// Address families to connect to the feed over
+const (
+	IPFamilyAny  = "any"
+	IPFamilyIPv4 = "ipv4"
+	IPFamilyIPv6 = "ipv6"
+)
+
+// DialConfig controls how the connection to the feed is opened
+type DialConfig struct {
+	Timeout                time.Duration `koanf:"timeout" reload:"hot"`
+	HandshakeTimeout       time.Duration `koanf:"handshake-timeout" reload:"hot"`
+	Proxy                  string        `koanf:"proxy" reload:"hot"`
+	IPFamily               string        `koanf:"ip-family" reload:"hot"`
+	DualStackFallbackDelay time.Duration `koanf:"dual-stack-fallback-delay" reload:"hot"`
+}
+
+func DialConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Duration(prefix+".timeout", DefaultDialConfig.Timeout, "duration to wait for the network connection to the sequencer feed to open")
+	f.Duration(prefix+".handshake-timeout", DefaultDialConfig.HandshakeTimeout, "duration to wait for the TLS and websocket handshakes with the sequencer feed to complete once the network connection is open")
+	f.String(prefix+".proxy", DefaultDialConfig.Proxy, "URL of an HTTP or SOCKS5 proxy to connect to the feed through (e.g. http://host:3128 or socks5://host:1080), defaults to the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables")
+	f.String(prefix+".ip-family", DefaultDialConfig.IPFamily, "address family to connect to the feed directly over, \""+IPFamilyAny+"\" to race IPv4 and IPv6 when the host has both, or \""+IPFamilyIPv4+"\" or \""+IPFamilyIPv6+"\" to force one")
+	f.Duration(prefix+".dual-stack-fallback-delay", DefaultDialConfig.DualStackFallbackDelay, "duration to wait on the preferred address family of a dual-stack feed host before racing the other (negative = try the other only once the first failed)")
+}
+
+var DefaultDialConfig = DialConfig{
+	Timeout:                10 * time.Second,
+	HandshakeTimeout:       10 * time.Second,
+	Proxy:                  "",
+	IPFamily:               IPFamilyAny,
+	DualStackFallbackDelay: 300 * time.Millisecond,
+}
+
+var DefaultTestDialConfig = DialConfig{
+	Timeout:                time.Second,
+	HandshakeTimeout:       time.Second,
+	Proxy:                  "",
+	IPFamily:               IPFamilyAny,
+	DualStackFallbackDelay: 300 * time.Millisecond,
+}
+
+func (c *DialConfig) Validate() error {
+	switch c.IPFamily {
+	case IPFamilyAny, IPFamilyIPv4, IPFamilyIPv6:
+	default:
+		return fmt.Errorf("invalid feed ip family %q, must be %q, %q or %q", c.IPFamily, IPFamilyAny, IPFamilyIPv4, IPFamilyIPv6)
+	}
+	return nil
+}
+
+// directNetDial connects to the feed host directly over the configured address
+// family. For a host with both A and AAAA records the dialer races the
+// families, starting the other one Dial.DualStackFallbackDelay after the
+// preferred one, and takes whichever connects first.
+func directNetDial(config *Config) NetDialFunc {
+	dialer := &net.Dialer{
+		Timeout:       config.Dial.Timeout,
+		FallbackDelay: config.Dial.DualStackFallbackDelay,
+	}
+	family := config.Dial.IPFamily
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if network == "tcp" {
+			switch family {
+			case IPFamilyIPv4:
+				network = "tcp4"
+			case IPFamilyIPv6:
+				network = "tcp6"
+			}
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+}
+
+// DialerFactory returns the function to open the network connection to the
+// given feed URL with, e.g. to resolve or pin addresses differently, to use
+// another transport or to stand in for the network in tests. Returning a nil
+// function falls back to the default, which connects directly or through the
+// configured proxy.
+type DialerFactory func(url string) (NetDialFunc, error)
+
+// SetDialerFactory replaces how connections to the feed are opened, it must be
+// called before Start
+func (bc *BroadcastClient) SetDialerFactory(factory DialerFactory) {
+	bc.dialerFactory = factory
+}
@@ -0,0 +1,148 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/offchainlabs/nitro/arbos/arbostypes"
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+func TestBroadcastClientDialerFactory(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	settings := wsbroadcastserver.DefaultTestBroadcasterConfig
+	feedErrChan := make(chan error, 10)
+	chainId := uint64(8742)
+	b := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &settings }, chainId, feedErrChan, nil)
+	Require(t, b.Initialize())
+	Require(t, b.Start(ctx))
+	defer b.StopAndWait()
+
+	// The feed host doesn't resolve, the dialer factory pins it to the broadcaster
+	port := b.ListenerAddr().(*net.TCPAddr).Port
+	feedURL := fmt.Sprintf("ws://feed.invalid:%d/", port)
+	dialed := make(chan string, 10)
+	config := DefaultTestConfig
+	config.Verify.Dangerous.AcceptMissing = true
+	broadcastClient, err := NewBroadcastClient(func() *Config { return &config }, []string{feedURL}, chainId, 0, nil, feedErrChan, nil, func(_ int32) {}, nil)
+	Require(t, err)
+	broadcastClient.SetDialerFactory(func(url string) (NetDialFunc, error) {
+		return func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dialed <- addr
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, fmt.Sprintf("127.0.0.1:%d", port))
+		}, nil
+	})
+	handler := &recordingHandler{make(chan arbutil.MessageIndex, 1), make(chan arbutil.MessageIndex, 1)}
+	broadcastClient.AddHandler(handler)
+	broadcastClient.Start(ctx)
+	defer broadcastClient.StopAndWait()
+
+	for b.ClientCount() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	Require(t, b.BroadcastSingle(arbostypes.EmptyTestMessageWithMetadata, 0))
+	select {
+	case <-handler.messages:
+	case err := <-feedErrChan:
+		t.Fatalf("feed error: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("client did not receive the message through the custom dialer")
+	}
+	if addr := <-dialed; addr != fmt.Sprintf("feed.invalid:%d", port) {
+		t.Fatalf("custom dialer called with %s", addr)
+	}
+}
+
+func TestBroadcastClientLoopback(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	settings := wsbroadcastserver.DefaultTestBroadcasterConfig
+	feedErrChan := make(chan error, 10)
+	chainId := uint64(8742)
+	b := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &settings }, chainId, feedErrChan, nil)
+	Require(t, b.Initialize())
+	if _, err := b.DialLoopback(ctx, "tcp", "loopback:80"); err == nil {
+		t.Fatal("dialed a broadcaster that isn't started")
+	}
+	Require(t, b.Start(ctx))
+	defer b.StopAndWait()
+
+	// Sent before the client connects, so it arrives as catchup
+	Require(t, b.BroadcastSingle(arbostypes.EmptyTestMessageWithMetadata, 0))
+
+	config := DefaultTestConfig
+	config.Verify.Dangerous.AcceptMissing = true
+	handler := &recordingHandler{make(chan arbutil.MessageIndex, 10), make(chan arbutil.MessageIndex, 10)}
+	broadcastClient, err := NewBroadcastClientWithOptions(
+		LoopbackURL,
+		WithConfig(func() *Config { return &config }),
+		WithChainId(chainId),
+		WithHandler(handler),
+		WithFatalErrChan(feedErrChan),
+		WithLoopback(b),
+	)
+	Require(t, err)
+	broadcastClient.Start(ctx)
+	defer broadcastClient.StopAndWait()
+
+	expect := func(ch chan arbutil.MessageIndex, want arbutil.MessageIndex, what string) {
+		t.Helper()
+		select {
+		case got := <-ch:
+			if got != want {
+				t.Fatalf("expected %s %d, got %d", what, want, got)
+			}
+		case err := <-feedErrChan:
+			t.Fatalf("feed error: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s %d not received over loopback", what, want)
+		}
+	}
+	expect(handler.messages, 0, "message")
+	Require(t, b.BroadcastSingle(arbostypes.EmptyTestMessageWithMetadata, 1))
+	expect(handler.messages, 1, "message")
+	b.Confirm(1)
+	expect(handler.confirmed, 1, "confirmation")
+}
+
+func TestDirectNetDialIPFamily(t *testing.T) {
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	Require(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	for family, valid := range map[string]bool{IPFamilyAny: true, IPFamilyIPv4: true, IPFamilyIPv6: false} {
+		config := DefaultTestConfig
+		config.Dial.IPFamily = family
+		conn, err := directNetDial(&config)(context.Background(), "tcp", listener.Addr().String())
+		if valid {
+			Require(t, err)
+			_ = conn.Close()
+		} else if err == nil {
+			_ = conn.Close()
+			t.Fatalf("expected dialing an IPv4 address over %s to fail", family)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	flag "github.com/spf13/pflag"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+var (
+	discoveryFailuresCounter = metrics.NewRegisteredCounter("arb/feed/discovery/failures", nil)
+	discoveryURLsGauge       = metrics.NewRegisteredGauge("arb/feed/discovery/urls", nil)
+)
+
+var errNoDiscoveredURLs = errors.New("no sequencer feed urls discovered yet")
+
+// DiscoveryConfig configures looking up the feed URLs in DNS, a registry
+// contract or the sequencer coordinator, so that relays can be rotated without
+// changing the config of every node
+type DiscoveryConfig struct {
+	Record   string        `koanf:"record"`
+	Type     string        `koanf:"type"`
+	Scheme   string        `koanf:"scheme"`
+	Interval time.Duration `koanf:"interval"`
+}
+
+func DiscoveryConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.String(prefix+".record", DefaultDiscoveryConfig.Record, "DNS name, registry contract address or sequencer coordinator redis URL to look the feed URLs up at, the discovered URLs replace the configured ones and are failed over between (empty = disabled)")
+	f.String(prefix+".type", DefaultDiscoveryConfig.Type, "where the feed URLs are looked up, either srv for a DNS SRV record of relay hosts, txt for DNS TXT records of feed URLs, registry for a parent chain registry contract of feed URLs signed by an allowed feed signer, or coordinator for the feed URL published by the sequencer chosen by the sequencer coordinator, switching feeds when another sequencer is chosen")
+	f.String(prefix+".scheme", DefaultDiscoveryConfig.Scheme, "URL scheme to connect to the hosts of a SRV record with")
+	f.Duration(prefix+".interval", DefaultDiscoveryConfig.Interval, "interval to look the feed URLs up again at")
+}
+
+var DefaultDiscoveryConfig = DiscoveryConfig{
+	Record:   "",
+	Type:     "srv",
+	Scheme:   "wss",
+	Interval: 5 * time.Minute,
+}
+
+func (c *DiscoveryConfig) Enable() bool {
+	return c.Record != ""
+}
+
+func (c *DiscoveryConfig) Validate() error {
+	if !c.Enable() {
+		return nil
+	}
+	switch c.Type {
+	case "srv", "txt", "coordinator":
+	case "registry":
+		if !common.IsHexAddress(c.Record) {
+			return fmt.Errorf("invalid feed registry contract address %q", c.Record)
+		}
+	default:
+		return fmt.Errorf("invalid feed discovery record type %q, must be srv, txt, registry or coordinator", c.Type)
+	}
+	if c.Interval <= 0 {
+		return errors.New("feed discovery interval must be positive")
+	}
+	return nil
+}
+
+// feedResolver is the part of net.Resolver used for discovery
+type feedResolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// Replaced in tests
+var discoveryResolver feedResolver = net.DefaultResolver
+
+// resolveFeedURLs looks the feed URLs up in DNS. SRV records are returned in
+// priority order, TXT records may hold several whitespace separated URLs.
+func (c *DiscoveryConfig) resolveFeedURLs(ctx context.Context) ([]string, error) {
+	var urls []string
+	switch c.Type {
+	case "srv":
+		_, records, err := discoveryResolver.LookupSRV(ctx, "", "", c.Record)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			host := strings.TrimSuffix(record.Target, ".")
+			urls = append(urls, c.Scheme+"://"+net.JoinHostPort(host, strconv.Itoa(int(record.Port))))
+		}
+	case "txt":
+		records, err := discoveryResolver.LookupTXT(ctx, c.Record)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			urls = append(urls, strings.Fields(record)...)
+		}
+	default:
+		return nil, fmt.Errorf("invalid feed discovery record type %q", c.Type)
+	}
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no feed urls found in %s record %s", c.Type, c.Record)
+	}
+	return urls, nil
+}
+
+// sameURLSet tells whether two lists hold the same URLs, ignoring order as the
+// order of SRV records with the same priority is randomized on every lookup
+func sameURLSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sortedA := append([]string{}, a...)
+	sortedB := append([]string{}, b...)
+	sort.Strings(sortedA)
+	sort.Strings(sortedB)
+	for i := range sortedA {
+		if sortedA[i] != sortedB[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// discover looks the feed URLs up and switches to them if they changed. Run
+// by the discovery thread, failed lookups keep the current URLs.
+func (bc *BroadcastClient) discover(ctx context.Context) time.Duration {
+	config := bc.config().Discovery
+	var urls []string
+	var err error
+	switch config.Type {
+	case "registry":
+		urls, err = bc.registryFeedURLs(ctx)
+	case "coordinator":
+		urls, err = bc.coordinatorFeedURLs(ctx)
+	default:
+		urls, err = config.resolveFeedURLs(ctx)
+	}
+	if err != nil {
+		discoveryFailuresCounter.Inc(1)
+		log.Warn("error discovering sequencer feed urls", "record", config.Record, "type", config.Type, "err", err)
+		return config.Interval
+	}
+	discoveryURLsGauge.Update(int64(len(urls)))
+	if !sameURLSet(urls, bc.discoveredURLs) {
+		log.Info("discovered sequencer feed urls", "record", config.Record, "urls", urls)
+		bc.discoveredURLs = urls
+		bc.SetURLs(urls)
+	}
+	return config.Interval
+}
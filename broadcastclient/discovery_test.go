@@ -0,0 +1,74 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+)
+
+type fakeResolver struct {
+	srv []*net.SRV
+	txt []string
+	err error
+}
+
+func (r *fakeResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	return "", r.srv, r.err
+}
+
+func (r *fakeResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	return r.txt, r.err
+}
+
+func TestFeedURLDiscovery(t *testing.T) {
+	resolver := &fakeResolver{
+		srv: []*net.SRV{
+			{Target: "relay-a.example.com.", Port: 9642},
+			{Target: "relay-b.example.com.", Port: 9642},
+		},
+		txt: []string{"wss://relay-a.example.com wss://relay-b.example.com", "ws://10.0.0.1:9642"},
+	}
+	defaultResolver := discoveryResolver
+	discoveryResolver = resolver
+	defer func() { discoveryResolver = defaultResolver }()
+
+	config := DefaultTestConfig
+	config.Discovery.Record = "_feed._tcp.example.com"
+	broadcastClient, err := NewBroadcastClient(func() *Config { return &config }, nil, 0, 0, nil, nil, nil, func(_ int32) {}, nil)
+	Require(t, err)
+	ctx := context.Background()
+
+	broadcastClient.discover(ctx)
+	expected := []string{"wss://relay-a.example.com:9642", "wss://relay-b.example.com:9642"}
+	if !reflect.DeepEqual(broadcastClient.pendingURLs, expected) {
+		t.Fatalf("expected discovered urls %v, got %v", expected, broadcastClient.pendingURLs)
+	}
+	broadcastClient.applyPendingURLs()
+
+	// The order of SRV records with the same priority changes between lookups
+	resolver.srv[0], resolver.srv[1] = resolver.srv[1], resolver.srv[0]
+	broadcastClient.discover(ctx)
+	if broadcastClient.hasPendingURLs() {
+		t.Fatal("reordered SRV records switched feed urls")
+	}
+
+	// Failed lookups keep the current urls
+	resolver.err = errors.New("lookup failed")
+	broadcastClient.discover(ctx)
+	if broadcastClient.hasPendingURLs() || broadcastClient.currentURL() != expected[0] {
+		t.Fatal("failed lookup changed feed urls")
+	}
+
+	resolver.err = nil
+	config.Discovery.Type = "txt"
+	broadcastClient.discover(ctx)
+	expected = []string{"wss://relay-a.example.com", "wss://relay-b.example.com", "ws://10.0.0.1:9642"}
+	if !reflect.DeepEqual(broadcastClient.pendingURLs, expected) {
+		t.Fatalf("expected discovered urls %v, got %v", expected, broadcastClient.pendingURLs)
+	}
+}
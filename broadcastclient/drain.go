@@ -0,0 +1,62 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+const drainPollInterval = 10 * time.Millisecond
+
+var drainTimeoutsCounter = metrics.NewRegisteredCounter("arb/feed/drain/timeouts", nil)
+
+// startReading marks the feed as being read, called before the connection
+// threads are launched so that a drain can't miss frames they are about to read
+func (bc *BroadcastClient) startReading() {
+	atomic.AddInt64(&bc.undelivered, 1)
+}
+
+// doneReading is called once the connection threads stopped reading the feed
+func (bc *BroadcastClient) doneReading() {
+	atomic.AddInt64(&bc.undelivered, -1)
+}
+
+// frameRead is called by the reader for every frame it read
+func (bc *BroadcastClient) frameRead() {
+	atomic.AddInt64(&bc.undelivered, 1)
+}
+
+// framesDone is called once frames were forwarded or dropped
+func (bc *BroadcastClient) framesDone(frames int64) {
+	atomic.AddInt64(&bc.undelivered, -frames)
+}
+
+// drain waits for the frames already read from the feed to be forwarded to the
+// handlers, giving up after Stop.DrainTimeout. Reading must have been stopped
+// first.
+func (bc *BroadcastClient) drain() {
+	timeout := bc.config().Stop.DrainTimeout
+	if timeout <= 0 || atomic.LoadInt64(&bc.undelivered) == 0 {
+		return
+	}
+	deadline := time.Now().Add(timeout)
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		undelivered := atomic.LoadInt64(&bc.undelivered)
+		if undelivered == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			drainTimeoutsCounter.Inc(1)
+			log.Warn("timed out forwarding messages read from the sequencer feed before shutting down", "timeout", timeout, "frames", undelivered)
+			return
+		}
+		<-ticker.C
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/offchainlabs/nitro/arbos/arbostypes"
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+func TestBroadcastClientDrainsOnStop(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	config := wsbroadcastserver.DefaultTestBroadcasterConfig
+	feedErrChan := make(chan error, 10)
+	chainId := uint64(8742)
+	b := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &config }, chainId, feedErrChan, nil)
+	Require(t, b.Initialize())
+	Require(t, b.Start(ctx))
+	defer b.StopAndWait()
+
+	clientConfig := DefaultTestConfig
+	clientConfig.Verify.Dangerous.AcceptMissing = true
+	clientConfig.Stop.DrainTimeout = 5 * time.Second
+	broadcastClient, err := newTestBroadcastClient(clientConfig, b.ListenerAddr(), chainId, 0, nil, feedErrChan, nil)
+	Require(t, err)
+	// The handler blocks until its messages are received below
+	handler := &recordingHandler{make(chan arbutil.MessageIndex), make(chan arbutil.MessageIndex, 1)}
+	broadcastClient.AddHandler(handler)
+	broadcastClient.Start(ctx)
+
+	for b.ClientCount() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	messageCount := 5
+	for i := 0; i < messageCount; i++ {
+		Require(t, b.BroadcastSingle(arbostypes.EmptyTestMessageWithMetadata, arbutil.MessageIndex(i)))
+	}
+	for broadcastClient.resumeSeqNum() != arbutil.MessageIndex(messageCount) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		broadcastClient.StopAndWait()
+		close(stopped)
+	}()
+	for !broadcastClient.isShuttingDown() {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Messages read before stopping are still forwarded
+	for i := 0; i < messageCount; i++ {
+		select {
+		case seqNum := <-handler.messages:
+			if seqNum != arbutil.MessageIndex(i) {
+				t.Fatalf("received sequence number %d, expected %d", seqNum, i)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("stopping client delivered %d messages, expected %d", i, messageCount)
+		}
+	}
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("client did not stop after draining")
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// EndpointConfig overrides the connection settings for a single feed URL.
+// Endpoints are configured as a JSON list, fields left out keep the settings
+// that apply to all feed URLs.
+type EndpointConfig struct {
+	URL           string     `json:"url"`
+	Timeout       string     `json:"timeout,omitempty"`
+	PreferTLS     *bool      `json:"prefer-tls,omitempty"`
+	RequireTLS    *bool      `json:"require-tls,omitempty"`
+	TLS           *TLSConfig `json:"tls,omitempty"`
+	AuthToken     string     `json:"auth-token,omitempty"`
+	AuthTokenFile string     `json:"auth-token-file,omitempty"`
+	// Sent in addition to the extra headers configured for all feed URLs
+	ExtraHeaders []string `json:"extra-headers,omitempty"`
+	// When failing over, URLs with a lower priority are tried first
+	Priority int `json:"priority,omitempty"`
+}
+
+// ParseEndpoints decodes the JSON list of per-URL settings
+func ParseEndpoints(endpoints string) ([]EndpointConfig, error) {
+	if endpoints == "" {
+		return nil, nil
+	}
+	var parsed []EndpointConfig
+	if err := json.Unmarshal([]byte(endpoints), &parsed); err != nil {
+		return nil, fmt.Errorf("invalid feed endpoints: %w", err)
+	}
+	return parsed, nil
+}
+
+// endpointConfigs returns the config to connect to each URL with an endpoint
+// configured, with the endpoint's settings applied
+func (c *Config) endpointConfigs() (map[string]*Config, error) {
+	endpoints, err := ParseEndpoints(c.Endpoints)
+	if err != nil {
+		return nil, err
+	}
+	configs := make(map[string]*Config, len(endpoints))
+	for _, endpoint := range endpoints {
+		if endpoint.URL == "" {
+			return nil, errors.New("feed endpoint missing url")
+		}
+		if _, found := configs[endpoint.URL]; found {
+			return nil, fmt.Errorf("feed endpoint %q configured more than once", endpoint.URL)
+		}
+		config := *c
+		if endpoint.Timeout != "" {
+			config.Timeout, err = time.ParseDuration(endpoint.Timeout)
+			if err != nil {
+				return nil, fmt.Errorf("invalid timeout for feed endpoint %q: %w", endpoint.URL, err)
+			}
+		}
+		if endpoint.PreferTLS != nil {
+			config.PreferTLS = *endpoint.PreferTLS
+		}
+		if endpoint.RequireTLS != nil {
+			config.RequireTLS = *endpoint.RequireTLS
+		}
+		if endpoint.TLS != nil {
+			if err := endpoint.TLS.Validate(); err != nil {
+				return nil, fmt.Errorf("invalid tls config for feed endpoint %q: %w", endpoint.URL, err)
+			}
+			config.TLS = *endpoint.TLS
+		}
+		if endpoint.AuthToken != "" || endpoint.AuthTokenFile != "" {
+			config.Handshake.AuthToken = endpoint.AuthToken
+			config.Handshake.AuthTokenFile = endpoint.AuthTokenFile
+		}
+		if len(endpoint.ExtraHeaders) > 0 {
+			if _, err := parseExtraHeaders(endpoint.ExtraHeaders); err != nil {
+				return nil, fmt.Errorf("invalid extra headers for feed endpoint %q: %w", endpoint.URL, err)
+			}
+			config.Handshake.ExtraHeaders = append(append([]string{}, c.Handshake.ExtraHeaders...), endpoint.ExtraHeaders...)
+		}
+		configs[endpoint.URL] = &config
+	}
+	return configs, nil
+}
+
+// urlConfig returns the config to connect to url with, which is config unless
+// an endpoint is configured for url. Rebuilt whenever the config is reloaded.
+func (bc *BroadcastClient) urlConfig(config *Config, url string) *Config {
+	bc.endpointsMutex.Lock()
+	defer bc.endpointsMutex.Unlock()
+	if config != bc.endpointsSource {
+		endpoints, err := config.endpointConfigs()
+		if err != nil {
+			// Already rejected by Validate unless the config was built in code
+			log.Error("ignoring invalid sequencer feed endpoints", "err", err)
+		}
+		bc.endpoints = endpoints
+		bc.endpointsSource = config
+	}
+	if endpointConfig, found := bc.endpoints[url]; found {
+		return endpointConfig
+	}
+	return config
+}
+
+// sortByPriority orders the feed URLs by their endpoint priority, URLs with
+// the same priority keep their order
+func (c *Config) sortByPriority(urls []*feedURL) {
+	endpoints, err := ParseEndpoints(c.Endpoints)
+	if err != nil || len(endpoints) == 0 {
+		return
+	}
+	priorities := make(map[string]int, len(endpoints))
+	for _, endpoint := range endpoints {
+		priorities[endpoint.URL] = endpoint.Priority
+	}
+	sort.SliceStable(urls, func(i, j int) bool {
+		return priorities[urls[i].url] < priorities[urls[j].url]
+	})
+}
@@ -0,0 +1,52 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEndpointOverrides(t *testing.T) {
+	config := DefaultTestConfig
+	config.URL = []string{"ws://primary:9642", "ws://backup:9642", "ws://other:9642"}
+	config.Handshake.AuthToken = "shared"
+	config.Endpoints = `[
+		{"url": "ws://backup:9642", "timeout": "30s", "auth-token": "backup", "priority": -1, "extra-headers": ["X-Gateway-Route: backup, eu"]},
+		{"url": "ws://primary:9642", "require-tls": false}
+	]`
+	Require(t, config.Validate())
+
+	broadcastClient, err := NewBroadcastClientWithOptions(config.URL[0], WithConfig(func() *Config { return &config }), WithFallbackURLs(config.URL[1:]...))
+	Require(t, err)
+	if url := broadcastClient.currentURL(); url != "ws://backup:9642" {
+		t.Fatalf("expected the lowest priority url first, got %s", url)
+	}
+	backup := broadcastClient.urlConfig(&config, "ws://backup:9642")
+	if backup.Timeout != 30*time.Second {
+		t.Fatalf("endpoint timeout not applied, got %v", backup.Timeout)
+	}
+	header, err := backup.handshakeHeader(0)
+	Require(t, err)
+	if header.Get("Authorization") != "Bearer backup" {
+		t.Fatalf("endpoint auth token not applied, got %q", header.Get("Authorization"))
+	}
+	if header.Get("X-Gateway-Route") != "backup, eu" {
+		t.Fatalf("endpoint extra header not applied, got %q", header.Get("X-Gateway-Route"))
+	}
+	if other := broadcastClient.urlConfig(&config, "ws://other:9642"); other != &config {
+		t.Fatal("url without an endpoint should use the shared config")
+	}
+
+	config.RequireTLS = true
+	if err := config.Validate(); !errors.Is(err, ErrPlaintextFeed) {
+		t.Fatalf("expected plaintext backup url to be rejected, got %v", err)
+	}
+	config.RequireTLS = false
+	config.Endpoints = `[{"url": "ws://backup:9642", "timeout": "soon"}]`
+	if err := config.Validate(); err == nil {
+		t.Fatal("expected invalid endpoint timeout to be rejected")
+	}
+}
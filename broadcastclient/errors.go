@@ -0,0 +1,157 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+const ERROR_CHAN_SIZE = 64
+
+// Errors of each category, a FeedError matches the one of its category with
+// errors.Is. ErrIdleTimeout is also wrapped into the error of a connection
+// that was closed because nothing was read from the feed for the read timeout.
+var (
+	ErrDialFailed      = errors.New("failed to connect to sequencer feed")
+	ErrHandshakeFailed = errors.New("sequencer feed handshake failed")
+	ErrConnectionLost  = errors.New("sequencer feed connection lost")
+	ErrIdleTimeout     = errors.New("sequencer feed connection timed out without receiving data")
+	ErrDecode          = errors.New("invalid sequencer feed message")
+	ErrSinkFailed      = errors.New("failed to forward sequencer feed messages")
+)
+
+// ErrorCategory tells which stage of reading the feed an error occurred in
+type ErrorCategory int
+
+const (
+	// DialError is a failure to establish a connection to the feed
+	DialError ErrorCategory = iota
+	// HandshakeError is a feed that was reached but rejected during the handshake,
+	// e.g. because of a chain id or version mismatch
+	HandshakeError
+	// ConnectionError is an established connection that was lost
+	ConnectionError
+	// DecodeError is a message from the feed that could not be decoded
+	DecodeError
+	// SinkError is a failure to hand messages over to the transaction streamer
+	SinkError
+)
+
+func (c ErrorCategory) String() string {
+	switch c {
+	case DialError:
+		return "dial"
+	case HandshakeError:
+		return "handshake"
+	case ConnectionError:
+		return "connection"
+	case DecodeError:
+		return "decode"
+	case SinkError:
+		return "sink"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(c))
+	}
+}
+
+// FeedError is an error the broadcast client encountered and recovered from
+type FeedError struct {
+	Category ErrorCategory
+	URL      string
+	Time     time.Time
+	Err      error
+}
+
+func (e *FeedError) Error() string {
+	return fmt.Sprintf("%s error on feed %s: %v", e.Category, e.URL, e.Err)
+}
+
+func (e *FeedError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the error of the category, e.g. errors.Is(err, ErrDecode)
+func (e *FeedError) Is(target error) bool {
+	return target != nil && target == e.Category.err()
+}
+
+func (c ErrorCategory) err() error {
+	switch c {
+	case DialError:
+		return ErrDialFailed
+	case HandshakeError:
+		return ErrHandshakeFailed
+	case ConnectionError:
+		return ErrConnectionLost
+	case DecodeError:
+		return ErrDecode
+	case SinkError:
+		return ErrSinkFailed
+	default:
+		return nil
+	}
+}
+
+// readError wraps ErrIdleTimeout into an error reading the feed if the read
+// deadline expired, or the connection was closed by checkIdle
+func readError(err error, idleClosed bool) error {
+	var netErr net.Error
+	if idleClosed || errors.Is(err, os.ErrDeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return fmt.Errorf("%w: %w", ErrIdleTimeout, err)
+	}
+	return err
+}
+
+// connectErrorCategory tells handshake rejections apart from failures to reach the feed
+func connectErrorCategory(err error) ErrorCategory {
+	if errors.Is(err, ErrMissingChainId) ||
+		errors.Is(err, ErrIncorrectChainId) ||
+		errors.Is(err, ErrMissingFeedServerVersion) ||
+		errors.Is(err, ErrIncorrectFeedServerVersion) ||
+		errors.Is(err, ErrIncompatibleFeedMessageVersion) {
+		return HandshakeError
+	}
+	return DialError
+}
+
+// Errors returns a channel of the errors encountered by the client. Errors are
+// dropped if the channel is not drained quickly enough, LastError and
+// ErrorCount are always kept up to date.
+func (bc *BroadcastClient) Errors() <-chan *FeedError {
+	return bc.errorChan
+}
+
+// LastError returns the most recent error encountered by the client, or nil
+func (bc *BroadcastClient) LastError() *FeedError {
+	return bc.lastError.Load()
+}
+
+// ErrorCount returns the number of errors encountered by the client
+func (bc *BroadcastClient) ErrorCount() int64 {
+	return atomic.LoadInt64(&bc.errorCount)
+}
+
+func (bc *BroadcastClient) reportError(category ErrorCategory, err error) {
+	feedErr := &FeedError{
+		Category: category,
+		URL:      bc.statusURL(),
+		Time:     time.Now(),
+		Err:      err,
+	}
+	bc.lastError.Store(feedErr)
+	atomic.AddInt64(&bc.errorCount, 1)
+	if category == DecodeError {
+		atomic.StoreInt64(&bc.lastDecodeErrorUnixNano, feedErr.Time.UnixNano())
+	}
+	bc.addRecentError(feedErr)
+	select {
+	case bc.errorChan <- feedErr:
+	default:
+	}
+}
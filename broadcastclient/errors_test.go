@@ -0,0 +1,45 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestFeedErrorTypes(t *testing.T) {
+	for category, expected := range map[ErrorCategory]error{
+		DialError:       ErrDialFailed,
+		HandshakeError:  ErrHandshakeFailed,
+		ConnectionError: ErrConnectionLost,
+		DecodeError:     ErrDecode,
+		SinkError:       ErrSinkFailed,
+	} {
+		var err error = &FeedError{Category: category, Err: io.EOF}
+		if !errors.Is(err, expected) || !errors.Is(err, io.EOF) {
+			t.Fatalf("%v error doesn't match %v", category, expected)
+		}
+		if category != DecodeError && errors.Is(err, ErrDecode) {
+			t.Fatalf("%v error matches ErrDecode", category)
+		}
+	}
+
+	client, server := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	Require(t, client.SetReadDeadline(time.Now()))
+	_, err := client.Read(make([]byte, 1))
+	if !errors.Is(readError(err, false), ErrIdleTimeout) {
+		t.Fatalf("expired read deadline not an idle timeout: %v", err)
+	}
+	if errors.Is(readError(io.EOF, false), ErrIdleTimeout) {
+		t.Fatal("EOF is an idle timeout")
+	}
+	if !errors.Is(readError(net.ErrClosed, true), ErrIdleTimeout) {
+		t.Fatal("connection closed for being idle not an idle timeout")
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gobwas/ws"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+var eventStreamFallbacksCounter = metrics.NewRegisteredCounter("arb/feed/event-stream/fallbacks", nil)
+
+// dialEventStream requests the feed at feedURL as server-sent events. Returns
+// the connection and the reader the events are read from.
+func dialEventStream(
+	ctx context.Context,
+	config *Config,
+	feedURL string,
+	netDial NetDialFunc,
+	tlsConfig *tls.Config,
+	header http.Header,
+	onHeader func(key, value []byte) error,
+) (net.Conn, *bufio.Reader, error) {
+	u, err := httpFeedURL(feedURL, wsbroadcastserver.EventStreamPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The body is read directly from the connection, the server doesn't
+	// chunk or otherwise frame it
+	conn, _, br, err := requestFeed(ctx, config, u, netDial, tlsConfig, header, "text/event-stream", onHeader)
+	return conn, br, err
+}
+
+// readEvent reads the next server-sent event from the feed and hands its data
+// to consume as a text frame. A comment, which the server sends to keep the
+// stream alive, is returned as a ping. Fails with ErrFrameTooLarge if the data
+// is longer than maxSize (0 = unlimited).
+func readEvent(conn net.Conn, br *bufio.Reader, timeout time.Duration, maxSize int64, consume frameConsumer) (ws.OpCode, error) {
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = conn.SetReadDeadline(time.Time{})
+	}()
+	var data []byte
+	for {
+		line, err := readEventLine(br, maxSize)
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case len(line) == 0:
+			if data == nil {
+				continue
+			}
+			return ws.OpText, consume(ws.OpText, bytes.NewReader(data))
+		case line[0] == ':':
+			if data == nil {
+				return ws.OpPing, nil
+			}
+		case bytes.HasPrefix(line, []byte("data:")):
+			value := bytes.TrimPrefix(line[len("data:"):], []byte(" "))
+			if data != nil {
+				data = append(data, '\n')
+			}
+			if maxSize > 0 && int64(len(data)+len(value)) > maxSize {
+				return ws.OpText, fmt.Errorf("%w: more than %d bytes", ErrFrameTooLarge, maxSize)
+			}
+			data = append(data, value...)
+		default:
+			// The feed doesn't use event names, ids or retry hints
+			log.Trace("ignoring sequencer feed event field", "line", string(line))
+		}
+	}
+}
+
+// readEventLine reads a line of the event stream without its line ending
+func readEventLine(br *bufio.Reader, maxSize int64) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := br.ReadSlice('\n')
+		if err != nil && !errors.Is(err, bufio.ErrBufferFull) {
+			return nil, err
+		}
+		line = append(line, chunk...)
+		if maxSize > 0 && int64(len(line)) > maxSize+int64(len("data: \r\n")) {
+			return nil, fmt.Errorf("%w: more than %d bytes", ErrFrameTooLarge, maxSize)
+		}
+		if err == nil {
+			return bytes.TrimRight(line, "\r\n"), nil
+		}
+	}
+}
+
+// eventStreamTransport reads the feed as server-sent events
+type eventStreamTransport struct {
+	body *bufio.Reader
+}
+
+func (t *eventStreamTransport) readFrame(_ context.Context, conn net.Conn, config *Config, timeout time.Duration, consume frameConsumer) (ws.OpCode, bool, error) {
+	op, err := readEvent(conn, t.body, timeout, int64(config.Decode.MaxFrameSize), consume)
+	return op, false, err
+}
+
+func (t *eventStreamTransport) readOnly() bool { return true }
+
+func (t *eventStreamTransport) name() string { return "event-stream" }
@@ -0,0 +1,86 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/offchainlabs/nitro/arbos/arbostypes"
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+// stripUpgradeConn stands in for a proxy that strips websocket upgrades
+type stripUpgradeConn struct {
+	net.Conn
+}
+
+func (c stripUpgradeConn) Write(p []byte) (int, error) {
+	return c.Conn.Write(bytes.Replace(p, []byte("Upgrade: websocket\r\n"), []byte("X-Stripped: websocket\r\n"), 1))
+}
+
+func TestBroadcastClientEventStreamFallback(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	settings := wsbroadcastserver.DefaultTestBroadcasterConfig
+	feedErrChan := make(chan error, 10)
+	chainId := uint64(8742)
+	b := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &settings }, chainId, feedErrChan, nil)
+	Require(t, b.Initialize())
+	Require(t, b.Start(ctx))
+	defer b.StopAndWait()
+	for i := 0; i < 3; i++ {
+		Require(t, b.BroadcastSingle(arbostypes.EmptyTestMessageWithMetadata, arbutil.MessageIndex(i)))
+	}
+
+	config := DefaultTestConfig
+	config.Transport.EventStreamFallback = true
+	config.Verify.Dangerous.AcceptMissing = true
+	broadcastClient, err := NewBroadcastClient(func() *Config { return &config }, []string{"ws://" + b.ListenerAddr().String()}, chainId, 0, nil, feedErrChan, nil, func(_ int32) {}, nil)
+	Require(t, err)
+	broadcastClient.SetDialerFactory(func(url string) (NetDialFunc, error) {
+		return func(ctx context.Context, network, addr string) (net.Conn, error) {
+			var dialer net.Dialer
+			conn, err := dialer.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return stripUpgradeConn{conn}, nil
+		}, nil
+	})
+	handler := &recordingHandler{make(chan arbutil.MessageIndex, 10), make(chan arbutil.MessageIndex, 1)}
+	broadcastClient.AddHandler(handler)
+	broadcastClient.Start(ctx)
+	defer broadcastClient.StopAndWait()
+
+	receive := func(expected arbutil.MessageIndex) {
+		t.Helper()
+		select {
+		case seqNum := <-handler.messages:
+			if seqNum != expected {
+				t.Fatalf("received sequence number %d, expected %d", seqNum, expected)
+			}
+		case err := <-feedErrChan:
+			t.Fatalf("feed error: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("sequence number %d was not received over the event stream", expected)
+		}
+	}
+	// Cached messages are sent on connect, later ones as they're broadcast
+	for expected := arbutil.MessageIndex(0); expected < 3; expected++ {
+		receive(expected)
+	}
+	if _, ok := broadcastClient.currentTransport().(*eventStreamTransport); !ok {
+		t.Fatal("client is not reading the feed as an event stream")
+	}
+	Require(t, b.BroadcastSingle(arbostypes.EmptyTestMessageWithMetadata, 3))
+	receive(3)
+}
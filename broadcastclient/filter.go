@@ -0,0 +1,105 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"fmt"
+
+	flag "github.com/spf13/pflag"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/offchainlabs/nitro/broadcaster"
+)
+
+var filteredMessagesCounter = metrics.NewRegisteredCounter("arb/feed/messages/filtered", nil)
+
+// MessageFilter returns whether a feed message is to be delivered. Messages
+// filtered out still advance the sequence number, they are just not handed to
+// the transaction streamer and handlers.
+type MessageFilter func(message *broadcaster.BroadcastFeedMessage) bool
+
+// FilterConfig restricts the feed messages delivered, for consumers like
+// watchtowers and analytics relays that only need some of the traffic. A node
+// must not filter the feed its transaction streamer follows.
+type FilterConfig struct {
+	Kinds   []int    `koanf:"kinds" reload:"hot"`
+	Senders []string `koanf:"senders" reload:"hot"`
+}
+
+func FilterConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.IntSlice(prefix+".kinds", DefaultFilterConfig.Kinds, "only deliver feed messages of these L1 message kinds (empty = all kinds)")
+	f.StringSlice(prefix+".senders", DefaultFilterConfig.Senders, "only deliver feed messages posted by these addresses (empty = all senders)")
+}
+
+var DefaultFilterConfig = FilterConfig{
+	Kinds:   []int{},
+	Senders: []string{},
+}
+
+func (c *FilterConfig) Validate() error {
+	for _, kind := range c.Kinds {
+		if kind < 0 || kind > 255 {
+			return fmt.Errorf("invalid feed filter message kind %d", kind)
+		}
+	}
+	for _, sender := range c.Senders {
+		if !common.IsHexAddress(sender) {
+			return fmt.Errorf("invalid feed filter sender address %q", sender)
+		}
+	}
+	return nil
+}
+
+// messageFilter builds the filter for the config, or returns nil if nothing is filtered
+func (c *FilterConfig) messageFilter() MessageFilter {
+	if len(c.Kinds) == 0 && len(c.Senders) == 0 {
+		return nil
+	}
+	kinds := make(map[uint8]bool, len(c.Kinds))
+	for _, kind := range c.Kinds {
+		kinds[uint8(kind)] = true
+	}
+	senders := make(map[common.Address]bool, len(c.Senders))
+	for _, sender := range c.Senders {
+		senders[common.HexToAddress(sender)] = true
+	}
+	return func(message *broadcaster.BroadcastFeedMessage) bool {
+		header := message.Message.Message
+		if header == nil || header.Header == nil {
+			return false
+		}
+		if len(kinds) > 0 && !kinds[header.Header.Kind] {
+			return false
+		}
+		if len(senders) > 0 && !senders[header.Header.Poster] {
+			return false
+		}
+		return true
+	}
+}
+
+// filterMessages drops the messages rejected by the configured filter or the
+// one passed to WithMessageFilter. Only called from the reader thread, or the
+// processing thread when decoding in workers.
+func (bc *BroadcastClient) filterMessages(messages []*broadcaster.BroadcastFeedMessage) []*broadcaster.BroadcastFeedMessage {
+	config := bc.config()
+	if config != bc.configFilterSource {
+		bc.configFilter = config.Filter.messageFilter()
+		bc.configFilterSource = config
+	}
+	if bc.configFilter == nil && bc.filter == nil {
+		return messages
+	}
+	kept := messages[:0]
+	for _, message := range messages {
+		if (bc.configFilter != nil && !bc.configFilter(message)) || (bc.filter != nil && !bc.filter(message)) {
+			filteredMessagesCounter.Inc(1)
+			continue
+		}
+		kept = append(kept, message)
+	}
+	return kept
+}
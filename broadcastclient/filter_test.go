@@ -0,0 +1,76 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/offchainlabs/nitro/arbos/arbostypes"
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+)
+
+func TestMessageFilter(t *testing.T) {
+	sender := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+	message := func(seqNum arbutil.MessageIndex, kind uint8, poster common.Address) *broadcaster.BroadcastFeedMessage {
+		return &broadcaster.BroadcastFeedMessage{
+			SequenceNumber: seqNum,
+			Message: arbostypes.MessageWithMetadata{
+				Message: &arbostypes.L1IncomingMessage{
+					Header: &arbostypes.L1IncomingMessageHeader{Kind: kind, Poster: poster},
+				},
+			},
+		}
+	}
+	messages := func() []*broadcaster.BroadcastFeedMessage {
+		return []*broadcaster.BroadcastFeedMessage{
+			message(0, arbostypes.L1MessageType_L2Message, sender),
+			message(1, arbostypes.L1MessageType_EndOfBlock, sender),
+			message(2, arbostypes.L1MessageType_L2Message, common.Address{}),
+		}
+	}
+	seqNums := func(messages []*broadcaster.BroadcastFeedMessage) []arbutil.MessageIndex {
+		result := []arbutil.MessageIndex{}
+		for _, message := range messages {
+			result = append(result, message.SequenceNumber)
+		}
+		return result
+	}
+
+	config := DefaultTestConfig
+	broadcastClient, err := NewBroadcastClientWithOptions("", WithConfig(func() *Config { return &config }))
+	Require(t, err)
+	if got := seqNums(broadcastClient.filterMessages(messages())); !reflect.DeepEqual(got, []arbutil.MessageIndex{0, 1, 2}) {
+		t.Fatalf("unfiltered client delivered %v", got)
+	}
+
+	// Reloading the config changes the filter
+	reloaded := DefaultTestConfig
+	reloaded.Filter.Kinds = []int{int(arbostypes.L1MessageType_L2Message)}
+	broadcastClient.config = func() *Config { return &reloaded }
+	if got := seqNums(broadcastClient.filterMessages(messages())); !reflect.DeepEqual(got, []arbutil.MessageIndex{0, 2}) {
+		t.Fatalf("kind filter delivered %v", got)
+	}
+
+	// The filter option applies on top of the config
+	broadcastClient, err = NewBroadcastClientWithOptions("",
+		WithConfig(func() *Config { return &reloaded }),
+		WithMessageFilter(func(message *broadcaster.BroadcastFeedMessage) bool {
+			return message.Message.Message.Header.Poster == sender
+		}),
+	)
+	Require(t, err)
+	if got := seqNums(broadcastClient.filterMessages(messages())); !reflect.DeepEqual(got, []arbutil.MessageIndex{0}) {
+		t.Fatalf("kind and sender filters delivered %v", got)
+	}
+
+	invalid := DefaultTestConfig
+	invalid.Filter.Senders = []string{"not an address"}
+	if err := invalid.Validate(); err == nil {
+		t.Fatal("expected invalid filter sender to be rejected")
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/gobwas/ws"
+
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/offchainlabs/nitro/broadcaster"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+var (
+	oversizedFramesCounter = metrics.NewRegisteredCounter("arb/feed/frames/oversized", nil)
+	bulkFramesCounter      = metrics.NewRegisteredCounter("arb/feed/frames/bulk", nil)
+)
+
+var ErrFrameTooLarge = errors.New("feed frame too large")
+
+// feedFrame is a data frame read from the feed. JSON frames and bulk catchup
+// frames are decoded while they are read if streaming is enabled, so large
+// catchup batches aren't held in memory twice.
+type feedFrame struct {
+	received bool
+	start    time.Time
+	// Size as read, bulk catchup frames are limited to maxSize decompressed
+	size    int64
+	maxSize int64
+	// The frame as read, unless it was decoded while reading. Backed by a
+	// pooled buffer until released.
+	data      []byte
+	buffer    *bytes.Buffer
+	streamed  *broadcaster.BroadcastMessage
+	streamErr error
+}
+
+// read consumes the frame payload. Only errors reading the connection and
+// ErrFrameTooLarge once more than maxSize bytes were read (0 = unlimited) are
+// returned, a frame that can't be decoded is reported by decode.
+func (f *feedFrame) read(op ws.OpCode, payload io.Reader, stream bool, maxSize int64) error {
+	f.received = true
+	f.start = time.Now()
+	f.maxSize = maxSize
+	counted := &countingReader{reader: payload, limit: maxSize}
+	defer func() { f.size = counted.count }()
+	if op == ws.OpText && stream {
+		f.streamed = &broadcaster.BroadcastMessage{}
+		f.streamErr = f.streamed.DecodeJSON(counted)
+		return counted.err
+	}
+	var data io.Reader = counted
+	if op == ws.OpBinary && stream {
+		peeked := bufio.NewReader(counted)
+		if magic, _ := peeked.Peek(2); wsbroadcastserver.IsBulkFrame(magic) {
+			f.streamed = &broadcaster.BroadcastMessage{}
+			f.streamErr = decodeBulk(peeked, maxSize, f.streamed)
+			if counted.err != nil {
+				return counted.err
+			}
+			if errors.Is(f.streamErr, ErrFrameTooLarge) {
+				return f.streamErr
+			}
+			return nil
+		}
+		data = peeked
+	}
+	f.buffer = wsbroadcastserver.GetBuffer()
+	_, err := f.buffer.ReadFrom(data)
+	f.data = f.buffer.Bytes()
+	return err
+}
+
+// release returns the frame buffer to the pool, the decoded message doesn't
+// reference it
+func (f *feedFrame) release() {
+	wsbroadcastserver.PutBuffer(f.buffer)
+	f.buffer = nil
+	f.data = nil
+}
+
+func (f *feedFrame) decode(op ws.OpCode) (broadcaster.BroadcastMessage, error) {
+	if f.streamed != nil {
+		return *f.streamed, f.streamErr
+	}
+	res := broadcaster.BroadcastMessage{}
+	var err error
+	if op == ws.OpBinary && wsbroadcastserver.IsBulkFrame(f.data) {
+		err = decodeBulk(bytes.NewReader(f.data), f.maxSize, &res)
+	} else if op == ws.OpBinary {
+		err = res.UnmarshalBinary(f.data)
+	} else {
+		err = json.Unmarshal(f.data, &res)
+	}
+	return res, err
+}
+
+// decodeBulk decompresses a bulk catchup frame and decodes the message inside,
+// which is JSON or RLP encoded like any other frame. More than maxSize
+// decompressed bytes (0 = unlimited) fail with ErrFrameTooLarge.
+func decodeBulk(r io.Reader, maxSize int64, m *broadcaster.BroadcastMessage) error {
+	bulkFramesCounter.Inc(1)
+	decompressor, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer decompressor.Close()
+	decompressed := &countingReader{reader: decompressor, limit: maxSize}
+	payload := bufio.NewReader(decompressed)
+	first, err := payload.Peek(1)
+	if err != nil {
+		return err
+	}
+	if first[0] == '{' {
+		err = m.DecodeJSON(payload)
+	} else {
+		var data []byte
+		data, err = io.ReadAll(payload)
+		if err == nil {
+			err = m.UnmarshalBinary(data)
+		}
+	}
+	if decompressed.err != nil {
+		return decompressed.err
+	}
+	return err
+}
+
+// countingReader counts the bytes read and remembers the first read error, to
+// tell connection failures apart from invalid data while decoding. Reading
+// past limit fails, the count is of decompressed bytes so that a small
+// compressed frame can't exhaust memory either.
+type countingReader struct {
+	reader io.Reader
+	limit  int64
+	count  int64
+	err    error
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if r.limit > 0 && int64(len(p)) > r.limit-r.count+1 {
+		// Read at most one byte past the limit, enough to tell it was exceeded
+		p = p[:r.limit-r.count+1]
+	}
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	if r.limit > 0 && r.count > r.limit {
+		err = fmt.Errorf("%w: more than %d bytes", ErrFrameTooLarge, r.limit)
+	}
+	if err != nil && !errors.Is(err, io.EOF) && r.err == nil {
+		r.err = err
+	}
+	return n, err
+}
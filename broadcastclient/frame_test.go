@@ -0,0 +1,129 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gobwas/ws"
+
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/offchainlabs/nitro/arbos/arbostypes"
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+	"github.com/offchainlabs/nitro/util/signature"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+func TestReceiveMessagesBinary(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	settings := wsbroadcastserver.DefaultTestBroadcasterConfig
+
+	privateKey, err := crypto.GenerateKey()
+	Require(t, err)
+	sequencerAddr := crypto.PubkeyToAddress(privateKey.PublicKey)
+	dataSigner := signature.DataSignerFromPrivateKey(privateKey)
+
+	feedErrChan := make(chan error, 10)
+	chainId := uint64(8748)
+	b := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &settings }, chainId, feedErrChan, dataSigner)
+
+	Require(t, b.Initialize())
+	Require(t, b.Start(ctx))
+	defer b.StopAndWait()
+
+	// Check the server agrees to the binary subprotocol
+	dialer := ws.Dialer{Protocols: []string{wsbroadcastserver.BinaryFeedSubprotocol}}
+	conn, _, handshake, err := dialer.Dial(ctx, fmt.Sprintf("ws://127.0.0.1:%d/", b.ListenerAddr().(*net.TCPAddr).Port))
+	Require(t, err)
+	Require(t, conn.Close())
+	if handshake.Protocol != wsbroadcastserver.BinaryFeedSubprotocol {
+		t.Fatalf("expected binary subprotocol to be negotiated, got %q", handshake.Protocol)
+	}
+
+	for i, compression := range []bool{false, true} {
+		config := DefaultTestConfig
+		config.Transport.Binary = true
+		config.EnableCompression = compression
+		ts := NewDummyTransactionStreamer(chainId, nil)
+		broadcastClient, err := newTestBroadcastClient(config, b.ListenerAddr(), chainId, arbutil.MessageIndex(i), ts, feedErrChan, &sequencerAddr)
+		Require(t, err)
+		broadcastClient.Start(ctx)
+
+		Require(t, b.BroadcastSingle(arbostypes.EmptyTestMessageWithMetadata, arbutil.MessageIndex(i)))
+
+		timer := time.NewTimer(5 * time.Second)
+		select {
+		case err := <-feedErrChan:
+			t.Fatalf("Broadcaster error: %s", err.Error())
+		case <-ts.messageReceiver:
+		case <-timer.C:
+			t.Fatalf("Client did not receive binary encoded message, compression %v", compression)
+		}
+		timer.Stop()
+		broadcastClient.StopAndWait()
+	}
+}
+
+type failingReader struct {
+	data []byte
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, errors.New("connection reset")
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestFeedFrameStreamDecode(t *testing.T) {
+	valid := `{"version":1,"messages":[{"sequenceNumber":7,"message":{"message":null,"delayedMessagesRead":0},"signature":null}]}`
+	for _, stream := range []bool{true, false} {
+		var frame feedFrame
+		Require(t, frame.read(ws.OpText, strings.NewReader(valid), stream, 0))
+		res, err := frame.decode(ws.OpText)
+		Require(t, err)
+		if len(res.Messages) != 1 || res.Messages[0].SequenceNumber != 7 || frame.size != int64(len(valid)) {
+			t.Fatalf("unexpected frame decoded with stream=%v: %+v size %d", stream, res, frame.size)
+		}
+		if stream != (frame.data == nil) {
+			t.Fatalf("frame held in memory with stream=%v", stream)
+		}
+	}
+
+	// Invalid data is a decode error, the connection is fine
+	var frame feedFrame
+	Require(t, frame.read(ws.OpText, strings.NewReader(`{"version":"one"}`), true, 0))
+	if _, err := frame.decode(ws.OpText); err == nil {
+		t.Fatal("expected decode error")
+	}
+
+	// A connection failing while decoding ends the connection
+	frame = feedFrame{}
+	if err := frame.read(ws.OpText, &failingReader{[]byte(valid[:20])}, true, 0); err == nil {
+		t.Fatal("expected connection error")
+	}
+
+	// Frames above the maximum size are rejected whether decoded while reading or not
+	for _, stream := range []bool{true, false} {
+		frame = feedFrame{}
+		Require(t, frame.read(ws.OpText, strings.NewReader(valid), stream, int64(len(valid))))
+		frame = feedFrame{}
+		if err := frame.read(ws.OpText, strings.NewReader(valid), stream, int64(len(valid)-1)); !errors.Is(err, ErrFrameTooLarge) {
+			t.Fatalf("expected oversized frame to be rejected with stream=%v, got %v", stream, err)
+		}
+	}
+}
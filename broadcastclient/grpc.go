@@ -0,0 +1,265 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gobwas/ws"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/wsbroadcastserver/feedpb"
+)
+
+const (
+	// grpcScheme is the scheme of feed URLs served as a plaintext gRPC stream
+	grpcScheme = "grpc"
+	// grpcTLSScheme is the scheme of feed URLs served as a gRPC stream over TLS
+	grpcTLSScheme = "grpcs"
+)
+
+var errGRPCConn = errors.New("gRPC feed connection is only read through its stream")
+
+// grpcFeedURL returns whether the feed at feedURL is served over gRPC
+func grpcFeedURL(feedURL string) bool {
+	u, err := url.Parse(feedURL)
+	return err == nil && (u.Scheme == grpcScheme || u.Scheme == grpcTLSScheme)
+}
+
+// grpcConn stands in for the network connection a feed is read over as a gRPC
+// stream, closing it ends the stream
+type grpcConn struct {
+	clientConn *grpc.ClientConn
+	cancel     context.CancelFunc
+	closeOnce  sync.Once
+
+	addrMutex sync.Mutex
+	local     net.Addr
+	remote    net.Addr
+}
+
+func (c *grpcConn) dialed(conn net.Conn) {
+	c.addrMutex.Lock()
+	defer c.addrMutex.Unlock()
+	c.local = conn.LocalAddr()
+	c.remote = conn.RemoteAddr()
+}
+
+func (c *grpcConn) Read([]byte) (int, error)  { return 0, errGRPCConn }
+func (c *grpcConn) Write([]byte) (int, error) { return 0, errGRPCConn }
+
+func (c *grpcConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		c.cancel()
+		err = c.clientConn.Close()
+	})
+	return err
+}
+
+func (c *grpcConn) LocalAddr() net.Addr {
+	c.addrMutex.Lock()
+	defer c.addrMutex.Unlock()
+	return c.local
+}
+
+func (c *grpcConn) RemoteAddr() net.Addr {
+	c.addrMutex.Lock()
+	defer c.addrMutex.Unlock()
+	return c.remote
+}
+
+// Reads are bounded by readFrame instead
+func (c *grpcConn) SetDeadline(time.Time) error      { return nil }
+func (c *grpcConn) SetReadDeadline(time.Time) error  { return nil }
+func (c *grpcConn) SetWriteDeadline(time.Time) error { return nil }
+
+// grpcTransport reads the feed from a gRPC stream, see feedpb.FeedClient
+type grpcTransport struct {
+	conn   *grpcConn
+	stream feedpb.Feed_SubscribeClient
+	// Set when a read timed out, the stream is cancelled then
+	timedOut int32
+}
+
+func (t *grpcTransport) readFrame(ctx context.Context, _ net.Conn, config *Config, timeout time.Duration, consume frameConsumer) (ws.OpCode, bool, error) {
+	// A stream can only be interrupted by cancelling it
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			t.conn.cancel()
+		case <-timer.C:
+			atomic.StoreInt32(&t.timedOut, 1)
+			t.conn.cancel()
+		}
+	}()
+	frame, err := t.stream.Recv()
+	if err != nil {
+		if atomic.LoadInt32(&t.timedOut) != 0 {
+			return 0, false, fmt.Errorf("%w: %v", os.ErrDeadlineExceeded, err)
+		}
+		if ctx.Err() != nil {
+			return 0, false, nil
+		}
+		if status.Code(err) == codes.ResourceExhausted {
+			return 0, false, fmt.Errorf("%w: %v", ErrFrameTooLarge, err)
+		}
+		return 0, false, err
+	}
+	if len(frame.Data) == 0 {
+		return ws.OpPing, false, nil
+	}
+	if config.Decode.MaxFrameSize > 0 && len(frame.Data) > config.Decode.MaxFrameSize {
+		return ws.OpText, false, fmt.Errorf("%w: more than %d bytes", ErrFrameTooLarge, config.Decode.MaxFrameSize)
+	}
+	return ws.OpText, false, consume(ws.OpText, bytes.NewReader(frame.Data))
+}
+
+// Catchup requests are sent as messages of the stream, not as frames
+func (t *grpcTransport) readOnly() bool { return true }
+
+func (t *grpcTransport) name() string { return "grpc" }
+
+func (t *grpcTransport) requestCatchup(requestedSeqNum arbutil.MessageIndex) error {
+	return t.stream.Send(&feedpb.CatchupRequest{RequestedSequenceNumber: uint64(requestedSeqNum)})
+}
+
+// dialGRPC subscribes to the feed served over gRPC at dialURL. The handshake
+// headers are sent as metadata, and the header metadata of the response is
+// checked with handshake.
+func (bc *BroadcastClient) dialGRPC(
+	ctx context.Context,
+	config *Config,
+	dialURL string,
+	httpHeader http.Header,
+	tlsConfig *tls.Config,
+	handshake *feedHandshake,
+) (net.Conn, feedTransport, error) {
+	u, err := url.Parse(dialURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	netDial, _, err := bc.feedNetDial(config, dialURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	if netDial == nil {
+		dialer := &net.Dialer{Timeout: config.Dial.Timeout}
+		netDial = dialer.DialContext
+	}
+	target := u.Host
+	var transportCredentials credentials.TransportCredentials
+	if u.Scheme == grpcTLSScheme {
+		transportCredentials = credentials.NewTLS(tlsConfig)
+		if u.Port() == "" {
+			target = net.JoinHostPort(u.Hostname(), "443")
+		}
+	} else {
+		transportCredentials = insecure.NewCredentials()
+		if u.Port() == "" {
+			target = net.JoinHostPort(u.Hostname(), "80")
+		}
+	}
+	maxMessageSize := math.MaxInt32
+	if config.Decode.MaxFrameSize > 0 && config.Decode.MaxFrameSize < math.MaxInt32-64 {
+		// Room for the protobuf framing, larger frames are rejected by
+		// readFrame with the usual error
+		maxMessageSize = config.Decode.MaxFrameSize + 64
+	}
+
+	if bc.isShuttingDown() {
+		return nil, nil, errShuttingDown
+	}
+
+	conn := &grpcConn{}
+	dialCtx, cancelDial := context.WithTimeout(ctx, config.Dial.Timeout+config.Dial.HandshakeTimeout)
+	defer cancelDial()
+	conn.clientConn, err = grpc.DialContext(
+		dialCtx,
+		target,
+		grpc.WithBlock(),
+		grpc.FailOnNonTempDialError(true),
+		grpc.WithReturnConnectionError(),
+		grpc.WithTransportCredentials(transportCredentials),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			netConn, err := netDial(ctx, "tcp", addr)
+			if err == nil {
+				conn.dialed(netConn)
+			}
+			return netConn, err
+		}),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(maxMessageSize)),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	md := metadata.MD{}
+	for key, values := range httpHeader {
+		md.Append(key, values...)
+	}
+	var streamCtx context.Context
+	streamCtx, conn.cancel = context.WithCancel(metadata.NewOutgoingContext(context.Background(), md))
+	stream, err := feedpb.NewFeedClient(conn.clientConn).Subscribe(streamCtx)
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, err
+	}
+
+	// The stream outlives the dial, only waiting for the response headers
+	// is bounded by it
+	headerRead := make(chan struct{})
+	watched := make(chan struct{})
+	go func() {
+		defer close(watched)
+		select {
+		case <-headerRead:
+		case <-dialCtx.Done():
+			conn.cancel()
+		}
+	}()
+	responseHeader, err := stream.Header()
+	close(headerRead)
+	<-watched
+	if err == nil && dialCtx.Err() != nil {
+		err = dialCtx.Err()
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, fmt.Errorf("feed refused gRPC stream: %w", err)
+	}
+	for key, values := range responseHeader {
+		name := textproto.CanonicalMIMEHeaderKey(key)
+		for _, value := range values {
+			if err := handshake.onHeader([]byte(name), []byte(value)); err != nil {
+				_ = conn.Close()
+				return nil, nil, err
+			}
+		}
+	}
+	return conn, &grpcTransport{conn: conn, stream: stream}, nil
+}
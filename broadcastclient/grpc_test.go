@@ -0,0 +1,72 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/offchainlabs/nitro/arbos/arbostypes"
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+func TestBroadcastClientOverGRPC(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	settings := wsbroadcastserver.DefaultTestBroadcasterConfig
+	settings.GRPC.Enable = true
+	feedErrChan := make(chan error, 10)
+	chainId := uint64(8742)
+	b := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &settings }, chainId, feedErrChan, nil)
+	Require(t, b.Initialize())
+	Require(t, b.Start(ctx))
+	defer b.StopAndWait()
+	for i := 0; i < 3; i++ {
+		Require(t, b.BroadcastSingle(arbostypes.EmptyTestMessageWithMetadata, arbutil.MessageIndex(i)))
+	}
+
+	config := DefaultTestConfig
+	config.Verify.Dangerous.AcceptMissing = true
+	config.URL = []string{"grpc://" + b.GRPCListenerAddr().String()}
+	Require(t, config.Validate())
+	broadcastClient, err := NewBroadcastClient(func() *Config { return &config }, config.URL, chainId, 0, nil, feedErrChan, nil, func(_ int32) {}, nil)
+	Require(t, err)
+	handler := &recordingHandler{make(chan arbutil.MessageIndex, 10), make(chan arbutil.MessageIndex, 1)}
+	broadcastClient.AddHandler(handler)
+	broadcastClient.Start(ctx)
+	defer broadcastClient.StopAndWait()
+
+	receive := func(expected arbutil.MessageIndex) {
+		t.Helper()
+		select {
+		case seqNum := <-handler.messages:
+			if seqNum != expected {
+				t.Fatalf("received sequence number %d, expected %d", seqNum, expected)
+			}
+		case err := <-feedErrChan:
+			t.Fatalf("feed error: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("sequence number %d was not received over gRPC", expected)
+		}
+	}
+	for expected := arbutil.MessageIndex(0); expected < 3; expected++ {
+		receive(expected)
+	}
+	if _, ok := broadcastClient.currentTransport().(*grpcTransport); !ok {
+		t.Fatal("client is not reading the feed over gRPC")
+	}
+	Require(t, b.BroadcastSingle(arbostypes.EmptyTestMessageWithMetadata, 3))
+	receive(3)
+
+	// Catchup requests are sent over the stream, the cached messages are
+	// resent and dropped as replays
+	broadcastClient.requestCatchup(&config, 0)
+	Require(t, b.BroadcastSingle(arbostypes.EmptyTestMessageWithMetadata, 4))
+	receive(4)
+}
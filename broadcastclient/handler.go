@@ -0,0 +1,82 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+)
+
+// BroadcastMessageHandler consumes what is read from the feed. Besides the
+// transaction streamer the client was constructed with and those added with
+// AddSink, any number of handlers can be registered, e.g. by indexers or
+// archivers. Handlers are called from the
+// delivery thread in registration order, so a slow handler delays the others.
+type BroadcastMessageHandler interface {
+	// HandleMessages receives validly signed feed messages in sequence
+	HandleMessages(messages []*broadcaster.BroadcastFeedMessage) error
+	// HandleConfirmedSeq receives the sequence numbers confirmed on the parent chain
+	HandleConfirmedSeq(seqNum arbutil.MessageIndex)
+}
+
+// txStreamerHandler adapts the transaction streamer passed to
+// NewBroadcastClient to a BroadcastMessageHandler
+type txStreamerHandler struct {
+	txStreamer TransactionStreamerInterface
+	config     ConfigFetcher
+
+	// Only accessed by the delivery thread
+	stuck *sinkCall
+
+	// Protects running and buffered, running is set while a call that may
+	// have timed out is in progress
+	mutex    sync.Mutex
+	running  bool
+	buffered []*broadcaster.BroadcastFeedMessage
+}
+
+func (h *txStreamerHandler) HandleConfirmedSeq(seqNum arbutil.MessageIndex) {}
+
+// AddHandler registers an additional consumer of the feed
+func (bc *BroadcastClient) AddHandler(handler BroadcastMessageHandler) {
+	bc.handlersMutex.Lock()
+	defer bc.handlersMutex.Unlock()
+	bc.handlers = append(bc.handlers, handler)
+}
+
+func (bc *BroadcastClient) currentHandlers() []BroadcastMessageHandler {
+	bc.handlersMutex.Lock()
+	defer bc.handlersMutex.Unlock()
+	return bc.handlers
+}
+
+// deliverMessages hands messages to every handler, a failing handler doesn't
+// keep the others from receiving them. Returns whether the messages were only
+// buffered for a stuck transaction streamer.
+func (bc *BroadcastClient) deliverMessages(messages []*broadcaster.BroadcastFeedMessage) (bool, error) {
+	var errs []error
+	buffered := false
+	for _, handler := range bc.currentHandlers() {
+		err := handler.HandleMessages(messages)
+		if errors.Is(err, errSinkBuffered) {
+			buffered = true
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return buffered, errors.Join(errs...)
+}
+
+func (bc *BroadcastClient) deliverConfirmedSeq(seqNum arbutil.MessageIndex) {
+	for _, handler := range bc.currentHandlers() {
+		handler.HandleConfirmedSeq(seqNum)
+	}
+	bc.publishConfirmedSeq(seqNum)
+	bc.pruneConfirmed(seqNum)
+}
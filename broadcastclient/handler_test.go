@@ -0,0 +1,143 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/offchainlabs/nitro/arbos/arbostypes"
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+type recordingHandler struct {
+	messages  chan arbutil.MessageIndex
+	confirmed chan arbutil.MessageIndex
+}
+
+func (h *recordingHandler) HandleMessages(messages []*broadcaster.BroadcastFeedMessage) error {
+	for _, message := range messages {
+		h.messages <- message.SequenceNumber
+	}
+	return nil
+}
+
+func (h *recordingHandler) HandleConfirmedSeq(seqNum arbutil.MessageIndex) {
+	h.confirmed <- seqNum
+}
+
+// blockingStreamer blocks the first call until release is closed, then fails it
+type blockingStreamer struct {
+	release chan struct{}
+	calls   int
+	added   []arbutil.MessageIndex
+}
+
+func (s *blockingStreamer) AddBroadcastMessages(messages []*broadcaster.BroadcastFeedMessage) error {
+	s.calls++
+	if s.calls == 1 {
+		<-s.release
+		return errors.New("streamer failed")
+	}
+	for _, message := range messages {
+		s.added = append(s.added, message.SequenceNumber)
+	}
+	return nil
+}
+
+func TestTxStreamerHandlerTimeout(t *testing.T) {
+	feedMessages := func(seqNums ...arbutil.MessageIndex) []*broadcaster.BroadcastFeedMessage {
+		messages := make([]*broadcaster.BroadcastFeedMessage, 0, len(seqNums))
+		for _, seqNum := range seqNums {
+			messages = append(messages, &broadcaster.BroadcastFeedMessage{SequenceNumber: seqNum})
+		}
+		return messages
+	}
+	for _, policy := range []string{SinkTimeoutPolicyBuffer, SinkTimeoutPolicyRetry} {
+		config := DefaultTestConfig
+		config.Sink.Timeout = 50 * time.Millisecond
+		config.Sink.TimeoutPolicy = policy
+		streamer := &blockingStreamer{release: make(chan struct{})}
+		handler := &txStreamerHandler{txStreamer: streamer, config: func() *Config { return &config }}
+
+		if err := handler.HandleMessages(feedMessages(0)); !errors.Is(err, ErrSinkTimeout) {
+			t.Fatalf("%s: expected sink timeout, got %v", policy, err)
+		}
+		var expected []arbutil.MessageIndex
+		if policy == SinkTimeoutPolicyBuffer {
+			// Buffered while the streamer is stuck and added once it returns
+			if err := handler.HandleMessages(feedMessages(1)); !errors.Is(err, errSinkBuffered) {
+				t.Fatalf("%s: expected messages to be buffered, got %v", policy, err)
+			}
+			close(streamer.release)
+			<-handler.stuck.done
+			expected = []arbutil.MessageIndex{1}
+		} else {
+			// Waits for the stuck call and retries the messages it failed to add
+			time.AfterFunc(100*time.Millisecond, func() { close(streamer.release) })
+			Require(t, handler.HandleMessages(feedMessages(1)))
+			expected = []arbutil.MessageIndex{0, 1}
+		}
+		Require(t, handler.HandleMessages(feedMessages(2)))
+		expected = append(expected, 2)
+		if !reflect.DeepEqual(streamer.added, expected) {
+			t.Fatalf("%s: streamer added %v, expected %v", policy, streamer.added, expected)
+		}
+	}
+}
+
+func TestBroadcastClientHandlers(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	config := wsbroadcastserver.DefaultTestBroadcasterConfig
+	feedErrChan := make(chan error, 10)
+	chainId := uint64(8742)
+	b := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &config }, chainId, feedErrChan, nil)
+	Require(t, b.Initialize())
+	Require(t, b.Start(ctx))
+	defer b.StopAndWait()
+
+	clientConfig := DefaultTestConfig
+	clientConfig.Verify.Dangerous.AcceptMissing = true
+	broadcastClient, err := newTestBroadcastClient(clientConfig, b.ListenerAddr(), chainId, 0, nil, feedErrChan, nil)
+	Require(t, err)
+	// Consumers other than the transaction streamer
+	handlers := []*recordingHandler{
+		{make(chan arbutil.MessageIndex, 1), make(chan arbutil.MessageIndex, 1)},
+		{make(chan arbutil.MessageIndex, 1), make(chan arbutil.MessageIndex, 1)},
+	}
+	for _, handler := range handlers {
+		broadcastClient.AddHandler(handler)
+	}
+	broadcastClient.Start(ctx)
+	defer broadcastClient.StopAndWait()
+
+	// Confirming removes the message from the catchup buffer, so wait for the client first
+	for b.ClientCount() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	Require(t, b.BroadcastSingle(arbostypes.EmptyTestMessageWithMetadata, 0))
+	b.Confirm(0)
+	for i, handler := range handlers {
+		for _, received := range []chan arbutil.MessageIndex{handler.messages, handler.confirmed} {
+			select {
+			case seqNum := <-received:
+				if seqNum != 0 {
+					t.Fatalf("handler %d received sequence number %d, expected 0", i, seqNum)
+				}
+			case err := <-feedErrChan:
+				t.Fatalf("feed error: %v", err)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("handler %d did not receive the message", i)
+			}
+		}
+	}
+}
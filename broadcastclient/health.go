@@ -0,0 +1,86 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+// HealthPath is where the status server answers readiness probes, with 200 if
+// the feed is healthy and 503 otherwise
+const HealthPath = "/health"
+
+var ErrFeedUnhealthy = errors.New("sequencer feed unhealthy")
+
+// HealthConfig sets when the feed is considered unhealthy, so that load
+// balancers can stop routing to a node whose feed is dead
+type HealthConfig struct {
+	MaxLag            time.Duration `koanf:"max-lag" reload:"hot"`
+	MaxLagMessages    uint64        `koanf:"max-lag-messages" reload:"hot"`
+	DecodeErrorWindow time.Duration `koanf:"decode-error-window" reload:"hot"`
+}
+
+func HealthConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Duration(prefix+".max-lag", DefaultHealthConfig.MaxLag, "time since the newest feed message was broadcast above which the feed is unhealthy, this includes quiet periods without messages (0 = disabled)")
+	f.Uint64(prefix+".max-lag-messages", DefaultHealthConfig.MaxLagMessages, "number of messages the chain head may be ahead of the feed before it is unhealthy (0 = disabled)")
+	f.Duration(prefix+".decode-error-window", DefaultHealthConfig.DecodeErrorWindow, "duration after failing to decode a feed message during which the feed is unhealthy (0 = disabled)")
+}
+
+var DefaultHealthConfig = HealthConfig{
+	MaxLag:            0,
+	MaxLagMessages:    0,
+	DecodeErrorWindow: time.Minute,
+}
+
+// Healthy returns nil if the client is connected to the feed, isn't lagging
+// beyond the health thresholds and has decoded everything it read recently.
+// Otherwise it returns an error wrapping ErrFeedUnhealthy saying why. It
+// doesn't block, ctx is only checked for cancellation.
+func (bc *BroadcastClient) Healthy(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	config := bc.config().Health
+	status := bc.Status()
+	if status.State != Connected {
+		return fmt.Errorf("%w: feed %s is %s", ErrFeedUnhealthy, status.URL, status.State)
+	}
+	lag := bc.lag()
+	if config.MaxLag > 0 && lag.Time > config.MaxLag {
+		return fmt.Errorf("%w: feed %s lags %v behind", ErrFeedUnhealthy, status.URL, lag.Time)
+	}
+	if config.MaxLagMessages > 0 && lag.Messages > config.MaxLagMessages {
+		return fmt.Errorf("%w: feed %s lags %d messages behind", ErrFeedUnhealthy, status.URL, lag.Messages)
+	}
+	if config.DecodeErrorWindow > 0 {
+		if last := atomic.LoadInt64(&bc.lastDecodeErrorUnixNano); last != 0 {
+			if since := time.Since(time.Unix(0, last)); since < config.DecodeErrorWindow {
+				return fmt.Errorf("%w: feed %s sent an undecodable message %v ago", ErrFeedUnhealthy, status.URL, since.Round(time.Millisecond))
+			}
+		}
+	}
+	return nil
+}
+
+// HealthHandler answers readiness probes with the result of healthy
+func HealthHandler(healthy func(ctx context.Context) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		if err := healthy(r.Context()); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = fmt.Fprintln(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprintln(w, "ok")
+	})
+}
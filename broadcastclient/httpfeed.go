@@ -0,0 +1,175 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gobwas/ws"
+)
+
+// upgradeRefused is whether dialing the feed failed because the websocket
+// upgrade was answered with something else, e.g. by a proxy stripping the
+// upgrade headers
+func upgradeRefused(err error) bool {
+	var statusErr ws.StatusError
+	return errors.As(err, &statusErr) ||
+		errors.Is(err, ws.ErrHandshakeBadUpgrade) ||
+		errors.Is(err, ws.ErrHandshakeBadConnection)
+}
+
+// httpFeedURL returns the URL of path on the feed at feedURL, which is reached
+// over plain HTTP
+func httpFeedURL(feedURL string, path string) (*url.URL, error) {
+	u, err := url.Parse(feedURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	default:
+		return nil, fmt.Errorf("no plain HTTP feed for url scheme %q", u.Scheme)
+	}
+	u.Path = path
+	return u, nil
+}
+
+// requestFeed sends a plain HTTP request for the feed to u and reads the
+// response headers, which are checked with onHeader like those of the
+// websocket upgrade. The request is bounded by ctx. Returns the connection,
+// the response and the reader the response was read from.
+func requestFeed(
+	ctx context.Context,
+	config *Config,
+	u *url.URL,
+	netDial NetDialFunc,
+	tlsConfig *tls.Config,
+	header http.Header,
+	contentType string,
+	onHeader func(key, value []byte) error,
+) (net.Conn, *http.Response, *bufio.Reader, error) {
+	addr := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+	if netDial == nil {
+		dialer := net.Dialer{Timeout: config.Dial.Timeout}
+		netDial = dialer.DialContext
+	}
+	conn, err := netDial(ctx, "tcp", addr)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	// Unblock the request if ctx is cancelled before its deadline
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-done:
+		}
+	}()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			_ = conn.Close()
+			return nil, nil, nil, err
+		}
+	}
+	if u.Scheme == "https" {
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		} else {
+			tlsConfig = tlsConfig.Clone()
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = u.Hostname()
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, nil, nil, err
+		}
+		conn = tlsConn
+	}
+
+	resp, br, err := readFeedResponse(conn, u, header, contentType, onHeader)
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, nil, err
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		_ = conn.Close()
+		return nil, nil, nil, err
+	}
+	if ctx.Err() != nil {
+		_ = conn.Close()
+		return nil, nil, nil, ctx.Err()
+	}
+	return conn, resp, br, nil
+}
+
+func readFeedResponse(conn net.Conn, u *url.URL, header http.Header, contentType string, onHeader func(key, value []byte) error) (*http.Response, *bufio.Reader, error) {
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        u,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     header.Clone(),
+		Host:       u.Host,
+	}
+	req.Header.Set("Accept", contentType)
+	req.Header.Set("Cache-Control", "no-cache")
+	if err := req.Write(conn); err != nil {
+		return nil, nil, fmt.Errorf("error sending feed request: %w", err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading feed response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, nil, fmt.Errorf("feed request for %s failed: %s", u.Path, resp.Status)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != contentType {
+		_ = resp.Body.Close()
+		return nil, nil, fmt.Errorf("feed response for %s has unexpected content type %q", u.Path, resp.Header.Get("Content-Type"))
+	}
+	for name, values := range resp.Header {
+		for _, value := range values {
+			if err := onHeader([]byte(name), []byte(value)); err != nil {
+				_ = resp.Body.Close()
+				return nil, nil, err
+			}
+		}
+	}
+	return resp, br, nil
+}
+
+// readOnly is whether the feed is read over plain HTTP, as an event stream or
+// by long polling, over gRPC or replayed from a recording, which leaves
+// nothing to send on the connection
+func (bc *BroadcastClient) readOnly() bool {
+	bc.connMutex.Lock()
+	defer bc.connMutex.Unlock()
+	return bc.transport != nil && bc.transport.readOnly()
+}
@@ -0,0 +1,120 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/offchainlabs/nitro/arbos/arbostypes"
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+)
+
+// INBOX_VERIFIER_WINDOW is the number of feed messages remembered while waiting
+// for their batch to be posted to the parent chain
+const INBOX_VERIFIER_WINDOW = 65536
+
+var (
+	inboxVerifiedCounter    = metrics.NewRegisteredCounter("arb/feed/inbox/verified", nil)
+	inboxDivergencesCounter = metrics.NewRegisteredCounter("arb/feed/inbox/divergences", nil)
+)
+
+// DivergenceFunc is called with the sequence number of a message read from the
+// parent chain inbox that differs from what the feed delivered for it
+type DivergenceFunc func(seqNum arbutil.MessageIndex, feedHash common.Hash, inboxHash common.Hash)
+
+// InboxVerifier remembers the messages received from the feed and compares
+// them to the messages read from the parent chain inbox once their batch is
+// posted, to detect a misbehaving or compromised sequencer or relay.
+type InboxVerifier struct {
+	chainId uint64
+
+	mutex        sync.Mutex
+	hashes       map[arbutil.MessageIndex]common.Hash
+	lowest       arbutil.MessageIndex
+	onDivergence DivergenceFunc
+}
+
+func NewInboxVerifier(chainId uint64) *InboxVerifier {
+	return &InboxVerifier{
+		chainId: chainId,
+		hashes:  make(map[arbutil.MessageIndex]common.Hash),
+	}
+}
+
+// OnDivergence sets the function to call when a divergence is found
+func (v *InboxVerifier) OnDivergence(onDivergence DivergenceFunc) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.onDivergence = onDivergence
+}
+
+// inboxVerifierHash hashes a message the way both sources agree on. The batch
+// gas cost is only known once the batch is posted, so it is left out.
+func inboxVerifierHash(message *arbostypes.MessageWithMetadata, seqNum arbutil.MessageIndex, chainId uint64) (common.Hash, error) {
+	if message.Message != nil && message.Message.BatchGasCost != nil {
+		withoutGasCost := *message
+		withoutGasCost.Message = new(arbostypes.L1IncomingMessage)
+		*withoutGasCost.Message = *message.Message
+		withoutGasCost.Message.BatchGasCost = nil
+		message = &withoutGasCost
+	}
+	return message.Hash(seqNum, chainId)
+}
+
+// HandleMessages records the messages received from the feed, so that the
+// verifier can be registered as a BroadcastMessageHandler
+func (v *InboxVerifier) HandleMessages(messages []*broadcaster.BroadcastFeedMessage) error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	for _, message := range messages {
+		hash, err := inboxVerifierHash(&message.Message, message.SequenceNumber, v.chainId)
+		if err != nil {
+			log.Warn("error hashing feed message for inbox verification", "seqNum", message.SequenceNumber, "err", err)
+			continue
+		}
+		v.hashes[message.SequenceNumber] = hash
+		for message.SequenceNumber >= v.lowest+INBOX_VERIFIER_WINDOW {
+			delete(v.hashes, v.lowest)
+			v.lowest++
+		}
+	}
+	return nil
+}
+
+func (v *InboxVerifier) HandleConfirmedSeq(seqNum arbutil.MessageIndex) {}
+
+// VerifyInboxMessages compares the messages read from the parent chain inbox,
+// starting at sequence number pos, to what the feed delivered for them.
+// Messages that weren't received from the feed are skipped.
+func (v *InboxVerifier) VerifyInboxMessages(pos arbutil.MessageIndex, messages []arbostypes.MessageWithMetadata) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	for i := range messages {
+		seqNum := pos + arbutil.MessageIndex(i)
+		feedHash, ok := v.hashes[seqNum]
+		if !ok {
+			continue
+		}
+		delete(v.hashes, seqNum)
+		inboxHash, err := inboxVerifierHash(&messages[i], seqNum, v.chainId)
+		if err != nil {
+			log.Warn("error hashing inbox message for feed verification", "seqNum", seqNum, "err", err)
+			continue
+		}
+		if inboxHash == feedHash {
+			inboxVerifiedCounter.Inc(1)
+			continue
+		}
+		inboxDivergencesCounter.Inc(1)
+		log.Error("message posted to parent chain differs from the message received from the sequencer feed", "seqNum", seqNum, "feedHash", feedHash, "inboxHash", inboxHash)
+		if v.onDivergence != nil {
+			v.onDivergence(seqNum, feedHash, inboxHash)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/offchainlabs/nitro/arbos/arbostypes"
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+)
+
+func TestInboxVerifier(t *testing.T) {
+	verifier := NewInboxVerifier(0)
+	var diverged []arbutil.MessageIndex
+	verifier.OnDivergence(func(seqNum arbutil.MessageIndex, feedHash common.Hash, inboxHash common.Hash) {
+		diverged = append(diverged, seqNum)
+	})
+	feedMessages := make([]*broadcaster.BroadcastFeedMessage, 3)
+	for i := range feedMessages {
+		feedMessages[i] = &broadcaster.BroadcastFeedMessage{
+			SequenceNumber: arbutil.MessageIndex(i),
+			Message:        arbostypes.TestMessageWithMetadataAndRequestId,
+		}
+	}
+	Require(t, verifier.HandleMessages(feedMessages))
+
+	inboxMessages := make([]arbostypes.MessageWithMetadata, 3)
+	for i := range inboxMessages {
+		message := *arbostypes.TestMessageWithMetadataAndRequestId.Message
+		// The batch gas cost is only known to the parent chain
+		message.BatchGasCost = new(uint64)
+		inboxMessages[i] = arbostypes.MessageWithMetadata{Message: &message}
+	}
+	inboxMessages[2].DelayedMessagesRead = 1
+	verifier.VerifyInboxMessages(0, inboxMessages)
+	if len(diverged) != 1 || diverged[0] != 2 {
+		t.Fatalf("expected divergence at sequence number 2 only, got %v", diverged)
+	}
+
+	// Verified messages are forgotten, and messages not seen on the feed are skipped
+	verifier.VerifyInboxMessages(0, inboxMessages)
+	if len(diverged) != 1 {
+		t.Fatalf("expected no further divergences, got %v", diverged)
+	}
+}
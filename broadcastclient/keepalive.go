@@ -0,0 +1,143 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/gobwas/ws"
+	flag "github.com/spf13/pflag"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+var (
+	pingsSentCounter    = metrics.NewRegisteredCounter("arb/feed/pings/sent", nil)
+	pongTimeoutsCounter = metrics.NewRegisteredCounter("arb/feed/pings/timeouts", nil)
+)
+
+// KeepAliveConfig controls how a quiet or stuck feed connection is detected
+type KeepAliveConfig struct {
+	PingInterval time.Duration `koanf:"ping-interval" reload:"hot"`
+	PongTimeout  time.Duration `koanf:"pong-timeout" reload:"hot"`
+	StallTimeout time.Duration `koanf:"stall-timeout" reload:"hot"`
+}
+
+func KeepAliveConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Duration(prefix+".ping-interval", DefaultKeepAliveConfig.PingInterval, "interval to ping the sequencer feed at to keep the connection alive during quiet periods (0 = disabled)")
+	f.Duration(prefix+".pong-timeout", DefaultKeepAliveConfig.PongTimeout, "duration to wait for the sequencer feed to answer a ping before reconnecting")
+	f.Duration(prefix+".stall-timeout", DefaultKeepAliveConfig.StallTimeout, "duration without new sequence numbers from the sequencer feed while the chain advances after which the feed is reconnected to, counting toward failover (0 = disabled)")
+}
+
+var DefaultKeepAliveConfig = KeepAliveConfig{
+	PingInterval: 0,
+	PongTimeout:  5 * time.Second,
+	StallTimeout: 0,
+}
+
+var DefaultTestKeepAliveConfig = KeepAliveConfig{
+	PingInterval: 0,
+	PongTimeout:  100 * time.Millisecond,
+	StallTimeout: 0,
+}
+
+// keepalive pings the feed every KeepAlive.PingInterval, so that idle
+// connections aren't dropped by NATs or firewalls, and closes the connection if
+// the feed doesn't answer within KeepAlive.PongTimeout. The reader then
+// reconnects as for any other broken connection. Returns how long to wait
+// before being called again.
+func (bc *BroadcastClient) keepalive(ctx context.Context) time.Duration {
+	config := bc.config()
+	if config.KeepAlive.PingInterval <= 0 {
+		bc.pingSentAt = time.Time{}
+		// Check again later in case pinging is enabled by a config reload
+		return time.Second
+	}
+	if bc.readOnly() {
+		// The feed can't be pinged over plain HTTP or when replayed, but event
+		// stream comments, poll answers and replay heartbeats keep the read
+		// timeout from expiring
+		bc.pingSentAt = time.Time{}
+		return config.KeepAlive.PingInterval
+	}
+	now := bc.clock.Now()
+	if !bc.pingSentAt.IsZero() {
+		// Any frame read since the ping counts as an answer, a pong may be
+		// queued behind a large catchup batch
+		if atomic.LoadInt64(&bc.lastFrameUnixNano) < bc.pingSentAt.UnixNano() {
+			deadline := bc.pingSentAt.Add(config.KeepAlive.PongTimeout)
+			if now.Before(deadline) {
+				return deadline.Sub(now)
+			}
+			conn := bc.currentConn()
+			if conn == nil {
+				bc.pingSentAt = time.Time{}
+				return config.KeepAlive.PingInterval
+			}
+			log.Warn("sequencer feed did not answer ping, reconnecting", "remote", conn.RemoteAddr(), "pongTimeout", config.KeepAlive.PongTimeout)
+			pongTimeoutsCounter.Inc(1)
+			bc.pingSentAt = time.Time{}
+			_ = conn.Close()
+			return config.KeepAlive.PingInterval
+		}
+		if next := bc.pingSentAt.Add(config.KeepAlive.PingInterval); now.Before(next) {
+			return next.Sub(now)
+		}
+	}
+	bc.pingSentAt = time.Time{}
+	conn := bc.currentConn()
+	if conn == nil {
+		return config.KeepAlive.PingInterval
+	}
+	bc.writeMutex.Lock()
+	_ = conn.SetWriteDeadline(time.Now().Add(config.KeepAlive.PongTimeout))
+	err := ws.WriteFrame(conn, ws.MaskFrame(ws.NewPingFrame(nil)))
+	_ = conn.SetWriteDeadline(time.Time{})
+	bc.writeMutex.Unlock()
+	if err != nil {
+		// A broken connection will also be noticed by the reader
+		log.Debug("error sending ping to sequencer feed", "remote", conn.RemoteAddr(), "err", err)
+		return config.KeepAlive.PingInterval
+	}
+	pingsSentCounter.Inc(1)
+	bc.pingSentAt = now
+	if config.KeepAlive.PongTimeout < config.KeepAlive.PingInterval {
+		return config.KeepAlive.PongTimeout
+	}
+	return config.KeepAlive.PingInterval
+}
+
+// checkIdle closes the connection once nothing was read from the feed for the
+// read timeout by the client's clock. Only run with a clock from WithClock,
+// the read deadline of the connection follows the system clock otherwise.
+// Returns how long to wait before being called again.
+func (bc *BroadcastClient) checkIdle(ctx context.Context) time.Duration {
+	timeout := bc.readTimeout(bc.config())
+	if timeout <= 0 {
+		return time.Second
+	}
+	idleFor := bc.clock.Now().Sub(time.Unix(0, atomic.LoadInt64(&bc.lastFrameUnixNano)))
+	if idleFor < timeout {
+		return timeout - idleFor
+	}
+	conn := bc.currentConn()
+	if conn == nil {
+		return timeout
+	}
+	log.Error("Server connection timed out without receiving data", "remote", conn.RemoteAddr(), "idleFor", idleFor)
+	atomic.StoreInt64(&bc.lastFrameUnixNano, bc.clock.Now().UnixNano())
+	atomic.StoreInt32(&bc.idleClosed, 1)
+	_ = conn.Close()
+	return timeout
+}
+
+func (bc *BroadcastClient) currentConn() net.Conn {
+	bc.connMutex.Lock()
+	defer bc.connMutex.Unlock()
+	return bc.conn
+}
@@ -0,0 +1,151 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+
+	"github.com/offchainlabs/nitro/broadcaster"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+func TestBroadcastClientPingKeepsConnectionAlive(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The broadcaster doesn't ping within the client's read timeout
+	settings := wsbroadcastserver.DefaultTestBroadcasterConfig
+	settings.Ping = 50 * time.Second
+	settings.ClientTimeout = 150 * time.Second
+	feedErrChan := make(chan error, 10)
+	b := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &settings }, 8742, feedErrChan, nil)
+	Require(t, b.Initialize())
+	Require(t, b.Start(ctx))
+	defer b.StopAndWait()
+
+	config := DefaultTestConfig
+	config.KeepAlive.PingInterval = 50 * time.Millisecond
+	broadcastClient, err := newTestBroadcastClient(config, b.ListenerAddr(), 8742, 0, nil, feedErrChan, nil)
+	Require(t, err)
+	disconnects := make(chan error, 10)
+	broadcastClient.AddConnectionListener(ConnectionListenerFuncs{
+		Disconnect: func(_ string, err error) { disconnects <- err },
+	})
+	broadcastClient.Start(ctx)
+	defer broadcastClient.StopAndWait()
+
+	select {
+	case err := <-disconnects:
+		t.Fatalf("client disconnected despite pings: %v", err)
+	case err := <-feedErrChan:
+		t.Fatalf("Broadcaster error: %s", err.Error())
+	case <-time.After(time.Second):
+	}
+}
+
+func TestBroadcastClientPongTimeout(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Completes the websocket upgrade but never reads, so pings go unanswered
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Require(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			if _, err := ws.Upgrade(conn); err != nil {
+				return
+			}
+		}
+	}()
+
+	config := DefaultTestConfig
+	config.Timeout = time.Minute
+	config.KeepAlive.PingInterval = 50 * time.Millisecond
+	broadcastClient, err := newTestBroadcastClient(config, listener.Addr(), 8742, 0, nil, nil, nil)
+	Require(t, err)
+	disconnects := make(chan error, 10)
+	broadcastClient.AddConnectionListener(ConnectionListenerFuncs{
+		Disconnect: func(_ string, err error) { disconnects <- err },
+	})
+	broadcastClient.Start(ctx)
+	defer broadcastClient.StopAndWait()
+
+	select {
+	case <-disconnects:
+	case <-time.After(5 * time.Second):
+		t.Fatal("client did not disconnect after missing pong")
+	}
+}
+
+func TestBroadcastClientHeartbeatsKeepConnectionAlive(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Never reads, so pings go unanswered, but keeps sending its own pings
+	// and empty heartbeat messages
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Require(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if _, err := ws.Upgrade(conn); err != nil {
+					return
+				}
+				for i := 0; ; i++ {
+					if i%2 == 0 {
+						err = ws.WriteFrame(conn, ws.NewPingFrame(nil))
+					} else {
+						err = wsutil.WriteServerText(conn, []byte(`{"version":1}`))
+					}
+					if err != nil {
+						return
+					}
+					time.Sleep(20 * time.Millisecond)
+				}
+			}()
+		}
+	}()
+
+	config := DefaultTestConfig
+	config.Timeout = time.Minute
+	config.KeepAlive.PingInterval = 50 * time.Millisecond
+	config.KeepAlive.PongTimeout = 100 * time.Millisecond
+	broadcastClient, err := newTestBroadcastClient(config, listener.Addr(), 8742, 0, nil, nil, nil)
+	Require(t, err)
+	disconnects := make(chan error, 10)
+	broadcastClient.AddConnectionListener(ConnectionListenerFuncs{
+		Disconnect: func(_ string, err error) { disconnects <- err },
+	})
+	broadcastClient.Start(ctx)
+	defer broadcastClient.StopAndWait()
+
+	select {
+	case err := <-disconnects:
+		t.Fatalf("client disconnected despite heartbeats: %v", err)
+	case feedErr := <-broadcastClient.Errors():
+		t.Fatalf("feed error: %v", feedErr)
+	case <-time.After(time.Second):
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	flag "github.com/spf13/pflag"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+)
+
+const lagCheckInterval = time.Second
+
+var (
+	lagTimeGauge     = metrics.NewRegisteredGauge("arb/feed/lag/time", nil)
+	lagMessagesGauge = metrics.NewRegisteredGauge("arb/feed/lag/messages", nil)
+	lagAlarmsCounter = metrics.NewRegisteredCounter("arb/feed/lag/alarms", nil)
+)
+
+// AlarmConfig sets the thresholds above which the feed is reported as lagging
+type AlarmConfig struct {
+	Latency         time.Duration `koanf:"latency" reload:"hot"`
+	Lag             time.Duration `koanf:"lag" reload:"hot"`
+	LagMessages     uint64        `koanf:"lag-messages" reload:"hot"`
+	BandwidthBudget int64         `koanf:"bandwidth-budget" reload:"hot"`
+}
+
+func AlarmConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Duration(prefix+".latency", DefaultAlarmConfig.Latency, "time from broadcast to receipt of feed messages above which a warning is logged (0 = disabled)")
+	f.Duration(prefix+".lag", DefaultAlarmConfig.Lag, "time since the newest message received from the feed was broadcast above which the lag alarm is raised, also while the feed is quiet, so only for chains that sequence continuously (0 = disabled)")
+	f.Uint64(prefix+".lag-messages", DefaultAlarmConfig.LagMessages, "number of messages the chain head is ahead of the feed above which the lag alarm is raised (0 = disabled)")
+	f.Int64(prefix+".bandwidth-budget", DefaultAlarmConfig.BandwidthBudget, "bytes per second read from the feed, averaged over a minute, above which a warning is logged (0 = disabled)")
+}
+
+var DefaultAlarmConfig = AlarmConfig{
+	Latency:         0,
+	Lag:             0,
+	LagMessages:     0,
+	BandwidthBudget: 0,
+}
+
+func (c *AlarmConfig) Validate() error {
+	if c.BandwidthBudget < 0 {
+		return errors.New("feed bandwidth budget must not be negative")
+	}
+	return nil
+}
+
+// FeedLag is how far the feed is behind
+type FeedLag struct {
+	// Time since the newest message received was broadcast, zero until a
+	// message stamped by the broadcaster is received
+	Time time.Duration
+	// Messages the chain head is ahead of the feed, zero unless SetChainHead
+	// was called
+	Messages uint64
+}
+
+// LagAlarmFunc is called when the feed lag goes above the alarm thresholds,
+// with alarmed set, and again when it is back below them. It's called from the
+// client's lag thread, so it must not block.
+type LagAlarmFunc func(url string, lag FeedLag, alarmed bool)
+
+// recordNewestTimestamp notes the broadcast time of the newest message
+// received, only called from the reader thread, or the processing thread when
+// decoding in workers
+func (bc *BroadcastClient) recordNewestTimestamp(messages []*broadcaster.BroadcastFeedMessage) {
+	for _, message := range messages {
+		if message == nil || message.BroadcastTimestamp == 0 {
+			continue
+		}
+		if timestamp := int64(message.BroadcastTimestamp); timestamp > atomic.LoadInt64(&bc.newestTimestampMilli) {
+			atomic.StoreInt64(&bc.newestTimestampMilli, timestamp)
+		}
+	}
+}
+
+// lag returns how far the feed is behind the wall clock and the chain head
+func (bc *BroadcastClient) lag() FeedLag {
+	var lag FeedLag
+	if newest := atomic.LoadInt64(&bc.newestTimestampMilli); newest > 0 {
+		lag.Time = time.Since(time.UnixMilli(newest))
+		if lag.Time < 0 {
+			// Clock skew between the broadcaster and this node
+			lag.Time = 0
+		}
+	}
+	if bc.chainHead != nil {
+		received := arbutil.MessageIndex(atomic.LoadUint64(&bc.receivedCount))
+		if head := bc.chainHead(); head > received {
+			lag.Messages = uint64(head - received)
+		}
+	}
+	return lag
+}
+
+// checkLag raises the lag alarm once the feed lag exceeds Alarms.Lag or
+// Alarms.LagMessages, and clears it once the lag is back below both. Unlike the
+// latency alarm it is also raised while no messages arrive at all. Returns how
+// long to wait before being called again.
+func (bc *BroadcastClient) checkLag(ctx context.Context) time.Duration {
+	config := bc.config()
+	lag := bc.lag()
+	lagTimeGauge.Update(lag.Time.Milliseconds())
+	lagMessagesGauge.Update(int64(lag.Messages))
+	timeLagging := config.Alarms.Lag > 0 && lag.Time > config.Alarms.Lag
+	messagesLagging := config.Alarms.LagMessages > 0 && lag.Messages > config.Alarms.LagMessages
+	alarmed := timeLagging || messagesLagging
+	if alarmed == bc.lagAlarmed {
+		return lagCheckInterval
+	}
+	bc.lagAlarmed = alarmed
+	url := bc.statusURL()
+	if alarmed {
+		lagAlarmsCounter.Inc(1)
+		log.Warn("sequencer feed lag above alarm threshold", "url", url, "lag", lag.Time, "messagesBehind", lag.Messages, "threshold", config.Alarms.Lag, "messagesThreshold", config.Alarms.LagMessages)
+	} else {
+		log.Info("sequencer feed lag back below alarm threshold", "url", url, "lag", lag.Time, "messagesBehind", lag.Messages)
+	}
+	if bc.lagAlarm != nil {
+		bc.lagAlarm(url, lag, alarmed)
+	}
+	return lagCheckInterval
+}
@@ -0,0 +1,45 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+)
+
+func TestLagAlarm(t *testing.T) {
+	config := DefaultTestConfig
+	config.Alarms.Lag = time.Second
+	config.Alarms.LagMessages = 10
+	var alarms []bool
+	broadcastClient, err := NewBroadcastClientWithOptions("", WithConfig(func() *Config { return &config }), WithLagAlarm(func(_ string, _ FeedLag, alarmed bool) {
+		alarms = append(alarms, alarmed)
+	}))
+	Require(t, err)
+	chainHead := arbutil.MessageIndex(0)
+	broadcastClient.SetChainHead(func() arbutil.MessageIndex { return chainHead })
+	sentAgo := func(ago time.Duration) []*broadcaster.BroadcastFeedMessage {
+		return []*broadcaster.BroadcastFeedMessage{{BroadcastTimestamp: uint64(time.Now().Add(-ago).UnixMilli())}}
+	}
+
+	// Nothing received yet isn't a lag
+	broadcastClient.checkLag(context.Background())
+	broadcastClient.recordNewestTimestamp(sentAgo(5 * time.Second))
+	broadcastClient.checkLag(context.Background())
+	broadcastClient.recordNewestTimestamp(sentAgo(0))
+	broadcastClient.checkLag(context.Background())
+	chainHead = 20
+	broadcastClient.checkLag(context.Background())
+	if !reflect.DeepEqual(alarms, []bool{true, false, true}) {
+		t.Fatalf("unexpected lag alarms %v", alarms)
+	}
+	if lag := broadcastClient.lag(); lag.Messages != 20 {
+		t.Fatalf("expected 20 messages behind, got %d", lag.Messages)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/offchainlabs/nitro/broadcaster"
+)
+
+// Latencies are recorded in milliseconds
+var (
+	receiveLatencyHistogram = metrics.NewRegisteredHistogram("arb/feed/latency/receive", nil, metrics.NewBoundedHistogramSample())
+	deliverLatencyHistogram = metrics.NewRegisteredHistogram("arb/feed/latency/deliver", nil, metrics.NewBoundedHistogramSample())
+	latencyAlarmsCounter    = metrics.NewRegisteredCounter("arb/feed/latency/alarms", nil)
+)
+
+// messagesLatency returns the highest time elapsed since the messages were
+// broadcast, recording each in the histogram. Returns false if none of the
+// messages were stamped by the broadcaster.
+func messagesLatency(messages []*broadcaster.BroadcastFeedMessage, histogram metrics.Histogram) (time.Duration, bool) {
+	now := time.Now()
+	var highest time.Duration
+	stamped := false
+	for _, message := range messages {
+		if message == nil || message.BroadcastTimestamp == 0 {
+			continue
+		}
+		latency := now.Sub(time.UnixMilli(int64(message.BroadcastTimestamp)))
+		if latency < 0 {
+			// Clock skew between the broadcaster and this node
+			latency = 0
+		}
+		histogram.Update(latency.Milliseconds())
+		if !stamped || latency > highest {
+			highest = latency
+		}
+		stamped = true
+	}
+	return highest, stamped
+}
+
+// recordReceiveLatency measures the time from broadcast to receipt and raises
+// the latency alarm once it exceeds Alarms.Latency. Only called from the reader
+// thread.
+func (bc *BroadcastClient) recordReceiveLatency(messages []*broadcaster.BroadcastFeedMessage) {
+	latency, ok := messagesLatency(messages, receiveLatencyHistogram)
+	if !ok {
+		return
+	}
+	bc.updateStatus(func(status *clientStatus) { status.latency = latency })
+	threshold := bc.config().Alarms.Latency
+	if threshold > 0 && latency > threshold {
+		latencyAlarmsCounter.Inc(1)
+		if !bc.latencyAlarmed {
+			log.Warn("sequencer feed latency above alarm threshold", "url", bc.statusURL(), "latency", latency, "threshold", threshold)
+			bc.latencyAlarmed = true
+		}
+	} else if bc.latencyAlarmed {
+		log.Info("sequencer feed latency back below alarm threshold", "url", bc.statusURL(), "latency", latency, "threshold", threshold)
+		bc.latencyAlarmed = false
+	}
+}
@@ -0,0 +1,35 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"testing"
+	"time"
+
+	"github.com/offchainlabs/nitro/broadcaster"
+)
+
+func TestLatencyAlarm(t *testing.T) {
+	config := DefaultTestConfig
+	config.Alarms.Latency = time.Second
+	broadcastClient, err := NewBroadcastClient(func() *Config { return &config }, nil, 0, 0, nil, nil, nil, func(_ int32) {}, nil)
+	Require(t, err)
+	sentAgo := func(ago time.Duration) []*broadcaster.BroadcastFeedMessage {
+		return []*broadcaster.BroadcastFeedMessage{{BroadcastTimestamp: uint64(time.Now().Add(-ago).UnixMilli())}}
+	}
+
+	// Messages from broadcasters that don't stamp them aren't measured
+	broadcastClient.recordReceiveLatency([]*broadcaster.BroadcastFeedMessage{{}})
+	if broadcastClient.latencyAlarmed {
+		t.Fatal("alarm raised for unstamped message")
+	}
+	broadcastClient.recordReceiveLatency(sentAgo(5 * time.Second))
+	if !broadcastClient.latencyAlarmed {
+		t.Fatal("alarm not raised for late message")
+	}
+	broadcastClient.recordReceiveLatency(sentAgo(0))
+	if broadcastClient.latencyAlarmed {
+		t.Fatal("alarm not cleared after timely message")
+	}
+}
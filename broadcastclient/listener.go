@@ -0,0 +1,59 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+// ConnectionListener is notified of changes in feed connectivity, for example
+// to flip the node's health status. Methods are called from the client's
+// connection threads, so they must not block.
+type ConnectionListener interface {
+	// OnConnect is called after every successful connection to the feed
+	OnConnect(url string)
+	// OnDisconnect is called when an established connection to the feed is lost
+	OnDisconnect(url string, err error)
+	// OnReconnect is called after OnConnect when the connection was
+	// re-established following a disconnect
+	OnReconnect(url string, attempts int)
+}
+
+// ConnectionListenerFuncs adapts plain functions to a ConnectionListener,
+// any of them may be left nil.
+type ConnectionListenerFuncs struct {
+	Connect    func(url string)
+	Disconnect func(url string, err error)
+	Reconnect  func(url string, attempts int)
+}
+
+func (f ConnectionListenerFuncs) OnConnect(url string) {
+	if f.Connect != nil {
+		f.Connect(url)
+	}
+}
+
+func (f ConnectionListenerFuncs) OnDisconnect(url string, err error) {
+	if f.Disconnect != nil {
+		f.Disconnect(url, err)
+	}
+}
+
+func (f ConnectionListenerFuncs) OnReconnect(url string, attempts int) {
+	if f.Reconnect != nil {
+		f.Reconnect(url, attempts)
+	}
+}
+
+// AddConnectionListener registers a listener for connectivity changes
+func (bc *BroadcastClient) AddConnectionListener(listener ConnectionListener) {
+	bc.listenersMutex.Lock()
+	defer bc.listenersMutex.Unlock()
+	bc.listeners = append(bc.listeners, listener)
+}
+
+func (bc *BroadcastClient) notifyListeners(notify func(ConnectionListener)) {
+	bc.listenersMutex.Lock()
+	listeners := bc.listeners
+	bc.listenersMutex.Unlock()
+	for _, listener := range listeners {
+		notify(listener)
+	}
+}
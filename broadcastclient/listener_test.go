@@ -0,0 +1,64 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/offchainlabs/nitro/broadcaster"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+func TestBroadcastClientConnectionListener(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	config := wsbroadcastserver.DefaultTestBroadcasterConfig
+	config.Ping = 50 * time.Second
+	config.ClientTimeout = 150 * time.Second
+
+	feedErrChan := make(chan error, 10)
+	chainId := uint64(8742)
+	b := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &config }, chainId, feedErrChan, nil)
+
+	Require(t, b.Initialize())
+	Require(t, b.Start(ctx))
+	defer b.StopAndWait()
+
+	broadcastClient, err := newTestBroadcastClient(
+		DefaultTestConfig,
+		b.ListenerAddr(),
+		chainId,
+		0,
+		nil,
+		feedErrChan,
+		nil,
+	)
+	Require(t, err)
+	events := make(chan string, 100)
+	broadcastClient.AddConnectionListener(ConnectionListenerFuncs{
+		Connect:    func(string) { events <- "connect" },
+		Disconnect: func(string, error) { events <- "disconnect" },
+		Reconnect:  func(string, int) { events <- "reconnect" },
+	})
+	broadcastClient.Start(ctx)
+	defer broadcastClient.StopAndWait()
+
+	// The client times out without pings and reconnects
+	for _, expected := range []string{"connect", "disconnect", "connect", "reconnect"} {
+		select {
+		case event := <-events:
+			if event != expected {
+				t.Fatalf("expected %s event, got %s", expected, event)
+			}
+		case err := <-feedErrChan:
+			t.Fatalf("Broadcaster error: %s", err.Error())
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %s event", expected)
+		}
+	}
+}
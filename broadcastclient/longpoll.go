@@ -0,0 +1,121 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gobwas/ws"
+
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+var errFeedURLsChanged = errors.New("sequencer feed urls changed")
+
+var (
+	longPollFallbacksCounter = metrics.NewRegisteredCounter("arb/feed/long-poll/fallbacks", nil)
+	pollsCounter             = metrics.NewRegisteredCounter("arb/feed/long-poll/polls", nil)
+)
+
+// longPoll is the state of following the feed by polling, only accessed by
+// the connection threads
+type longPoll struct {
+	client    *BroadcastClient
+	feedURL   string
+	netDial   NetDialFunc
+	tlsConfig *tls.Config
+	header    http.Header
+	onHeader  func(key, value []byte) error
+
+	// The body of the last response
+	body *bufio.Reader
+}
+
+// poll asks the feed for the messages after those already received, waiting up
+// to Transport.LongPollWait for new ones. The feed answers once it has any, so
+// the response headers may take that long. Returns the connection the response
+// body is read from.
+func (bc *BroadcastClient) poll(ctx context.Context, config *Config, lp *longPoll) (net.Conn, error) {
+	u, err := httpFeedURL(lp.feedURL, wsbroadcastserver.MessagesPath)
+	if err != nil {
+		return nil, err
+	}
+	query := u.Query()
+	if next := bc.resumeSeqNum(); next > 0 {
+		query.Set(wsbroadcastserver.AfterQueryParameter, strconv.FormatUint(uint64(next-1), 10))
+	}
+	query.Set(wsbroadcastserver.WaitQueryParameter, config.Transport.LongPollWait.String())
+	u.RawQuery = query.Encode()
+	pollCtx, cancel := context.WithTimeout(ctx, config.Dial.Timeout+config.Dial.HandshakeTimeout+config.Transport.LongPollWait)
+	defer cancel()
+	conn, resp, _, err := requestFeed(pollCtx, config, u, lp.netDial, lp.tlsConfig, lp.header, "application/x-ndjson", lp.onHeader)
+	if err != nil {
+		return nil, err
+	}
+	lp.body = bufio.NewReader(resp.Body)
+	pollsCounter.Inc(1)
+	return conn, nil
+}
+
+// readFrame reads the next message line from the last response and hands it
+// to consume as a text frame, polling again once the response is read.
+// Returns whether the feed was polled, after which the feed may resend
+// messages already received.
+func (lp *longPoll) readFrame(ctx context.Context, conn net.Conn, config *Config, timeout time.Duration, consume frameConsumer) (ws.OpCode, bool, error) {
+	bc := lp.client
+	polled := false
+	for {
+		if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+			return 0, polled, err
+		}
+		line, err := readEventLine(lp.body, int64(config.Decode.MaxFrameSize))
+		_ = conn.SetReadDeadline(time.Time{})
+		if errors.Is(err, io.EOF) {
+			next, err := bc.poll(ctx, config, lp)
+			if err != nil {
+				return 0, polled, err
+			}
+			bc.connMutex.Lock()
+			if bc.shuttingDown {
+				bc.connMutex.Unlock()
+				_ = next.Close()
+				return 0, polled, errShuttingDown
+			}
+			if bc.pendingURLs != nil || bc.returnToPrimary {
+				// Closing the last connection didn't interrupt the poll
+				bc.connMutex.Unlock()
+				_ = next.Close()
+				return 0, polled, errFeedURLsChanged
+			}
+			bc.conn = next
+			bc.connMutex.Unlock()
+			_ = conn.Close()
+			conn = next
+			polled = true
+			continue
+		}
+		if err != nil {
+			return 0, polled, err
+		}
+		if len(line) == 0 {
+			continue
+		}
+		return ws.OpText, polled, consume(ws.OpText, bytes.NewReader(line))
+	}
+}
+
+func (lp *longPoll) readOnly() bool { return true }
+
+func (lp *longPoll) name() string { return "long-poll" }
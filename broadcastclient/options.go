@@ -0,0 +1,251 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+	"github.com/offchainlabs/nitro/util/contracts"
+	"github.com/offchainlabs/nitro/util/signature"
+)
+
+// Option configures a BroadcastClient built by NewBroadcastClientWithOptions
+type Option func(*clientOptions)
+
+type clientOptions struct {
+	config              ConfigFetcher
+	fallbackURLs        []string
+	chainId             uint64
+	currentMessageCount arbutil.MessageIndex
+	txStreamer          TransactionStreamerInterface
+	handlers            []BroadcastMessageHandler
+	listeners           []ConnectionListener
+	fatalErrChan        chan error
+	bpVerifier          contracts.BatchPosterVerifierInterface
+	adjustCount         func(int32)
+	unreachable         func(error)
+	dialerFactory       DialerFactory
+	idleTimeout         time.Duration
+	clock               Clock
+	filter              MessageFilter
+	lagAlarm            LagAlarmFunc
+	frameTee            FrameTee
+	pruneCallbacks      []PruneFunc
+	sinks               []namedStreamer
+}
+
+type namedStreamer struct {
+	name       string
+	txStreamer TransactionStreamerInterface
+}
+
+// WithConfig sets where the client reads its config from, DefaultConfig is used otherwise
+func WithConfig(config ConfigFetcher) Option {
+	return func(o *clientOptions) { o.config = config }
+}
+
+// WithFallbackURLs adds feed URLs to fail over to, in priority order
+func WithFallbackURLs(urls ...string) Option {
+	return func(o *clientOptions) { o.fallbackURLs = append(o.fallbackURLs, urls...) }
+}
+
+// WithChainId sets the chain id the feed must be serving
+func WithChainId(chainId uint64) Option {
+	return func(o *clientOptions) { o.chainId = chainId }
+}
+
+// WithMessageCount sets the number of messages the node already has, so the
+// feed starts at the next one
+func WithMessageCount(currentMessageCount arbutil.MessageIndex) Option {
+	return func(o *clientOptions) { o.currentMessageCount = currentMessageCount }
+}
+
+// WithTransactionStreamer sets the transaction streamer messages are added to
+func WithTransactionStreamer(txStreamer TransactionStreamerInterface) Option {
+	return func(o *clientOptions) { o.txStreamer = txStreamer }
+}
+
+// WithSink adds a transaction streamer the feed is delivered to besides the
+// node's own, see AddSink
+func WithSink(name string, txStreamer TransactionStreamerInterface) Option {
+	return func(o *clientOptions) { o.sinks = append(o.sinks, namedStreamer{name, txStreamer}) }
+}
+
+// WithHandler registers an additional consumer of the feed, see AddHandler
+func WithHandler(handler BroadcastMessageHandler) Option {
+	return func(o *clientOptions) { o.handlers = append(o.handlers, handler) }
+}
+
+// WithConnectionListener registers a listener for connectivity changes, see AddConnectionListener
+func WithConnectionListener(listener ConnectionListener) Option {
+	return func(o *clientOptions) { o.listeners = append(o.listeners, listener) }
+}
+
+// WithFatalErrChan sets the channel errors the client can't recover from are sent on
+func WithFatalErrChan(fatalErrChan chan error) Option {
+	return func(o *clientOptions) { o.fatalErrChan = fatalErrChan }
+}
+
+// WithBatchPosterVerifier sets how the sequencer signing feed messages is
+// recognized, required unless the sequencer isn't accepted as a signer
+func WithBatchPosterVerifier(bpVerifier contracts.BatchPosterVerifierInterface) Option {
+	return func(o *clientOptions) { o.bpVerifier = bpVerifier }
+}
+
+// WithConnectedCountHook sets a function called with +1 when the client
+// connects and -1 when it disconnects
+func WithConnectedCountHook(adjustCount func(int32)) Option {
+	return func(o *clientOptions) { o.adjustCount = adjustCount }
+}
+
+// WithUnreachableHook sets a function called when the client gives up reconnecting
+func WithUnreachableHook(unreachable func(error)) Option {
+	return func(o *clientOptions) { o.unreachable = unreachable }
+}
+
+// WithDialerFactory replaces how connections to the feed are opened, see SetDialerFactory
+func WithDialerFactory(factory DialerFactory) Option {
+	return func(o *clientOptions) { o.dialerFactory = factory }
+}
+
+// LoopbackURL is a feed URL for clients connected WithLoopback
+const LoopbackURL = "ws://loopback/"
+
+// WithLoopback connects to a broadcaster in the same process instead of over
+// the network, e.g. in tests. Any ws:// feed URL will do, like LoopbackURL.
+func WithLoopback(b *broadcaster.Broadcaster) Option {
+	return WithDialerFactory(func(string) (NetDialFunc, error) { return b.DialLoopback, nil })
+}
+
+// WithClock replaces the system clock the client times its reconnect backoff,
+// idle timeout and stall detection with, e.g. a ManualClock in tests
+func WithClock(clock Clock) Option {
+	return func(o *clientOptions) { o.clock = clock }
+}
+
+// WithIdleTimeout overrides the Timeout config, the duration to wait for data
+// from the feed before reconnecting
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(o *clientOptions) { o.idleTimeout = timeout }
+}
+
+// WithMessageFilter restricts the messages delivered to those the filter
+// accepts, in addition to the filter config
+func WithMessageFilter(filter MessageFilter) Option {
+	return func(o *clientOptions) { o.filter = filter }
+}
+
+// WithLagAlarm sets a function called when the feed lag crosses the Alarms.Lag
+// or Alarms.LagMessages thresholds, e.g. to page an operator
+func WithLagAlarm(lagAlarm LagAlarmFunc) Option {
+	return func(o *clientOptions) { o.lagAlarm = lagAlarm }
+}
+
+// WithFrameTee sets a function called with the undecoded payload of every
+// data frame read from the feed. Frames are then read into memory in full
+// before decoding even if Decode.Stream is set.
+func WithFrameTee(tee FrameTee) Option {
+	return func(o *clientOptions) { o.frameTee = tee }
+}
+
+// WithPruneCallback registers a function to prune state kept for the feed
+// with once messages are confirmed, see AddPruneCallback
+func WithPruneCallback(prune PruneFunc) Option {
+	return func(o *clientOptions) { o.pruneCallbacks = append(o.pruneCallbacks, prune) }
+}
+
+// NewBroadcastClientWithOptions creates a client of the feed at url, an empty
+// url with no fallback URLs creates a client that doesn't connect.
+func NewBroadcastClientWithOptions(url string, opts ...Option) (*BroadcastClient, error) {
+	o := clientOptions{
+		config:      func() *Config { return &DefaultConfig },
+		adjustCount: func(int32) {},
+		clock:       systemClock{},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	initialConfig := o.config()
+	sigVerifier, err := signature.NewVerifier(initialConfig.verifierConfig(), o.bpVerifier)
+	if err != nil {
+		return nil, err
+	}
+	urls := make([]*feedURL, 0, len(o.fallbackURLs)+1)
+	if url != "" {
+		urls = append(urls, &feedURL{url: url})
+	}
+	for _, fallbackURL := range o.fallbackURLs {
+		urls = append(urls, &feedURL{url: fallbackURL})
+	}
+	initialConfig.sortByPriority(urls)
+	currentMessageCount := o.currentMessageCount
+	if initialConfig.CheckpointFile != "" {
+		checkpoint, found, err := loadCheckpoint(initialConfig.CheckpointFile)
+		if err != nil {
+			log.Warn("ignoring unreadable sequencer feed checkpoint", "path", initialConfig.CheckpointFile, "err", err)
+		} else if found {
+			log.Info("resuming sequencer feed from checkpoint", "path", initialConfig.CheckpointFile, "checkpoint", checkpoint, "currentMessageCount", currentMessageCount)
+			currentMessageCount = checkpoint + 1
+		}
+	}
+	var frameRecorder *recorder
+	if initialConfig.Record.Dir != "" {
+		frameRecorder, err = newRecorder(initialConfig.Record.Dir, func() *RecordConfig { return &o.config().Record })
+		if err != nil {
+			return nil, err
+		}
+	}
+	handlers := append([]BroadcastMessageHandler{&txStreamerHandler{txStreamer: o.txStreamer, config: o.config}}, o.handlers...)
+	pruneCallbacks := o.pruneCallbacks
+	if frameRecorder != nil {
+		pruneCallbacks = append(pruneCallbacks, frameRecorder.pruneConfirmed)
+	}
+	bc := &BroadcastClient{
+		config:            o.config,
+		urls:              urls,
+		chainId:           o.chainId,
+		nextSeqNum:        currentMessageCount,
+		receivedCount:     uint64(currentMessageCount),
+		reorderBuffer:     newReorderBuffer(),
+		deliveryChan:      make(chan deliveryBatch, DELIVERY_QUEUE_SIZE),
+		errorChan:         make(chan *FeedError, ERROR_CHAN_SIZE),
+		handlers:          handlers,
+		pruneCallbacks:    pruneCallbacks,
+		threads:           make(map[string]int),
+		listeners:         o.listeners,
+		subscribers:       make(map[<-chan arbutil.MessageIndex]chan arbutil.MessageIndex),
+		fatalErrChan:      o.fatalErrChan,
+		sigVerifier:       sigVerifier,
+		sigVerifierSource: initialConfig,
+		bpVerifier:        o.bpVerifier,
+		adjustCount:       o.adjustCount,
+		unreachable:       o.unreachable,
+		dialerFactory:     o.dialerFactory,
+		idleTimeout:       o.idleTimeout,
+		clock:             o.clock,
+		filter:            o.filter,
+		lagAlarm:          o.lagAlarm,
+		frameTee:          o.frameTee,
+		recorder:          frameRecorder,
+	}
+	for _, sink := range o.sinks {
+		if err := bc.AddSink(sink.name, sink.txStreamer); err != nil {
+			return nil, err
+		}
+	}
+	bc.publishURLs()
+	return bc, nil
+}
+
+// readTimeout returns the duration to wait for data from the feed
+func (bc *BroadcastClient) readTimeout(config *Config) time.Duration {
+	if bc.idleTimeout > 0 {
+		return bc.idleTimeout
+	}
+	return config.Timeout
+}
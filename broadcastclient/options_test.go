@@ -0,0 +1,71 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/offchainlabs/nitro/arbos/arbostypes"
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+func TestNewBroadcastClientWithOptions(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	config := wsbroadcastserver.DefaultTestBroadcasterConfig
+	feedErrChan := make(chan error, 10)
+	chainId := uint64(8742)
+	b := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &config }, chainId, feedErrChan, nil)
+	Require(t, b.Initialize())
+	Require(t, b.Start(ctx))
+	defer b.StopAndWait()
+
+	clientConfig := DefaultTestConfig
+	clientConfig.Verify.Dangerous.AcceptMissing = true
+	handler := &recordingHandler{make(chan arbutil.MessageIndex, 1), make(chan arbutil.MessageIndex, 1)}
+	connected := make(chan string, 1)
+	broadcastClient, err := NewBroadcastClientWithOptions(
+		fmt.Sprintf("ws://127.0.0.1:%d/", b.ListenerAddr().(*net.TCPAddr).Port),
+		WithConfig(func() *Config { return &clientConfig }),
+		WithChainId(chainId),
+		WithFatalErrChan(feedErrChan),
+		WithHandler(handler),
+		WithConnectionListener(ConnectionListenerFuncs{Connect: func(url string) { connected <- url }}),
+		WithIdleTimeout(time.Minute),
+	)
+	Require(t, err)
+	if timeout := broadcastClient.readTimeout(&clientConfig); timeout != time.Minute {
+		t.Fatalf("expected idle timeout of a minute, got %v", timeout)
+	}
+	broadcastClient.Start(ctx)
+	defer broadcastClient.StopAndWait()
+
+	select {
+	case <-connected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection listener not notified")
+	}
+	for b.ClientCount() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	Require(t, b.BroadcastSingle(arbostypes.EmptyTestMessageWithMetadata, 0))
+	select {
+	case seqNum := <-handler.messages:
+		if seqNum != 0 {
+			t.Fatalf("received sequence number %d, expected 0", seqNum)
+		}
+	case err := <-feedErrChan:
+		t.Fatalf("feed error: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("client did not deliver the message")
+	}
+}
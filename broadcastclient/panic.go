@@ -0,0 +1,90 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	flag "github.com/spf13/pflag"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+var panicsCounter = metrics.NewRegisteredCounter("arb/feed/panics", nil)
+
+// ErrThreadPanicked is a client thread that panicked more often than it may
+// be restarted, see Panic.Restarts
+var ErrThreadPanicked = errors.New("sequencer feed client thread panicked")
+
+// PanicConfig controls restarting the feed client's threads after a panic
+type PanicConfig struct {
+	Restarts     int           `koanf:"restarts" reload:"hot"`
+	RestartDelay time.Duration `koanf:"restart-delay" reload:"hot"`
+}
+
+func PanicConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Int(prefix+".restarts", DefaultPanicConfig.Restarts, "number of times the sequencer feed client's threads are restarted after a panic, e.g. on a malformed message, before the feed is given up on (0 = never restart, -1 = always restart)")
+	f.Duration(prefix+".restart-delay", DefaultPanicConfig.RestartDelay, "duration to wait before restarting a sequencer feed client thread that panicked")
+}
+
+var DefaultPanicConfig = PanicConfig{
+	Restarts:     10,
+	RestartDelay: time.Second,
+}
+
+var DefaultTestPanicConfig = PanicConfig{
+	Restarts:     10,
+	RestartDelay: 10 * time.Millisecond,
+}
+
+func (c *PanicConfig) Validate() error {
+	if c.Restarts < -1 {
+		return errors.New("feed panic restarts must be -1 or more")
+	}
+	if c.RestartDelay < 0 {
+		return errors.New("feed panic restart delay must not be negative")
+	}
+	return nil
+}
+
+// recoverThread runs foo, recovering if it panics. After a panic the
+// connection is closed, since the thread may have been in the middle of a
+// frame, and restart tells whether foo may be run again. Restarts are counted
+// across all threads of the client, once Panic.Restarts is exceeded the feed is
+// given up on.
+func (bc *BroadcastClient) recoverThread(ctx context.Context, name string, foo func(ctx context.Context)) (panicked bool, restart bool) {
+	defer func() {
+		recovered := recover()
+		if recovered == nil {
+			return
+		}
+		panicked = true
+		panicsCounter.Inc(1)
+		log.Error("sequencer feed client thread panicked", "thread", name, "panic", recovered, "stack", string(debug.Stack()))
+		bc.connMutex.Lock()
+		if bc.conn != nil {
+			_ = bc.conn.Close()
+		}
+		bc.connMutex.Unlock()
+		if ctx.Err() != nil {
+			return
+		}
+		config := bc.config()
+		restarts := atomic.AddInt64(&bc.panicRestarts, 1)
+		if config.Panic.Restarts >= 0 && restarts > int64(config.Panic.Restarts) {
+			bc.giveUp(fmt.Errorf("%w: %s: %v", ErrThreadPanicked, name, recovered))
+			return
+		}
+		log.Warn("restarting sequencer feed client thread", "thread", name, "restarts", restarts, "delay", config.Panic.RestartDelay)
+		restart = bc.sleep(ctx, config.Panic.RestartDelay)
+	}()
+	foo(ctx)
+	return false, false
+}
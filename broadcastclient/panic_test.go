@@ -0,0 +1,99 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/offchainlabs/nitro/arbos/arbostypes"
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+type panickingHandler struct {
+	recordingHandler
+	panics int32
+}
+
+func (h *panickingHandler) HandleMessages(messages []*broadcaster.BroadcastFeedMessage) error {
+	if atomic.AddInt32(&h.panics, -1) >= 0 {
+		panic("malformed message")
+	}
+	return h.recordingHandler.HandleMessages(messages)
+}
+
+func TestPanicRestart(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	settings := wsbroadcastserver.DefaultTestBroadcasterConfig
+	feedErrChan := make(chan error, 10)
+	chainId := uint64(8742)
+	b := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &settings }, chainId, feedErrChan, nil)
+	Require(t, b.Initialize())
+	Require(t, b.Start(ctx))
+	defer b.StopAndWait()
+
+	for _, restarts := range []int{1, 0} {
+		config := DefaultTestConfig
+		config.Verify.Dangerous.AcceptMissing = true
+		config.Panic.Restarts = restarts
+		handler := &panickingHandler{recordingHandler{make(chan arbutil.MessageIndex, 10), make(chan arbutil.MessageIndex, 10)}, 1}
+		unreachable := make(chan error, 1)
+		broadcastClient, err := NewBroadcastClientWithOptions(
+			LoopbackURL,
+			WithConfig(func() *Config { return &config }),
+			WithChainId(chainId),
+			WithHandler(handler),
+			WithLoopback(b),
+			WithUnreachableHook(func(err error) { unreachable <- err }),
+		)
+		Require(t, err)
+		broadcastClient.Start(ctx)
+		for b.ClientCount() == 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		panicsBefore := panicsCounter.Count()
+		seqNum := arbutil.MessageIndex(b.GetCachedMessageCount())
+		Require(t, b.BroadcastSingle(arbostypes.EmptyTestMessageWithMetadata, seqNum))
+		if restarts == 0 {
+			select {
+			case err := <-unreachable:
+				if !errors.Is(err, ErrThreadPanicked) {
+					t.Fatalf("unexpected error giving up: %v", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("client did not give up after the panic")
+			}
+			broadcastClient.StopAndWait()
+			continue
+		}
+		// The delivery thread restarts and the client reconnects, later
+		// messages are delivered
+		deadline := time.After(5 * time.Second)
+		for delivered := false; !delivered; {
+			select {
+			case <-handler.messages:
+				delivered = true
+			case err := <-unreachable:
+				t.Fatalf("client gave up: %v", err)
+			case <-deadline:
+				t.Fatal("message not delivered after the panic")
+			case <-time.After(50 * time.Millisecond):
+				seqNum++
+				Require(t, b.BroadcastSingle(arbostypes.EmptyTestMessageWithMetadata, seqNum))
+			}
+		}
+		if panicsCounter.Count() <= panicsBefore {
+			t.Fatal("panic not counted")
+		}
+		broadcastClient.StopAndWait()
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+var pausedGauge = metrics.NewRegisteredGauge("arb/feed/paused", nil)
+
+// Pause stops the client from reading the feed until Resume is called, e.g.
+// during maintenance or while the transaction streamer is backed up. Frames
+// already read when Pause is called are still delivered. Messages the feed
+// sends in the meantime queue up on the connection, if the feed drops the
+// connection the client reconnects from the next expected sequence number
+// after resuming.
+func (bc *BroadcastClient) Pause() {
+	bc.pauseMutex.Lock()
+	defer bc.pauseMutex.Unlock()
+	if bc.resumeChan != nil {
+		return
+	}
+	bc.resumeChan = make(chan struct{})
+	pausedGauge.Inc(1)
+	log.Info("pausing sequencer feed")
+}
+
+// Resume continues reading the feed after Pause
+func (bc *BroadcastClient) Resume() {
+	bc.pauseMutex.Lock()
+	defer bc.pauseMutex.Unlock()
+	if bc.resumeChan == nil {
+		return
+	}
+	close(bc.resumeChan)
+	bc.resumeChan = nil
+	pausedGauge.Dec(1)
+	log.Info("resuming sequencer feed")
+}
+
+// IsPaused returns whether Pause was called without a matching Resume
+func (bc *BroadcastClient) IsPaused() bool {
+	bc.pauseMutex.Lock()
+	defer bc.pauseMutex.Unlock()
+	return bc.resumeChan != nil
+}
+
+// waitWhilePaused blocks the reader thread while the client is paused, it
+// returns false if the context was cancelled in the meantime
+func (bc *BroadcastClient) waitWhilePaused(ctx context.Context) bool {
+	bc.pauseMutex.Lock()
+	resume := bc.resumeChan
+	bc.pauseMutex.Unlock()
+	if resume == nil {
+		return true
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case <-resume:
+		return true
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/offchainlabs/nitro/arbos/arbostypes"
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+func TestBroadcastClientPauseResume(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	config := wsbroadcastserver.DefaultTestBroadcasterConfig
+	feedErrChan := make(chan error, 10)
+	chainId := uint64(8742)
+	b := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &config }, chainId, feedErrChan, nil)
+	Require(t, b.Initialize())
+	Require(t, b.Start(ctx))
+	defer b.StopAndWait()
+
+	clientConfig := DefaultTestConfig
+	clientConfig.Verify.Dangerous.AcceptMissing = true
+	broadcastClient, err := newTestBroadcastClient(clientConfig, b.ListenerAddr(), chainId, 0, nil, feedErrChan, nil)
+	Require(t, err)
+	handler := &recordingHandler{make(chan arbutil.MessageIndex, 1), make(chan arbutil.MessageIndex, 1)}
+	broadcastClient.AddHandler(handler)
+	broadcastClient.Pause()
+	if !broadcastClient.IsPaused() {
+		t.Fatal("client not paused")
+	}
+	broadcastClient.Start(ctx)
+	defer broadcastClient.StopAndWait()
+
+	for b.ClientCount() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	Require(t, b.BroadcastSingle(arbostypes.EmptyTestMessageWithMetadata, 0))
+	select {
+	case seqNum := <-handler.messages:
+		t.Fatalf("paused client delivered sequence number %d", seqNum)
+	case err := <-feedErrChan:
+		t.Fatalf("feed error: %v", err)
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	broadcastClient.Resume()
+	select {
+	case seqNum := <-handler.messages:
+		if seqNum != 0 {
+			t.Fatalf("received sequence number %d, expected 0", seqNum)
+		}
+	case err := <-feedErrChan:
+		t.Fatalf("feed error: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("resumed client did not deliver the message")
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gobwas/ws"
+	flag "github.com/spf13/pflag"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+var (
+	primaryProbeFailuresCounter = metrics.NewRegisteredCounter("arb/feed/sources/primary/probe-failures", nil)
+	primaryReturnsCounter       = metrics.NewRegisteredCounter("arb/feed/sources/primary/returns", nil)
+)
+
+// FailoverConfig controls following one feed URL at a time, failing over to
+// the next when the current one is unreachable
+type FailoverConfig struct {
+	Enable               bool          `koanf:"enable"`
+	Threshold            int           `koanf:"threshold" reload:"hot"`
+	ReturnToPrimaryAfter time.Duration `koanf:"return-to-primary-after" reload:"hot"`
+	PrimaryProbeInterval time.Duration `koanf:"primary-probe-interval" reload:"hot"`
+}
+
+func FailoverConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Bool(prefix+".enable", DefaultFailoverConfig.Enable, "connect to one feed URL at a time, failing over to the next URL in the list when the current one is unreachable or stalls")
+	f.Int(prefix+".threshold", DefaultFailoverConfig.Threshold, "number of consecutive failed connection attempts or read timeouts before failing over to the next feed URL")
+	f.Duration(prefix+".return-to-primary-after", DefaultFailoverConfig.ReturnToPrimaryAfter, "duration the primary feed URL, the first one by priority, must answer every probe for while a backup URL is used before switching back to it (0 = stay on the backup)")
+	f.Duration(prefix+".primary-probe-interval", DefaultFailoverConfig.PrimaryProbeInterval, "interval to probe the primary feed URL at while a backup URL is used")
+}
+
+var DefaultFailoverConfig = FailoverConfig{
+	Enable:               false,
+	Threshold:            3,
+	ReturnToPrimaryAfter: 0,
+	PrimaryProbeInterval: 10 * time.Second,
+}
+
+var DefaultTestFailoverConfig = FailoverConfig{
+	Enable:               false,
+	Threshold:            1,
+	ReturnToPrimaryAfter: 0,
+	PrimaryProbeInterval: 50 * time.Millisecond,
+}
+
+func (c *FailoverConfig) Validate() error {
+	if c.ReturnToPrimaryAfter > 0 && c.PrimaryProbeInterval <= 0 {
+		return errors.New("primary feed probe interval must be positive to return to the primary feed")
+	}
+	return nil
+}
+
+// checkPrimary probes the primary feed URL, the first one by priority, while a
+// backup URL is used, and switches back to it once it has answered every probe
+// for Failover.ReturnToPrimaryAfter. Waiting for the primary to be stable keeps
+// the client from flapping between the URLs. Returns how long to wait before
+// being called again.
+func (bc *BroadcastClient) checkPrimary(ctx context.Context) time.Duration {
+	config := bc.config()
+	if config.Failover.ReturnToPrimaryAfter <= 0 {
+		bc.primaryHealthySince = time.Time{}
+		// Check again later in case returning is enabled by a config reload
+		return time.Second
+	}
+	urls := bc.statusURLs()
+	if len(urls) < 2 || urls[0].Active || bc.hasPendingSwitch() {
+		bc.primaryHealthySince = time.Time{}
+		return config.Failover.PrimaryProbeInterval
+	}
+	primary := urls[0].URL
+	if err := bc.probeFeed(ctx, primary); err != nil {
+		primaryProbeFailuresCounter.Inc(1)
+		if !bc.primaryHealthySince.IsZero() {
+			log.Info("primary sequencer feed url failed probe, staying on backup", "url", primary, "err", err)
+		}
+		bc.primaryHealthySince = time.Time{}
+		return config.Failover.PrimaryProbeInterval
+	}
+	now := time.Now()
+	if bc.primaryHealthySince.IsZero() {
+		log.Info("primary sequencer feed url reachable again", "url", primary, "returningAfter", config.Failover.ReturnToPrimaryAfter)
+		bc.primaryHealthySince = now
+	}
+	if now.Sub(bc.primaryHealthySince) >= config.Failover.ReturnToPrimaryAfter {
+		bc.primaryHealthySince = time.Time{}
+		bc.switchToPrimary()
+	}
+	return config.Failover.PrimaryProbeInterval
+}
+
+// probeFeed checks that the feed at feedURL completes the websocket handshake
+// for the right chain, closing the connection straight away
+func (bc *BroadcastClient) probeFeed(ctx context.Context, feedURL string) error {
+	config := bc.urlConfig(bc.config(), feedURL)
+	netDial, handshakeURL, err := bc.feedNetDial(config, feedURL)
+	if err != nil {
+		return err
+	}
+	tlsConfig, err := config.TLS.tlsConfig()
+	if err != nil {
+		return err
+	}
+	header, err := config.handshakeHeader(bc.resumeSeqNum())
+	if err != nil {
+		return err
+	}
+	dialer := ws.Dialer{
+		Header: ws.HandshakeHeaderHTTP(header),
+		OnHeader: func(key, value []byte) error {
+			if string(key) != wsbroadcastserver.HTTPHeaderChainId {
+				return nil
+			}
+			chainId, err := strconv.ParseUint(string(value), 0, 64)
+			if err != nil {
+				return err
+			}
+			if chainId != bc.chainId {
+				return ErrIncorrectChainId
+			}
+			return nil
+		},
+		Timeout:   config.Dial.Timeout,
+		TLSConfig: tlsConfig,
+		NetDial:   netDial,
+	}
+	probeCtx, cancel := context.WithTimeout(ctx, config.Dial.Timeout+config.Dial.HandshakeTimeout)
+	defer cancel()
+	conn, _, _, err := dialer.Dial(probeCtx, handshakeURL)
+	if err != nil {
+		return err
+	}
+	_ = conn.SetWriteDeadline(time.Now().Add(time.Second))
+	closeFrame := ws.NewCloseFrame(ws.NewCloseFrameBody(ws.StatusNormalClosure, "probe"))
+	_ = ws.WriteFrame(conn, ws.MaskFrame(closeFrame))
+	return conn.Close()
+}
+
+// switchToPrimary closes the connection to the backup feed URL, so that the
+// reader reconnects to the primary URL. Like SetURLs, the switch doesn't count
+// as a failure of the backup.
+func (bc *BroadcastClient) switchToPrimary() {
+	bc.connMutex.Lock()
+	defer bc.connMutex.Unlock()
+	bc.returnToPrimary = true
+	bc.closeForSwitch("returning to primary feed")
+}
+
+// applyReturnToPrimary makes the primary feed URL the active one again. Only
+// called from the connection threads.
+func (bc *BroadcastClient) applyReturnToPrimary() {
+	if len(bc.urls) == 0 || bc.activeURL == 0 {
+		return
+	}
+	log.Info("returning to primary sequencer feed url", "from", bc.currentURL(), "to", bc.urls[0].url)
+	primaryReturnsCounter.Inc(1)
+	bc.activeURL = 0
+	bc.urls[0].consecutiveFailures = 0
+	sourcesActiveIndexGauge.Update(0)
+	bc.publishURLs()
+}
+
+// statusURLs returns the state of the feed URLs, for threads other than the
+// connection threads
+func (bc *BroadcastClient) statusURLs() []URLStatus {
+	bc.statusMutex.Lock()
+	defer bc.statusMutex.Unlock()
+	return bc.status.urls
+}
@@ -0,0 +1,107 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/offchainlabs/nitro/arbos/arbostypes"
+	"github.com/offchainlabs/nitro/broadcaster"
+	"github.com/offchainlabs/nitro/util/contracts"
+	"github.com/offchainlabs/nitro/util/signature"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+func TestBroadcastClientReturnsToPrimary(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	privateKey, err := crypto.GenerateKey()
+	Require(t, err)
+	sequencerAddr := crypto.PubkeyToAddress(privateKey.PublicKey)
+	dataSigner := signature.DataSignerFromPrivateKey(privateKey)
+	feedErrChan := make(chan error, 10)
+	chainId := uint64(8749)
+
+	backupSettings := wsbroadcastserver.DefaultTestBroadcasterConfig
+	backup := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &backupSettings }, chainId, feedErrChan, dataSigner)
+	Require(t, backup.Initialize())
+	Require(t, backup.Start(ctx))
+	defer backup.StopAndWait()
+
+	// The primary is down until the client settled on the backup
+	unusedListener, err := net.Listen("tcp", "127.0.0.1:0")
+	Require(t, err)
+	primaryPort := unusedListener.Addr().(*net.TCPAddr).Port
+	Require(t, unusedListener.Close())
+	primaryURL := fmt.Sprintf("ws://127.0.0.1:%d/", primaryPort)
+	backupURL := fmt.Sprintf("ws://127.0.0.1:%d/", backup.ListenerAddr().(*net.TCPAddr).Port)
+
+	config := DefaultTestConfig
+	config.Failover.Threshold = 1
+	config.Failover.ReturnToPrimaryAfter = 300 * time.Millisecond
+	// Only returning to the primary may switch away from the idle backup
+	config.Timeout = 10 * time.Second
+	config.Verify.AcceptSequencer = true
+	ts := NewDummyTransactionStreamer(chainId, nil)
+	broadcastClient, err := NewBroadcastClient(
+		func() *Config { return &config },
+		[]string{primaryURL, backupURL},
+		chainId,
+		0,
+		ts,
+		feedErrChan,
+		contracts.NewMockBatchPosterVerifier(sequencerAddr),
+		func(_ int32) {},
+		nil,
+	)
+	Require(t, err)
+	broadcastClient.Start(ctx)
+	defer broadcastClient.StopAndWait()
+
+	receive := func(from string) {
+		t.Helper()
+		select {
+		case err := <-feedErrChan:
+			t.Fatalf("Broadcaster error: %s", err.Error())
+		case <-ts.messageReceiver:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("client did not receive message from %s", from)
+		}
+	}
+	Require(t, backup.BroadcastSingle(arbostypes.EmptyTestMessageWithMetadata, 0))
+	receive("backup")
+
+	primarySettings := wsbroadcastserver.DefaultTestBroadcasterConfig
+	primarySettings.Port = strconv.Itoa(primaryPort)
+	primary := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &primarySettings }, chainId, feedErrChan, dataSigner)
+	primaryUp := time.Now()
+	Require(t, primary.Initialize())
+	Require(t, primary.Start(ctx))
+	defer primary.StopAndWait()
+
+	for primary.ClientCount() == 0 || broadcastClient.Status().URL != primaryURL {
+		if time.Since(primaryUp) > 5*time.Second {
+			t.Fatal("client did not return to the primary url")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if returnedAfter := time.Since(primaryUp); returnedAfter < config.Failover.ReturnToPrimaryAfter {
+		t.Fatalf("client returned to the primary url after %v, before it was up for %v", returnedAfter, config.Failover.ReturnToPrimaryAfter)
+	}
+	urls := broadcastClient.Status().URLs
+	if len(urls) != 2 || !urls[0].Active || urls[1].Active {
+		t.Fatalf("expected primary url to be active, got %+v", urls)
+	}
+	Require(t, primary.BroadcastSingle(arbostypes.EmptyTestMessageWithMetadata, 1))
+	receive("primary")
+}
@@ -0,0 +1,272 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/gobwas/ws"
+	flag "github.com/spf13/pflag"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ethereum/go-ethereum/log"
+
+	"github.com/offchainlabs/nitro/broadcaster"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+// FRAME_QUEUE_SIZE is the number of frames read ahead of the processing thread
+// when decoding in workers
+const FRAME_QUEUE_SIZE = 64
+
+// DecodeConfig controls how frames read from the feed are decoded
+type DecodeConfig struct {
+	Stream            bool `koanf:"stream" reload:"hot"`
+	Workers           int  `koanf:"workers"`
+	MaxFrameSize      int  `koanf:"max-frame-size" reload:"hot"`
+	VerifyContentHash bool `koanf:"verify-content-hash" reload:"hot"`
+}
+
+func DecodeConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Bool(prefix+".stream", DefaultDecodeConfig.Stream, "decode JSON feed messages while they are read from the connection, instead of reading each frame into memory first")
+	f.Int(prefix+".workers", DefaultDecodeConfig.Workers, "number of threads decoding feed messages and verifying their signatures, so that the connection is read while earlier frames are processed (0 = decode on the reader thread)")
+	f.Int(prefix+".max-frame-size", DefaultDecodeConfig.MaxFrameSize, "maximum size in bytes of a frame read from the feed after decompression, the feed is reconnected to if exceeded (0 = unlimited)")
+	f.Bool(prefix+".verify-content-hash", DefaultDecodeConfig.VerifyContentHash, "drop feed messages that don't match the content hash included by the broadcaster, catching messages corrupted in transit, e.g. by a proxy")
+}
+
+var DefaultDecodeConfig = DecodeConfig{
+	Stream:            true,
+	Workers:           0,
+	MaxFrameSize:      256 * 1024 * 1024,
+	VerifyContentHash: false,
+}
+
+// frameJob is a frame on its way from the reader, through decoding and
+// signature verification, to sequencing
+type frameJob struct {
+	ctx          context.Context
+	span         trace.Span
+	op           ws.OpCode
+	frame        feedFrame
+	url          string
+	afterConnect bool
+	// Generation of the recording file the frame was recorded to, 0 if not
+	recording uint64
+
+	// Set by decodeFrame
+	res       broadcaster.BroadcastMessage
+	decodeErr error
+	helloErr  error
+	valid     []*broadcaster.BroadcastFeedMessage
+
+	// Closed once decoded, only used with decode workers
+	done chan struct{}
+}
+
+// startDecodeWorkers moves decoding and signature verification off the reader
+// thread, so that CPU heavy frames don't delay reading the connection into an
+// idle timeout. Frames are decoded concurrently but processed in the order
+// they were read, by the processing thread which then owns the sequencing state.
+func (bc *BroadcastClient) startDecodeWorkers(workers int) {
+	// Set under statusMutex for Status, the threads using the queues are
+	// launched afterwards
+	bc.statusMutex.Lock()
+	bc.decodeQueue = make(chan *frameJob, FRAME_QUEUE_SIZE)
+	bc.processQueue = make(chan *frameJob, FRAME_QUEUE_SIZE)
+	bc.statusMutex.Unlock()
+	for i := 0; i < workers; i++ {
+		bc.launchThread("decode worker", func(ctx context.Context) {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-bc.decodeQueue:
+					bc.decodeFrame(job)
+					close(job.done)
+				}
+			}
+		})
+	}
+	bc.launchThread("processing", func(ctx context.Context) {
+		for {
+			var job *frameJob
+			select {
+			case <-ctx.Done():
+				return
+			case job = <-bc.processQueue:
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-job.done:
+			}
+			if !bc.processFrame(ctx, job) {
+				return
+			}
+		}
+	})
+}
+
+// handleFrame passes a frame read from the feed on, returns false if the
+// reader should stop. Only called from the reader thread.
+func (bc *BroadcastClient) handleFrame(ctx context.Context, job *frameJob) bool {
+	if bc.decodeQueue == nil {
+		bc.decodeFrame(job)
+		return bc.processFrame(ctx, job)
+	}
+	job.done = make(chan struct{})
+	select {
+	case <-ctx.Done():
+		return false
+	case bc.processQueue <- job:
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case bc.decodeQueue <- job:
+	}
+	return true
+}
+
+// decodeFrame decodes a frame and verifies the signatures of its messages,
+// called from the reader thread or a decode worker
+func (bc *BroadcastClient) decodeFrame(job *frameJob) {
+	var decodeOpts []trace.SpanStartOption
+	if job.frame.streamed != nil {
+		// Decoded while it was read
+		decodeOpts = append(decodeOpts, trace.WithTimestamp(job.frame.start))
+	}
+	_, decodeSpan := tracer.Start(job.ctx, "feed.decode", decodeOpts...)
+	job.res, job.decodeErr = job.frame.decode(job.op)
+	endSpanWithError(decodeSpan, job.decodeErr)
+	if job.decodeErr != nil {
+		decodeErrorsCounter.Inc(1)
+		bc.reportError(DecodeError, job.decodeErr)
+		if job.frame.data != nil {
+			log.Error("error unmarshalling message", "msg", job.frame.data, "err", job.decodeErr)
+		} else {
+			log.Error("error decoding message", "bytes", job.frame.size, "err", job.decodeErr)
+		}
+	}
+	job.frame.release()
+	if job.decodeErr != nil {
+		return
+	}
+	setBatchAttributes(job.span, job.res.Messages)
+
+	if job.helloErr = bc.verifyHello(job.url, job.res.HelloMessage); job.helloErr != nil {
+		return
+	}
+	if job.res.Version != 1 || len(job.res.Messages) == 0 {
+		return
+	}
+	verifyCtx, verifySpan := tracer.Start(job.ctx, "feed.verify")
+	defer verifySpan.End()
+	verifyContentHash := bc.config().Decode.VerifyContentHash
+	messages := make([]*broadcaster.BroadcastFeedMessage, 0, len(job.res.Messages))
+	for _, message := range job.res.Messages {
+		if message == nil {
+			log.Warn("ignoring nil feed message")
+			continue
+		}
+		if verifyContentHash {
+			// Dropped like a message that never arrived, which delivery.hold-on-gap
+			// requests from the feed again
+			if err := bc.verifyContentHash(message); err != nil {
+				bc.reportError(DecodeError, err)
+				log.Error("dropping corrupted feed message", "url", job.url, "sequenceNumber", message.SequenceNumber, "err", err)
+				continue
+			}
+		}
+		messages = append(messages, message)
+	}
+	errs := bc.verifySignatures(verifyCtx, messages)
+	job.valid = make([]*broadcaster.BroadcastFeedMessage, 0, len(messages))
+	for i, message := range messages {
+		if err := errs[i]; err != nil {
+			log.Error("error validating feed signature", "error", err, "sequence number", message.SequenceNumber)
+			bc.fatalErrChan <- fmt.Errorf("error validating feed signature %v: %w", message.SequenceNumber, err)
+			continue
+		}
+
+		job.valid = append(job.valid, message)
+	}
+}
+
+// processFrame sequences the messages of a decoded frame and queues them for
+// delivery, returns false if reading the feed should stop. Called from the
+// reader thread, or the processing thread with decode workers.
+func (bc *BroadcastClient) processFrame(ctx context.Context, job *frameJob) bool {
+	queued := false
+	defer func() {
+		if !queued {
+			bc.framesDone(1)
+		}
+	}()
+	if job.afterConnect {
+		bc.suppressReplay = true
+	}
+	if job.recording != 0 {
+		bc.recorder.recorded(job.recording, job.res.Messages)
+	}
+	if job.decodeErr != nil {
+		endSpanWithError(job.span, job.decodeErr)
+		return true
+	}
+	if job.helloErr != nil {
+		bc.reportError(HandshakeError, job.helloErr)
+		log.Error("disconnecting from sequencer feed", "url", job.url, "err", job.helloErr)
+		endSpanWithError(job.span, job.helloErr)
+		atomic.StoreInt32(&bc.rejected, 1)
+		if conn := bc.currentConn(); conn != nil {
+			_ = conn.Close()
+		}
+		bc.fatalErrChan <- job.helloErr
+		return false
+	}
+	defer job.span.End()
+
+	res := &job.res
+	messagesReceivedCounter.Inc(int64(len(res.Messages)))
+	bc.recordReceiveLatency(res.Messages)
+	bc.recordNewestTimestamp(res.Messages)
+	if len(res.Messages) > 0 {
+		log.Debug("received batch item", "count", len(res.Messages), "first seq", res.Messages[0].SequenceNumber)
+	} else if res.ConfirmedSequenceNumberMessage != nil {
+		log.Debug("confirmed sequence number", "seq", res.ConfirmedSequenceNumberMessage.SequenceNumber)
+	} else if res.HelloMessage != nil {
+		log.Debug("received feed hello", "url", job.url, "chainId", res.HelloMessage.ChainId)
+	} else {
+		// Servers may send empty messages as heartbeats through proxies that
+		// don't pass control frames on
+		heartbeatsReceivedCounter.Inc(1)
+		log.Trace("received feed heartbeat", "url", job.url, "length", job.frame.size)
+	}
+	if res.Version != 1 {
+		// Version negotiation makes this unexpected, so don't drop messages silently
+		unsupportedVersionCounter.Inc(1)
+		log.Warn("ignoring feed message with unsupported version", "url", job.url, "version", res.Version, "supportedVersions", wsbroadcastserver.SupportedFeedMessageVersions)
+		return true
+	}
+	batch := deliveryBatch{ctx: job.ctx, frames: 1, bytes: job.frame.size}
+	var messages []*broadcaster.BroadcastFeedMessage
+	if len(res.Messages) > 0 {
+		messages = bc.sequenceMessages(job.valid)
+	}
+	if res.ConfirmedSequenceNumberMessage != nil {
+		confirmedSeq := res.ConfirmedSequenceNumberMessage.SequenceNumber
+		batch.confirmedSeq = &confirmedSeq
+		messages = append(messages, bc.pruneHeldMessages(confirmedSeq)...)
+	}
+	if len(messages) > 0 {
+		batch.messages = bc.dropStaleMessages(bc.filterMessages(messages))
+	}
+	if len(batch.messages) > 0 || batch.confirmedSeq != nil {
+		queued = bc.queueDelivery(ctx, batch)
+		return queued
+	}
+	return true
+}
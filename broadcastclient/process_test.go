@@ -0,0 +1,69 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/offchainlabs/nitro/arbos/arbostypes"
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+	"github.com/offchainlabs/nitro/util/signature"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+func TestReceiveMessagesWithDecodeWorkers(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	messageCount := 200
+	chainId := uint64(9742)
+
+	privateKey, err := crypto.GenerateKey()
+	Require(t, err)
+	sequencerAddr := crypto.PubkeyToAddress(privateKey.PublicKey)
+	dataSigner := signature.DataSignerFromPrivateKey(privateKey)
+
+	feedErrChan := make(chan error, 10)
+	b := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &wsbroadcastserver.DefaultTestBroadcasterConfig }, chainId, feedErrChan, dataSigner)
+	Require(t, b.Initialize())
+	Require(t, b.Start(ctx))
+	defer b.StopAndWait()
+
+	config := DefaultTestConfig
+	config.Decode.Workers = 4
+	ts := NewDummyTransactionStreamer(chainId, &sequencerAddr)
+	broadcastClient, err := newTestBroadcastClient(config, b.ListenerAddr(), chainId, 0, ts, feedErrChan, &sequencerAddr)
+	Require(t, err)
+	broadcastClient.Start(ctx)
+	defer broadcastClient.StopAndWait()
+
+	for b.ClientCount() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	go func() {
+		for i := 0; i < messageCount; i++ {
+			Require(t, b.BroadcastSingle(arbostypes.TestMessageWithMetadataAndRequestId, arbutil.MessageIndex(i)))
+		}
+	}()
+
+	// Frames are decoded concurrently but must still be delivered in order
+	for i := 0; i < messageCount; i++ {
+		select {
+		case message := <-ts.messageReceiver:
+			if message.SequenceNumber != arbutil.MessageIndex(i) {
+				t.Fatalf("received sequence number %d, expected %d", message.SequenceNumber, i)
+			}
+		case err := <-feedErrChan:
+			t.Fatalf("feed error: %v", err)
+		case <-time.After(10 * time.Second):
+			t.Fatalf("received %d messages, expected %d", i, messageCount)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// NetDialFunc opens the network connection a websocket connection to the feed
+// is established over
+type NetDialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// proxyURL returns the proxy to reach the feed through, or nil to connect
+// directly. An explicitly configured proxy takes precedence over the standard
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+func (c *Config) proxyURL(feedURL string) (*url.URL, error) {
+	if c.Dial.Proxy != "" {
+		return url.Parse(c.Dial.Proxy)
+	}
+	u, err := url.Parse(feedURL)
+	if err != nil {
+		return nil, err
+	}
+	// The environment variables are keyed on the http schemes
+	switch u.Scheme {
+	case "ws", grpcScheme:
+		u.Scheme = "http"
+	case "wss", grpcTLSScheme:
+		u.Scheme = "https"
+	}
+	return http.ProxyFromEnvironment(&http.Request{URL: u})
+}
+
+// proxyNetDial returns a dial function that tunnels connections through the
+// given HTTP or SOCKS5 proxy.
+func proxyNetDial(proxyURL *url.URL) (NetDialFunc, error) {
+	switch proxyURL.Scheme {
+	case "http", "https":
+		return func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialHTTPConnect(ctx, proxyURL, network, addr)
+		}, nil
+	case "socks5", "socks5h":
+		var auth *proxy.Auth
+		if proxyURL.User != nil {
+			password, _ := proxyURL.User.Password()
+			auth = &proxy.Auth{User: proxyURL.User.Username(), Password: password}
+		}
+		dialer, err := proxy.SOCKS5("tcp", proxyHostPort(proxyURL), auth, &net.Dialer{})
+		if err != nil {
+			return nil, err
+		}
+		contextDialer, ok := dialer.(proxy.ContextDialer)
+		if !ok {
+			return nil, errors.New("socks5 dialer does not support contexts")
+		}
+		return contextDialer.DialContext, nil
+	default:
+		return nil, fmt.Errorf("unsupported feed proxy scheme %q", proxyURL.Scheme)
+	}
+}
+
+func proxyHostPort(proxyURL *url.URL) string {
+	if proxyURL.Port() != "" {
+		return proxyURL.Host
+	}
+	switch proxyURL.Scheme {
+	case "https":
+		return net.JoinHostPort(proxyURL.Hostname(), "443")
+	case "socks5", "socks5h":
+		return net.JoinHostPort(proxyURL.Hostname(), "1080")
+	default:
+		return net.JoinHostPort(proxyURL.Hostname(), "80")
+	}
+}
+
+// dialHTTPConnect opens a tunnel to addr using the HTTP CONNECT method
+func dialHTTPConnect(ctx context.Context, proxyURL *url.URL, network, addr string) (net.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, proxyHostPort(proxyURL))
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL.Scheme == "https" {
+		conn = tls.Client(conn, &tls.Config{
+			ServerName: proxyURL.Hostname(),
+			MinVersion: tls.VersionTLS12,
+		})
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxyURL.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to send CONNECT to feed proxy: %w", err)
+	}
+	// Nothing is sent through the tunnel before the client speaks, so the
+	// buffered reader can't swallow any of the feed's data
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to read CONNECT response from feed proxy: %w", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_ = conn.Close()
+		return nil, fmt.Errorf("feed proxy refused CONNECT: %s", strings.TrimSpace(resp.Status))
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return conn, nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/offchainlabs/nitro/arbos/arbostypes"
+	"github.com/offchainlabs/nitro/broadcaster"
+	"github.com/offchainlabs/nitro/util/signature"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+func TestBroadcastClientThroughHTTPProxy(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	settings := wsbroadcastserver.DefaultTestBroadcasterConfig
+
+	privateKey, err := crypto.GenerateKey()
+	Require(t, err)
+	sequencerAddr := crypto.PubkeyToAddress(privateKey.PublicKey)
+	dataSigner := signature.DataSignerFromPrivateKey(privateKey)
+
+	feedErrChan := make(chan error, 10)
+	chainId := uint64(8747)
+	b := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &settings }, chainId, feedErrChan, dataSigner)
+
+	Require(t, b.Initialize())
+	Require(t, b.Start(ctx))
+	defer b.StopAndWait()
+
+	// Minimal HTTP CONNECT proxy
+	proxyListener, err := net.Listen("tcp", "127.0.0.1:0")
+	Require(t, err)
+	defer proxyListener.Close()
+	var tunnels int32
+	go func() {
+		for {
+			conn, err := proxyListener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				req, err := http.ReadRequest(bufio.NewReader(conn))
+				if err != nil || req.Method != http.MethodConnect {
+					return
+				}
+				target, err := net.Dial("tcp", req.Host)
+				if err != nil {
+					return
+				}
+				defer target.Close()
+				atomic.AddInt32(&tunnels, 1)
+				if _, err := conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n")); err != nil {
+					return
+				}
+				go func() { _, _ = io.Copy(target, conn) }()
+				_, _ = io.Copy(conn, target)
+			}()
+		}
+	}()
+
+	config := DefaultTestConfig
+	config.Dial.Proxy = "http://" + proxyListener.Addr().String()
+	ts := NewDummyTransactionStreamer(chainId, nil)
+	broadcastClient, err := newTestBroadcastClient(config, b.ListenerAddr(), chainId, 0, ts, feedErrChan, &sequencerAddr)
+	Require(t, err)
+	broadcastClient.Start(ctx)
+	defer broadcastClient.StopAndWait()
+
+	Require(t, b.BroadcastSingle(arbostypes.EmptyTestMessageWithMetadata, 0))
+
+	timer := time.NewTimer(5 * time.Second)
+	defer timer.Stop()
+	select {
+	case err := <-feedErrChan:
+		t.Fatalf("Broadcaster error: %s", err.Error())
+	case <-ts.messageReceiver:
+	case <-timer.C:
+		t.Fatal("Client did not receive message through proxy")
+	}
+	if atomic.LoadInt32(&tunnels) == 0 {
+		t.Fatal("Client did not connect through proxy")
+	}
+}
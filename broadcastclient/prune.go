@@ -0,0 +1,65 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+)
+
+var prunedHeldCounter = metrics.NewRegisteredCounter("arb/feed/prune/held", nil)
+
+// PruneFunc is called with the sequence number confirmed on the parent chain
+// whenever it increases, after which nothing up to it needs to be kept in
+// memory or on disk for the feed. Called from the delivery thread, after the
+// handlers and subscribers were notified.
+type PruneFunc func(confirmed arbutil.MessageIndex)
+
+// AddPruneCallback registers a function to prune state kept for the feed with
+// once messages are confirmed
+func (bc *BroadcastClient) AddPruneCallback(prune PruneFunc) {
+	bc.handlersMutex.Lock()
+	defer bc.handlersMutex.Unlock()
+	bc.pruneCallbacks = append(bc.pruneCallbacks, prune)
+}
+
+func (bc *BroadcastClient) currentPruneCallbacks() []PruneFunc {
+	bc.handlersMutex.Lock()
+	defer bc.handlersMutex.Unlock()
+	return bc.pruneCallbacks
+}
+
+// pruneConfirmed calls the prune callbacks if the confirmed sequence number
+// increased. Only called from the delivery thread.
+func (bc *BroadcastClient) pruneConfirmed(confirmed arbutil.MessageIndex) {
+	if bc.pruned && confirmed <= bc.prunedThrough {
+		return
+	}
+	bc.pruned = true
+	bc.prunedThrough = confirmed
+	for _, prune := range bc.currentPruneCallbacks() {
+		prune(confirmed)
+	}
+}
+
+// pruneHeldMessages drops the messages held past a sequence gap that are
+// confirmed on the parent chain, which fills the gap for the node. The cursor
+// moves past the confirmed sequence number and the messages held right after
+// it are returned for delivery. Only called from the reader thread, or the
+// processing thread when decoding in workers.
+func (bc *BroadcastClient) pruneHeldMessages(confirmed arbutil.MessageIndex) []*broadcaster.BroadcastFeedMessage {
+	if bc.reorderBuffer.len() == 0 || confirmed < bc.nextSeqNum {
+		return nil
+	}
+	pruned := bc.reorderBuffer.pruneThrough(confirmed)
+	prunedHeldCounter.Inc(int64(pruned))
+	log.Info("sequence gap in sequencer feed confirmed on parent chain", "url", bc.statusURL(), "expected", bc.nextSeqNum, "confirmed", confirmed, "pruned", pruned)
+	bc.nextSeqNum = confirmed + 1
+	run := bc.reorderBuffer.popRun(bc.nextSeqNum)
+	bc.nextSeqNum += arbutil.MessageIndex(len(run))
+	return run
+}
@@ -0,0 +1,56 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"testing"
+
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+)
+
+func TestPruneConfirmed(t *testing.T) {
+	var pruned []arbutil.MessageIndex
+	config := DefaultTestConfig
+	config.Delivery.HoldOnGap = true
+	broadcastClient, err := NewBroadcastClientWithOptions(
+		"",
+		WithConfig(func() *Config { return &config }),
+		WithMessageCount(5),
+		WithPruneCallback(func(confirmed arbutil.MessageIndex) { pruned = append(pruned, confirmed) }),
+	)
+	Require(t, err)
+	feedMessages := func(seqNums ...arbutil.MessageIndex) []*broadcaster.BroadcastFeedMessage {
+		messages := make([]*broadcaster.BroadcastFeedMessage, 0, len(seqNums))
+		for _, seqNum := range seqNums {
+			messages = append(messages, &broadcaster.BroadcastFeedMessage{SequenceNumber: seqNum})
+		}
+		return messages
+	}
+
+	broadcastClient.sequenceMessages(feedMessages(5, 8, 9, 11))
+	if held := broadcastClient.pruneHeldMessages(4); held != nil {
+		t.Fatalf("expected nothing released below the cursor, got %d messages", len(held))
+	}
+	// Confirming 7 fills the gap before 8, 11 is still held past the next one
+	held := broadcastClient.pruneHeldMessages(7)
+	if len(held) != 2 || held[0].SequenceNumber != 8 || held[1].SequenceNumber != 9 {
+		t.Fatalf("expected 8 and 9 released, got %d messages", len(held))
+	}
+	if broadcastClient.nextSeqNum != 10 || broadcastClient.reorderBuffer.len() != 1 {
+		t.Fatalf("expected next sequence number 10 with 1 held, got %d with %d held", broadcastClient.nextSeqNum, broadcastClient.reorderBuffer.len())
+	}
+	// Held messages confirmed themselves are dropped
+	if held := broadcastClient.pruneHeldMessages(12); len(held) != 0 || broadcastClient.reorderBuffer.len() != 0 || broadcastClient.nextSeqNum != 13 {
+		t.Fatalf("expected confirmed held message dropped, got %d released, %d held", len(held), broadcastClient.reorderBuffer.len())
+	}
+
+	// Callbacks are only called when the confirmed sequence number increases
+	for _, confirmed := range []arbutil.MessageIndex{3, 3, 2, 7} {
+		broadcastClient.deliverConfirmedSeq(confirmed)
+	}
+	if len(pruned) != 2 || pruned[0] != 3 || pruned[1] != 7 {
+		t.Fatalf("expected pruning at 3 and 7, got %v", pruned)
+	}
+}
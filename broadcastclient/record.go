@@ -0,0 +1,329 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	flag "github.com/spf13/pflag"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+)
+
+var (
+	recordedFramesCounter = metrics.NewRegisteredCounter("arb/feed/record/frames", nil)
+	recordedBytesCounter  = metrics.NewRegisteredCounter("arb/feed/record/bytes", nil)
+	recordErrorsCounter   = metrics.NewRegisteredCounter("arb/feed/record/errors", nil)
+	recordPrunedCounter   = metrics.NewRegisteredCounter("arb/feed/record/pruned", nil)
+)
+
+const (
+	recordingPrefix     = "feed-"
+	recordingSuffix     = ".rec"
+	recordingTimeFormat = "20060102T150405.000000000Z"
+
+	// Each frame is recorded as the receive time in unix nanoseconds, a flags
+	// byte and the payload length, all big endian, followed by the payload
+	recordHeaderSize = 8 + 1 + 4
+	recordFlagBinary = 1
+)
+
+var ErrRecordTruncated = errors.New("feed recording ends in a partial frame")
+
+// RecordConfig configures recording the frames read from the feed to disk, for
+// investigating incidents or replaying production traffic in tests
+type RecordConfig struct {
+	Dir            string `koanf:"dir"`
+	MaxFileSize    int64  `koanf:"max-file-size" reload:"hot"`
+	MaxFiles       int    `koanf:"max-files" reload:"hot"`
+	PruneConfirmed bool   `koanf:"prune-confirmed" reload:"hot"`
+}
+
+func RecordConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.String(prefix+".dir", DefaultRecordConfig.Dir, "directory to record every frame read from the sequencer feed to, with the time it was received (empty = disabled)")
+	f.Int64(prefix+".max-file-size", DefaultRecordConfig.MaxFileSize, "size in bytes after which the feed recording is continued in a new file")
+	f.Int(prefix+".max-files", DefaultRecordConfig.MaxFiles, "number of feed recording files to keep, the oldest being deleted on rotation (0 = keep all)")
+	f.Bool(prefix+".prune-confirmed", DefaultRecordConfig.PruneConfirmed, "delete the feed recording files written by this run once every message in them is confirmed on the parent chain")
+}
+
+var DefaultRecordConfig = RecordConfig{
+	MaxFileSize:    256 * 1024 * 1024,
+	MaxFiles:       16,
+	PruneConfirmed: false,
+}
+
+func (c *RecordConfig) Validate() error {
+	if c.Dir == "" {
+		return nil
+	}
+	if c.MaxFileSize <= 0 {
+		return errors.New("feed recording max file size must be positive")
+	}
+	if c.MaxFiles < 0 {
+		return errors.New("feed recording max files must not be negative")
+	}
+	return nil
+}
+
+// RecordedFrame is a frame read back from a feed recording
+type RecordedFrame struct {
+	Received time.Time
+	Binary   bool
+	Payload  []byte
+}
+
+// recordingFile tracks the messages in a recording file written by this run,
+// to know when it can be pruned
+type recordingFile struct {
+	path        string
+	hasMessages bool
+	lastSeqNum  arbutil.MessageIndex
+}
+
+// recorder appends the frames read from the feed to the current recording
+// file, starting a new one once it's full
+type recorder struct {
+	dir    string
+	config func() *RecordConfig
+
+	mutex sync.Mutex
+	file  *os.File
+	size  int64
+	// Generation of the current file, each file gets the next one
+	generation uint64
+	files      map[uint64]*recordingFile
+	// Every frame recorded to files of lower generations was processed
+	processed uint64
+}
+
+func newRecorder(dir string, config func() *RecordConfig) (*recorder, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating feed recording directory: %w", err)
+	}
+	return &recorder{dir: dir, config: config, files: make(map[uint64]*recordingFile)}, nil
+}
+
+// record appends a frame, logging rather than returning errors as recording
+// mustn't interrupt reading the feed. A file that failed to be written is
+// closed, so the next frame starts a new one. Returns the generation of the
+// file the frame was recorded to, 0 if it wasn't.
+func (r *recorder) record(received time.Time, binaryFrame bool, payload []byte) uint64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	size := int64(recordHeaderSize + len(payload))
+	if r.file != nil && r.size > 0 && r.size+size > r.config().MaxFileSize {
+		r.closeFile()
+	}
+	if r.file == nil {
+		if err := r.openFile(received); err != nil {
+			recordErrorsCounter.Inc(1)
+			log.Warn("error opening sequencer feed recording", "dir", r.dir, "err", err)
+			return 0
+		}
+	}
+	record := make([]byte, recordHeaderSize, size)
+	binary.BigEndian.PutUint64(record, uint64(received.UnixNano()))
+	if binaryFrame {
+		record[8] = recordFlagBinary
+	}
+	binary.BigEndian.PutUint32(record[9:], uint32(len(payload)))
+	record = append(record, payload...)
+	if _, err := r.file.Write(record); err != nil {
+		recordErrorsCounter.Inc(1)
+		log.Warn("error writing sequencer feed recording", "path", r.file.Name(), "err", err)
+		r.closeFile()
+		return 0
+	}
+	r.size += size
+	recordedFramesCounter.Inc(1)
+	recordedBytesCounter.Inc(size)
+	return r.generation
+}
+
+// recorded notes the messages of a frame recorded to the file of generation
+// once it's processed. Frames are processed in the order they were recorded.
+func (r *recorder) recorded(generation uint64, messages []*broadcaster.BroadcastFeedMessage) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.processed = generation
+	file, ok := r.files[generation]
+	if !ok {
+		return
+	}
+	for _, message := range messages {
+		if !file.hasMessages || message.SequenceNumber > file.lastSeqNum {
+			file.hasMessages = true
+			file.lastSeqNum = message.SequenceNumber
+		}
+	}
+}
+
+// pruneConfirmed deletes the recording files written by this run whose
+// messages are all confirmed, if PruneConfirmed is set. Files still being
+// written to or with frames not yet processed are kept.
+func (r *recorder) pruneConfirmed(confirmed arbutil.MessageIndex) {
+	if !r.config().PruneConfirmed {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for generation, file := range r.files {
+		if generation >= r.processed || (r.file != nil && generation == r.generation) {
+			continue
+		}
+		if file.hasMessages && file.lastSeqNum > confirmed {
+			continue
+		}
+		if err := os.Remove(file.path); err != nil && !os.IsNotExist(err) {
+			log.Warn("error deleting confirmed sequencer feed recording", "path", file.path, "err", err)
+			continue
+		}
+		delete(r.files, generation)
+		recordPrunedCounter.Inc(1)
+		log.Debug("deleted confirmed sequencer feed recording", "path", file.path, "confirmed", confirmed)
+	}
+}
+
+// openFile starts a new recording file named after the time of its first
+// frame, deleting the oldest files beyond MaxFiles
+func (r *recorder) openFile(received time.Time) error {
+	name := recordingPrefix + received.UTC().Format(recordingTimeFormat) + recordingSuffix
+	file, err := os.OpenFile(filepath.Join(r.dir, name), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	r.file = file
+	r.size = info.Size()
+	r.generation++
+	r.files[r.generation] = &recordingFile{path: file.Name()}
+	r.prune()
+	return nil
+}
+
+// prune deletes the oldest recording files beyond MaxFiles
+func (r *recorder) prune() {
+	maxFiles := r.config().MaxFiles
+	if maxFiles <= 0 {
+		return
+	}
+	files, err := RecordingFiles(r.dir)
+	if err != nil {
+		log.Warn("error listing sequencer feed recordings", "dir", r.dir, "err", err)
+		return
+	}
+	for len(files) > maxFiles {
+		if err := os.Remove(files[0]); err != nil {
+			log.Warn("error deleting sequencer feed recording", "path", files[0], "err", err)
+		}
+		for generation, file := range r.files {
+			if file.path == files[0] {
+				delete(r.files, generation)
+			}
+		}
+		files = files[1:]
+	}
+}
+
+func (r *recorder) closeFile() {
+	if err := r.file.Close(); err != nil {
+		log.Warn("error closing sequencer feed recording", "path", r.file.Name(), "err", err)
+	}
+	r.file = nil
+	r.size = 0
+}
+
+func (r *recorder) close() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.file != nil {
+		r.closeFile()
+	}
+}
+
+// RecordingFiles returns the paths of the feed recording files in dir, oldest
+// first
+func RecordingFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Type().IsRegular() && strings.HasPrefix(name, recordingPrefix) && strings.HasSuffix(name, recordingSuffix) {
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+	// The names sort by the time of their first frame
+	sort.Strings(files)
+	return files, nil
+}
+
+// ReadRecording calls fn with every frame of a feed recording in order,
+// stopping at the first error fn returns. The payload is only valid during the
+// call. A recording that ends in a partial frame, as after a crash, fails with
+// ErrRecordTruncated once the frames before it have been read.
+func ReadRecording(r io.Reader, fn func(frame *RecordedFrame) error) error {
+	var header [recordHeaderSize]byte
+	var payload []byte
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return ErrRecordTruncated
+			}
+			return err
+		}
+		length := binary.BigEndian.Uint32(header[9:])
+		if uint32(cap(payload)) < length {
+			payload = make([]byte, length)
+		}
+		payload = payload[:length]
+		if _, err := io.ReadFull(r, payload); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return ErrRecordTruncated
+			}
+			return err
+		}
+		frame := &RecordedFrame{
+			Received: time.Unix(0, int64(binary.BigEndian.Uint64(header[:8]))),
+			Binary:   header[8]&recordFlagBinary != 0,
+			Payload:  payload,
+		}
+		if err := fn(frame); err != nil {
+			return err
+		}
+	}
+}
+
+// ReadRecordingFile reads a feed recording file with ReadRecording
+func ReadRecordingFile(path string, fn func(frame *RecordedFrame) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return ReadRecording(bufio.NewReader(file), fn)
+}
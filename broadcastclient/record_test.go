@@ -0,0 +1,101 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/offchainlabs/nitro/arbos/arbostypes"
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+func TestBroadcastClientRecordsFrames(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	config := wsbroadcastserver.DefaultTestBroadcasterConfig
+	feedErrChan := make(chan error, 10)
+	chainId := uint64(8742)
+	b := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &config }, chainId, feedErrChan, nil)
+	Require(t, b.Initialize())
+	Require(t, b.Start(ctx))
+	defer b.StopAndWait()
+
+	dir := t.TempDir()
+	clientConfig := DefaultTestConfig
+	clientConfig.Verify.Dangerous.AcceptMissing = true
+	clientConfig.Record.Dir = dir
+	// Every frame starts a new file
+	clientConfig.Record.MaxFileSize = 1
+	clientConfig.Record.MaxFiles = 2
+	handler := &recordingHandler{make(chan arbutil.MessageIndex, 10), make(chan arbutil.MessageIndex, 10)}
+	broadcastClient, err := NewBroadcastClientWithOptions(
+		fmt.Sprintf("ws://127.0.0.1:%d/", b.ListenerAddr().(*net.TCPAddr).Port),
+		WithConfig(func() *Config { return &clientConfig }),
+		WithChainId(chainId),
+		WithFatalErrChan(feedErrChan),
+		WithHandler(handler),
+	)
+	Require(t, err)
+	broadcastClient.Start(ctx)
+
+	for b.ClientCount() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		Require(t, b.BroadcastSingle(arbostypes.EmptyTestMessageWithMetadata, arbutil.MessageIndex(i)))
+		select {
+		case <-handler.messages:
+		case err := <-feedErrChan:
+			t.Fatalf("feed error: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("client did not deliver the message")
+		}
+	}
+	broadcastClient.StopAndWait()
+
+	files, err := RecordingFiles(dir)
+	Require(t, err)
+	if len(files) != 2 {
+		t.Fatalf("expected 2 recording files after rotation, got %v", files)
+	}
+	var seqNums []arbutil.MessageIndex
+	for _, file := range files {
+		Require(t, ReadRecordingFile(file, func(frame *RecordedFrame) error {
+			if frame.Received.Before(start) || frame.Received.After(time.Now()) {
+				t.Errorf("frame recorded with receive time %v", frame.Received)
+			}
+			var msg broadcaster.BroadcastMessage
+			if err := json.Unmarshal(frame.Payload, &msg); err != nil {
+				return err
+			}
+			for _, message := range msg.Messages {
+				seqNums = append(seqNums, message.SequenceNumber)
+			}
+			return nil
+		}))
+	}
+	if len(seqNums) == 0 || seqNums[len(seqNums)-1] != 2 {
+		t.Fatalf("expected the recording to end with sequence number 2, got %v", seqNums)
+	}
+
+	data, err := os.ReadFile(files[len(files)-1])
+	Require(t, err)
+	err = ReadRecording(bytes.NewReader(data[:len(data)-1]), func(*RecordedFrame) error { return nil })
+	if !errors.Is(err, ErrRecordTruncated) {
+		t.Fatalf("expected a truncated recording error, got %v", err)
+	}
+}
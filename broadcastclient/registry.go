@@ -0,0 +1,138 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+
+	"github.com/offchainlabs/nitro/util/signature"
+)
+
+// The registry contract returns the feed URLs along with a signature over each
+// of them by an allowed feed signer
+const feedRegistryABI = `[{"inputs":[],"name":"feedEndpoints","outputs":[{"internalType":"string[]","name":"urls","type":"string[]"},{"internalType":"bytes[]","name":"signatures","type":"bytes[]"}],"stateMutability":"view","type":"function"}]`
+
+var feedRegistryEntryPrefix = []byte("Arbitrum feed endpoint")
+
+var errNoRegistryCaller = errors.New("no chain client to read the feed registry contract with")
+
+type feedRegistry interface {
+	feedEndpoints(ctx context.Context) ([]string, [][]byte, error)
+}
+
+// contractFeedRegistry reads the feed URLs from a registry contract
+type contractFeedRegistry struct {
+	caller  ethereum.ContractCaller
+	address common.Address
+	abi     abi.ABI
+}
+
+func newContractFeedRegistry(caller ethereum.ContractCaller, address common.Address) (*contractFeedRegistry, error) {
+	parsed, err := abi.JSON(strings.NewReader(feedRegistryABI))
+	if err != nil {
+		return nil, err
+	}
+	return &contractFeedRegistry{
+		caller:  caller,
+		address: address,
+		abi:     parsed,
+	}, nil
+}
+
+func (r *contractFeedRegistry) feedEndpoints(ctx context.Context) ([]string, [][]byte, error) {
+	data, err := r.abi.Pack("feedEndpoints")
+	if err != nil {
+		return nil, nil, err
+	}
+	result, err := r.caller.CallContract(ctx, ethereum.CallMsg{To: &r.address, Data: data}, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	outputs, err := r.abi.Unpack("feedEndpoints", result)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(outputs) != 2 {
+		return nil, nil, fmt.Errorf("unexpected number of outputs from feed registry: %d", len(outputs))
+	}
+	urls, ok := outputs[0].([]string)
+	if !ok {
+		return nil, nil, fmt.Errorf("unexpected feed registry urls type %T", outputs[0])
+	}
+	signatures, ok := outputs[1].([][]byte)
+	if !ok {
+		return nil, nil, fmt.Errorf("unexpected feed registry signatures type %T", outputs[1])
+	}
+	if len(urls) != len(signatures) {
+		return nil, nil, fmt.Errorf("feed registry returned %d urls but %d signatures", len(urls), len(signatures))
+	}
+	return urls, signatures, nil
+}
+
+// SetRegistryCaller sets the chain client the feed registry contract is read
+// with when discovery uses a registry, must be called before Start.
+func (bc *BroadcastClient) SetRegistryCaller(caller ethereum.ContractCaller) error {
+	config := bc.config().Discovery
+	if !config.Enable() || config.Type != "registry" {
+		return nil
+	}
+	registry, err := newContractFeedRegistry(caller, common.HexToAddress(config.Record))
+	if err != nil {
+		return err
+	}
+	bc.registry = registry
+	return nil
+}
+
+// FeedRegistryEntryHash is the hash a feed signer signs to list url in the
+// registry of the given chain
+func FeedRegistryEntryHash(chainId uint64, url string) common.Hash {
+	var chainIdBytes [8]byte
+	binary.BigEndian.PutUint64(chainIdBytes[:], chainId)
+	return crypto.Keccak256Hash(feedRegistryEntryPrefix, chainIdBytes[:], []byte(url))
+}
+
+// registryFeedURLs reads the feed URLs from the registry, skipping entries
+// that aren't signed by an allowed feed signer. Unlike feed messages, unsigned
+// entries are never accepted.
+func (bc *BroadcastClient) registryFeedURLs(ctx context.Context) ([]string, error) {
+	if bc.registry == nil {
+		return nil, errNoRegistryCaller
+	}
+	entries, signatures, err := bc.registry.feedEndpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// The reader thread owns the cached verifier
+	sigVerifier, err := signature.NewVerifier(bc.config().verifierConfig(), bc.bpVerifier)
+	if err != nil {
+		return nil, err
+	}
+	urls := make([]string, 0, len(entries))
+	for i, url := range entries {
+		if len(signatures[i]) == 0 {
+			log.Warn("ignoring unsigned feed registry entry", "url", url)
+			continue
+		}
+		if err := sigVerifier.VerifyHash(ctx, signatures[i], FeedRegistryEntryHash(bc.chainId, url)); err != nil {
+			log.Warn("ignoring feed registry entry with invalid signature", "url", url, "err", err)
+			continue
+		}
+		urls = append(urls, url)
+	}
+	if len(urls) == 0 {
+		return nil, errors.New("no validly signed feed urls in registry")
+	}
+	return urls, nil
+}
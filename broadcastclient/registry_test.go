@@ -0,0 +1,67 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/offchainlabs/nitro/util/signature"
+)
+
+type fakeFeedRegistry struct {
+	urls       []string
+	signatures [][]byte
+}
+
+func (r *fakeFeedRegistry) feedEndpoints(ctx context.Context) ([]string, [][]byte, error) {
+	return r.urls, r.signatures, nil
+}
+
+func TestFeedRegistryDiscovery(t *testing.T) {
+	chainId := uint64(9743)
+	signerKey, err := crypto.GenerateKey()
+	Require(t, err)
+	otherKey, err := crypto.GenerateKey()
+	Require(t, err)
+
+	config := DefaultTestConfig
+	config.Verify = signature.TestingFeedVerifierConfig
+	config.AllowedSigners = []string{crypto.PubkeyToAddress(signerKey.PublicKey).Hex()}
+	config.Discovery.Type = "registry"
+	config.Discovery.Record = "0x0000000000000000000000000000000000000a4b"
+	Require(t, config.Validate())
+	broadcastClient, err := NewBroadcastClient(func() *Config { return &config }, nil, chainId, 0, nil, nil, nil, func(_ int32) {}, nil)
+	Require(t, err)
+	ctx := context.Background()
+
+	// Without a chain client nothing can be discovered
+	broadcastClient.discover(ctx)
+	if broadcastClient.hasPendingURLs() {
+		t.Fatal("feed urls discovered without a registry")
+	}
+
+	sign := func(key *ecdsa.PrivateKey, url string) []byte {
+		sig, err := crypto.Sign(FeedRegistryEntryHash(chainId, url).Bytes(), key)
+		Require(t, err)
+		return sig
+	}
+	broadcastClient.registry = &fakeFeedRegistry{
+		urls: []string{"wss://relay-a.example.com", "wss://relay-b.example.com", "wss://relay-c.example.com"},
+		signatures: [][]byte{
+			sign(signerKey, "wss://relay-a.example.com"),
+			sign(otherKey, "wss://relay-b.example.com"),
+			nil,
+		},
+	}
+	broadcastClient.discover(ctx)
+	expected := []string{"wss://relay-a.example.com"}
+	if !reflect.DeepEqual(broadcastClient.pendingURLs, expected) {
+		t.Fatalf("expected registry urls %v, got %v", expected, broadcastClient.pendingURLs)
+	}
+}
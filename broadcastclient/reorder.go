@@ -0,0 +1,94 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"sort"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+)
+
+var reorderBufferGauge = metrics.NewRegisteredGauge("arb/feed/sequence/held", nil)
+
+// reorderBuffer holds feed messages received ahead of the next expected
+// sequence number, so they can be delivered in order once the gap is filled.
+// It is not thread safe, except for held.
+type reorderBuffer struct {
+	messages map[arbutil.MessageIndex]*broadcaster.BroadcastFeedMessage
+	// Number of messages, use atomic access
+	count int64
+}
+
+func newReorderBuffer() *reorderBuffer {
+	return &reorderBuffer{messages: make(map[arbutil.MessageIndex]*broadcaster.BroadcastFeedMessage)}
+}
+
+func (b *reorderBuffer) len() int {
+	return len(b.messages)
+}
+
+// held returns the number of messages held, safe to call from any thread
+func (b *reorderBuffer) held() int64 {
+	return atomic.LoadInt64(&b.count)
+}
+
+func (b *reorderBuffer) updated() {
+	atomic.StoreInt64(&b.count, int64(len(b.messages)))
+	reorderBufferGauge.Update(int64(len(b.messages)))
+}
+
+func (b *reorderBuffer) add(message *broadcaster.BroadcastFeedMessage) {
+	b.messages[message.SequenceNumber] = message
+	b.updated()
+}
+
+// popRun removes and returns the contiguous run of messages starting at seqNum
+func (b *reorderBuffer) popRun(seqNum arbutil.MessageIndex) []*broadcaster.BroadcastFeedMessage {
+	var run []*broadcaster.BroadcastFeedMessage
+	for {
+		message, ok := b.messages[seqNum]
+		if !ok {
+			break
+		}
+		delete(b.messages, seqNum)
+		run = append(run, message)
+		seqNum++
+	}
+	b.updated()
+	return run
+}
+
+// pruneThrough removes the messages up to and including seqNum, returns how
+// many were removed
+func (b *reorderBuffer) pruneThrough(seqNum arbutil.MessageIndex) int {
+	pruned := 0
+	for held := range b.messages {
+		if held <= seqNum {
+			delete(b.messages, held)
+			pruned++
+		}
+	}
+	b.updated()
+	return pruned
+}
+
+// drain removes and returns all messages in sequence order, gaps included
+func (b *reorderBuffer) drain() []*broadcaster.BroadcastFeedMessage {
+	messages := make([]*broadcaster.BroadcastFeedMessage, 0, len(b.messages))
+	for _, message := range b.messages {
+		messages = append(messages, message)
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].SequenceNumber < messages[j].SequenceNumber })
+	b.clear()
+	return messages
+}
+
+func (b *reorderBuffer) clear() {
+	b.messages = make(map[arbutil.MessageIndex]*broadcaster.BroadcastFeedMessage)
+	b.updated()
+}
@@ -0,0 +1,235 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/gobwas/ws"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+var (
+	replayedFramesCounter  = metrics.NewRegisteredCounter("arb/feed/replay/frames", nil)
+	replaysFinishedCounter = metrics.NewRegisteredCounter("arb/feed/replay/finished", nil)
+)
+
+// replayScheme is the scheme of feed URLs replaying a recording made with
+// record.dir instead of connecting to a feed, e.g.
+// file:///var/lib/nitro/feed-recording for a directory of recording files or
+// the path of a single one
+const replayScheme = "file"
+
+// replayFlagHeartbeat marks a frame written while the replay waits to pace the
+// next recorded frame, so the reader doesn't time out. It's only used between
+// the replay and the reader, never recorded.
+const replayFlagHeartbeat = 1 << 7
+
+// replayPath returns the recording path of a file:// feed URL
+func replayPath(feedURL string) (string, bool) {
+	u, err := url.Parse(feedURL)
+	if err != nil || u.Scheme != replayScheme {
+		return "", false
+	}
+	return u.Path, true
+}
+
+// replayFiles returns the recording files at path, oldest first
+func replayFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	files, err := RecordingFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no feed recordings in %s", path)
+	}
+	return files, nil
+}
+
+// dialReplay starts replaying the recording at path. Returns the end of the
+// pipe the frames are written to and the reader they are read from, which the
+// reader thread treats like any other feed connection.
+func dialReplay(path string, speed float64, heartbeat time.Duration) (net.Conn, *bufio.Reader, error) {
+	files, err := replayFiles(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to replay feed recording: %w", err)
+	}
+	client, server := net.Pipe()
+	go replayRecording(server, path, files, speed, heartbeat)
+	return client, bufio.NewReader(client), nil
+}
+
+// replayRecording writes the frames of the recording files to conn, paced as
+// they were received sped up by speed, or as fast as they're read if speed is
+// 0. Once the recording ends the replay idles like a quiet feed until conn is
+// closed.
+func replayRecording(conn net.Conn, path string, files []string, speed float64, heartbeat time.Duration) {
+	defer conn.Close()
+	start := time.Now()
+	var first time.Time
+	for _, file := range files {
+		err := ReadRecordingFile(file, func(frame *RecordedFrame) error {
+			if speed > 0 {
+				if first.IsZero() {
+					first = frame.Received
+				}
+				due := start.Add(time.Duration(float64(frame.Received.Sub(first)) / speed))
+				if err := replayWait(conn, due, heartbeat); err != nil {
+					return err
+				}
+			}
+			var flags byte
+			if frame.Binary {
+				flags = recordFlagBinary
+			}
+			return writeReplayFrame(conn, flags, frame.Payload)
+		})
+		if errors.Is(err, ErrRecordTruncated) {
+			log.Warn("feed recording ends in a partial frame, continuing with the next file", "path", file)
+			continue
+		}
+		if err != nil {
+			if !errors.Is(err, io.ErrClosedPipe) {
+				log.Error("error replaying feed recording", "path", file, "err", err)
+			}
+			return
+		}
+	}
+	replaysFinishedCounter.Inc(1)
+	log.Info("finished replaying sequencer feed recording", "path", path)
+	for writeReplayFrame(conn, replayFlagHeartbeat, nil) == nil {
+		time.Sleep(heartbeat)
+	}
+}
+
+// replayWait waits until due, writing a heartbeat every heartbeat interval.
+// Fails once conn is closed.
+func replayWait(conn net.Conn, due time.Time, heartbeat time.Duration) error {
+	for {
+		wait := time.Until(due)
+		if wait <= 0 {
+			return nil
+		}
+		if wait > heartbeat {
+			wait = heartbeat
+		}
+		time.Sleep(wait)
+		if time.Until(due) > 0 {
+			if err := writeReplayFrame(conn, replayFlagHeartbeat, nil); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func writeReplayFrame(conn net.Conn, flags byte, payload []byte) error {
+	frame := make([]byte, recordHeaderSize, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint64(frame, uint64(time.Now().UnixNano()))
+	frame[8] = flags
+	binary.BigEndian.PutUint32(frame[9:], uint32(len(payload)))
+	_, err := conn.Write(append(frame, payload...))
+	return err
+}
+
+// readReplay reads the next frame of a replayed recording and hands it to
+// consume. A heartbeat is returned as a ping. Fails with ErrFrameTooLarge if
+// the frame is longer than maxSize (0 = unlimited).
+func readReplay(conn net.Conn, br *bufio.Reader, timeout time.Duration, maxSize int64, consume frameConsumer) (ws.OpCode, error) {
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = conn.SetReadDeadline(time.Time{})
+	}()
+	var header [recordHeaderSize]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return 0, err
+	}
+	flags := header[8]
+	if flags&replayFlagHeartbeat != 0 {
+		return ws.OpPing, nil
+	}
+	op := ws.OpText
+	if flags&recordFlagBinary != 0 {
+		op = ws.OpBinary
+	}
+	length := int64(binary.BigEndian.Uint32(header[9:]))
+	if maxSize > 0 && length > maxSize {
+		return op, fmt.Errorf("%w: %d bytes, more than %d", ErrFrameTooLarge, length, maxSize)
+	}
+	payload := io.LimitReader(br, length)
+	err := consume(op, payload)
+	// A streamed decode may stop before the end of the frame
+	if _, discardErr := io.Copy(io.Discard, payload); err == nil {
+		err = discardErr
+	}
+	replayedFramesCounter.Inc(1)
+	return op, err
+}
+
+// connectReplay starts replaying the recording at path in place of connecting
+// to a feed. A recording has no chain id or feed version to check.
+func (bc *BroadcastClient) connectReplay(config *Config, path string) error {
+	heartbeat := bc.readTimeout(config) / 2
+	if heartbeat <= 0 {
+		heartbeat = time.Second
+	}
+	conn, br, err := dialReplay(path, config.ReplaySpeed, heartbeat)
+	if err != nil {
+		return err
+	}
+	bc.connMutex.Lock()
+	if bc.shuttingDown {
+		bc.connMutex.Unlock()
+		_ = conn.Close()
+		return errShuttingDown
+	}
+	bc.conn = conn
+	bc.transport = &replayTransport{body: br}
+	bc.connMutex.Unlock()
+	now := bc.clock.Now().UnixNano()
+	atomic.StoreInt64(&bc.lastProgressUnixNano, now)
+	atomic.StoreInt64(&bc.lastFrameUnixNano, now)
+	bc.updateStatus(func(status *clientStatus) {
+		status.connectedSince = bc.clock.Now()
+		status.connectionBytes = 0
+	})
+	bc.setState(Connected)
+	sourcesConnectsCounter.Inc(1)
+	log.Info("replaying sequencer feed recording", "path", path, "speed", config.ReplaySpeed)
+	return nil
+}
+
+// replayTransport reads the feed from a replayed recording
+type replayTransport struct {
+	body *bufio.Reader
+}
+
+func (t *replayTransport) readFrame(_ context.Context, conn net.Conn, config *Config, timeout time.Duration, consume frameConsumer) (ws.OpCode, bool, error) {
+	op, err := readReplay(conn, t.body, timeout, int64(config.Decode.MaxFrameSize), consume)
+	return op, false, err
+}
+
+func (t *replayTransport) readOnly() bool { return true }
+
+func (t *replayTransport) name() string { return "replay" }
@@ -0,0 +1,79 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/offchainlabs/nitro/arbos/arbostypes"
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+)
+
+func TestBroadcastClientReplaysRecording(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	recordConfig := DefaultRecordConfig
+	frameRecorder, err := newRecorder(dir, func() *RecordConfig { return &recordConfig })
+	Require(t, err)
+	received := time.Now()
+	// The last gap is longer than the read timeout once sped up
+	for i, offset := range []time.Duration{0, 100 * time.Millisecond, 600 * time.Millisecond} {
+		payload, err := json.Marshal(broadcaster.BroadcastMessage{
+			Version: 1,
+			Messages: []*broadcaster.BroadcastFeedMessage{{
+				SequenceNumber: arbutil.MessageIndex(i),
+				Message:        arbostypes.EmptyTestMessageWithMetadata,
+			}},
+		})
+		Require(t, err)
+		frameRecorder.record(received.Add(offset), false, payload)
+	}
+	frameRecorder.close()
+
+	clientConfig := DefaultTestConfig
+	clientConfig.Verify.Dangerous.AcceptMissing = true
+	clientConfig.ReplaySpeed = 2
+	Require(t, clientConfig.Validate())
+	feedErrChan := make(chan error, 10)
+	handler := &recordingHandler{make(chan arbutil.MessageIndex, 10), make(chan arbutil.MessageIndex, 10)}
+	var connects int32
+	broadcastClient, err := NewBroadcastClientWithOptions(
+		"file://"+dir,
+		WithConfig(func() *Config { return &clientConfig }),
+		WithFatalErrChan(feedErrChan),
+		WithHandler(handler),
+		WithConnectionListener(ConnectionListenerFuncs{Connect: func(string) { atomic.AddInt32(&connects, 1) }}),
+	)
+	Require(t, err)
+	start := time.Now()
+	broadcastClient.Start(ctx)
+	defer broadcastClient.StopAndWait()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case seqNum := <-handler.messages:
+			if seqNum != arbutil.MessageIndex(i) {
+				t.Fatalf("replayed sequence number %d, expected %d", seqNum, i)
+			}
+		case err := <-feedErrChan:
+			t.Fatalf("feed error: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("client did not deliver the replayed message")
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Fatalf("recording replayed in %v, expected it paced to about 300ms", elapsed)
+	}
+	if count := atomic.LoadInt32(&connects); count != 1 {
+		t.Fatalf("replay connected %d times, expected once", count)
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+var tlsFallbackCounter = metrics.NewRegisteredCounter("arb/feed/tls/fallbacks", nil)
+
+var ErrPlaintextFeed = errors.New("plaintext feed url not allowed")
+
+// unixScheme is the scheme of feed URLs served over a unix socket by a relay
+// on the same host, e.g. ws+unix:///run/nitro/feed.sock
+const unixScheme = "ws+unix"
+
+// validateFeedURL checks that a feed URL can be dialed, and is encrypted if
+// requireTLS is set. URLs read over WebTransport are only allowed if
+// webTransport is set.
+func validateFeedURL(feedURL string, requireTLS bool, webTransport bool) error {
+	u, err := url.Parse(feedURL)
+	if err != nil {
+		return fmt.Errorf("invalid feed url %q: %w", feedURL, err)
+	}
+	switch u.Scheme {
+	case "wss", grpcTLSScheme:
+	case unixScheme:
+		// Never leaves the host, so it doesn't need TLS
+		if u.Path == "" {
+			return fmt.Errorf("invalid feed url %q: missing unix socket path", feedURL)
+		}
+		return nil
+	case replayScheme:
+		if u.Path == "" {
+			return fmt.Errorf("invalid feed url %q: missing recording path", feedURL)
+		}
+		return nil
+	case "https", quicScheme:
+		if !webTransport {
+			return fmt.Errorf("invalid feed url %q: %s:// urls are read over WebTransport, which is experimental and must be enabled with transport.webtransport", feedURL, u.Scheme)
+		}
+	case "ws", grpcScheme:
+		if requireTLS {
+			return fmt.Errorf("%w: %q, use a wss:// or grpcs:// url or disable require-tls", ErrPlaintextFeed, feedURL)
+		}
+	case "":
+		return fmt.Errorf("invalid feed url %q: missing scheme, must be ws:// or wss://", feedURL)
+	default:
+		return fmt.Errorf("invalid feed url %q: unsupported scheme %q, must be ws, wss, %s, %s, https, %s, %s or %s", feedURL, u.Scheme, grpcScheme, grpcTLSScheme, quicScheme, unixScheme, replayScheme)
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("invalid feed url %q: missing host", feedURL)
+	}
+	return nil
+}
+
+// dialURL returns the URL to dial for the active feed URL, which is upgraded
+// from ws:// to wss:// if PreferTLS is set and the feed wasn't found to lack
+// TLS support. Only called from the connection threads.
+func (bc *BroadcastClient) dialURL(config *Config) (string, bool) {
+	active := bc.urls[bc.activeURL]
+	if !config.PreferTLS || active.tlsUnsupported {
+		return active.url, false
+	}
+	u, err := url.Parse(active.url)
+	if err != nil || u.Scheme != "ws" {
+		return active.url, false
+	}
+	u.Scheme = "wss"
+	return u.String(), true
+}
+
+// tlsUpgradeFailed falls back to plaintext for the active feed URL after
+// dialing it with TLS failed, until the feed URLs change
+func (bc *BroadcastClient) tlsUpgradeFailed(dialURL string, err error) {
+	tlsFallbackCounter.Inc(1)
+	active := bc.urls[bc.activeURL]
+	active.tlsUnsupported = true
+	log.Warn("sequencer feed does not support TLS, falling back to plaintext", "url", active.url, "tlsUrl", dialURL, "err", err)
+}
+
+// unixSocketPath returns the socket path of a ws+unix:// feed URL
+func unixSocketPath(feedURL string) (string, bool) {
+	u, err := url.Parse(feedURL)
+	if err != nil || u.Scheme != unixScheme {
+		return "", false
+	}
+	return u.Path, true
+}
+
+// unixNetDial connects to the unix socket at path, whatever address the
+// websocket dialer asks for
+func unixNetDial(path string) NetDialFunc {
+	var dialer net.Dialer
+	return func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return dialer.DialContext(ctx, "unix", path)
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateFeedURL(t *testing.T) {
+	for _, test := range []struct {
+		url          string
+		requireTLS   bool
+		webTransport bool
+		valid        bool
+	}{
+		{"wss://arb1.arbitrum.io/feed", true, false, true},
+		{"ws://127.0.0.1:9642/", false, false, true},
+		{"ws://127.0.0.1:9642/", true, false, false},
+		{"https://arb1.arbitrum.io/feed", false, false, false},
+		{"https://arb1.arbitrum.io/feed", true, true, true},
+		{"quic://arb1.arbitrum.io:9644", true, false, false},
+		{"quic://arb1.arbitrum.io:9644", true, true, true},
+		{"quic:///feed", false, true, false},
+		{"arb1.arbitrum.io/feed", false, false, false},
+		{"wss:///feed", false, false, false},
+		{"ws+unix:///run/nitro/feed.sock", true, false, true},
+		{"ws+unix://", false, false, false},
+		{"grpc://127.0.0.1:9645", false, false, true},
+		{"grpc://127.0.0.1:9645", true, false, false},
+		{"grpcs://arb1.arbitrum.io", true, false, true},
+	} {
+		err := validateFeedURL(test.url, test.requireTLS, test.webTransport)
+		if (err == nil) != test.valid {
+			t.Errorf("url %s with require-tls %v and transport.webtransport %v: expected valid %v, got %v", test.url, test.requireTLS, test.webTransport, test.valid, err)
+		}
+	}
+	config := DefaultTestConfig
+	config.URL = []string{"ws://127.0.0.1:9642/"}
+	config.RequireTLS = true
+	if err := config.Validate(); !errors.Is(err, ErrPlaintextFeed) {
+		t.Fatalf("expected plaintext feed url to be refused, got %v", err)
+	}
+}
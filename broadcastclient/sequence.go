@@ -0,0 +1,146 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gobwas/ws/wsutil"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+var (
+	sequenceGapCounter    = metrics.NewRegisteredCounter("arb/feed/sequence/gaps", nil)
+	catchupRequestCounter = metrics.NewRegisteredCounter("arb/feed/sequence/catchup/requests", nil)
+	lastSequenceGauge     = metrics.NewRegisteredGauge("arb/feed/sequence/last", nil)
+	replayDroppedCounter  = metrics.NewRegisteredCounter("arb/feed/sequence/replay-dropped", nil)
+)
+
+// sequenceMessages detects gaps in the sequence numbers received from the feed
+// and returns the messages to deliver. If Delivery.HoldOnGap is set, messages
+// past a gap are held back in the reorder buffer and the missing messages are
+// requested from the feed. Only called from the reader thread, or the
+// processing thread when decoding in workers.
+func (bc *BroadcastClient) sequenceMessages(messages []*broadcaster.BroadcastFeedMessage) []*broadcaster.BroadcastFeedMessage {
+	config := bc.config()
+	deliver := make([]*broadcaster.BroadcastFeedMessage, 0, len(messages))
+	for _, message := range messages {
+		if bc.suppressReplay {
+			// After a reconnect the feed may resend messages that were already
+			// delivered, anything lower than the cursor until then is a replay
+			if bc.delivered && message.SequenceNumber < bc.nextSeqNum {
+				replayDroppedCounter.Inc(1)
+				continue
+			}
+			bc.suppressReplay = false
+		}
+		// Before the first delivery a zero cursor means the caller doesn't know where the feed is
+		knownCursor := bc.nextSeqNum > 0 || bc.delivered
+		if knownCursor && message.SequenceNumber > bc.nextSeqNum {
+			if bc.reorderBuffer.len() == 0 {
+				sequenceGapCounter.Inc(1)
+				log.Warn(
+					"gap in sequencer feed sequence numbers",
+					"url", bc.statusURL(),
+					"expected", bc.nextSeqNum,
+					"received", message.SequenceNumber,
+					"missing", message.SequenceNumber-bc.nextSeqNum,
+					"holding", config.Delivery.HoldOnGap,
+				)
+				if config.Delivery.HoldOnGap {
+					bc.requestCatchup(config, bc.nextSeqNum)
+				}
+			}
+			if config.Delivery.HoldOnGap {
+				if bc.reorderBuffer.len() < config.Delivery.ReorderBufferSize {
+					bc.reorderBuffer.add(message)
+					continue
+				}
+				log.Error("too many feed messages held waiting for sequence gap to be filled, delivering out of sequence", "expected", bc.nextSeqNum, "held", bc.reorderBuffer.len())
+				deliver = append(deliver, bc.releaseHeldMessages()...)
+			}
+		} else if message.SequenceNumber < bc.nextSeqNum && bc.reorderBuffer.len() > 0 {
+			// Held messages past a reorg are stale
+			bc.reorderBuffer.clear()
+		}
+
+		deliver = append(deliver, message)
+		bc.nextSeqNum = message.SequenceNumber + 1
+		bc.delivered = true
+		run := bc.reorderBuffer.popRun(bc.nextSeqNum)
+		deliver = append(deliver, run...)
+		bc.nextSeqNum += arbutil.MessageIndex(len(run))
+	}
+	if bc.delivered {
+		lastSeqNum := bc.nextSeqNum - 1
+		lastSequenceGauge.Update(int64(lastSeqNum))
+		bc.updateStatus(func(status *clientStatus) { status.lastSequenceNumber = &lastSeqNum })
+	}
+	bc.recordProgress()
+	return deliver
+}
+
+// requestCatchup asks the feed to resend its cached messages starting from
+// requestedSeqNum. Servers that don't support catchup requests ignore them.
+func (bc *BroadcastClient) requestCatchup(config *Config, requestedSeqNum arbutil.MessageIndex) {
+	conn := bc.currentConn()
+	if conn == nil {
+		return
+	}
+	if requester, ok := bc.currentTransport().(catchupRequester); ok {
+		bc.writeMutex.Lock()
+		err := requester.requestCatchup(requestedSeqNum)
+		bc.writeMutex.Unlock()
+		if err != nil {
+			log.Warn("error sending feed catchup request", "url", bc.statusURL(), "requestedSeqNum", requestedSeqNum, "err", err)
+			return
+		}
+		catchupRequestCounter.Inc(1)
+		return
+	}
+	if bc.readOnly() {
+		// Nothing can be sent over plain HTTP, the next poll asks for the
+		// missing messages, an event stream only gets them by reconnecting.
+		// A replay only has what was recorded.
+		log.Debug("cannot request feed catchup without a websocket connection", "url", bc.statusURL(), "requestedSeqNum", requestedSeqNum)
+		return
+	}
+	data, err := json.Marshal(wsbroadcastserver.CatchupRequest{RequestedSequenceNumber: requestedSeqNum})
+	if err != nil {
+		log.Error("error encoding feed catchup request", "err", err)
+		return
+	}
+	bc.writeMutex.Lock()
+	defer bc.writeMutex.Unlock()
+	if err := conn.SetWriteDeadline(time.Now().Add(bc.readTimeout(config))); err != nil {
+		log.Warn("error setting feed catchup request write deadline", "url", bc.statusURL(), "err", err)
+		return
+	}
+	defer func() {
+		_ = conn.SetWriteDeadline(time.Time{})
+	}()
+	if err := wsutil.WriteClientText(conn, data); err != nil {
+		// A broken connection will also be noticed by the next read
+		log.Warn("error sending feed catchup request", "url", bc.statusURL(), "requestedSeqNum", requestedSeqNum, "err", err)
+		return
+	}
+	catchupRequestCounter.Inc(1)
+}
+
+// releaseHeldMessages returns all held messages in sequence order and moves
+// the cursor past them.
+func (bc *BroadcastClient) releaseHeldMessages() []*broadcaster.BroadcastFeedMessage {
+	held := bc.reorderBuffer.drain()
+	if len(held) > 0 {
+		bc.nextSeqNum = held[len(held)-1].SequenceNumber + 1
+	}
+	return held
+}
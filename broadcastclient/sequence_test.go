@@ -0,0 +1,84 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"testing"
+
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+)
+
+func TestSequenceGapHold(t *testing.T) {
+	feedMessages := func(seqNums ...arbutil.MessageIndex) []*broadcaster.BroadcastFeedMessage {
+		messages := make([]*broadcaster.BroadcastFeedMessage, 0, len(seqNums))
+		for _, seqNum := range seqNums {
+			messages = append(messages, &broadcaster.BroadcastFeedMessage{SequenceNumber: seqNum})
+		}
+		return messages
+	}
+	checkDelivered := func(delivered []*broadcaster.BroadcastFeedMessage, expected ...arbutil.MessageIndex) {
+		t.Helper()
+		if len(delivered) != len(expected) {
+			t.Fatalf("expected %d messages delivered, got %d", len(expected), len(delivered))
+		}
+		for i, message := range delivered {
+			if message.SequenceNumber != expected[i] {
+				t.Fatalf("expected sequence number %d at position %d, got %d", expected[i], i, message.SequenceNumber)
+			}
+		}
+	}
+
+	config := DefaultTestConfig
+	config.Delivery.HoldOnGap = true
+	broadcastClient, err := NewBroadcastClient(func() *Config { return &config }, nil, 0, 5, nil, nil, nil, func(_ int32) {}, nil)
+	Require(t, err)
+
+	checkDelivered(broadcastClient.sequenceMessages(feedMessages(5)), 5)
+	checkDelivered(broadcastClient.sequenceMessages(feedMessages(7, 8)))
+	checkDelivered(broadcastClient.sequenceMessages(feedMessages(6)), 6, 7, 8)
+	if broadcastClient.nextSeqNum != 9 {
+		t.Fatalf("expected next sequence number 9, got %d", broadcastClient.nextSeqNum)
+	}
+
+	// Without holding, messages past a gap are still forwarded
+	config.Delivery.HoldOnGap = false
+	checkDelivered(broadcastClient.sequenceMessages(feedMessages(11, 12)), 11, 12)
+
+	// A full reorder buffer is released out of sequence
+	config.Delivery.HoldOnGap = true
+	config.Delivery.ReorderBufferSize = 2
+	checkDelivered(broadcastClient.sequenceMessages(feedMessages(16, 15)))
+	checkDelivered(broadcastClient.sequenceMessages(feedMessages(17)), 15, 16, 17)
+}
+
+func TestSequenceReplayDropped(t *testing.T) {
+	broadcastClient, err := NewBroadcastClient(func() *Config { return &DefaultTestConfig }, nil, 0, 5, nil, nil, nil, func(_ int32) {}, nil)
+	Require(t, err)
+	seqNums := func(messages []*broadcaster.BroadcastFeedMessage) []arbutil.MessageIndex {
+		var seqNums []arbutil.MessageIndex
+		for _, message := range messages {
+			seqNums = append(seqNums, message.SequenceNumber)
+		}
+		return seqNums
+	}
+	feedMessages := func(seqNums ...arbutil.MessageIndex) []*broadcaster.BroadcastFeedMessage {
+		messages := make([]*broadcaster.BroadcastFeedMessage, 0, len(seqNums))
+		for _, seqNum := range seqNums {
+			messages = append(messages, &broadcaster.BroadcastFeedMessage{SequenceNumber: seqNum})
+		}
+		return messages
+	}
+
+	broadcastClient.sequenceMessages(feedMessages(5, 6))
+	// As set by a reconnect
+	broadcastClient.suppressReplay = true
+	if delivered := seqNums(broadcastClient.sequenceMessages(feedMessages(4, 5, 6, 7))); len(delivered) != 1 || delivered[0] != 7 {
+		t.Fatalf("expected only 7 to be delivered after reconnect, got %v", delivered)
+	}
+	// Once the replay is over lower sequence numbers are reorgs
+	if delivered := seqNums(broadcastClient.sequenceMessages(feedMessages(6))); len(delivered) != 1 || delivered[0] != 6 {
+		t.Fatalf("expected reorg to 6 to be delivered, got %v", delivered)
+	}
+}
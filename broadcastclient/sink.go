@@ -0,0 +1,198 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	flag "github.com/spf13/pflag"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/offchainlabs/nitro/broadcaster"
+)
+
+var (
+	sinkTimeoutsCounter = metrics.NewRegisteredCounter("arb/feed/sink/timeouts", nil)
+	sinkRetriesCounter  = metrics.NewRegisteredCounter("arb/feed/sink/retries", nil)
+	sinkBufferedGauge   = metrics.NewRegisteredGauge("arb/feed/sink/buffered", nil)
+)
+
+var ErrSinkTimeout = errors.New("timed out adding feed messages to the transaction streamer")
+
+// errSinkBuffered is returned for messages held back while the transaction
+// streamer is stuck, so they aren't checkpointed yet
+var errSinkBuffered = errors.New("feed messages buffered until the transaction streamer returns")
+
+const (
+	// SinkTimeoutPolicyBuffer keeps delivering to the other handlers while the
+	// transaction streamer is stuck, buffering its messages until it returns
+	SinkTimeoutPolicyBuffer = "buffer"
+	// SinkTimeoutPolicyRetry holds delivery until the transaction streamer
+	// returns, adding the timed out messages again if it failed
+	SinkTimeoutPolicyRetry = "retry"
+)
+
+// SinkConfig bounds how long the transaction streamer may take to accept
+// messages from the feed
+type SinkConfig struct {
+	Timeout       time.Duration `koanf:"timeout" reload:"hot"`
+	TimeoutPolicy string        `koanf:"timeout-policy" reload:"hot"`
+	BufferSize    int           `koanf:"buffer-size" reload:"hot"`
+}
+
+func SinkConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Duration(prefix+".timeout", DefaultSinkConfig.Timeout, "duration to wait for the transaction streamer to accept feed messages before reporting it stuck (0 = wait forever)")
+	f.String(prefix+".timeout-policy", DefaultSinkConfig.TimeoutPolicy, "what to do with feed messages while the transaction streamer is stuck, either buffer to keep reading the feed and add them once it returns, or retry to stop reading until it returns and add the timed out messages again if it failed")
+	f.Int(prefix+".buffer-size", DefaultSinkConfig.BufferSize, "maximum number of feed messages buffered while the transaction streamer is stuck, after which reading the feed waits for it")
+}
+
+var DefaultSinkConfig = SinkConfig{
+	Timeout:       time.Minute,
+	TimeoutPolicy: SinkTimeoutPolicyBuffer,
+	BufferSize:    65536,
+}
+
+var DefaultTestSinkConfig = SinkConfig{
+	Timeout:       time.Second,
+	TimeoutPolicy: SinkTimeoutPolicyBuffer,
+	BufferSize:    1024,
+}
+
+func (c *SinkConfig) Validate() error {
+	switch c.TimeoutPolicy {
+	case SinkTimeoutPolicyBuffer, SinkTimeoutPolicyRetry:
+	default:
+		return fmt.Errorf("invalid feed sink timeout policy %q, must be buffer or retry", c.TimeoutPolicy)
+	}
+	if c.BufferSize < 0 {
+		return errors.New("feed sink buffer size must not be negative")
+	}
+	return nil
+}
+
+// sinkCall is a call to the transaction streamer that may outlive its timeout
+type sinkCall struct {
+	messages []*broadcaster.BroadcastFeedMessage
+	done     chan struct{}
+	err      error
+}
+
+// add hands messages to the transaction streamer, giving up waiting after the
+// sink timeout. A call that timed out is left running and becomes the stuck
+// call that later deliveries wait for, as the transaction streamer can't be
+// called concurrently.
+func (h *txStreamerHandler) add(config *SinkConfig, messages []*broadcaster.BroadcastFeedMessage) error {
+	if config.Timeout <= 0 {
+		return h.txStreamer.AddBroadcastMessages(messages)
+	}
+	call := &sinkCall{
+		messages: messages,
+		done:     make(chan struct{}),
+	}
+	h.mutex.Lock()
+	h.running = true
+	h.mutex.Unlock()
+	go h.run(call)
+	timer := time.NewTimer(config.Timeout)
+	defer timer.Stop()
+	select {
+	case <-call.done:
+		return call.err
+	case <-timer.C:
+		sinkTimeoutsCounter.Inc(1)
+		h.stuck = call
+		return fmt.Errorf("%w after %v, first sequence number %v", ErrSinkTimeout, config.Timeout, messages[0].SequenceNumber)
+	}
+}
+
+// run makes the call, then adds the messages buffered while it was stuck
+func (h *txStreamerHandler) run(call *sinkCall) {
+	defer close(call.done)
+	call.err = h.txStreamer.AddBroadcastMessages(call.messages)
+	for {
+		h.mutex.Lock()
+		buffered := h.buffered
+		h.buffered = nil
+		if len(buffered) == 0 {
+			h.running = false
+		}
+		h.mutex.Unlock()
+		if len(buffered) == 0 {
+			sinkBufferedGauge.Update(0)
+			return
+		}
+		if err := h.txStreamer.AddBroadcastMessages(buffered); err != nil {
+			log.Error("transaction streamer failed to add buffered feed messages", "firstSeqNum", buffered[0].SequenceNumber, "count", len(buffered), "err", err)
+		}
+	}
+}
+
+// sinkCallDone waits up to timeout for the call to return, or forever if the
+// timeout isn't positive
+func sinkCallDone(call *sinkCall, timeout time.Duration) bool {
+	if timeout <= 0 {
+		<-call.done
+		return true
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-call.done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// waitStuck waits for the stuck call to return, warning every sink timeout.
+// Returns the messages the stuck call failed to add if they are to be retried.
+func (h *txStreamerHandler) waitStuck(config *SinkConfig) []*broadcaster.BroadcastFeedMessage {
+	stuck := h.stuck
+	var waited time.Duration
+	for !sinkCallDone(stuck, config.Timeout) {
+		waited += config.Timeout
+		sinkTimeoutsCounter.Inc(1)
+		log.Warn("transaction streamer still adding feed messages", "waited", waited, "firstSeqNum", stuck.messages[0].SequenceNumber)
+	}
+	h.stuck = nil
+	if stuck.err == nil {
+		return nil
+	}
+	if config.TimeoutPolicy == SinkTimeoutPolicyRetry {
+		sinkRetriesCounter.Inc(1)
+		log.Warn("retrying feed messages the transaction streamer failed to add after timing out", "firstSeqNum", stuck.messages[0].SequenceNumber, "err", stuck.err)
+		return stuck.messages
+	}
+	log.Error("transaction streamer failed to add feed messages after timing out", "firstSeqNum", stuck.messages[0].SequenceNumber, "err", stuck.err)
+	return nil
+}
+
+func (h *txStreamerHandler) HandleMessages(messages []*broadcaster.BroadcastFeedMessage) error {
+	if h.txStreamer == nil {
+		return nil
+	}
+	config := &h.config().Sink
+	if h.stuck != nil {
+		if config.TimeoutPolicy == SinkTimeoutPolicyBuffer {
+			h.mutex.Lock()
+			buffer := h.running && len(h.buffered)+len(messages) <= config.BufferSize
+			if buffer {
+				h.buffered = append(h.buffered, messages...)
+				sinkBufferedGauge.Update(int64(len(h.buffered)))
+			}
+			h.mutex.Unlock()
+			if buffer {
+				return errSinkBuffered
+			}
+		}
+		if retry := h.waitStuck(config); len(retry) > 0 {
+			messages = append(append([]*broadcaster.BroadcastFeedMessage{}, retry...), messages...)
+		}
+	}
+	return h.add(config, messages)
+}
@@ -0,0 +1,150 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+)
+
+// SinkStatus is the state of an additional transaction streamer the feed is
+// delivered to
+type SinkStatus struct {
+	Name string `json:"name"`
+	// Only set once the sink accepted a message
+	LastSequenceNumber *arbutil.MessageIndex `json:"lastSequenceNumber,omitempty"`
+	// Messages received from the feed that the sink didn't accept yet
+	Lag uint64 `json:"lag"`
+	// Time from broadcast to acceptance of the most recent stamped message
+	Latency time.Duration `json:"latency"`
+	Errors  int64         `json:"errors"`
+}
+
+// streamerSink is an additional transaction streamer the feed is delivered to,
+// e.g. a shadow indexer next to the node's own. It has its own sink timeout
+// and buffer, and its errors are reported without failing the delivery, so it
+// can't hold back the checkpoint of the node's streamer.
+type streamerSink struct {
+	name    string
+	bc      *BroadcastClient
+	handler *txStreamerHandler
+
+	latencyHistogram metrics.Histogram
+	lagGauge         metrics.Gauge
+	errorsCounter    metrics.Counter
+
+	// Use atomic access, lastSeqNum is only valid once accepted is set
+	accepted     int32
+	lastSeqNum   uint64
+	latencyNanos int64
+	errorCount   int64
+}
+
+func (s *streamerSink) HandleMessages(messages []*broadcaster.BroadcastFeedMessage) error {
+	err := s.handler.HandleMessages(messages)
+	if errors.Is(err, errSinkBuffered) {
+		s.updateLag()
+		return nil
+	}
+	if err != nil {
+		s.errorsCounter.Inc(1)
+		atomic.AddInt64(&s.errorCount, 1)
+		log.Warn("error adding feed messages to sink", "sink", s.name, "firstSeqNum", messages[0].SequenceNumber, "err", err)
+		s.bc.reportError(SinkError, fmt.Errorf("sink %s: %w", s.name, err))
+		s.updateLag()
+		return nil
+	}
+	if latency, ok := messagesLatency(messages, s.latencyHistogram); ok {
+		atomic.StoreInt64(&s.latencyNanos, int64(latency))
+	}
+	atomic.StoreUint64(&s.lastSeqNum, uint64(messages[len(messages)-1].SequenceNumber))
+	atomic.StoreInt32(&s.accepted, 1)
+	s.updateLag()
+	return nil
+}
+
+func (s *streamerSink) HandleConfirmedSeq(arbutil.MessageIndex) {}
+
+// lag returns how many messages received from the feed the sink didn't accept
+func (s *streamerSink) lag() uint64 {
+	received := atomic.LoadUint64(&s.bc.receivedCount)
+	var accepted uint64
+	if atomic.LoadInt32(&s.accepted) != 0 {
+		accepted = atomic.LoadUint64(&s.lastSeqNum) + 1
+	}
+	if received <= accepted {
+		return 0
+	}
+	return received - accepted
+}
+
+func (s *streamerSink) updateLag() {
+	s.lagGauge.Update(int64(s.lag()))
+}
+
+func (s *streamerSink) status() SinkStatus {
+	status := SinkStatus{
+		Name:    s.name,
+		Lag:     s.lag(),
+		Latency: time.Duration(atomic.LoadInt64(&s.latencyNanos)),
+		Errors:  atomic.LoadInt64(&s.errorCount),
+	}
+	if atomic.LoadInt32(&s.accepted) != 0 {
+		lastSeqNum := arbutil.MessageIndex(atomic.LoadUint64(&s.lastSeqNum))
+		status.LastSequenceNumber = &lastSeqNum
+	}
+	return status
+}
+
+// AddSink registers an additional transaction streamer the feed is delivered
+// to under name, which identifies it in the status and the
+// arb/feed/sink/<name>/ metrics. Messages are delivered to it in sequence
+// like to the node's own streamer, but errors of the sink don't fail the
+// delivery.
+func (bc *BroadcastClient) AddSink(name string, txStreamer TransactionStreamerInterface) error {
+	if name == "" || txStreamer == nil {
+		return errors.New("feed sink needs a name and a transaction streamer")
+	}
+	bc.handlersMutex.Lock()
+	defer bc.handlersMutex.Unlock()
+	for _, sink := range bc.sinks {
+		if sink.name == name {
+			return fmt.Errorf("feed sink %s already added", name)
+		}
+	}
+	prefix := "arb/feed/sink/" + name
+	sink := &streamerSink{
+		name:             name,
+		bc:               bc,
+		handler:          &txStreamerHandler{txStreamer: txStreamer, config: bc.config},
+		latencyHistogram: metrics.GetOrRegisterHistogram(prefix+"/latency", nil, metrics.NewBoundedHistogramSample()),
+		lagGauge:         metrics.GetOrRegisterGauge(prefix+"/lag", nil),
+		errorsCounter:    metrics.GetOrRegisterCounter(prefix+"/errors", nil),
+	}
+	bc.sinks = append(bc.sinks, sink)
+	bc.handlers = append(bc.handlers, sink)
+	return nil
+}
+
+func (bc *BroadcastClient) sinkStatuses() []SinkStatus {
+	bc.handlersMutex.Lock()
+	sinks := bc.sinks
+	bc.handlersMutex.Unlock()
+	if len(sinks) == 0 {
+		return nil
+	}
+	statuses := make([]SinkStatus, 0, len(sinks))
+	for _, sink := range sinks {
+		statuses = append(statuses, sink.status())
+	}
+	return statuses
+}
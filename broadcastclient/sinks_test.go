@@ -0,0 +1,75 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+)
+
+// addingStreamer records the sequence numbers it's given, or fails with err
+type addingStreamer struct {
+	err   error
+	added []arbutil.MessageIndex
+}
+
+func (s *addingStreamer) AddBroadcastMessages(messages []*broadcaster.BroadcastFeedMessage) error {
+	if s.err != nil {
+		return s.err
+	}
+	for _, message := range messages {
+		s.added = append(s.added, message.SequenceNumber)
+	}
+	return nil
+}
+
+func TestBroadcastClientSinks(t *testing.T) {
+	config := DefaultTestConfig
+	config.Sink.Timeout = 0
+	streamer, shadow, broken := &addingStreamer{}, &addingStreamer{}, &addingStreamer{err: errors.New("sink broken")}
+	broadcastClient, err := NewBroadcastClientWithOptions(
+		"",
+		WithConfig(func() *Config { return &config }),
+		WithTransactionStreamer(streamer),
+		WithSink("shadow", shadow),
+		WithSink("broken", broken),
+	)
+	Require(t, err)
+	if err := broadcastClient.AddSink("shadow", shadow); err == nil {
+		t.Fatal("expected error adding a sink with a name already used")
+	}
+
+	messages := make([]*broadcaster.BroadcastFeedMessage, 0, 3)
+	for seqNum := arbutil.MessageIndex(0); seqNum < 3; seqNum++ {
+		messages = append(messages, &broadcaster.BroadcastFeedMessage{SequenceNumber: seqNum})
+	}
+	atomic.StoreUint64(&broadcastClient.receivedCount, 3)
+	buffered, err := broadcastClient.deliverMessages(messages)
+	if err != nil || buffered {
+		t.Fatalf("expected a failing sink not to fail the delivery, got buffered %v, err %v", buffered, err)
+	}
+	for _, added := range [][]arbutil.MessageIndex{streamer.added, shadow.added} {
+		if len(added) != 3 || added[2] != 2 {
+			t.Fatalf("expected messages 0 to 2 added, got %v", added)
+		}
+	}
+
+	sinks := broadcastClient.Status().Sinks
+	if len(sinks) != 2 || sinks[0].Name != "shadow" || sinks[1].Name != "broken" {
+		t.Fatalf("unexpected sink statuses: %+v", sinks)
+	}
+	if sinks[0].LastSequenceNumber == nil || *sinks[0].LastSequenceNumber != 2 || sinks[0].Lag != 0 || sinks[0].Errors != 0 {
+		t.Fatalf("unexpected status of the working sink: %+v", sinks[0])
+	}
+	if sinks[1].LastSequenceNumber != nil || sinks[1].Lag != 3 || sinks[1].Errors != 1 {
+		t.Fatalf("unexpected status of the failing sink: %+v", sinks[1])
+	}
+	if lastError := broadcastClient.LastError(); lastError == nil || lastError.Category != SinkError {
+		t.Fatalf("expected the sink error to be reported, got %v", lastError)
+	}
+}
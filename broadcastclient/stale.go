@@ -0,0 +1,52 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/offchainlabs/nitro/broadcaster"
+)
+
+var staleMessagesCounter = metrics.NewRegisteredCounter("arb/feed/messages/stale", nil)
+
+// messageAge returns the time since the sequencer created the message, taken
+// from the timestamp in the message header. Returns false if the message has
+// no header.
+func messageAge(message *broadcaster.BroadcastFeedMessage, now time.Time) (time.Duration, bool) {
+	if message == nil || message.Message.Message == nil || message.Message.Message.Header == nil {
+		return 0, false
+	}
+	return now.Sub(time.Unix(int64(message.Message.Message.Header.Timestamp), 0)), true
+}
+
+// dropStaleMessages drops the messages older than Delivery.MaxMessageAge, e.g.
+// replayed by a relay that lags far behind. Like filtered messages they still
+// advance the sequence number, the node picks them up from the parent chain
+// instead. Only called from the reader thread, or the processing thread when
+// decoding in workers.
+func (bc *BroadcastClient) dropStaleMessages(messages []*broadcaster.BroadcastFeedMessage) []*broadcaster.BroadcastFeedMessage {
+	maxAge := bc.config().Delivery.MaxMessageAge
+	if maxAge <= 0 {
+		return messages
+	}
+	now := time.Now()
+	kept := messages[:0]
+	dropped := 0
+	for _, message := range messages {
+		if age, ok := messageAge(message, now); ok && age > maxAge {
+			dropped++
+			continue
+		}
+		kept = append(kept, message)
+	}
+	if dropped > 0 {
+		staleMessagesCounter.Inc(int64(dropped))
+		log.Warn("dropped stale sequencer feed messages", "url", bc.statusURL(), "count", dropped, "maxAge", maxAge)
+	}
+	return kept
+}
@@ -0,0 +1,41 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"testing"
+	"time"
+
+	"github.com/offchainlabs/nitro/arbos/arbostypes"
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+)
+
+func TestDropStaleMessages(t *testing.T) {
+	message := func(seqNum arbutil.MessageIndex, age time.Duration) *broadcaster.BroadcastFeedMessage {
+		return &broadcaster.BroadcastFeedMessage{
+			SequenceNumber: seqNum,
+			Message: arbostypes.MessageWithMetadata{
+				Message: &arbostypes.L1IncomingMessage{
+					Header: &arbostypes.L1IncomingMessageHeader{Timestamp: uint64(time.Now().Add(-age).Unix())},
+				},
+			},
+		}
+	}
+	messages := func() []*broadcaster.BroadcastFeedMessage {
+		return []*broadcaster.BroadcastFeedMessage{message(0, time.Hour), message(1, time.Minute), message(2, 0)}
+	}
+
+	config := DefaultTestConfig
+	broadcastClient, err := NewBroadcastClientWithOptions("", WithConfig(func() *Config { return &config }))
+	Require(t, err)
+	if kept := broadcastClient.dropStaleMessages(messages()); len(kept) != 3 {
+		t.Fatalf("expected no messages dropped while disabled, kept %d", len(kept))
+	}
+	config.Delivery.MaxMessageAge = 10 * time.Minute
+	kept := broadcastClient.dropStaleMessages(messages())
+	if len(kept) != 2 || kept[0].SequenceNumber != 1 || kept[1].SequenceNumber != 2 {
+		t.Fatalf("expected only the hour old message dropped, kept %v", kept)
+	}
+}
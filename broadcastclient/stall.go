@@ -0,0 +1,74 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/offchainlabs/nitro/arbutil"
+)
+
+var stallsCounter = metrics.NewRegisteredCounter("arb/feed/stalls", nil)
+
+// ChainHeadFunc returns the number of messages the node knows of from any
+// source, e.g. other feeds or the parent chain
+type ChainHeadFunc func() arbutil.MessageIndex
+
+// SetChainHead sets where the client learns whether the chain advanced while
+// its feed stalled, it must be called before Start. Without it any
+// KeepAlive.StallTimeout without new sequence numbers is treated as a stall.
+func (bc *BroadcastClient) SetChainHead(chainHead ChainHeadFunc) {
+	bc.chainHead = chainHead
+}
+
+// recordProgress notes the message count received from the feed, only called
+// from the reader thread, or the processing thread when decoding in workers
+func (bc *BroadcastClient) recordProgress() {
+	count := uint64(bc.nextSeqNum)
+	if atomic.SwapUint64(&bc.receivedCount, count) != count {
+		atomic.StoreInt64(&bc.lastProgressUnixNano, bc.clock.Now().UnixNano())
+	}
+}
+
+// resumeSeqNum returns the sequence number to request when connecting,
+// safe to call while frames are still being processed
+func (bc *BroadcastClient) resumeSeqNum() arbutil.MessageIndex {
+	return arbutil.MessageIndex(atomic.LoadUint64(&bc.receivedCount))
+}
+
+// checkStall closes the connection to a feed that stopped sending new
+// sequence numbers while the chain moved on, for example a relay that keeps
+// the connection alive but lags far behind. The reader then reconnects, which
+// counts toward failing over to the next URL. Returns how long to wait before
+// being called again.
+func (bc *BroadcastClient) checkStall(ctx context.Context) time.Duration {
+	timeout := bc.config().KeepAlive.StallTimeout
+	if timeout <= 0 {
+		// Check again later in case stall detection is enabled by a config reload
+		return time.Second
+	}
+	stalledFor := bc.clock.Now().Sub(time.Unix(0, atomic.LoadInt64(&bc.lastProgressUnixNano)))
+	if stalledFor < timeout {
+		return timeout - stalledFor
+	}
+	receivedCount := arbutil.MessageIndex(atomic.LoadUint64(&bc.receivedCount))
+	if bc.chainHead != nil && bc.chainHead() <= receivedCount {
+		// The chain isn't advancing either
+		return timeout
+	}
+	conn := bc.currentConn()
+	if conn == nil {
+		return timeout
+	}
+	log.Warn("sequencer feed stalled, reconnecting", "remote", conn.RemoteAddr(), "stalledFor", stalledFor, "messageCount", receivedCount)
+	stallsCounter.Inc(1)
+	atomic.StoreInt64(&bc.lastProgressUnixNano, bc.clock.Now().UnixNano())
+	_ = conn.Close()
+	return timeout
+}
@@ -0,0 +1,63 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+func TestBroadcastClientStallDetection(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	settings := wsbroadcastserver.DefaultTestBroadcasterConfig
+	feedErrChan := make(chan error, 10)
+	b := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &settings }, 8742, feedErrChan, nil)
+	Require(t, b.Initialize())
+	Require(t, b.Start(ctx))
+	defer b.StopAndWait()
+
+	// The connection stays alive but the feed never sends anything
+	config := DefaultTestConfig
+	config.Timeout = time.Minute
+	config.KeepAlive.StallTimeout = 200 * time.Millisecond
+	broadcastClient, err := newTestBroadcastClient(config, b.ListenerAddr(), 8742, 5, nil, feedErrChan, nil)
+	Require(t, err)
+	var chainHead uint64 = 5
+	broadcastClient.SetChainHead(func() arbutil.MessageIndex {
+		return arbutil.MessageIndex(atomic.LoadUint64(&chainHead))
+	})
+	disconnects := make(chan error, 10)
+	broadcastClient.AddConnectionListener(ConnectionListenerFuncs{
+		Disconnect: func(_ string, err error) { disconnects <- err },
+	})
+	broadcastClient.Start(ctx)
+	defer broadcastClient.StopAndWait()
+
+	// A quiet feed isn't stalled while the chain isn't advancing either
+	select {
+	case err := <-disconnects:
+		t.Fatalf("client disconnected while chain head didn't advance: %v", err)
+	case err := <-feedErrChan:
+		t.Fatalf("Broadcaster error: %s", err.Error())
+	case <-time.After(time.Second):
+	}
+
+	atomic.StoreUint64(&chainHead, 10)
+	select {
+	case <-disconnects:
+	case err := <-feedErrChan:
+		t.Fatalf("Broadcaster error: %s", err.Error())
+	case <-time.After(5 * time.Second):
+		t.Fatal("client did not reconnect to stalled feed")
+	}
+}
@@ -0,0 +1,287 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+
+	"github.com/offchainlabs/nitro/arbutil"
+)
+
+// Number of the most recent errors kept for the status
+const RECENT_ERRORS_SIZE = 16
+
+// ConnectionState tells what the client is doing with its feed connection
+type ConnectionState int
+
+const (
+	// Connecting is a client that is (re)connecting to the feed
+	Connecting ConnectionState = iota
+	// Connected is a client with an established connection to the feed
+	Connected
+	// Paused is a client that stopped reading the feed until resumed
+	Paused
+	// Unreachable is a client that gave up reconnecting to the feed
+	Unreachable
+	// Stopped is a client that has been shut down
+	Stopped
+	// Disconnected is a client that isn't started yet or just lost its
+	// connection to the feed
+	Disconnected
+	// Retrying is a client waiting to reconnect to the feed after a failed
+	// connection attempt or a lost connection, or reconnecting
+	Retrying
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case Connecting:
+		return "connecting"
+	case Connected:
+		return "connected"
+	case Paused:
+		return "paused"
+	case Unreachable:
+		return "unreachable"
+	case Stopped:
+		return "stopped"
+	case Disconnected:
+		return "disconnected"
+	case Retrying:
+		return "retrying"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(s))
+	}
+}
+
+func (s ConnectionState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// connectionState is the state of the feed connection, replaced rather than
+// modified
+type connectionState struct {
+	state ConnectionState
+	since time.Time
+}
+
+// setState moves the connection to state, safe to call from any thread. A
+// stopped client stays stopped.
+func (bc *BroadcastClient) setState(state ConnectionState) {
+	next := &connectionState{state: state, since: time.Now()}
+	for {
+		current := bc.connState.Load()
+		if current != nil && (current.state == Stopped || current.state == state) {
+			return
+		}
+		if bc.connState.CompareAndSwap(current, next) {
+			log.Debug("sequencer feed connection state changed", "url", bc.statusURL(), "state", state)
+			return
+		}
+	}
+}
+
+// State returns the state of the feed connection and since when it's in it,
+// safe to call from any thread. Unlike Status it doesn't tell whether the
+// client is paused.
+func (bc *BroadcastClient) State() (ConnectionState, time.Time) {
+	current := bc.connState.Load()
+	if current == nil {
+		return Disconnected, time.Time{}
+	}
+	return current.state, current.since
+}
+
+// Status is a snapshot of the client state, e.g. for a debug endpoint
+type Status struct {
+	URL   string          `json:"url"`
+	State ConnectionState `json:"state"`
+	// When the connection got into its state, zero before the client is started
+	StateSince time.Time `json:"stateSince"`
+	// Zero unless connected
+	ConnectedSince time.Time `json:"connectedSince"`
+	// Only set once a message has been received
+	LastSequenceNumber *arbutil.MessageIndex `json:"lastSequenceNumber,omitempty"`
+	RetryCount         int64                 `json:"retryCount"`
+	LastError          *FeedError            `json:"lastError,omitempty"`
+	// Time from broadcast to receipt of the most recent stamped message
+	Latency time.Duration `json:"latency"`
+	// Bytes read over the current or last connection, and their average rate
+	// while connected
+	ConnectionBytes          int64   `json:"connectionBytes"`
+	ConnectionBytesPerSecond float64 `json:"connectionBytesPerSecond"`
+	// Sequence number the feed is read from after a reconnect
+	NextSequenceNumber arbutil.MessageIndex `json:"nextSequenceNumber"`
+	URLs               []URLStatus          `json:"urls"`
+	Queues             QueueStatus          `json:"queues"`
+	ErrorCount         int64                `json:"errorCount"`
+	// Oldest first, at most RECENT_ERRORS_SIZE
+	RecentErrors []*FeedError `json:"recentErrors,omitempty"`
+	// Transaction streamers added with AddSink
+	Sinks []SinkStatus `json:"sinks,omitempty"`
+}
+
+// URLStatus is the state of one of the feed URLs the client fails over between
+type URLStatus struct {
+	URL                 string `json:"url"`
+	Active              bool   `json:"active"`
+	ConsecutiveFailures int    `json:"consecutiveFailures"`
+	// Zero unless connecting to the URL ever failed
+	LastFailure time.Time `json:"lastFailure"`
+	// Bytes read from the URL since the client started
+	BytesRead int64 `json:"bytesRead"`
+}
+
+// QueueStatus is what the client read from the feed but didn't forward yet
+type QueueStatus struct {
+	// Frames waiting for a decode worker, only with decode workers
+	Decode int `json:"decode"`
+	// Decoded frames waiting to be sequenced, only with decode workers
+	Process int `json:"process"`
+	// Batches of messages waiting to be handed to the transaction streamer
+	Delivery int `json:"delivery"`
+	// Messages held back waiting for a sequence gap to be filled
+	Held int64 `json:"held"`
+	// Frames read but not yet forwarded
+	Undelivered int64 `json:"undelivered"`
+}
+
+func (e *FeedError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Category string    `json:"category"`
+		URL      string    `json:"url"`
+		Time     time.Time `json:"time"`
+		Err      string    `json:"error"`
+	}{e.Category.String(), e.URL, e.Time, e.Err.Error()})
+}
+
+// clientStatus holds the parts of the status owned by the connection threads,
+// protected by statusMutex
+type clientStatus struct {
+	url                string
+	connectedSince     time.Time
+	lastSequenceNumber *arbutil.MessageIndex
+	latency            time.Duration
+	// Replaced rather than modified, so it can be shared with Status
+	urls         []URLStatus
+	recentErrors []*FeedError
+	// Bytes read over the current connection and from each URL
+	connectionBytes int64
+	urlBytes        map[string]int64
+}
+
+func (bc *BroadcastClient) updateStatus(update func(status *clientStatus)) {
+	bc.statusMutex.Lock()
+	defer bc.statusMutex.Unlock()
+	update(&bc.status)
+}
+
+// statusURL returns the URL of the last connection, for threads other than
+// the connection threads
+func (bc *BroadcastClient) statusURL() string {
+	bc.statusMutex.Lock()
+	defer bc.statusMutex.Unlock()
+	return bc.status.url
+}
+
+// publishURLs copies the state of the feed URLs into the status, called by
+// the connection threads whenever it changes
+func (bc *BroadcastClient) publishURLs() {
+	urls := make([]URLStatus, 0, len(bc.urls))
+	for i, url := range bc.urls {
+		urls = append(urls, URLStatus{
+			URL:                 url.url,
+			Active:              i == bc.activeURL,
+			ConsecutiveFailures: url.consecutiveFailures,
+			LastFailure:         url.lastFailure,
+		})
+	}
+	bc.updateStatus(func(status *clientStatus) { status.urls = urls })
+}
+
+// addRecentError keeps err in the status, dropping the oldest error once
+// RECENT_ERRORS_SIZE are kept
+func (bc *BroadcastClient) addRecentError(err *FeedError) {
+	bc.updateStatus(func(status *clientStatus) {
+		recentErrors := status.recentErrors
+		if len(recentErrors) >= RECENT_ERRORS_SIZE {
+			recentErrors = recentErrors[len(recentErrors)-RECENT_ERRORS_SIZE+1:]
+		}
+		status.recentErrors = append(append(make([]*FeedError, 0, len(recentErrors)+1), recentErrors...), err)
+	})
+}
+
+// Status returns the current state of the client, safe to call from any thread
+func (bc *BroadcastClient) Status() Status {
+	bc.statusMutex.Lock()
+	status := Status{
+		URL:                bc.status.url,
+		ConnectedSince:     bc.status.connectedSince,
+		Latency:            bc.status.latency,
+		RetryCount:         bc.GetRetryCount(),
+		LastError:          bc.LastError(),
+		NextSequenceNumber: bc.resumeSeqNum(),
+		ConnectionBytes:    bc.status.connectionBytes,
+		Queues: QueueStatus{
+			Decode:      len(bc.decodeQueue),
+			Process:     len(bc.processQueue),
+			Delivery:    len(bc.deliveryChan),
+			Held:        bc.reorderBuffer.held(),
+			Undelivered: atomic.LoadInt64(&bc.undelivered),
+		},
+		ErrorCount:   bc.ErrorCount(),
+		RecentErrors: bc.status.recentErrors,
+		Sinks:        bc.sinkStatuses(),
+	}
+	for _, url := range bc.status.urls {
+		url.BytesRead = bc.status.urlBytes[url.URL]
+		status.URLs = append(status.URLs, url)
+	}
+	if connected := bc.clock.Now().Sub(bc.status.connectedSince); !bc.status.connectedSince.IsZero() && connected > 0 {
+		status.ConnectionBytesPerSecond = float64(bc.status.connectionBytes) / connected.Seconds()
+	}
+	if bc.status.lastSequenceNumber != nil {
+		lastSequenceNumber := *bc.status.lastSequenceNumber
+		status.LastSequenceNumber = &lastSequenceNumber
+	}
+	bc.statusMutex.Unlock()
+
+	status.State, status.StateSince = bc.State()
+	switch {
+	case status.State == Stopped || status.State == Unreachable:
+	case bc.Stopped():
+		status.State = Stopped
+	case bc.IsPaused():
+		status.State = Paused
+	}
+	return status
+}
+
+// StatusHandler serves the statuses of feed clients as JSON, e.g. on a debug
+// server. The status isn't sensitive but isn't meant to be public either.
+func StatusHandler(statuses func() []Status) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		if r.Method == http.MethodHead {
+			return
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(statuses()); err != nil {
+			log.Debug("error writing sequencer feed status", "err", err)
+		}
+	})
+}
@@ -0,0 +1,116 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/offchainlabs/nitro/arbos/arbostypes"
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+func TestBroadcastClientStatus(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	config := wsbroadcastserver.DefaultTestBroadcasterConfig
+	feedErrChan := make(chan error, 10)
+	chainId := uint64(8742)
+	b := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &config }, chainId, feedErrChan, nil)
+	Require(t, b.Initialize())
+	Require(t, b.Start(ctx))
+	defer b.StopAndWait()
+
+	clientConfig := DefaultTestConfig
+	clientConfig.Verify.Dangerous.AcceptMissing = true
+	broadcastClient, err := newTestBroadcastClient(clientConfig, b.ListenerAddr(), chainId, 0, nil, feedErrChan, nil)
+	Require(t, err)
+	handler := &recordingHandler{make(chan arbutil.MessageIndex, 1), make(chan arbutil.MessageIndex, 1)}
+	broadcastClient.AddHandler(handler)
+	status := broadcastClient.Status()
+	if status.State != Disconnected || !status.StateSince.IsZero() || status.LastSequenceNumber != nil {
+		t.Fatalf("unexpected status before start: %+v", status)
+	}
+	if len(status.URLs) != 1 || !status.URLs[0].Active {
+		t.Fatalf("unexpected url status before start: %+v", status.URLs)
+	}
+	if err := broadcastClient.Healthy(ctx); !errors.Is(err, ErrFeedUnhealthy) {
+		t.Fatalf("expected unhealthy feed before start, got %v", err)
+	}
+	broadcastClient.Start(ctx)
+
+	for b.ClientCount() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	Require(t, b.BroadcastSingle(arbostypes.EmptyTestMessageWithMetadata, 0))
+	select {
+	case <-handler.messages:
+	case err := <-feedErrChan:
+		t.Fatalf("feed error: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("client did not deliver the message")
+	}
+	status = broadcastClient.Status()
+	if status.State != Connected || status.ConnectedSince.IsZero() || status.StateSince.Before(status.ConnectedSince) || status.URL == "" {
+		t.Fatalf("unexpected status while connected: %+v", status)
+	}
+	if status.LastSequenceNumber == nil || *status.LastSequenceNumber != 0 {
+		t.Fatalf("expected last sequence number 0, got %v", status.LastSequenceNumber)
+	}
+	if status.NextSequenceNumber != 1 {
+		t.Fatalf("expected next sequence number 1, got %v", status.NextSequenceNumber)
+	}
+	Require(t, broadcastClient.Healthy(ctx))
+
+	for i := 0; i < RECENT_ERRORS_SIZE+2; i++ {
+		broadcastClient.reportError(DecodeError, fmt.Errorf("error %d", i))
+	}
+	recentErrors := broadcastClient.Status().RecentErrors
+	if len(recentErrors) != RECENT_ERRORS_SIZE || recentErrors[0].Err.Error() != "error 2" || recentErrors[RECENT_ERRORS_SIZE-1].Err.Error() != fmt.Sprintf("error %d", RECENT_ERRORS_SIZE+1) {
+		t.Fatalf("unexpected recent errors: %v", recentErrors)
+	}
+	if err := broadcastClient.Healthy(ctx); !errors.Is(err, ErrFeedUnhealthy) {
+		t.Fatalf("expected unhealthy feed after decode errors, got %v", err)
+	}
+	healthServer := httptest.NewServer(HealthHandler(broadcastClient.Healthy))
+	defer healthServer.Close()
+	healthResp, err := http.Get(healthServer.URL)
+	Require(t, err)
+	healthResp.Body.Close()
+	if healthResp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected unhealthy feed to be unavailable, got %s", healthResp.Status)
+	}
+
+	server := httptest.NewServer(StatusHandler(func() []Status { return []Status{broadcastClient.Status()} }))
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	Require(t, err)
+	defer resp.Body.Close()
+	var served []struct {
+		State        string      `json:"state"`
+		URLs         []URLStatus `json:"urls"`
+		RecentErrors []struct {
+			Category string `json:"category"`
+		} `json:"recentErrors"`
+	}
+	Require(t, json.NewDecoder(resp.Body).Decode(&served))
+	if len(served) != 1 || served[0].State != "connected" || len(served[0].URLs) != 1 || len(served[0].RecentErrors) != RECENT_ERRORS_SIZE || served[0].RecentErrors[0].Category != "decode" {
+		t.Fatalf("unexpected served status: %+v", served)
+	}
+
+	broadcastClient.StopAndWait()
+	if state := broadcastClient.Status().State; state != Stopped {
+		t.Fatalf("expected stopped client, got %v", state)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	flag "github.com/spf13/pflag"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+var stopTimeoutsCounter = metrics.NewRegisteredCounter("arb/feed/stop/timeouts", nil)
+
+// StopConfig bounds how long shutting down the feed client may take
+type StopConfig struct {
+	DrainTimeout time.Duration `koanf:"drain-timeout" reload:"hot"`
+	Timeout      time.Duration `koanf:"timeout" reload:"hot"`
+}
+
+func StopConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Duration(prefix+".drain-timeout", DefaultStopConfig.DrainTimeout, "duration to wait on shutdown for messages already read from the sequencer feed to be forwarded (0 = don't wait)")
+	f.Duration(prefix+".timeout", DefaultStopConfig.Timeout, "duration to wait on shutdown for the sequencer feed client's threads to exit, e.g. when stuck forwarding to the transaction streamer, before leaving them behind (0 = wait indefinitely)")
+}
+
+var DefaultStopConfig = StopConfig{
+	DrainTimeout: 5 * time.Second,
+	Timeout:      30 * time.Second,
+}
+
+var DefaultTestStopConfig = StopConfig{
+	DrainTimeout: time.Second,
+	Timeout:      5 * time.Second,
+}
+
+// launchThread launches a thread that is named in the log if it doesn't exit
+// within Stop.Timeout on shutdown, and restarted if it panics, see
+// Panic.Restarts
+func (bc *BroadcastClient) launchThread(name string, foo func(ctx context.Context)) {
+	bc.launchThreadThen(name, foo, nil)
+}
+
+// launchThreadThen is launchThread calling then, if not nil, once the thread
+// exits for good
+func (bc *BroadcastClient) launchThreadThen(name string, foo func(ctx context.Context), then func()) {
+	bc.LaunchThread(func(ctx context.Context) {
+		bc.threadBusy(name, 1)
+		defer bc.threadBusy(name, -1)
+		if then != nil {
+			defer then()
+		}
+		for {
+			if panicked, restart := bc.recoverThread(ctx, name, foo); !panicked || !restart {
+				return
+			}
+		}
+	})
+}
+
+// callIteratively is CallIteratively with the thread named in the log if a
+// call doesn't return within Stop.Timeout on shutdown, waiting between calls by
+// the client's clock
+func (bc *BroadcastClient) callIteratively(name string, foo func(ctx context.Context) time.Duration) {
+	bc.LaunchThread(func(ctx context.Context) {
+		for {
+			var interval time.Duration
+			bc.threadBusy(name, 1)
+			panicked, restart := bc.recoverThread(ctx, name, func(ctx context.Context) { interval = foo(ctx) })
+			bc.threadBusy(name, -1)
+			if ctx.Err() != nil || (panicked && !restart) {
+				return
+			}
+			if interval > 0 && !bc.sleep(ctx, interval) {
+				return
+			}
+		}
+	})
+}
+
+func (bc *BroadcastClient) threadBusy(name string, delta int) {
+	bc.threadsMutex.Lock()
+	defer bc.threadsMutex.Unlock()
+	bc.threads[name] += delta
+	if bc.threads[name] <= 0 {
+		delete(bc.threads, name)
+	}
+}
+
+// busyThreads returns the names of the threads that are running, or busy for
+// iterative ones
+func (bc *BroadcastClient) busyThreads() []string {
+	bc.threadsMutex.Lock()
+	defer bc.threadsMutex.Unlock()
+	names := make([]string, 0, len(bc.threads))
+	for name := range bc.threads {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// stopThreads stops the threads and waits up to Stop.Timeout for them to exit.
+// Threads still running by then are left behind, with the connection closed
+// again in case they're blocked on it, so a stuck handler can't hang the
+// node's shutdown.
+func (bc *BroadcastClient) stopThreads() {
+	timeout := bc.config().Stop.Timeout
+	if timeout <= 0 || !bc.Started() {
+		bc.StopWaiter.StopAndWait()
+		return
+	}
+	bc.StopOnly()
+	waitChan, err := bc.GetWaitChannel()
+	if err != nil {
+		log.Warn("error waiting for sequencer feed client to stop", "err", err)
+		return
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-waitChan:
+		return
+	case <-timer.C:
+	}
+	stopTimeoutsCounter.Inc(1)
+	bc.connMutex.Lock()
+	if bc.conn != nil {
+		_ = bc.conn.Close()
+	}
+	bc.connMutex.Unlock()
+	log.Error("sequencer feed client threads did not exit in time, shutting down without them", "url", bc.statusURL(), "timeout", timeout, "threads", bc.busyThreads())
+}
@@ -0,0 +1,167 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	flag "github.com/spf13/pflag"
+
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+)
+
+var (
+	confirmedSeqDroppedCounter = metrics.NewRegisteredCounter("arb/feed/confirmed/dropped", nil)
+	subscriptionDroppedCounter = metrics.NewRegisteredCounter("arb/feed/subscription/dropped", nil)
+)
+
+// Policies for a confirmed sequence number listener that is full, since a
+// confirmation implies all earlier ones dropping some only delays pruning
+const (
+	// ConfirmedPolicyDropOldest makes room by dropping the oldest notification
+	ConfirmedPolicyDropOldest = "drop-oldest"
+	// ConfirmedPolicyBlock waits up to Confirmed.Timeout, then drops the new one
+	ConfirmedPolicyBlock = "block"
+)
+
+// ConfirmedConfig controls passing on confirmed sequence numbers to a listener
+// that is full
+type ConfirmedConfig struct {
+	Policy  string        `koanf:"policy" reload:"hot"`
+	Timeout time.Duration `koanf:"timeout" reload:"hot"`
+}
+
+func ConfirmedConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.String(prefix+".policy", DefaultConfirmedConfig.Policy, "what to do with a confirmed sequence number when its listener is full: \""+ConfirmedPolicyDropOldest+"\" to make room by dropping the oldest, or \""+ConfirmedPolicyBlock+"\" to wait up to the timeout before dropping it")
+	f.Duration(prefix+".timeout", DefaultConfirmedConfig.Timeout, "duration to wait for a full confirmed sequence number listener with the block policy (0 = wait indefinitely)")
+}
+
+var DefaultConfirmedConfig = ConfirmedConfig{
+	Policy:  ConfirmedPolicyDropOldest,
+	Timeout: time.Second,
+}
+
+func (c *ConfirmedConfig) Validate() error {
+	if c.Policy != ConfirmedPolicyDropOldest && c.Policy != ConfirmedPolicyBlock {
+		return fmt.Errorf("invalid confirmed sequence number policy %q, must be %q or %q", c.Policy, ConfirmedPolicyDropOldest, ConfirmedPolicyBlock)
+	}
+	return nil
+}
+
+// SubscribeConfirmedSeq returns a channel receiving the sequence numbers
+// confirmed on the parent chain. Each subscriber has its own buffer of
+// bufferSize entries, a subscriber that falls behind loses its oldest
+// notifications rather than blocking the delivery thread. Since a confirmation
+// implies all earlier ones, only the latest notification matters.
+func (bc *BroadcastClient) SubscribeConfirmedSeq(bufferSize int) <-chan arbutil.MessageIndex {
+	if bufferSize < 1 {
+		bufferSize = 1
+	}
+	ch := make(chan arbutil.MessageIndex, bufferSize)
+	bc.subscribersMutex.Lock()
+	defer bc.subscribersMutex.Unlock()
+	bc.subscribers[ch] = ch
+	return ch
+}
+
+// Unsubscribe stops notifications to a channel returned by SubscribeConfirmedSeq
+// and closes it
+func (bc *BroadcastClient) Unsubscribe(subscription <-chan arbutil.MessageIndex) {
+	bc.subscribersMutex.Lock()
+	defer bc.subscribersMutex.Unlock()
+	ch, ok := bc.subscribers[subscription]
+	if !ok {
+		return
+	}
+	delete(bc.subscribers, subscription)
+	close(ch)
+}
+
+func (bc *BroadcastClient) publishConfirmedSeq(seqNum arbutil.MessageIndex) {
+	bc.subscribersMutex.Lock()
+	defer bc.subscribersMutex.Unlock()
+	for _, ch := range bc.subscribers {
+		for sent := false; !sent; {
+			select {
+			case ch <- seqNum:
+				sent = true
+			default:
+				// Make room by dropping the oldest notification, unless the
+				// subscriber just received it
+				select {
+				case <-ch:
+					confirmedSeqDroppedCounter.Inc(1)
+				default:
+				}
+			}
+		}
+	}
+}
+
+// Subscribe returns a channel receiving the messages delivered from the feed,
+// decoded and verified, for consumers in the same process that aren't a
+// transaction streamer. Each subscriber has its own buffer of bufferSize
+// messages, a subscriber that falls behind loses its oldest messages rather
+// than blocking the delivery thread, which shows as a gap in the sequence
+// numbers. The channel is closed by calling cancel or when the client stops.
+func (bc *BroadcastClient) Subscribe(bufferSize int) (<-chan *broadcaster.BroadcastFeedMessage, func()) {
+	if bufferSize < 1 {
+		bufferSize = 1
+	}
+	ch := make(chan *broadcaster.BroadcastFeedMessage, bufferSize)
+	bc.subscribersMutex.Lock()
+	if bc.messageSubscribers == nil {
+		bc.messageSubscribers = make(map[chan *broadcaster.BroadcastFeedMessage]struct{})
+	}
+	bc.messageSubscribers[ch] = struct{}{}
+	bc.subscribersMutex.Unlock()
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			bc.subscribersMutex.Lock()
+			defer bc.subscribersMutex.Unlock()
+			if _, ok := bc.messageSubscribers[ch]; ok {
+				delete(bc.messageSubscribers, ch)
+				close(ch)
+			}
+		})
+	}
+	return ch, cancel
+}
+
+func (bc *BroadcastClient) publishMessages(messages []*broadcaster.BroadcastFeedMessage) {
+	bc.subscribersMutex.Lock()
+	defer bc.subscribersMutex.Unlock()
+	for ch := range bc.messageSubscribers {
+		for _, message := range messages {
+			for sent := false; !sent; {
+				select {
+				case ch <- message:
+					sent = true
+				default:
+					select {
+					case <-ch:
+						subscriptionDroppedCounter.Inc(1)
+					default:
+					}
+				}
+			}
+		}
+	}
+}
+
+// closeSubscriptions closes the channels returned by Subscribe once the client stopped
+func (bc *BroadcastClient) closeSubscriptions() {
+	bc.subscribersMutex.Lock()
+	defer bc.subscribersMutex.Unlock()
+	for ch := range bc.messageSubscribers {
+		delete(bc.messageSubscribers, ch)
+		close(ch)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/offchainlabs/nitro/arbos/arbostypes"
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+func TestConfirmedSeqSubscriptionDropsOldest(t *testing.T) {
+	broadcastClient, err := NewBroadcastClient(func() *Config { return &DefaultTestConfig }, nil, 0, 0, nil, nil, nil, func(_ int32) {}, nil)
+	Require(t, err)
+	slow := broadcastClient.SubscribeConfirmedSeq(2)
+	fast := broadcastClient.SubscribeConfirmedSeq(10)
+	for seqNum := arbutil.MessageIndex(1); seqNum <= 3; seqNum++ {
+		broadcastClient.deliverConfirmedSeq(seqNum)
+	}
+	for _, expected := range []arbutil.MessageIndex{2, 3} {
+		if received := <-slow; received != expected {
+			t.Fatalf("slow subscriber received %v, expected %v", received, expected)
+		}
+	}
+	for _, expected := range []arbutil.MessageIndex{1, 2, 3} {
+		if received := <-fast; received != expected {
+			t.Fatalf("fast subscriber received %v, expected %v", received, expected)
+		}
+	}
+	broadcastClient.Unsubscribe(slow)
+	if _, ok := <-slow; ok {
+		t.Fatal("subscription not closed by Unsubscribe")
+	}
+	broadcastClient.deliverConfirmedSeq(4)
+	if received := <-fast; received != 4 {
+		t.Fatalf("fast subscriber received %v, expected 4", received)
+	}
+}
+
+func TestMessageSubscription(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	settings := wsbroadcastserver.DefaultTestBroadcasterConfig
+	feedErrChan := make(chan error, 10)
+	chainId := uint64(8742)
+	b := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &settings }, chainId, feedErrChan, nil)
+	Require(t, b.Initialize())
+	Require(t, b.Start(ctx))
+	defer b.StopAndWait()
+
+	config := DefaultTestConfig
+	config.Verify.Dangerous.AcceptMissing = true
+	broadcastClient, err := NewBroadcastClientWithOptions(
+		LoopbackURL,
+		WithConfig(func() *Config { return &config }),
+		WithChainId(chainId),
+		WithLoopback(b),
+	)
+	Require(t, err)
+	messages, _ := broadcastClient.Subscribe(10)
+	slow, cancelSlow := broadcastClient.Subscribe(1)
+	broadcastClient.Start(ctx)
+	for seqNum := arbutil.MessageIndex(0); seqNum < 3; seqNum++ {
+		Require(t, b.BroadcastSingle(arbostypes.EmptyTestMessageWithMetadata, seqNum))
+	}
+	for expected := arbutil.MessageIndex(0); expected < 3; expected++ {
+		select {
+		case message := <-messages:
+			if message.SequenceNumber != expected {
+				t.Fatalf("subscriber received message %d, expected %d", message.SequenceNumber, expected)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("message %d not received by subscriber", expected)
+		}
+	}
+	// The slow subscriber only kept the newest message
+	if message := <-slow; message.SequenceNumber != 2 {
+		t.Fatalf("slow subscriber received message %d, expected 2", message.SequenceNumber)
+	}
+	cancelSlow()
+	cancelSlow()
+	if _, ok := <-slow; ok {
+		t.Fatal("subscription not closed by cancel")
+	}
+	broadcastClient.StopAndWait()
+	if _, ok := <-messages; ok {
+		t.Fatal("subscription not closed when the client stopped")
+	}
+}
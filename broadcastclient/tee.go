@@ -0,0 +1,37 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import "time"
+
+// FrameTee is called with the payload of every data frame read from the feed
+// before it is decoded, so that tools like archivers and mirrors can capture
+// the feed without a second connection to the relay. The payload is JSON
+// unless binary, decompressed but otherwise as sent. It's only valid during
+// the call and must be copied to be kept. Called from the reader thread, so it
+// must not block.
+type FrameTee func(url string, binary bool, payload []byte)
+
+// teeing is whether frames are handed to the tee or recorded, which needs them
+// read into memory in full
+func (bc *BroadcastClient) teeing() bool {
+	return bc.frameTee != nil || bc.recorder != nil
+}
+
+// teeFrame records a frame read from url and hands it to the tee, if any.
+// Returns the generation of the recording file the frame was recorded to, 0 if
+// it wasn't recorded.
+func (bc *BroadcastClient) teeFrame(url string, binary bool, frame *feedFrame) uint64 {
+	if frame.data == nil {
+		return 0
+	}
+	var recording uint64
+	if bc.recorder != nil {
+		recording = bc.recorder.record(time.Now(), binary, frame.data)
+	}
+	if bc.frameTee != nil {
+		bc.frameTee(url, binary, frame.data)
+	}
+	return recording
+}
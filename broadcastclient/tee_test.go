@@ -0,0 +1,90 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/offchainlabs/nitro/arbos/arbostypes"
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+func TestBroadcastClientFrameTee(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	config := wsbroadcastserver.DefaultTestBroadcasterConfig
+	feedErrChan := make(chan error, 10)
+	chainId := uint64(8742)
+	b := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &config }, chainId, feedErrChan, nil)
+	Require(t, b.Initialize())
+	Require(t, b.Start(ctx))
+	defer b.StopAndWait()
+
+	clientConfig := DefaultTestConfig
+	clientConfig.Verify.Dangerous.AcceptMissing = true
+	clientConfig.Decode.Stream = true
+	handler := &recordingHandler{make(chan arbutil.MessageIndex, 1), make(chan arbutil.MessageIndex, 1)}
+	feedURL := fmt.Sprintf("ws://127.0.0.1:%d/", b.ListenerAddr().(*net.TCPAddr).Port)
+	type teed struct {
+		url     string
+		payload []byte
+	}
+	frames := make(chan teed, 10)
+	broadcastClient, err := NewBroadcastClientWithOptions(
+		feedURL,
+		WithConfig(func() *Config { return &clientConfig }),
+		WithChainId(chainId),
+		WithFatalErrChan(feedErrChan),
+		WithHandler(handler),
+		WithFrameTee(func(url string, binary bool, payload []byte) {
+			if binary {
+				t.Error("feed sent a binary frame")
+			}
+			frames <- teed{url, append([]byte(nil), payload...)}
+		}),
+	)
+	Require(t, err)
+	broadcastClient.Start(ctx)
+	defer broadcastClient.StopAndWait()
+
+	for b.ClientCount() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	Require(t, b.BroadcastSingle(arbostypes.EmptyTestMessageWithMetadata, 0))
+	select {
+	case <-handler.messages:
+	case err := <-feedErrChan:
+		t.Fatalf("feed error: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("client did not deliver the message")
+	}
+	for {
+		select {
+		case frame := <-frames:
+			if frame.url != feedURL {
+				t.Fatalf("frame teed from %q, expected %q", frame.url, feedURL)
+			}
+			var msg broadcaster.BroadcastMessage
+			Require(t, json.Unmarshal(frame.payload, &msg))
+			if len(msg.Messages) == 0 {
+				continue
+			}
+			if msg.Messages[0].SequenceNumber != 0 {
+				t.Fatalf("teed message has sequence number %d, expected 0", msg.Messages[0].SequenceNumber)
+			}
+			return
+		default:
+			t.Fatal("frame with the message was not teed")
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+var (
+	throttledDeliveriesCounter = metrics.NewRegisteredCounter("arb/feed/delivery/throttled", nil)
+	throttleWaitHistogram      = metrics.NewRegisteredHistogram("arb/feed/delivery/throttle-wait", nil, metrics.NewBoundedHistogramSample())
+)
+
+// deliveryThrottle paces deliveries to the handlers so that they average at
+// most Delivery.MessageRate and Delivery.ByteRate. Time the handlers were idle
+// isn't saved up, so a catch-up burst after downtime is spread out as well.
+type deliveryThrottle struct {
+	// When the next delivery may start
+	next time.Time
+}
+
+// wait blocks until batch may be delivered, then accounts for it. Returns
+// false if ctx was cancelled first. Only called from the delivery thread.
+func (t *deliveryThrottle) wait(ctx context.Context, config *Config, batch *deliveryBatch) bool {
+	now := time.Now()
+	if config.Delivery.MessageRate <= 0 && config.Delivery.ByteRate <= 0 {
+		t.next = now
+		return true
+	}
+	var cost time.Duration
+	if config.Delivery.MessageRate > 0 {
+		cost = time.Duration(float64(len(batch.messages)) / config.Delivery.MessageRate * float64(time.Second))
+	}
+	if config.Delivery.ByteRate > 0 {
+		if byBytes := time.Duration(float64(batch.bytes) / float64(config.Delivery.ByteRate) * float64(time.Second)); byBytes > cost {
+			cost = byBytes
+		}
+	}
+	if delay := t.next.Sub(now); delay > 0 {
+		throttledDeliveriesCounter.Inc(1)
+		throttleWaitHistogram.Update(delay.Milliseconds())
+		log.Trace("throttling sequencer feed delivery", "messages", len(batch.messages), "bytes", batch.bytes, "delay", delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+		now = t.next
+	}
+	t.next = now.Add(cost)
+	return true
+}
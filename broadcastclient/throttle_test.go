@@ -0,0 +1,49 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/offchainlabs/nitro/broadcaster"
+)
+
+func TestDeliveryThrottle(t *testing.T) {
+	config := DefaultTestConfig
+	batch := func(messages int, bytes int64) *deliveryBatch {
+		return &deliveryBatch{messages: make([]*broadcaster.BroadcastFeedMessage, messages), bytes: bytes}
+	}
+	var throttle deliveryThrottle
+	waited := func(batch *deliveryBatch) time.Duration {
+		start := time.Now()
+		if !throttle.wait(context.Background(), &config, batch) {
+			t.Fatal("throttle wait cancelled")
+		}
+		return time.Since(start)
+	}
+
+	if elapsed := waited(batch(1000, 1<<20)); elapsed > 50*time.Millisecond {
+		t.Fatalf("unthrottled delivery waited %v", elapsed)
+	}
+	config.Delivery.MessageRate = 1000
+	// The first delivery pays afterwards, the second waits for it
+	waited(batch(200, 0))
+	if elapsed := waited(batch(1, 0)); elapsed < 150*time.Millisecond {
+		t.Fatalf("expected delivery throttled by message rate, waited %v", elapsed)
+	}
+	config.Delivery.MessageRate = 0
+	config.Delivery.ByteRate = 1000
+	waited(batch(1, 200))
+	if elapsed := waited(batch(1, 0)); elapsed < 150*time.Millisecond {
+		t.Fatalf("expected delivery throttled by byte rate, waited %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if throttle.wait(ctx, &config, batch(1, 1000)) && throttle.wait(ctx, &config, batch(1, 0)) {
+		t.Fatal("throttle wait not cancelled")
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	flag "github.com/spf13/pflag"
+)
+
+type TLSConfig struct {
+	CACertFile         string `koanf:"ca-cert-file" reload:"hot" json:"ca-cert-file,omitempty"`
+	ClientCertFile     string `koanf:"client-cert-file" reload:"hot" json:"client-cert-file,omitempty"`
+	ClientKeyFile      string `koanf:"client-key-file" reload:"hot" json:"client-key-file,omitempty"`
+	InsecureSkipVerify bool   `koanf:"insecure-skip-verify" reload:"hot" json:"insecure-skip-verify,omitempty"`
+	ServerName         string `koanf:"server-name" reload:"hot" json:"server-name,omitempty"`
+}
+
+func TLSConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.String(prefix+".ca-cert-file", DefaultTLSConfig.CACertFile, "PEM file of root certificates to verify the feed server with instead of the system roots")
+	f.String(prefix+".client-cert-file", DefaultTLSConfig.ClientCertFile, "PEM file of the client certificate to present to the feed server for mutual TLS")
+	f.String(prefix+".client-key-file", DefaultTLSConfig.ClientKeyFile, "PEM file of the private key for the client certificate")
+	f.Bool(prefix+".insecure-skip-verify", DefaultTLSConfig.InsecureSkipVerify, "DANGEROUS! skip verification of the feed server certificate")
+	f.String(prefix+".server-name", DefaultTLSConfig.ServerName, "name to send as SNI and verify the feed server certificate for, when it differs from the host dialed, e.g. behind a load balancer addressed by IP (empty = the host of the feed url)")
+}
+
+var DefaultTLSConfig = TLSConfig{
+	CACertFile:         "",
+	ClientCertFile:     "",
+	ClientKeyFile:      "",
+	InsecureSkipVerify: false,
+	ServerName:         "",
+}
+
+func (c *TLSConfig) Validate() error {
+	if (c.ClientCertFile == "") != (c.ClientKeyFile == "") {
+		return errors.New("feed client certificate and key files must be set together")
+	}
+	return nil
+}
+
+// tlsConfig builds the TLS config used to dial the feed. Files are read on
+// every call so rotated certificates are picked up on the next reconnect.
+func (c *TLSConfig) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// #nosec G402
+		InsecureSkipVerify: c.InsecureSkipVerify,
+		ServerName:         c.ServerName,
+	}
+	if c.CACertFile != "" {
+		pem, err := os.ReadFile(c.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read feed CA certificate file: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in feed CA certificate file %s", c.CACertFile)
+		}
+	}
+	if c.ClientCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.ClientCertFile, c.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load feed client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
@@ -0,0 +1,204 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/offchainlabs/nitro/arbos/arbostypes"
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+// writeTestCert writes a self-signed certificate for 127.0.0.1, which is also
+// its own CA, and its key to dir
+func writeTestCert(t *testing.T, dir string, name string) (string, string, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Require(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Require(t, err)
+	cert, err := x509.ParseCertificate(der)
+	Require(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	Require(t, err)
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	Require(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	Require(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600))
+	return certFile, keyFile, cert
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, cert := writeTestCert(t, dir, "client")
+
+	config := TLSConfig{CACertFile: certFile, ClientCertFile: certFile, ClientKeyFile: keyFile, InsecureSkipVerify: true}
+	Require(t, config.Validate())
+	tlsConfig, err := config.tlsConfig()
+	Require(t, err)
+	if tlsConfig.MinVersion != tls.VersionTLS12 || !tlsConfig.InsecureSkipVerify {
+		t.Fatalf("unexpected tls config: min version %x, insecure skip verify %v", tlsConfig.MinVersion, tlsConfig.InsecureSkipVerify)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	if !roots.Equal(tlsConfig.RootCAs) {
+		t.Fatal("CA certificate file not used as the root certificates")
+	}
+	if len(tlsConfig.Certificates) != 1 {
+		t.Fatalf("expected the client certificate to be presented, got %d certificates", len(tlsConfig.Certificates))
+	}
+
+	// A client certificate needs its key
+	if err := (&TLSConfig{ClientCertFile: certFile}).Validate(); err == nil {
+		t.Fatal("expected client certificate without key to be rejected")
+	}
+	notPEM := filepath.Join(dir, "not.pem")
+	Require(t, os.WriteFile(notPEM, []byte("not a certificate"), 0o600))
+	for _, config := range []TLSConfig{
+		{CACertFile: filepath.Join(dir, "missing.pem")},
+		{CACertFile: notPEM},
+		{ClientCertFile: certFile, ClientKeyFile: notPEM},
+	} {
+		if _, err := config.tlsConfig(); err == nil {
+			t.Fatalf("expected tls config %+v to fail", config)
+		}
+	}
+}
+
+func TestBroadcastClientTLS(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	serverCert, serverKey, _ := writeTestCert(t, dir, "server")
+	clientCert, clientKey, _ := writeTestCert(t, dir, "client")
+	settings := wsbroadcastserver.DefaultTestBroadcasterConfig
+	settings.Addr = "127.0.0.1"
+	settings.TLS = wsbroadcastserver.TLSConfig{
+		CertFile:          serverCert,
+		KeyFile:           serverKey,
+		ClientCAFile:      clientCert,
+		RequireClientCert: true,
+	}
+	Require(t, settings.Validate())
+	feedErrChan := make(chan error, 10)
+	chainId := uint64(8742)
+	b := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &settings }, chainId, feedErrChan, nil)
+	Require(t, b.Initialize())
+	Require(t, b.Start(ctx))
+	defer b.StopAndWait()
+	addr := b.ListenerAddr().String()
+
+	config := DefaultTestConfig
+	config.Verify.Dangerous.AcceptMissing = true
+	config.TLS = TLSConfig{CACertFile: serverCert, ClientCertFile: clientCert, ClientKeyFile: clientKey}
+	handler := &recordingHandler{make(chan arbutil.MessageIndex, 10), make(chan arbutil.MessageIndex, 10)}
+	broadcastClient, err := NewBroadcastClientWithOptions(
+		"wss://"+addr+"/",
+		WithConfig(func() *Config { return &config }),
+		WithChainId(chainId),
+		WithHandler(handler),
+	)
+	Require(t, err)
+	broadcastClient.Start(ctx)
+	defer broadcastClient.StopAndWait()
+	Require(t, b.BroadcastSingle(arbostypes.EmptyTestMessageWithMetadata, 0))
+	select {
+	case <-handler.messages:
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not received over tls")
+	}
+}
+
+func TestBroadcastClientPreferTLSFallback(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	settings := wsbroadcastserver.DefaultTestBroadcasterConfig
+	feedErrChan := make(chan error, 10)
+	chainId := uint64(8742)
+	b := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &settings }, chainId, feedErrChan, nil)
+	Require(t, b.Initialize())
+	Require(t, b.Start(ctx))
+	defer b.StopAndWait()
+
+	// The broadcaster only speaks plaintext, so the TLS upgrade fails
+	config := DefaultTestConfig
+	config.Verify.Dangerous.AcceptMissing = true
+	config.PreferTLS = true
+	broadcastClient, err := newTestBroadcastClient(config, b.ListenerAddr(), chainId, 0, nil, feedErrChan, nil)
+	Require(t, err)
+	handler := &recordingHandler{make(chan arbutil.MessageIndex, 1), make(chan arbutil.MessageIndex, 1)}
+	broadcastClient.AddHandler(handler)
+	broadcastClient.Start(ctx)
+	defer broadcastClient.StopAndWait()
+
+	for b.ClientCount() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	Require(t, b.BroadcastSingle(arbostypes.EmptyTestMessageWithMetadata, 0))
+	select {
+	case <-handler.messages:
+	case err := <-feedErrChan:
+		t.Fatalf("feed error: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("client did not fall back to plaintext")
+	}
+}
+
+func TestTLSServerName(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	Require(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600))
+	addr := server.Listener.Addr().String()
+
+	// The test certificate is issued for example.com, not the address dialed
+	for serverName, valid := range map[string]bool{"example.com": true, "relay.invalid": false} {
+		config := TLSConfig{CACertFile: caFile, ServerName: serverName}
+		tlsConfig, err := config.tlsConfig()
+		Require(t, err)
+		conn, err := tls.Dial("tcp", addr, tlsConfig)
+		if valid {
+			Require(t, err)
+			if state := conn.ConnectionState(); state.ServerName != serverName {
+				t.Fatalf("expected server name %s, got %s", serverName, state.ServerName)
+			}
+			_ = conn.Close()
+		} else if err == nil {
+			_ = conn.Close()
+			t.Fatalf("expected certificate verification to fail for server name %s", serverName)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/offchainlabs/nitro/broadcaster"
+)
+
+// Spans are recorded with the global OpenTelemetry tracer provider, which is a
+// no-op unless the embedding application installs one.
+var tracer = otel.Tracer("github.com/offchainlabs/nitro/broadcastclient")
+
+// setBatchAttributes annotates a feed batch span with the range of sequence
+// numbers it carried
+func setBatchAttributes(span trace.Span, messages []*broadcaster.BroadcastFeedMessage) {
+	if len(messages) == 0 || messages[0] == nil || messages[len(messages)-1] == nil {
+		return
+	}
+	span.SetAttributes(
+		attribute.Int("feed.messages", len(messages)),
+		attribute.Int64("feed.first_sequence_number", int64(messages[0].SequenceNumber)),
+		attribute.Int64("feed.last_sequence_number", int64(messages[len(messages)-1].SequenceNumber)),
+	)
+}
+
+func endSpanWithError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,105 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/offchainlabs/nitro/arbos/arbostypes"
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+var (
+	spanRecorderOnce sync.Once
+	spanRecorder     *tracetest.SpanRecorder
+)
+
+// recordSpans installs a tracer provider recording the spans of the client.
+// The tracer of the client is bound to the first provider installed.
+func recordSpans() *tracetest.SpanRecorder {
+	spanRecorderOnce.Do(func() {
+		spanRecorder = tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder)))
+	})
+	return spanRecorder
+}
+
+func TestTraceFeedBatches(t *testing.T) {
+	recorder := recordSpans()
+	started := time.Now()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	settings := wsbroadcastserver.DefaultTestBroadcasterConfig
+	feedErrChan := make(chan error, 10)
+	chainId := uint64(8742)
+	b := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &settings }, chainId, feedErrChan, nil)
+	Require(t, b.Initialize())
+	Require(t, b.Start(ctx))
+	defer b.StopAndWait()
+	Require(t, b.BroadcastSingle(arbostypes.EmptyTestMessageWithMetadata, 0))
+
+	config := DefaultTestConfig
+	config.Verify.Dangerous.AcceptMissing = true
+	handler := &recordingHandler{make(chan arbutil.MessageIndex, 10), make(chan arbutil.MessageIndex, 10)}
+	broadcastClient, err := NewBroadcastClientWithOptions(
+		"ws://"+b.ListenerAddr().String()+"/",
+		WithConfig(func() *Config { return &config }),
+		WithChainId(chainId),
+		WithHandler(handler),
+	)
+	Require(t, err)
+	broadcastClient.Start(ctx)
+	defer broadcastClient.StopAndWait()
+	select {
+	case <-handler.messages:
+	case err := <-feedErrChan:
+		t.Fatalf("feed error: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not received")
+	}
+
+	// The batch span ends once its messages were handed on
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for start := time.Now(); spans["feed.batch"] == nil; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("feed batch span not ended, ended spans: %v", spans)
+		}
+		for _, span := range recorder.Ended() {
+			if span.StartTime().Before(started) {
+				continue
+			}
+			for _, attr := range span.Attributes() {
+				// Only the batch of the message, not those of the hello or
+				// confirmations
+				if attr.Key == "feed.first_sequence_number" && attr.Value.AsInt64() == 0 {
+					spans[span.Name()] = span
+				}
+			}
+		}
+	}
+	batch := spans["feed.batch"]
+	added := spans["feed.add-messages"]
+	if added == nil {
+		t.Fatal("no span for adding the batch's messages")
+	}
+	if added.Parent().SpanID() != batch.SpanContext().SpanID() {
+		t.Fatal("adding the messages not traced as part of the batch")
+	}
+	for _, span := range recorder.Ended() {
+		if span.Name() == "feed.decode" && span.Parent().SpanID() == batch.SpanContext().SpanID() {
+			return
+		}
+	}
+	t.Fatal("decoding not traced as part of the batch")
+}
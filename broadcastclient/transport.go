@@ -0,0 +1,109 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsflate"
+	flag "github.com/spf13/pflag"
+
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+// TransportConfig selects the encodings and transports the feed may be read
+// over besides JSON over websocket
+type TransportConfig struct {
+	Binary              bool          `koanf:"binary" reload:"hot"`
+	BulkCatchup         bool          `koanf:"bulk-catchup" reload:"hot"`
+	EventStreamFallback bool          `koanf:"event-stream-fallback" reload:"hot"`
+	LongPollFallback    bool          `koanf:"long-poll-fallback" reload:"hot"`
+	LongPollWait        time.Duration `koanf:"long-poll-wait" reload:"hot"`
+	WebTransport        bool          `koanf:"webtransport" reload:"hot"`
+}
+
+func TransportConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Bool(prefix+".binary", DefaultTransportConfig.Binary, "request the binary RLP encoding of feed messages, falling back to JSON if the feed server does not support it")
+	f.Bool(prefix+".bulk-catchup", DefaultTransportConfig.BulkCatchup, "accept a large catchup backlog as a single gzip compressed frame, if the feed server is configured to send one")
+	f.Bool(prefix+".event-stream-fallback", DefaultTransportConfig.EventStreamFallback, "read the feed as server-sent events over plain HTTP if the websocket upgrade is refused, e.g. by a proxy")
+	f.Bool(prefix+".long-poll-fallback", DefaultTransportConfig.LongPollFallback, "follow the feed by repeatedly polling for new messages over plain HTTP if the websocket upgrade is refused, and the event stream too if enabled")
+	f.Duration(prefix+".long-poll-wait", DefaultTransportConfig.LongPollWait, "how long each poll asks the feed to wait for new messages before answering without any")
+	f.Bool(prefix+".webtransport", DefaultTransportConfig.WebTransport, "experimental: allow https:// and quic:// feed urls, which are read over WebTransport (HTTP/3 over QUIC)")
+}
+
+var DefaultTransportConfig = TransportConfig{
+	Binary:              false,
+	BulkCatchup:         true,
+	EventStreamFallback: false,
+	LongPollFallback:    false,
+	LongPollWait:        30 * time.Second,
+	WebTransport:        false,
+}
+
+// frameConsumer reads the data of a frame read from the feed
+type frameConsumer func(op ws.OpCode, frame io.Reader) error
+
+// feedTransport is how the feed is read from the connection to it, over
+// websocket, as server-sent events, by long polling, from a gRPC stream or
+// from a replayed recording. Only accessed by the connection threads.
+type feedTransport interface {
+	// readFrame reads the next frame from conn and hands its data to consume.
+	// Returns whether the feed may have resent messages already received.
+	readFrame(ctx context.Context, conn net.Conn, config *Config, timeout time.Duration, consume frameConsumer) (op ws.OpCode, resent bool, err error)
+	// readOnly is whether nothing is sent to the feed, not even a close frame
+	readOnly() bool
+	// name identifies the transport in logs
+	name() string
+}
+
+// catchupRequester is implemented by transports that send catchup requests
+// some other way than as a websocket text frame
+type catchupRequester interface {
+	requestCatchup(requestedSeqNum arbutil.MessageIndex) error
+}
+
+// wsTransport reads the feed over websocket
+type wsTransport struct {
+	// Frames read along with the upgrade response
+	earlyFrameData io.Reader
+	flateReader    *wsflate.Reader
+}
+
+func newWSTransport(br *bufio.Reader) *wsTransport {
+	t := &wsTransport{flateReader: wsbroadcastserver.NewFlateReader()}
+	if br != nil {
+		// Depending on how long the client takes to read the response, there may be
+		// data after the WebSocket upgrade response in a single read from the socket,
+		// ie WebSocket frames sent by the server. If this happens, Dial returns
+		// a non-nil bufio.Reader so that data isn't lost. But beware, this buffered
+		// reader is still hooked up to the socket; trying to read past what had already
+		// been buffered will do a blocking read on the socket, so we have to wrap it
+		// in a LimitedReader.
+		t.earlyFrameData = io.LimitReader(br, int64(br.Buffered()))
+	}
+	return t
+}
+
+func (t *wsTransport) readFrame(ctx context.Context, conn net.Conn, config *Config, timeout time.Duration, consume frameConsumer) (ws.OpCode, bool, error) {
+	op, err := wsbroadcastserver.ReadDataFunc(ctx, conn, t.earlyFrameData, timeout, ws.StateClientSide, config.EnableCompression, t.flateReader, consume)
+	return op, false, err
+}
+
+func (t *wsTransport) readOnly() bool { return false }
+
+func (t *wsTransport) name() string { return "websocket" }
+
+// currentTransport returns how the feed is read from the current connection,
+// nil if not connected yet
+func (bc *BroadcastClient) currentTransport() feedTransport {
+	bc.connMutex.Lock()
+	defer bc.connMutex.Unlock()
+	return bc.transport
+}
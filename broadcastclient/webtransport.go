@@ -0,0 +1,83 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"sync"
+
+	"github.com/quic-go/quic-go/http3"
+	"github.com/quic-go/webtransport-go"
+)
+
+// quicScheme is an alias of https:// for feed URLs read over WebTransport
+const quicScheme = "quic"
+
+// webTransportURL returns the https:// URL of the WebTransport session of a
+// feed URL, and whether the feed is read over WebTransport
+func webTransportURL(feedURL string) (string, bool) {
+	u, err := url.Parse(feedURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != quicScheme) {
+		return "", false
+	}
+	u.Scheme = "https"
+	return u.String(), true
+}
+
+// webTransportNetDial opens a WebTransport session to sessionURL and a stream
+// in it for the websocket dialer, whatever address it asks for
+func webTransportNetDial(config *Config, sessionURL string) NetDialFunc {
+	return func(ctx context.Context, _, _ string) (net.Conn, error) {
+		tlsConfig, err := config.TLS.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		dialer := &webtransport.Dialer{RoundTripper: &http3.RoundTripper{TLSClientConfig: tlsConfig}}
+		_, session, err := dialer.Dial(ctx, sessionURL, nil)
+		if err != nil {
+			_ = dialer.Close()
+			return nil, err
+		}
+		stream, err := session.OpenStreamSync(ctx)
+		if err != nil {
+			_ = session.CloseWithError(0, "")
+			_ = dialer.Close()
+			return nil, err
+		}
+		return &webTransportConn{Stream: stream, session: session, dialer: dialer}, nil
+	}
+}
+
+// webTransportConn is the stream of a WebTransport session, closing it ends
+// the session
+type webTransportConn struct {
+	webtransport.Stream
+	session   *webtransport.Session
+	dialer    *webtransport.Dialer
+	closeOnce sync.Once
+}
+
+func (c *webTransportConn) LocalAddr() net.Addr { return c.session.LocalAddr() }
+
+func (c *webTransportConn) RemoteAddr() net.Addr { return c.session.RemoteAddr() }
+
+func (c *webTransportConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		err = c.Stream.Close()
+		_ = c.session.CloseWithError(0, "")
+		_ = c.dialer.Close()
+		_ = c.dialer.RoundTripper.Close()
+	})
+	return err
+}
+
+// webTransportTransport reads the feed over websocket on a WebTransport stream
+type webTransportTransport struct {
+	*wsTransport
+}
+
+func (t *webTransportTransport) name() string { return "webtransport" }
@@ -0,0 +1,75 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/offchainlabs/nitro/arbos/arbostypes"
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+func TestBroadcastClientOverWebTransport(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serverCert, serverKey, _ := writeTestCert(t, t.TempDir(), "server")
+	settings := wsbroadcastserver.DefaultTestBroadcasterConfig
+	settings.Addr = "127.0.0.1"
+	settings.TLS = wsbroadcastserver.TLSConfig{CertFile: serverCert, KeyFile: serverKey}
+	settings.WebTransport.Enable = true
+	Require(t, settings.Validate())
+	feedErrChan := make(chan error, 10)
+	chainId := uint64(8742)
+	b := broadcaster.NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &settings }, chainId, feedErrChan, nil)
+	Require(t, b.Initialize())
+	Require(t, b.Start(ctx))
+	defer b.StopAndWait()
+	for i := 0; i < 3; i++ {
+		Require(t, b.BroadcastSingle(arbostypes.EmptyTestMessageWithMetadata, arbutil.MessageIndex(i)))
+	}
+
+	config := DefaultTestConfig
+	config.Verify.Dangerous.AcceptMissing = true
+	config.TLS.CACertFile = serverCert
+	config.URL = []string{"quic://" + b.WebTransportListenerAddr().String()}
+	if err := config.Validate(); err == nil {
+		t.Fatal("webtransport feed url accepted without transport.webtransport")
+	}
+	config.Transport.WebTransport = true
+	Require(t, config.Validate())
+	broadcastClient, err := NewBroadcastClient(func() *Config { return &config }, config.URL, chainId, 0, nil, feedErrChan, nil, func(_ int32) {}, nil)
+	Require(t, err)
+	handler := &recordingHandler{make(chan arbutil.MessageIndex, 10), make(chan arbutil.MessageIndex, 1)}
+	broadcastClient.AddHandler(handler)
+	broadcastClient.Start(ctx)
+	defer broadcastClient.StopAndWait()
+
+	receive := func(expected arbutil.MessageIndex) {
+		t.Helper()
+		select {
+		case seqNum := <-handler.messages:
+			if seqNum != expected {
+				t.Fatalf("received sequence number %d, expected %d", seqNum, expected)
+			}
+		case err := <-feedErrChan:
+			t.Fatalf("feed error: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("sequence number %d was not received over webtransport", expected)
+		}
+	}
+	for expected := arbutil.MessageIndex(0); expected < 3; expected++ {
+		receive(expected)
+	}
+	if _, ok := broadcastClient.currentTransport().(*webTransportTransport); !ok {
+		t.Fatal("client is not reading the feed over webtransport")
+	}
+	Require(t, b.BroadcastSingle(arbostypes.EmptyTestMessageWithMetadata, 3))
+	receive(3)
+}
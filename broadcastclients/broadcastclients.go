@@ -5,20 +5,128 @@ package broadcastclients
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
 	"sync/atomic"
+	"time"
 
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
 
 	"github.com/offchainlabs/nitro/arbutil"
 	"github.com/offchainlabs/nitro/broadcastclient"
+	"github.com/offchainlabs/nitro/broadcaster"
 	"github.com/offchainlabs/nitro/util/contracts"
+	"github.com/offchainlabs/nitro/util/stopwaiter"
 )
 
+const ROUTER_QUEUE_SIZE = 1024
+const RECENT_FEED_ITEM_TTL = time.Second * 10
+const RECENT_FEED_INITIAL_MAP_SIZE = 1024
+
+var (
+	duplicateMessagesCounter = metrics.NewRegisteredCounter("arb/feed/sources/duplicates", nil)
+	unreachableClientsGauge  = metrics.NewRegisteredGauge("arb/feed/sources/unreachable", nil)
+	droppedConfirmedCounter  = metrics.NewRegisteredCounter("arb/feed/sources/confirmed/dropped", nil)
+)
+
+// routedMessages are messages received from the client with index source, or
+// -1 if the sender is unknown
+type routedMessages struct {
+	source   int
+	messages []*broadcaster.BroadcastFeedMessage
+	// Closed by the routing thread once everything queued before it was forwarded
+	drained chan struct{}
+}
+
+// Router receives messages from every client and forwards each sequence number only once
+type Router struct {
+	messageChan                 chan routedMessages
+	confirmedSequenceNumberChan chan arbutil.MessageIndex
+
+	forwardTxStreamer                      broadcastclient.TransactionStreamerInterface
+	forwardConfirmedSequenceNumberListener chan arbutil.MessageIndex
+
+	// Closed when the routing thread exits so clients don't block on a full queue
+	done chan struct{}
+
+	// Highest message count forwarded from any client, use atomic access
+	messageCount uint64
+}
+
+// MessageCount returns the highest message count received from any feed, so a
+// client can tell it stalled while the others kept going
+func (r *Router) MessageCount() arbutil.MessageIndex {
+	return arbutil.MessageIndex(atomic.LoadUint64(&r.messageCount))
+}
+
+func (r *Router) AddBroadcastMessages(feedMessages []*broadcaster.BroadcastFeedMessage) error {
+	return r.route(-1, feedMessages)
+}
+
+func (r *Router) route(source int, feedMessages []*broadcaster.BroadcastFeedMessage) error {
+	select {
+	case r.messageChan <- routedMessages{source: source, messages: feedMessages}:
+	case <-r.done:
+	}
+	return nil
+}
+
+// routerSource tells the router which client messages came from, so that
+// feeds can be counted towards a quorum
+type routerSource struct {
+	router *Router
+	source int
+}
+
+func (s *routerSource) AddBroadcastMessages(feedMessages []*broadcaster.BroadcastFeedMessage) error {
+	return s.router.route(s.source, feedMessages)
+}
+
+// drain waits up to timeout for the messages queued in the router to be
+// forwarded, the clients must have been stopped first
+func (r *Router) drain(timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	drained := make(chan struct{})
+	select {
+	case r.messageChan <- routedMessages{drained: drained}:
+	case <-r.done:
+		return
+	case <-timer.C:
+		log.Warn("timed out forwarding messages read from the sequencer feeds before shutting down", "timeout", timeout)
+		return
+	}
+	select {
+	case <-drained:
+	case <-r.done:
+	case <-timer.C:
+		log.Warn("timed out forwarding messages read from the sequencer feeds before shutting down", "timeout", timeout)
+	}
+}
+
 type BroadcastClients struct {
-	clients []*broadcastclient.BroadcastClient
+	stopwaiter.StopWaiter
+	config        broadcastclient.ConfigFetcher
+	clients       []*broadcastclient.BroadcastClient
+	router        *Router
+	quorum        *quorum
+	inboxVerifier *broadcastclient.InboxVerifier
+
+	// Only set by NewBroadcastClientsFromConfig
+	fatalErrChan chan error
+	// Set before Start
+	pruneCallbacks []broadcastclient.PruneFunc
 
 	// Use atomic access
 	connected int32
+	running   int32
 }
 
 func NewBroadcastClients(
@@ -29,41 +137,245 @@ func NewBroadcastClients(
 	confirmedSequenceNumberListener chan arbutil.MessageIndex,
 	fatalErrChan chan error,
 	bpVerifier contracts.BatchPosterVerifierInterface,
+) (*BroadcastClients, error) {
+	return newBroadcastClients(configFetcher, l2ChainId, txStreamer, confirmedSequenceNumberListener, []broadcastclient.Option{
+		broadcastclient.WithMessageCount(currentMessageCount),
+		broadcastclient.WithFatalErrChan(fatalErrChan),
+		broadcastclient.WithBatchPosterVerifier(bpVerifier),
+	})
+}
+
+// NewBroadcastClientsFromConfig creates clients for a config that isn't
+// reloaded, e.g. by tools embedding the feed client. Unless WithFatalErrChan is
+// passed, errors the clients can't recover from are sent on FatalErrors.
+func NewBroadcastClientsFromConfig(
+	config *broadcastclient.Config,
+	l2ChainId uint64,
+	txStreamer broadcastclient.TransactionStreamerInterface,
+	opts ...broadcastclient.Option,
+) (*BroadcastClients, error) {
+	if !config.Enable() {
+		return nil, errors.New("no feed urls configured")
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	fatalErrChan := make(chan error, 1)
+	opts = append([]broadcastclient.Option{broadcastclient.WithFatalErrChan(fatalErrChan)}, opts...)
+	clients, err := newBroadcastClients(func() *broadcastclient.Config { return config }, l2ChainId, txStreamer, nil, opts)
+	if err != nil {
+		return nil, err
+	}
+	clients.fatalErrChan = fatalErrChan
+	return clients, nil
+}
+
+func newBroadcastClients(
+	configFetcher broadcastclient.ConfigFetcher,
+	l2ChainId uint64,
+	txStreamer broadcastclient.TransactionStreamerInterface,
+	confirmedSequenceNumberListener chan arbutil.MessageIndex,
+	opts []broadcastclient.Option,
 ) (*BroadcastClients, error) {
 	config := configFetcher()
 	urlCount := len(config.URL)
-	if urlCount <= 0 {
+	if urlCount <= 0 && !config.Discovery.Enable() {
 		return nil, nil
 	}
 
-	clients := BroadcastClients{}
-	clients.clients = make([]*broadcastclient.BroadcastClient, 0, urlCount)
+	if config.Quorum > 0 {
+		if config.Failover.Enable || config.Discovery.Enable() {
+			return nil, errors.New("feed quorum requires every feed URL to be connected to, it cannot be combined with failover or discovery")
+		}
+		if config.Quorum > urlCount {
+			return nil, fmt.Errorf("feed quorum of %d is larger than the %d feed URLs configured", config.Quorum, urlCount)
+		}
+	}
+
+	// In failover mode a single client rotates through the URLs in priority order,
+	// otherwise every URL gets its own simultaneously connected client. Discovered
+	// URLs are always failed over between.
+	urlGroups := make([][]string, 0, urlCount)
+	if config.Failover.Enable || config.Discovery.Enable() {
+		urlGroups = append(urlGroups, config.URL)
+	} else {
+		for _, address := range config.URL {
+			urlGroups = append(urlGroups, []string{address})
+		}
+	}
+
+	clients := BroadcastClients{
+		config: configFetcher,
+		router: &Router{
+			messageChan:                            make(chan routedMessages, ROUTER_QUEUE_SIZE),
+			confirmedSequenceNumberChan:            make(chan arbutil.MessageIndex, ROUTER_QUEUE_SIZE),
+			forwardTxStreamer:                      txStreamer,
+			forwardConfirmedSequenceNumberListener: confirmedSequenceNumberListener,
+			done:                                   make(chan struct{}),
+		},
+	}
+	if config.Quorum > 0 {
+		clients.quorum = newQuorum(config.Quorum)
+	}
+	if config.VerifyInbox {
+		clients.inboxVerifier = broadcastclient.NewInboxVerifier(l2ChainId)
+	}
+	clients.clients = make([]*broadcastclient.BroadcastClient, 0, len(urlGroups))
 	var lastClientErr error
-	for _, address := range config.URL {
-		client, err := broadcastclient.NewBroadcastClient(
-			configFetcher,
-			address,
-			l2ChainId,
-			currentMessageCount,
-			txStreamer,
-			confirmedSequenceNumberListener,
-			fatalErrChan,
-			bpVerifier,
-			func(delta int32) { clients.adjustCount(delta) },
+	for _, addresses := range urlGroups {
+		var url string
+		var fallbackURLs []string
+		if len(addresses) > 0 {
+			url, fallbackURLs = addresses[0], addresses[1:]
+		}
+		clientOpts := make([]broadcastclient.Option, 0, len(opts)+6)
+		clientOpts = append(clientOpts, broadcastclient.WithConfig(configFetcher), broadcastclient.WithChainId(l2ChainId))
+		clientOpts = append(clientOpts, opts...)
+		clientOpts = append(clientOpts,
+			broadcastclient.WithFallbackURLs(fallbackURLs...),
+			broadcastclient.WithTransactionStreamer(&routerSource{router: clients.router, source: len(clients.clients)}),
+			broadcastclient.WithConnectedCountHook(func(delta int32) { clients.adjustCount(delta) }),
+			broadcastclient.WithUnreachableHook(clients.clientUnreachable),
 		)
+		client, err := broadcastclient.NewBroadcastClientWithOptions(url, clientOpts...)
 		if err != nil {
 			lastClientErr = err
-			log.Warn("init broadcast client failed", "address", address)
+			log.Warn("init broadcast client failed", "addresses", addresses, "err", err)
+			continue
 		}
+		client.SetChainHead(clients.router.MessageCount)
 		clients.clients = append(clients.clients, client)
 	}
+	clients.running = int32(len(clients.clients))
 	if len(clients.clients) == 0 {
-		log.Error("no connected feed on startup, last error: %w", lastClientErr)
+		return nil, fmt.Errorf("no sequencer feed client could be created: %w", lastClientErr)
+	}
+	if config.Quorum > len(clients.clients) {
+		return nil, fmt.Errorf("feed quorum of %d is larger than the %d feed clients created: %w", config.Quorum, len(clients.clients), lastClientErr)
 	}
 
 	return &clients, nil
 }
 
+// FatalErrors returns the channel errors the clients can't recover from are
+// sent on, only for clients created by NewBroadcastClientsFromConfig
+func (bcs *BroadcastClients) FatalErrors() <-chan error {
+	return bcs.fatalErrChan
+}
+
+// InboxVerifier returns the verifier comparing feed messages to the parent
+// chain inbox, or nil if inbox verification is disabled
+func (bcs *BroadcastClients) InboxVerifier() *broadcastclient.InboxVerifier {
+	return bcs.inboxVerifier
+}
+
+// SetRegistryCaller sets the chain client to read the feed registry contract
+// with, must be called before Start
+func (bcs *BroadcastClients) SetRegistryCaller(caller ethereum.ContractCaller) error {
+	for _, client := range bcs.clients {
+		if err := client.SetRegistryCaller(caller); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetBLSKeyRegistryCaller sets the chain client to read the BLS key registry
+// contract with, must be called before Start
+func (bcs *BroadcastClients) SetBLSKeyRegistryCaller(caller ethereum.ContractCaller) error {
+	for _, client := range bcs.clients {
+		if err := client.SetBLSKeyRegistryCaller(caller); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetCoordinator sets the sequencer coordinator for clients following the
+// chosen sequencer's feed
+func (bcs *BroadcastClients) SetCoordinator(coordinator broadcastclient.FeedCoordinator) {
+	for _, client := range bcs.clients {
+		client.SetCoordinator(coordinator)
+	}
+}
+
+// AddPruneCallback registers a function to prune state kept for the feeds
+// with once messages are confirmed. It's called from the routing thread with
+// each higher confirmed sequence number. Must be called before Start.
+func (bcs *BroadcastClients) AddPruneCallback(prune broadcastclient.PruneFunc) {
+	bcs.pruneCallbacks = append(bcs.pruneCallbacks, prune)
+}
+
+// Status returns the state of every client
+func (bcs *BroadcastClients) Status() []broadcastclient.Status {
+	statuses := make([]broadcastclient.Status, 0, len(bcs.clients))
+	for _, client := range bcs.clients {
+		statuses = append(statuses, client.Status())
+	}
+	return statuses
+}
+
+// StatusHandler serves the state of every client as JSON, e.g. to be mounted
+// on the node's debug server
+func (bcs *BroadcastClients) StatusHandler() http.Handler {
+	return broadcastclient.StatusHandler(bcs.Status)
+}
+
+// Healthy returns nil if enough clients are healthy to follow the feed, any
+// one of them or as many as the quorum if there is one
+func (bcs *BroadcastClients) Healthy(ctx context.Context) error {
+	required := 1
+	if bcs.quorum != nil {
+		required = bcs.quorum.threshold
+	}
+	healthy := 0
+	var errs []error
+	for _, client := range bcs.clients {
+		if client == nil {
+			continue
+		}
+		if err := client.Healthy(ctx); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		healthy++
+		if healthy >= required {
+			return nil
+		}
+	}
+	if len(errs) == 0 {
+		return fmt.Errorf("%w: no feed clients", broadcastclient.ErrFeedUnhealthy)
+	}
+	return fmt.Errorf("%d of %d feeds healthy, %d required: %w", healthy, len(bcs.clients), required, errors.Join(errs...))
+}
+
+// serveStatus serves StatusHandler, and readiness probes at HealthPath, at
+// addr until the clients are stopped
+func (bcs *BroadcastClients) serveStatus(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/", bcs.StatusHandler())
+	mux.Handle(broadcastclient.HealthPath, broadcastclient.HealthHandler(bcs.Healthy))
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	log.Info("serving sequencer feed status", "addr", listener.Addr())
+	bcs.LaunchThread(func(ctx context.Context) {
+		<-ctx.Done()
+		_ = server.Close()
+	})
+	bcs.LaunchThread(func(ctx context.Context) {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error("error serving sequencer feed status", "err", err)
+		}
+	})
+	return nil
+}
+
 func (bcs *BroadcastClients) adjustCount(delta int32) {
 	connected := atomic.AddInt32(&bcs.connected, delta)
 	if connected <= 0 {
@@ -71,13 +383,178 @@ func (bcs *BroadcastClients) adjustCount(delta int32) {
 	}
 }
 
+// clientUnreachable is called when a client has given up reconnecting. Messages
+// keep arriving through the parent chain inbox, so this is only alerted on.
+func (bcs *BroadcastClients) clientUnreachable(err error) {
+	unreachableClientsGauge.Inc(1)
+	if atomic.AddInt32(&bcs.running, -1) <= 0 {
+		log.Error("all sequencer feeds unreachable, falling back to parent chain messages only", "err", err)
+	}
+}
+
 func (bcs *BroadcastClients) Start(ctx context.Context) {
+	bcs.StopWaiter.Start(ctx, bcs)
 	for _, client := range bcs.clients {
+		bcs.forwardConfirmedSeq(client.SubscribeConfirmedSeq(ROUTER_QUEUE_SIZE))
 		client.Start(ctx)
 	}
+	if addr := bcs.config().StatusAddr; addr != "" {
+		if err := bcs.serveStatus(addr); err != nil {
+			log.Error("error listening for sequencer feed status requests", "addr", addr, "err", err)
+		}
+	}
+
+	var lastConfirmed arbutil.MessageIndex
+	confirmedSeen := false
+	recentFeedItemsNew := make(map[arbutil.MessageIndex]time.Time, RECENT_FEED_INITIAL_MAP_SIZE)
+	recentFeedItemsOld := make(map[arbutil.MessageIndex]time.Time, RECENT_FEED_INITIAL_MAP_SIZE)
+	bcs.LaunchThread(func(ctx context.Context) {
+		defer close(bcs.router.done)
+		recentFeedItemsCleanup := time.NewTicker(RECENT_FEED_ITEM_TTL)
+		defer recentFeedItemsCleanup.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case routed := <-bcs.router.messageChan:
+				if routed.drained != nil {
+					close(routed.drained)
+					continue
+				}
+				forward := make([]*broadcaster.BroadcastFeedMessage, 0, len(routed.messages))
+				for _, msg := range routed.messages {
+					if bcs.quorum != nil {
+						if msg = bcs.quorum.vote(routed.source, msg); msg == nil {
+							continue
+						}
+					}
+					if _, ok := recentFeedItemsNew[msg.SequenceNumber]; ok {
+						duplicateMessagesCounter.Inc(1)
+						continue
+					}
+					if _, ok := recentFeedItemsOld[msg.SequenceNumber]; ok {
+						duplicateMessagesCounter.Inc(1)
+						continue
+					}
+					recentFeedItemsNew[msg.SequenceNumber] = time.Now()
+					forward = append(forward, msg)
+					if count := uint64(msg.SequenceNumber) + 1; count > atomic.LoadUint64(&bcs.router.messageCount) {
+						atomic.StoreUint64(&bcs.router.messageCount, count)
+					}
+				}
+				if len(forward) == 0 {
+					continue
+				}
+				if err := bcs.router.forwardTxStreamer.AddBroadcastMessages(forward); err != nil {
+					log.Error("Error routing message from Sequencer Feeds", "err", err)
+				}
+				if bcs.inboxVerifier != nil {
+					_ = bcs.inboxVerifier.HandleMessages(forward)
+				}
+			case cs := <-bcs.router.confirmedSequenceNumberChan:
+				if confirmedSeen && cs <= lastConfirmed {
+					continue
+				}
+				confirmedSeen = true
+				lastConfirmed = cs
+				if !bcs.forwardConfirmed(ctx, cs) {
+					return
+				}
+				if bcs.quorum != nil {
+					bcs.quorum.pruneConfirmed(cs)
+				}
+				for _, prune := range bcs.pruneCallbacks {
+					prune(cs)
+				}
+			case <-recentFeedItemsCleanup.C:
+				// Cycle buckets to get rid of old entries
+				recentFeedItemsOld = recentFeedItemsNew
+				recentFeedItemsNew = make(map[arbutil.MessageIndex]time.Time, RECENT_FEED_INITIAL_MAP_SIZE)
+				if bcs.quorum != nil {
+					bcs.quorum.prune(RECENT_FEED_ITEM_TTL)
+				}
+			}
+		}
+	})
 }
+
+// forwardConfirmed passes a confirmed sequence number on to the listener, if
+// any, following Confirmed.Policy when the listener is full so that a slow
+// listener can't stall routing messages. Returns false if ctx is done.
+func (bcs *BroadcastClients) forwardConfirmed(ctx context.Context, cs arbutil.MessageIndex) bool {
+	listener := bcs.router.forwardConfirmedSequenceNumberListener
+	if listener == nil {
+		return true
+	}
+	select {
+	case listener <- cs:
+		return true
+	default:
+	}
+	config := bcs.config()
+	if config.Confirmed.Policy == broadcastclient.ConfirmedPolicyBlock {
+		var timeout <-chan time.Time
+		if config.Confirmed.Timeout > 0 {
+			timer := time.NewTimer(config.Confirmed.Timeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case listener <- cs:
+		case <-timeout:
+			droppedConfirmedCounter.Inc(1)
+			log.Warn("timed out passing confirmed sequence number on, dropping it", "seqNum", cs, "timeout", config.Confirmed.Timeout)
+		}
+		return true
+	}
+	for {
+		select {
+		case listener <- cs:
+			return true
+		default:
+		}
+		// Make room by dropping the oldest notification, unless the listener
+		// just received it
+		select {
+		case <-listener:
+			droppedConfirmedCounter.Inc(1)
+		default:
+		}
+	}
+}
+
+// forwardConfirmedSeq passes a client's confirmed sequence numbers on to the
+// router. The client drops the oldest ones if the router falls behind.
+func (bcs *BroadcastClients) forwardConfirmedSeq(confirmed <-chan arbutil.MessageIndex) {
+	bcs.LaunchThread(func(ctx context.Context) {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case cs, ok := <-confirmed:
+				if !ok {
+					return
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case bcs.router.confirmedSequenceNumberChan <- cs:
+				}
+			}
+		}
+	})
+}
+
+// StopAndWait stops the clients, each forwarding what it already read from
+// its feed, and waits for the router to pass those messages on before stopping
 func (bcs *BroadcastClients) StopAndWait() {
 	for _, client := range bcs.clients {
 		client.StopAndWait()
 	}
+	if bcs.Started() && !bcs.Stopped() {
+		bcs.router.drain(bcs.config().Stop.DrainTimeout)
+	}
+	bcs.StopWaiter.StopAndWait()
 }
@@ -0,0 +1,321 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclients
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/offchainlabs/nitro/arbos/arbostypes"
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcastclient"
+	"github.com/offchainlabs/nitro/broadcaster"
+)
+
+type recordingStreamer struct {
+	received chan arbutil.MessageIndex
+}
+
+func (s *recordingStreamer) AddBroadcastMessages(feedMessages []*broadcaster.BroadcastFeedMessage) error {
+	for _, msg := range feedMessages {
+		s.received <- msg.SequenceNumber
+	}
+	return nil
+}
+
+func feedMessages(seqNums ...arbutil.MessageIndex) []*broadcaster.BroadcastFeedMessage {
+	messages := make([]*broadcaster.BroadcastFeedMessage, 0, len(seqNums))
+	for _, seqNum := range seqNums {
+		messages = append(messages, &broadcaster.BroadcastFeedMessage{
+			SequenceNumber: seqNum,
+			Message:        arbostypes.EmptyTestMessageWithMetadata,
+		})
+	}
+	return messages
+}
+
+func TestRouterDeduplicatesMessages(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	streamer := &recordingStreamer{received: make(chan arbutil.MessageIndex, 10)}
+	confirmed := make(chan arbutil.MessageIndex, 10)
+	bcs := &BroadcastClients{
+		config: func() *broadcastclient.Config { return &broadcastclient.DefaultTestConfig },
+		router: &Router{
+			messageChan:                            make(chan routedMessages, ROUTER_QUEUE_SIZE),
+			confirmedSequenceNumberChan:            make(chan arbutil.MessageIndex, ROUTER_QUEUE_SIZE),
+			forwardTxStreamer:                      streamer,
+			forwardConfirmedSequenceNumberListener: confirmed,
+			done:                                   make(chan struct{}),
+		},
+	}
+	bcs.Start(ctx)
+	defer bcs.StopAndWait()
+
+	// Two feeds deliver overlapping ranges
+	_ = bcs.router.AddBroadcastMessages(feedMessages(0, 1, 2))
+	_ = bcs.router.AddBroadcastMessages(feedMessages(1, 2, 3))
+	bcs.router.confirmedSequenceNumberChan <- 1
+	bcs.router.confirmedSequenceNumberChan <- 1
+	bcs.router.confirmedSequenceNumberChan <- 2
+
+	for expected := arbutil.MessageIndex(0); expected <= 3; expected++ {
+		select {
+		case seqNum := <-streamer.received:
+			if seqNum != expected {
+				t.Fatalf("expected sequence number %v, got %v", expected, seqNum)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("sequence number %v was not forwarded", expected)
+		}
+	}
+	for _, expected := range []arbutil.MessageIndex{1, 2} {
+		select {
+		case seqNum := <-confirmed:
+			if seqNum != expected {
+				t.Fatalf("expected confirmed sequence number %v, got %v", expected, seqNum)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("confirmed sequence number %v was not forwarded", expected)
+		}
+	}
+	select {
+	case seqNum := <-streamer.received:
+		t.Fatalf("duplicate sequence number %v forwarded", seqNum)
+	case seqNum := <-confirmed:
+		t.Fatalf("duplicate confirmed sequence number %v forwarded", seqNum)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestRouterConfirmedPolicy(t *testing.T) {
+	config := broadcastclient.DefaultTestConfig
+	confirmed := make(chan arbutil.MessageIndex, 2)
+	bcs := &BroadcastClients{
+		config: func() *broadcastclient.Config { return &config },
+		router: &Router{forwardConfirmedSequenceNumberListener: confirmed},
+	}
+	ctx := context.Background()
+
+	// A full listener loses its oldest notifications
+	for seqNum := arbutil.MessageIndex(1); seqNum <= 3; seqNum++ {
+		if !bcs.forwardConfirmed(ctx, seqNum) {
+			t.Fatal("forwarding stopped with a live context")
+		}
+	}
+	if first, second := <-confirmed, <-confirmed; first != 2 || second != 3 {
+		t.Fatalf("expected 2 and 3 kept, got %v and %v", first, second)
+	}
+
+	// Blocking waits for the listener up to the timeout, then drops the new one
+	config.Confirmed.Policy = broadcastclient.ConfirmedPolicyBlock
+	config.Confirmed.Timeout = 50 * time.Millisecond
+	confirmed <- 4
+	confirmed <- 5
+	start := time.Now()
+	if !bcs.forwardConfirmed(ctx, 6) {
+		t.Fatal("forwarding stopped with a live context")
+	}
+	if waited := time.Since(start); waited < config.Confirmed.Timeout {
+		t.Fatalf("expected to wait %v for the listener, waited %v", config.Confirmed.Timeout, waited)
+	}
+	if first, second := <-confirmed, <-confirmed; first != 4 || second != 5 {
+		t.Fatalf("expected 4 and 5 kept, got %v and %v", first, second)
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	confirmed <- 7
+	confirmed <- 8
+	config.Confirmed.Timeout = 0
+	if bcs.forwardConfirmed(cancelled, 9) {
+		t.Fatal("expected forwarding to stop with a cancelled context")
+	}
+}
+
+func TestRouterDrainsOnStop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Unbuffered, so messages stay queued in the router until received below
+	streamer := &recordingStreamer{received: make(chan arbutil.MessageIndex)}
+	bcs := &BroadcastClients{
+		config: func() *broadcastclient.Config { return &broadcastclient.DefaultTestConfig },
+		router: &Router{
+			messageChan:                 make(chan routedMessages, ROUTER_QUEUE_SIZE),
+			confirmedSequenceNumberChan: make(chan arbutil.MessageIndex, ROUTER_QUEUE_SIZE),
+			forwardTxStreamer:           streamer,
+			done:                        make(chan struct{}),
+		},
+	}
+	bcs.Start(ctx)
+	_ = bcs.router.AddBroadcastMessages(feedMessages(0, 1))
+	_ = bcs.router.AddBroadcastMessages(feedMessages(2, 3))
+
+	stopped := make(chan struct{})
+	go func() {
+		bcs.StopAndWait()
+		close(stopped)
+	}()
+	for expected := arbutil.MessageIndex(0); expected <= 3; expected++ {
+		select {
+		case seqNum := <-streamer.received:
+			if seqNum != expected {
+				t.Fatalf("expected sequence number %v, got %v", expected, seqNum)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("sequence number %v was not forwarded before stopping", expected)
+		}
+	}
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("router did not stop after draining")
+	}
+}
+
+func TestRouterQuorum(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	streamer := &recordingStreamer{received: make(chan arbutil.MessageIndex, 10)}
+	bcs := &BroadcastClients{
+		config: func() *broadcastclient.Config { return &broadcastclient.DefaultTestConfig },
+		router: &Router{
+			messageChan:                 make(chan routedMessages, ROUTER_QUEUE_SIZE),
+			confirmedSequenceNumberChan: make(chan arbutil.MessageIndex, ROUTER_QUEUE_SIZE),
+			forwardTxStreamer:           streamer,
+			done:                        make(chan struct{}),
+		},
+		quorum: newQuorum(2),
+	}
+	bcs.Start(ctx)
+	defer bcs.StopAndWait()
+	sources := make([]*routerSource, 3)
+	for i := range sources {
+		sources[i] = &routerSource{router: bcs.router, source: i}
+	}
+	expectForwarded := func(expected arbutil.MessageIndex) {
+		t.Helper()
+		select {
+		case seqNum := <-streamer.received:
+			if seqNum != expected {
+				t.Fatalf("expected sequence number %v, got %v", expected, seqNum)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("sequence number %v was not forwarded", expected)
+		}
+	}
+	expectNothing := func() {
+		t.Helper()
+		select {
+		case seqNum := <-streamer.received:
+			t.Fatalf("sequence number %v forwarded without quorum", seqNum)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	// A single feed, even repeating itself, doesn't make a quorum
+	_ = sources[0].AddBroadcastMessages(feedMessages(0))
+	_ = sources[0].AddBroadcastMessages(feedMessages(0))
+	expectNothing()
+	_ = sources[1].AddBroadcastMessages(feedMessages(0))
+	expectForwarded(0)
+	_ = sources[2].AddBroadcastMessages(feedMessages(0))
+	expectNothing()
+
+	// Feeds that disagree are counted separately
+	tampered := feedMessages(1)
+	tampered[0].Message.DelayedMessagesRead = 1
+	_ = sources[0].AddBroadcastMessages(feedMessages(1))
+	_ = sources[1].AddBroadcastMessages(tampered)
+	expectNothing()
+	_ = sources[2].AddBroadcastMessages(feedMessages(1))
+	expectForwarded(1)
+}
+
+func TestNewBroadcastClientsFromConfig(t *testing.T) {
+	streamer := &recordingStreamer{received: make(chan arbutil.MessageIndex, 10)}
+	config := broadcastclient.DefaultTestConfig
+	if _, err := NewBroadcastClientsFromConfig(&config, 0, streamer); err == nil {
+		t.Fatal("expected error without feed urls")
+	}
+
+	config.URL = []string{"ws://127.0.0.1:1/", "ws://127.0.0.1:2/"}
+	config.Quorum = 3
+	if _, err := NewBroadcastClientsFromConfig(&config, 0, streamer); err == nil {
+		t.Fatal("expected error for quorum larger than the number of feeds")
+	}
+
+	config.Quorum = 2
+	bcs, err := NewBroadcastClientsFromConfig(&config, 0, streamer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bcs.clients) != 2 || bcs.quorum == nil {
+		t.Fatalf("expected 2 clients in quorum mode, got %d", len(bcs.clients))
+	}
+	if bcs.FatalErrors() == nil {
+		t.Fatal("no channel for fatal errors")
+	}
+	for i, status := range bcs.Status() {
+		if status.URL != "" || status.State != broadcastclient.Disconnected {
+			t.Fatalf("unexpected status of client %d before start: %+v", i, status)
+		}
+	}
+	if err := bcs.Healthy(context.Background()); !errors.Is(err, broadcastclient.ErrFeedUnhealthy) {
+		t.Fatalf("expected unhealthy feeds before start, got %v", err)
+	}
+
+	// Clients that can't be created aren't started
+	notADir := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(notADir, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config.Record.Dir = notADir
+	if _, err := NewBroadcastClientsFromConfig(&config, 0, streamer); err == nil {
+		t.Fatal("expected error when no client could be created")
+	}
+}
+
+func TestFeedComparisonFindsDivergence(t *testing.T) {
+	config := broadcastclient.DefaultTestConfig
+	comparison, err := NewFeedComparison(func() *broadcastclient.Config { return &config }, 9744, [2]string{"ws://a", "ws://b"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The second feed skips 2, which is never compared
+	comparison.add(0, feedMessages(0, 1, 2, 3))
+	comparison.add(1, feedMessages(0, 1, 3))
+	if compared, last := comparison.Compared(); compared != 3 || last != 3 {
+		t.Fatalf("expected 3 sequence numbers compared up to 3, got %d up to %d", compared, last)
+	}
+
+	tampered := feedMessages(4, 5)
+	tampered[1].Message = arbostypes.TestMessageWithMetadataAndRequestId
+	comparison.add(1, tampered)
+	comparison.add(0, feedMessages(4, 5, 6))
+	select {
+	case divergence := <-comparison.Diverged():
+		if divergence.SequenceNumber != 5 {
+			t.Fatalf("expected divergence at 5, got %v", divergence.SequenceNumber)
+		}
+		if divergence.Hashes[0] == divergence.Hashes[1] {
+			t.Fatal("diverged content has identical hashes")
+		}
+		if !errors.Is(divergence, ErrFeedsDiverged) {
+			t.Fatal("divergence doesn't wrap ErrFeedsDiverged")
+		}
+	default:
+		t.Fatal("divergence not reported")
+	}
+	if compared, _ := comparison.Compared(); compared != 4 {
+		t.Fatalf("expected 4 identical sequence numbers, got %d", compared)
+	}
+}
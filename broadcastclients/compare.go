@@ -0,0 +1,174 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclients
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcastclient"
+	"github.com/offchainlabs/nitro/broadcaster"
+)
+
+var comparedMessagesCounter = metrics.NewRegisteredCounter("arb/feed/compare/messages", nil)
+
+var ErrFeedsDiverged = errors.New("feeds diverged")
+
+// Divergence is the first sequence number two feeds delivered different
+// content for, with the content hash from each feed
+type Divergence struct {
+	SequenceNumber arbutil.MessageIndex
+	URLs           [2]string
+	Hashes         [2]common.Hash
+}
+
+func (d *Divergence) Error() string {
+	return fmt.Sprintf("%v at sequence number %v: %v from %s, %v from %s", ErrFeedsDiverged, d.SequenceNumber, d.Hashes[0], d.URLs[0], d.Hashes[1], d.URLs[1])
+}
+
+func (d *Divergence) Unwrap() error {
+	return ErrFeedsDiverged
+}
+
+// FeedComparison follows two feeds at once and compares the content they
+// deliver for each sequence number, to detect tampering or corruption by a
+// relay
+type FeedComparison struct {
+	urls     [2]string
+	clients  [2]*broadcastclient.BroadcastClient
+	diverged chan *Divergence
+	errChan  chan error
+
+	mutex sync.Mutex
+	// Content hashes of the sequence numbers only one feed delivered yet
+	pending [2]map[arbutil.MessageIndex]common.Hash
+	// Last sequence number delivered by each feed
+	last         [2]arbutil.MessageIndex
+	delivered    [2]bool
+	compared     uint64
+	lastCompared arbutil.MessageIndex
+	divergence   *Divergence
+}
+
+// comparisonHandler hands the messages of one of the compared feeds to the
+// comparison
+type comparisonHandler struct {
+	comparison *FeedComparison
+	side       int
+}
+
+func (h *comparisonHandler) HandleMessages(messages []*broadcaster.BroadcastFeedMessage) error {
+	h.comparison.add(h.side, messages)
+	return nil
+}
+
+func (h *comparisonHandler) HandleConfirmedSeq(arbutil.MessageIndex) {}
+
+// NewFeedComparison creates clients of both feed URLs, asking each for the
+// messages from start onwards. Both use the same config apart from the URL.
+func NewFeedComparison(configFetcher broadcastclient.ConfigFetcher, chainId uint64, urls [2]string, start arbutil.MessageIndex) (*FeedComparison, error) {
+	c := &FeedComparison{
+		urls:     urls,
+		diverged: make(chan *Divergence, 1),
+		errChan:  make(chan error, 2),
+	}
+	for side, url := range urls {
+		c.pending[side] = make(map[arbutil.MessageIndex]common.Hash, RECENT_FEED_INITIAL_MAP_SIZE)
+		client, err := broadcastclient.NewBroadcastClientWithOptions(
+			url,
+			broadcastclient.WithConfig(configFetcher),
+			broadcastclient.WithChainId(chainId),
+			broadcastclient.WithMessageCount(start),
+			broadcastclient.WithFatalErrChan(c.errChan),
+			broadcastclient.WithHandler(&comparisonHandler{comparison: c, side: side}),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error creating client of feed %s: %w", url, err)
+		}
+		c.clients[side] = client
+	}
+	return c, nil
+}
+
+func (c *FeedComparison) Start(ctx context.Context) {
+	for _, client := range c.clients {
+		client.Start(ctx)
+	}
+}
+
+func (c *FeedComparison) StopAndWait() {
+	for _, client := range c.clients {
+		client.StopAndWait()
+	}
+}
+
+// Diverged receives the first divergence found, if any
+func (c *FeedComparison) Diverged() <-chan *Divergence {
+	return c.diverged
+}
+
+// Errors receives the errors that stop a client from following its feed
+func (c *FeedComparison) Errors() <-chan error {
+	return c.errChan
+}
+
+// Compared returns how many sequence numbers both feeds delivered identical
+// content for, and the last of them
+func (c *FeedComparison) Compared() (uint64, arbutil.MessageIndex) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.compared, c.lastCompared
+}
+
+// add compares the messages delivered by one feed with those the other feed
+// delivered for the same sequence numbers, keeping them until the other feed
+// delivers them. Each feed delivers in sequence, so a sequence number the
+// other feed already went past was skipped by it and can't be compared.
+func (c *FeedComparison) add(side int, messages []*broadcaster.BroadcastFeedMessage) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.divergence != nil {
+		return
+	}
+	other := 1 - side
+	for _, msg := range messages {
+		seqNum := msg.SequenceNumber
+		c.last[side] = seqNum
+		c.delivered[side] = true
+		hash, err := quorumContentHash(msg)
+		if err != nil {
+			log.Warn("error hashing feed message for comparison", "url", c.urls[side], "seqNum", seqNum, "err", err)
+			continue
+		}
+		otherHash, ok := c.pending[other][seqNum]
+		if !ok {
+			if !c.delivered[other] || seqNum > c.last[other] {
+				c.pending[side][seqNum] = hash
+			}
+			continue
+		}
+		delete(c.pending[other], seqNum)
+		if otherHash != hash {
+			c.divergence = &Divergence{
+				SequenceNumber: seqNum,
+				URLs:           c.urls,
+			}
+			c.divergence.Hashes[side] = hash
+			c.divergence.Hashes[other] = otherHash
+			log.Error("sequencer feeds diverged", "seqNum", seqNum, "url", c.urls[0], "hash", c.divergence.Hashes[0], "otherUrl", c.urls[1], "otherHash", c.divergence.Hashes[1])
+			c.diverged <- c.divergence
+			return
+		}
+		c.compared++
+		c.lastCompared = seqNum
+		comparedMessagesCounter.Inc(1)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclients
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+)
+
+var (
+	divergenceCounter    = metrics.NewRegisteredCounter("arb/feed/sources/divergences", nil)
+	quorumExpiredCounter = metrics.NewRegisteredCounter("arb/feed/sources/quorum/expired", nil)
+	quorumPrunedCounter  = metrics.NewRegisteredCounter("arb/feed/sources/quorum/pruned", nil)
+	quorumPendingGauge   = metrics.NewRegisteredGauge("arb/feed/sources/quorum/pending", nil)
+)
+
+// quorumCandidate is one version of the content received for a sequence number
+type quorumCandidate struct {
+	message *broadcaster.BroadcastFeedMessage
+	sources map[int]struct{}
+}
+
+type quorumVotes struct {
+	firstSeen  time.Time
+	forwarded  bool
+	diverged   bool
+	candidates map[common.Hash]*quorumCandidate
+}
+
+// quorum only lets a message through once enough feeds delivered identical
+// content for its sequence number. Only used from the routing thread.
+type quorum struct {
+	threshold int
+	votes     map[arbutil.MessageIndex]*quorumVotes
+}
+
+func newQuorum(threshold int) *quorum {
+	return &quorum{
+		threshold: threshold,
+		votes:     make(map[arbutil.MessageIndex]*quorumVotes, RECENT_FEED_INITIAL_MAP_SIZE),
+	}
+}
+
+// quorumContentHash hashes what the sequencer sent, the broadcast timestamp is
+// left out as it isn't part of the signed content
+func quorumContentHash(msg *broadcaster.BroadcastFeedMessage) (common.Hash, error) {
+	data, err := json.Marshal(msg.Message)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash(data, msg.Signature), nil
+}
+
+// vote records that source delivered msg, and returns the message once its
+// content reaches the threshold. Each sequence number is returned at most once.
+func (q *quorum) vote(source int, msg *broadcaster.BroadcastFeedMessage) *broadcaster.BroadcastFeedMessage {
+	hash, err := quorumContentHash(msg)
+	if err != nil {
+		log.Warn("error hashing feed message for quorum", "seqNum", msg.SequenceNumber, "err", err)
+		return nil
+	}
+	votes, ok := q.votes[msg.SequenceNumber]
+	if !ok {
+		votes = &quorumVotes{
+			firstSeen:  time.Now(),
+			candidates: make(map[common.Hash]*quorumCandidate, 1),
+		}
+		q.votes[msg.SequenceNumber] = votes
+		quorumPendingGauge.Update(int64(len(q.votes)))
+	}
+	candidate, ok := votes.candidates[hash]
+	if !ok {
+		candidate = &quorumCandidate{message: msg, sources: make(map[int]struct{}, q.threshold)}
+		votes.candidates[hash] = candidate
+		if len(votes.candidates) > 1 && !votes.diverged {
+			votes.diverged = true
+			divergenceCounter.Inc(1)
+			log.Error("sequencer feeds delivered different content for the same sequence number", "seqNum", msg.SequenceNumber, "versions", len(votes.candidates))
+		}
+	}
+	candidate.sources[source] = struct{}{}
+	if votes.forwarded || len(candidate.sources) < q.threshold {
+		return nil
+	}
+	votes.forwarded = true
+	return candidate.message
+}
+
+// prune forgets sequence numbers first seen more than ttl ago, so a late feed
+// can still raise a divergence alarm for recently forwarded messages
+func (q *quorum) prune(ttl time.Duration) {
+	cutoff := time.Now().Add(-ttl)
+	for seqNum, votes := range q.votes {
+		if votes.firstSeen.After(cutoff) {
+			continue
+		}
+		if !votes.forwarded {
+			quorumExpiredCounter.Inc(1)
+			log.Warn("sequencer feeds did not reach quorum for sequence number", "seqNum", seqNum, "versions", len(votes.candidates), "threshold", q.threshold)
+		}
+		delete(q.votes, seqNum)
+	}
+	quorumPendingGauge.Update(int64(len(q.votes)))
+}
+
+// pruneConfirmed forgets the forwarded sequence numbers up to confirmed, which
+// the node doesn't need the feeds for anymore. A late feed delivering one of
+// them again is then caught as a duplicate by the router. Sequence numbers
+// that never reached quorum are left to expire with a warning.
+func (q *quorum) pruneConfirmed(confirmed arbutil.MessageIndex) {
+	for seqNum, votes := range q.votes {
+		if seqNum <= confirmed && votes.forwarded {
+			delete(q.votes, seqNum)
+			quorumPrunedCounter.Inc(1)
+		}
+	}
+	quorumPendingGauge.Update(int64(len(q.votes)))
+}
@@ -5,7 +5,9 @@ package broadcaster
 
 import (
 	"context"
+	"fmt"
 	"net"
+	"time"
 
 	"github.com/gobwas/ws"
 
@@ -19,6 +21,7 @@ import (
 )
 
 type Broadcaster struct {
+	config        wsbroadcastserver.BroadcasterConfigFetcher
 	server        *wsbroadcastserver.WSBroadcastServer
 	catchupBuffer *SequenceNumberCatchupBuffer
 	chainId       uint64
@@ -44,12 +47,23 @@ type BroadcastMessage struct {
 	// TODO better name than messages since there are different types of messages
 	Messages                       []*BroadcastFeedMessage         `json:"messages,omitempty"`
 	ConfirmedSequenceNumberMessage *ConfirmedSequenceNumberMessage `json:"confirmedSequenceNumberMessage,omitempty"`
+	HelloMessage                   *HelloMessage                   `json:"helloMessage,omitempty"`
 }
 
 type BroadcastFeedMessage struct {
 	SequenceNumber arbutil.MessageIndex           `json:"sequenceNumber"`
 	Message        arbostypes.MessageWithMetadata `json:"message"`
 	Signature      []byte                         `json:"signature"`
+	// Unix milliseconds when the message was first broadcast, not covered by
+	// the signature and only used to measure feed latency
+	BroadcastTimestamp uint64 `json:"broadcastTimestamp,omitempty" rlp:"optional"`
+	// BLS signature over the message hash, set by sequencers signing the feed
+	// with BLS so that clients can verify a whole batch at once
+	BlsSignature []byte `json:"blsSignature,omitempty" rlp:"optional"`
+	// Message hash set by broadcasters configured to, so that clients can
+	// detect messages corrupted in transit, e.g. by a proxy, without a
+	// sequencer signature
+	ContentHash []byte `json:"contentHash,omitempty" rlp:"optional"`
 }
 
 func (m *BroadcastFeedMessage) Hash(chainId uint64) (common.Hash, error) {
@@ -60,9 +74,21 @@ type ConfirmedSequenceNumberMessage struct {
 	SequenceNumber arbutil.MessageIndex `json:"sequenceNumber"`
 }
 
+// HelloMessage is sent to every client as the first message after it connects,
+// so clients can verify they are connected to the feed of the right chain even
+// if the handshake headers were stripped along the way.
+type HelloMessage struct {
+	ChainId uint64 `json:"chainId"`
+}
+
 func NewBroadcaster(config wsbroadcastserver.BroadcasterConfigFetcher, chainId uint64, feedErrChan chan error, dataSigner signature.DataSignerFunc) *Broadcaster {
-	catchupBuffer := NewSequenceNumberCatchupBuffer(func() bool { return config().LimitCatchup })
+	catchupBuffer := NewSequenceNumberCatchupBuffer(
+		func() bool { return config().LimitCatchup },
+		func() *wsbroadcastserver.CatchupRetentionConfig { return &config().CatchupRetention },
+		chainId,
+	)
 	return &Broadcaster{
+		config:        config,
 		server:        wsbroadcastserver.NewWSBroadcastServer(config, catchupBuffer, chainId, feedErrChan),
 		catchupBuffer: catchupBuffer,
 		chainId:       chainId,
@@ -101,32 +127,55 @@ func (b *Broadcaster) BroadcastSingle(msg arbostypes.MessageWithMetadata, seq ar
 		return err
 	}
 
-	b.BroadcastSingleFeedMessage(bfm)
-	return nil
+	return b.BroadcastSingleFeedMessage(bfm)
 }
 
-func (b *Broadcaster) BroadcastSingleFeedMessage(bfm *BroadcastFeedMessage) {
+func (b *Broadcaster) BroadcastSingleFeedMessage(bfm *BroadcastFeedMessage) error {
 	broadcastFeedMessages := make([]*BroadcastFeedMessage, 0, 1)
 
 	broadcastFeedMessages = append(broadcastFeedMessages, bfm)
 
-	b.BroadcastFeedMessages(broadcastFeedMessages)
-}
-
-func (b *Broadcaster) BroadcastFeedMessages(messages []*BroadcastFeedMessage) {
+	return b.BroadcastFeedMessages(broadcastFeedMessages)
+}
+
+// BroadcastFeedMessages broadcasts copies of the messages stamped with the
+// broadcast time and, if configured, the content hash, the caller's messages
+// are left untouched. Nothing is broadcast if a message can't be hashed.
+func (b *Broadcaster) BroadcastFeedMessages(messages []*BroadcastFeedMessage) error {
+	// Relayed messages keep the timestamp of the original broadcaster, so
+	// latency is measured end to end
+	now := uint64(time.Now().UnixMilli())
+	contentHash := b.config().ContentHash
+	stamped := make([]*BroadcastFeedMessage, 0, len(messages))
+	for _, message := range messages {
+		stampedMessage := *message
+		if stampedMessage.BroadcastTimestamp == 0 {
+			stampedMessage.BroadcastTimestamp = now
+		}
+		// Relayed messages keep the hash of the original broadcaster too
+		if contentHash && len(stampedMessage.ContentHash) == 0 {
+			hash, err := stampedMessage.Hash(b.chainId)
+			if err != nil {
+				return fmt.Errorf("error hashing feed message %d: %w", message.SequenceNumber, err)
+			}
+			stampedMessage.ContentHash = hash.Bytes()
+		}
+		stamped = append(stamped, &stampedMessage)
+	}
 
 	bm := BroadcastMessage{
-		Version:  1,
-		Messages: messages,
+		Version:  wsbroadcastserver.FeedMessageVersion,
+		Messages: stamped,
 	}
 
 	b.server.Broadcast(bm)
+	return nil
 }
 
 func (b *Broadcaster) Confirm(seq arbutil.MessageIndex) {
 	log.Debug("confirming sequence number", "sequenceNumber", seq)
 	b.server.Broadcast(BroadcastMessage{
-		Version:                        1,
+		Version:                        wsbroadcastserver.FeedMessageVersion,
 		ConfirmedSequenceNumberMessage: &ConfirmedSequenceNumberMessage{seq}})
 }
 
@@ -138,24 +187,65 @@ func (b *Broadcaster) ListenerAddr() net.Addr {
 	return b.server.ListenerAddr()
 }
 
+// GRPCListenerAddr returns the address of the gRPC feed, nil if not enabled
+func (b *Broadcaster) GRPCListenerAddr() net.Addr {
+	return b.server.GRPCListenerAddr()
+}
+
+// WebTransportListenerAddr returns the UDP address of the WebTransport feed,
+// nil if not enabled
+func (b *Broadcaster) WebTransportListenerAddr() net.Addr {
+	return b.server.WebTransportListenerAddr()
+}
+
+// DialLoopback connects to the broadcaster within the process, without going
+// over the network, see WSBroadcastServer.DialLoopback
+func (b *Broadcaster) DialLoopback(ctx context.Context, network, addr string) (net.Conn, error) {
+	return b.server.DialLoopback(ctx, network, addr)
+}
+
 func (b *Broadcaster) GetCachedMessageCount() int {
 	return b.catchupBuffer.GetMessageCount()
 }
 
 func (b *Broadcaster) Initialize() error {
+	if err := b.catchupBuffer.OpenStore(&b.config().CatchupStore); err != nil {
+		return err
+	}
+	if err := b.catchupBuffer.OpenSharedStore(&b.config().SharedCatchup); err != nil {
+		return err
+	}
 	return b.server.Initialize()
 }
 
 func (b *Broadcaster) Start(ctx context.Context) error {
+	if b.catchupBuffer.store != nil {
+		b.catchupBuffer.store.Start(ctx)
+	}
+	if b.catchupBuffer.shared != nil {
+		b.catchupBuffer.shared.Start(ctx)
+	}
 	return b.server.Start(ctx)
 }
 
 func (b *Broadcaster) StartWithHeader(ctx context.Context, header ws.HandshakeHeader) error {
+	if b.catchupBuffer.store != nil {
+		b.catchupBuffer.store.Start(ctx)
+	}
+	if b.catchupBuffer.shared != nil {
+		b.catchupBuffer.shared.Start(ctx)
+	}
 	return b.server.StartWithHeader(ctx, header)
 }
 
 func (b *Broadcaster) StopAndWait() {
 	b.server.StopAndWait()
+	if b.catchupBuffer.shared != nil {
+		b.catchupBuffer.shared.StopAndWait()
+	}
+	if err := b.catchupBuffer.CloseStore(); err != nil {
+		log.Warn("error closing catchup store", "err", err)
+	}
 }
 
 func (b *Broadcaster) Started() bool {
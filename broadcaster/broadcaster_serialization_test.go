@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/big"
+	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/offchainlabs/nitro/arbos/arbostypes"
@@ -69,3 +70,104 @@ func ExampleBroadcastMessage_confirmedseqnum() {
 	fmt.Println(buf.String())
 	// Output: {"version":1,"confirmedSequenceNumberMessage":{"sequenceNumber":1234}}
 }
+
+func TestBroadcastMessageBinaryRoundTrip(t *testing.T) {
+	var requestId common.Hash
+	msg := BroadcastMessage{
+		Version: 1,
+		Messages: []*BroadcastFeedMessage{
+			{
+				SequenceNumber: 12345,
+				Message: arbostypes.MessageWithMetadata{
+					Message: &arbostypes.L1IncomingMessage{
+						Header: &arbostypes.L1IncomingMessageHeader{
+							Kind:      3,
+							RequestId: &requestId,
+							L1BaseFee: big.NewInt(7),
+						},
+						L2msg: []byte{0xde, 0xad, 0xbe, 0xef},
+					},
+					DelayedMessagesRead: 3333,
+				},
+				Signature:          []byte{0x01, 0x02},
+				BroadcastTimestamp: 1700000000000,
+			},
+		},
+		ConfirmedSequenceNumberMessage: &ConfirmedSequenceNumberMessage{
+			SequenceNumber: 1234,
+		},
+	}
+	data, err := msg.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded BroadcastMessage
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	expected, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, err := json.Marshal(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expected, actual) {
+		t.Fatalf("binary round trip mismatch, expected %s got %s", expected, actual)
+	}
+}
+
+func TestBroadcastMessageDecodeJSON(t *testing.T) {
+	var requestId common.Hash
+	msg := BroadcastMessage{
+		Version: 1,
+		Messages: []*BroadcastFeedMessage{
+			{
+				SequenceNumber: 12345,
+				Message: arbostypes.MessageWithMetadata{
+					Message: &arbostypes.L1IncomingMessage{
+						Header: &arbostypes.L1IncomingMessageHeader{
+							Kind:      3,
+							RequestId: &requestId,
+							L1BaseFee: big.NewInt(7),
+						},
+						L2msg: []byte{0xde, 0xad, 0xbe, 0xef},
+					},
+					DelayedMessagesRead: 3333,
+				},
+				Signature: []byte{0x01, 0x02},
+			},
+			{
+				SequenceNumber: 12346,
+				Message:        arbostypes.EmptyTestMessageWithMetadata,
+			},
+		},
+		ConfirmedSequenceNumberMessage: &ConfirmedSequenceNumberMessage{
+			SequenceNumber: 1234,
+		},
+	}
+	expected, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Unknown keys are skipped
+	data := append([]byte(`{"unknown":{"nested":[1,2]},`), expected[1:]...)
+	var decoded BroadcastMessage
+	if err := decoded.DecodeJSON(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	actual, err := json.Marshal(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expected, actual) {
+		t.Fatalf("streaming decode mismatch, expected %s got %s", expected, actual)
+	}
+
+	for _, invalid := range []string{`[]`, `{"messages":{}}`, `{"version":1`, `{"messages":[{"sequenceNumber":"x"}]}`} {
+		if err := new(BroadcastMessage).DecodeJSON(bytes.NewReader([]byte(invalid))); err == nil {
+			t.Fatalf("expected error decoding %s", invalid)
+		}
+	}
+}
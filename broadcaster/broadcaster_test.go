@@ -5,11 +5,19 @@ package broadcaster
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"math/big"
+	"net"
 	"testing"
 	"time"
 
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+
 	"github.com/offchainlabs/nitro/arbos/arbostypes"
+	"github.com/offchainlabs/nitro/arbutil"
 	"github.com/offchainlabs/nitro/util/testhelpers"
 	"github.com/offchainlabs/nitro/wsbroadcastserver"
 )
@@ -102,6 +110,75 @@ func TestBroadcasterMessagesRemovedOnConfirmation(t *testing.T) {
 		"clear all messages after confirmed 1 beyond latest"))
 }
 
+func TestBroadcasterServesCatchupRequests(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	config := wsbroadcastserver.DefaultTestBroadcasterConfig
+
+	chainId := uint64(5555)
+	feedErrChan := make(chan error, 10)
+	b := NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &config }, chainId, feedErrChan, nil)
+	Require(t, b.Initialize())
+	Require(t, b.Start(ctx))
+	defer b.StopAndWait()
+
+	for i := 0; i < 4; i++ {
+		Require(t, b.BroadcastSingle(arbostypes.EmptyTestMessageWithMetadata, arbutil.MessageIndex(i)))
+	}
+	waitUntilUpdated(t, &messageCountPredicate{b, 4, "after 4 messages", 0})
+
+	port := b.ListenerAddr().(*net.TCPAddr).Port
+	url := fmt.Sprintf("ws://127.0.0.1:%d/?%s=2", port, wsbroadcastserver.RequestedSequenceNumberQueryParameter)
+	conn, br, _, err := ws.Dial(ctx, url)
+	Require(t, err)
+	defer conn.Close()
+	// The catchup may have been read along with the handshake response
+	rw := struct {
+		io.Reader
+		io.Writer
+	}{conn, conn}
+	if br != nil {
+		rw.Reader = io.MultiReader(br, conn)
+	}
+
+	expectSequenceNumbers := func(expected ...arbutil.MessageIndex) {
+		t.Helper()
+		Require(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		data, _, err := wsutil.ReadServerData(rw)
+		Require(t, err)
+		var bm BroadcastMessage
+		Require(t, json.Unmarshal(data, &bm))
+		if len(bm.Messages) != len(expected) {
+			Fail(t, "expected", len(expected), "messages, got", len(bm.Messages))
+		}
+		for i, message := range bm.Messages {
+			if message.SequenceNumber != expected[i] {
+				Fail(t, "expected sequence number", expected[i], "got", message.SequenceNumber)
+			}
+		}
+	}
+
+	// The hello comes before anything else
+	Require(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	data, _, err := wsutil.ReadServerData(rw)
+	Require(t, err)
+	var hello BroadcastMessage
+	Require(t, json.Unmarshal(data, &hello))
+	if hello.HelloMessage == nil || hello.HelloMessage.ChainId != chainId {
+		Fail(t, "expected hello with chain id", chainId, "got", string(data))
+	}
+
+	// The query parameter requests the cached messages on connect
+	expectSequenceNumbers(2, 3)
+
+	// A connected client can request the cached messages again
+	request, err := json.Marshal(wsbroadcastserver.CatchupRequest{RequestedSequenceNumber: 0})
+	Require(t, err)
+	Require(t, wsutil.WriteClientText(conn, request))
+	expectSequenceNumbers(0, 1, 2, 3)
+}
+
 func Require(t *testing.T, err error, printables ...interface{}) {
 	t.Helper()
 	testhelpers.RequireImpl(t, err, printables...)
@@ -111,3 +188,40 @@ func Fail(t *testing.T, printables ...interface{}) {
 	t.Helper()
 	testhelpers.FailImpl(t, printables...)
 }
+
+func TestBroadcastFeedMessagesStampsCopies(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	config := wsbroadcastserver.DefaultTestBroadcasterConfig
+	config.ContentHash = true
+
+	chainId := uint64(5555)
+	feedErrChan := make(chan error, 10)
+	b := NewBroadcaster(func() *wsbroadcastserver.BroadcasterConfig { return &config }, chainId, feedErrChan, nil)
+	Require(t, b.Initialize())
+	Require(t, b.Start(ctx))
+	defer b.StopAndWait()
+
+	message, err := b.NewBroadcastFeedMessage(arbostypes.EmptyTestMessageWithMetadata, 0)
+	Require(t, err)
+	Require(t, b.BroadcastFeedMessages([]*BroadcastFeedMessage{message}))
+	if message.BroadcastTimestamp != 0 || message.ContentHash != nil {
+		t.Fatal("message of the caller stamped")
+	}
+	waitUntilUpdated(t, &messageCountPredicate{b, 1, "after 1 message", 0})
+	if cached := b.catchupBuffer.messages[0]; cached.BroadcastTimestamp == 0 || len(cached.ContentHash) == 0 {
+		t.Fatal("broadcast message not stamped")
+	}
+
+	// Messages that can't be hashed aren't broadcast without a hash
+	unhashable, err := b.NewBroadcastFeedMessage(arbostypes.MessageWithMetadata{
+		Message: &arbostypes.L1IncomingMessage{
+			Header: &arbostypes.L1IncomingMessageHeader{L1BaseFee: big.NewInt(-1)},
+		},
+	}, 1)
+	Require(t, err)
+	if err := b.BroadcastFeedMessages([]*BroadcastFeedMessage{unhashable}); err == nil {
+		t.Fatal("message broadcast without content hash")
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcaster
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/offchainlabs/nitro/util/stopwaiter"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+var (
+	catchupStoreErrorsCounter      = metrics.NewRegisteredCounter("arb/feed/cache/store/errors", nil)
+	catchupStoreCompactionsCounter = metrics.NewRegisteredCounter("arb/feed/cache/store/compactions", nil)
+	catchupStoreDroppedCounter     = metrics.NewRegisteredCounter("arb/feed/cache/store/dropped", nil)
+)
+
+const (
+	// The store is rewritten once at least this many messages were recorded
+	// since it was last, and most of them aren't cached anymore
+	minCatchupStoreCompaction = 1024
+	// Broadcasts waiting to be written to the store, more are dropped rather
+	// than holding up the broadcast to clients, and the store is rewritten
+	// once there's room again
+	catchupStoreQueue = 1024
+)
+
+// catchupStore persists the broadcasts applied to the catchup buffer as lines
+// of JSON in an append-only file, so that replaying them restores the buffer.
+// The file is compacted to just the cached messages on startup and whenever
+// it's mostly stale. The broadcasts are written by a thread of their own, so a
+// slow disk doesn't hold up the broadcast to clients.
+type catchupStore struct {
+	stopwaiter.StopWaiter
+	config wsbroadcastserver.CatchupStoreConfig
+	writes chan catchupStoreWrite
+	// Set by the writer thread when a write failed, the store is rewritten
+	// then
+	failed int32
+
+	// Used by the writer thread only once started
+	file *os.File
+
+	// Used by the broadcasting thread only
+	recorded int
+	dropped  bool
+}
+
+// catchupStoreWrite appends a broadcast to the store, or replaces it with
+// messages if compact is set
+type catchupStoreWrite struct {
+	bm       *BroadcastMessage
+	compact  bool
+	messages []*BroadcastFeedMessage
+}
+
+// OpenStore restores the catchup buffer from the configured store file and
+// records every broadcast to it from then on. It must be called before the
+// buffer is used.
+func (b *SequenceNumberCatchupBuffer) OpenStore(config *wsbroadcastserver.CatchupStoreConfig) error {
+	if config.File == "" {
+		return nil
+	}
+	file, err := os.Open(config.File)
+	if err == nil {
+		err = b.restore(file)
+		file.Close()
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to restore catchup buffer from %s: %w", config.File, err)
+	}
+	b.updated()
+	store := &catchupStore{
+		config: *config,
+		writes: make(chan catchupStoreWrite, catchupStoreQueue),
+	}
+	if err := store.compact(b.messages); err != nil {
+		return err
+	}
+	b.store = store
+	log.Info("restored catchup buffer", "file", config.File, "messages", len(b.messages))
+	return nil
+}
+
+// CloseStore stops recording broadcasts to the store file, once the ones still
+// queued are written
+func (b *SequenceNumberCatchupBuffer) CloseStore() error {
+	if b.store == nil {
+		return nil
+	}
+	b.store.StopAndWait()
+	b.store.flush(b.messages)
+	file := b.store.file
+	b.store = nil
+	if file == nil {
+		return nil
+	}
+	return file.Close()
+}
+
+// restore replays the broadcasts recorded in the store. A broken line is most
+// likely the last one being cut off by a crash, so the broadcasts up to it are
+// kept.
+func (b *SequenceNumberCatchupBuffer) restore(file io.Reader) error {
+	reader := bufio.NewReader(file)
+	for lineNum := 1; ; lineNum++ {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var bm BroadcastMessage
+			if jsonErr := json.Unmarshal(line, &bm); jsonErr != nil {
+				log.Warn("ignoring rest of catchup store after broken line", "line", lineNum, "err", jsonErr)
+				return nil
+			}
+			b.apply(&bm)
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *catchupStore) Start(ctx context.Context) {
+	s.StopWaiter.Start(ctx, s)
+	s.LaunchThread(func(ctx context.Context) {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case write := <-s.writes:
+				s.write(write)
+			}
+		}
+	})
+}
+
+// record queues a broadcast to be appended to the store file, or the cached
+// messages to replace it with if it's mostly stale, missed broadcasts or the
+// previous write failed
+func (s *catchupStore) record(bm *BroadcastMessage, messages []*BroadcastFeedMessage) {
+	if len(bm.Messages) == 0 && bm.ConfirmedSequenceNumberMessage == nil {
+		return
+	}
+	s.recorded += len(bm.Messages)
+	write := catchupStoreWrite{bm: bm}
+	if s.dropped || atomic.LoadInt32(&s.failed) != 0 || (s.recorded > minCatchupStoreCompaction && s.recorded > 2*len(messages)) {
+		// The buffer reuses its slice, so the writer needs a copy
+		write = catchupStoreWrite{compact: true, messages: append([]*BroadcastFeedMessage(nil), messages...)}
+	}
+	select {
+	case s.writes <- write:
+		if write.compact {
+			s.recorded = 0
+			s.dropped = false
+			atomic.StoreInt32(&s.failed, 0)
+		}
+	default:
+		s.dropped = true
+		catchupStoreDroppedCounter.Inc(1)
+	}
+}
+
+// flush writes the broadcasts still queued once the writer thread stopped,
+// and rewrites the store if it missed any
+func (s *catchupStore) flush(messages []*BroadcastFeedMessage) {
+	for {
+		select {
+		case write := <-s.writes:
+			s.write(write)
+		default:
+			if s.dropped || atomic.LoadInt32(&s.failed) != 0 {
+				s.write(catchupStoreWrite{compact: true, messages: messages})
+			}
+			return
+		}
+	}
+}
+
+// write applies a queued write to the store file. Errors are only logged, the
+// catchup buffer itself is still up to date.
+func (s *catchupStore) write(write catchupStoreWrite) {
+	var err error
+	if write.compact {
+		err = s.compact(write.messages)
+	} else if s.file != nil {
+		err = s.append(write.bm)
+	} else {
+		// A previous write failed, the compaction that follows has it
+		return
+	}
+	if err != nil {
+		log.Error("error writing catchup store", "file", s.config.File, "err", err)
+		catchupStoreErrorsCounter.Inc(1)
+		atomic.StoreInt32(&s.failed, 1)
+	}
+}
+
+func (s *catchupStore) append(bm *BroadcastMessage) error {
+	line, err := json.Marshal(bm)
+	if err != nil {
+		return err
+	}
+	_, err = s.file.Write(append(line, '\n'))
+	if err == nil && s.config.Sync {
+		err = s.file.Sync()
+	}
+	if err != nil {
+		// A partially written line would break the ones after it, rewrite
+		// the whole file next time instead
+		s.file.Close()
+		s.file = nil
+	}
+	return err
+}
+
+// compact atomically replaces the store file with one holding just messages
+func (s *catchupStore) compact(messages []*BroadcastFeedMessage) error {
+	tmpPath := s.config.File + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if len(messages) > 0 {
+		line, err := json.Marshal(BroadcastMessage{Version: wsbroadcastserver.FeedMessageVersion, Messages: messages})
+		if err == nil {
+			_, err = tmp.Write(append(line, '\n'))
+		}
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, s.config.File); err != nil {
+		return err
+	}
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file, err = os.OpenFile(s.config.File, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		s.file = nil
+		return err
+	}
+	catchupStoreCompactionsCounter.Inc(1)
+	return nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcaster
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// binaryBroadcastMessage is the RLP wire format of BroadcastMessage, sent to
+// clients that negotiated wsbroadcastserver.BinaryFeedSubprotocol.
+//
+// Fields added to BroadcastMessage or BroadcastFeedMessage later on must be
+// tagged rlp:"optional" to keep older clients able to decode the messages.
+type binaryBroadcastMessage struct {
+	Version                        uint64
+	Messages                       []*BroadcastFeedMessage
+	ConfirmedSequenceNumberMessage *ConfirmedSequenceNumberMessage `rlp:"nil"`
+	HelloMessage                   *HelloMessage                   `rlp:"optional"`
+}
+
+func (m BroadcastMessage) MarshalBinary() ([]byte, error) {
+	if m.Version < 0 {
+		return nil, errors.New("negative broadcast message version")
+	}
+	return rlp.EncodeToBytes(&binaryBroadcastMessage{
+		Version:                        uint64(m.Version),
+		Messages:                       m.Messages,
+		ConfirmedSequenceNumberMessage: m.ConfirmedSequenceNumberMessage,
+		HelloMessage:                   m.HelloMessage,
+	})
+}
+
+func (m *BroadcastMessage) UnmarshalBinary(data []byte) error {
+	var wire binaryBroadcastMessage
+	if err := rlp.DecodeBytes(data, &wire); err != nil {
+		return err
+	}
+	m.Version = int(wire.Version)
+	m.Messages = wire.Messages
+	m.ConfirmedSequenceNumberMessage = wire.ConfirmedSequenceNumberMessage
+	m.HelloMessage = wire.HelloMessage
+	return nil
+}
+
+// DecodeJSON decodes a JSON encoded message from r one feed message at a time,
+// so that a large batch never has to be held in memory in its encoded form as
+// well. Trailing data after the message is not read.
+func (m *BroadcastMessage) DecodeJSON(r io.Reader) error {
+	decoder := json.NewDecoder(r)
+	if err := expectDelim(decoder, '{'); err != nil {
+		return err
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := token.(string)
+		if !ok {
+			return fmt.Errorf("unexpected broadcast message key %v", token)
+		}
+		// Keys are matched case insensitively like json.Unmarshal does
+		switch {
+		case strings.EqualFold(key, "version"):
+			err = decoder.Decode(&m.Version)
+		case strings.EqualFold(key, "messages"):
+			err = m.decodeMessages(decoder)
+		case strings.EqualFold(key, "confirmedSequenceNumberMessage"):
+			err = decoder.Decode(&m.ConfirmedSequenceNumberMessage)
+		case strings.EqualFold(key, "helloMessage"):
+			err = decoder.Decode(&m.HelloMessage)
+		default:
+			var ignored json.RawMessage
+			err = decoder.Decode(&ignored)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return expectDelim(decoder, '}')
+}
+
+func (m *BroadcastMessage) decodeMessages(decoder *json.Decoder) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		m.Messages = nil
+		return nil
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("expected broadcast feed messages array, got %v", token)
+	}
+	m.Messages = m.Messages[:0]
+	for decoder.More() {
+		var message *BroadcastFeedMessage
+		if err := decoder.Decode(&message); err != nil {
+			return err
+		}
+		m.Messages = append(m.Messages, message)
+	}
+	return expectDelim(decoder, ']')
+}
+
+func expectDelim(decoder *json.Decoder, expected json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != expected {
+		return fmt.Errorf("expected %v in broadcast message, got %v", expected, token)
+	}
+	return nil
+}
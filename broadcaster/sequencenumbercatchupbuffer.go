@@ -5,6 +5,7 @@ package broadcaster
 
 import (
 	"errors"
+	"sort"
 	"sync/atomic"
 	"time"
 
@@ -23,51 +24,132 @@ const (
 var (
 	confirmedSequenceNumberGauge = metrics.NewRegisteredGauge("arb/sequencenumber/confirmed", nil)
 	cachedMessagesSentHistogram  = metrics.NewRegisteredHistogram("arb/feed/clients/cache/sent", nil, metrics.NewBoundedHistogramSample())
+	cachedMessagesGauge          = metrics.NewRegisteredGauge("arb/feed/cache/messages", nil)
+	cachedBytesGauge             = metrics.NewRegisteredGauge("arb/feed/cache/bytes", nil)
+	cacheEvictedMessagesCounter  = metrics.NewRegisteredCounter("arb/feed/cache/evicted/messages", nil)
+	cacheEvictedBytesCounter     = metrics.NewRegisteredCounter("arb/feed/cache/evicted/bytes", nil)
+	cacheEvictedAgeCounter       = metrics.NewRegisteredCounter("arb/feed/cache/evicted/age", nil)
 )
 
+// SequenceNumberCatchupBuffer caches the broadcast messages that weren't
+// confirmed yet, ordered by sequence number, to send to connecting clients
+// starting from the sequence number they request.
 type SequenceNumberCatchupBuffer struct {
 	messages     []*BroadcastFeedMessage
 	messageCount int32
 	limitCatchup func() bool
+	chainId      uint64
+
+	// Estimated size of messages, see messageSize
+	bytes     int
+	retention func() *wsbroadcastserver.CatchupRetentionConfig
+
+	// Persists the buffer across restarts if opened, see OpenStore
+	store *catchupStore
+	// Shares the buffer with other relays if opened, see OpenSharedStore
+	shared *sharedCatchup
 }
 
-func NewSequenceNumberCatchupBuffer(limitCatchup func() bool) *SequenceNumberCatchupBuffer {
+func NewSequenceNumberCatchupBuffer(limitCatchup func() bool, retention func() *wsbroadcastserver.CatchupRetentionConfig, chainId uint64) *SequenceNumberCatchupBuffer {
 	return &SequenceNumberCatchupBuffer{
 		limitCatchup: limitCatchup,
+		chainId:      chainId,
+		retention:    retention,
+	}
+}
+
+// messageSize estimates the memory held by a cached message
+func messageSize(m *BroadcastFeedMessage) int {
+	size := 128 + len(m.Signature) + len(m.BlsSignature) + len(m.ContentHash)
+	if m.Message.Message != nil {
+		size += len(m.Message.Message.L2msg)
+	}
+	return size
+}
+
+func (b *SequenceNumberCatchupBuffer) push(m *BroadcastFeedMessage) {
+	b.messages = append(b.messages, m)
+	b.bytes += messageSize(m)
+}
+
+func (b *SequenceNumberCatchupBuffer) clear() {
+	b.messages = nil
+	b.bytes = 0
+}
+
+// dropFront removes the oldest n messages
+func (b *SequenceNumberCatchupBuffer) dropFront(n int) {
+	for i := range b.messages[:n] {
+		b.bytes -= messageSize(b.messages[i])
+		// Don't keep the message alive until the slice is reallocated
+		b.messages[i] = nil
+	}
+	if b.bytes < 0 || n == len(b.messages) {
+		b.bytes = 0
+	}
+	b.messages = b.messages[n:]
+	if len(b.messages) > 10 && cap(b.messages) > len(b.messages)*10 {
+		// Too much spare capacity, copy to fresh slice to reset memory usage
+		b.messages = append([]*BroadcastFeedMessage(nil), b.messages[:len(b.messages)]...)
+	}
+}
+
+// enforceRetention evicts the oldest messages beyond any retention limit
+func (b *SequenceNumberCatchupBuffer) enforceRetention() {
+	if b.retention == nil {
+		return
+	}
+	config := b.retention()
+	if config.MaxMessages > 0 && len(b.messages) > config.MaxMessages {
+		evict := len(b.messages) - config.MaxMessages
+		cacheEvictedMessagesCounter.Inc(int64(evict))
+		b.dropFront(evict)
+	}
+	if config.MaxBytes > 0 && b.bytes > config.MaxBytes {
+		evict, excess := 0, b.bytes-config.MaxBytes
+		for evict < len(b.messages) && excess > 0 {
+			excess -= messageSize(b.messages[evict])
+			evict++
+		}
+		cacheEvictedBytesCounter.Inc(int64(evict))
+		b.dropFront(evict)
+	}
+	if config.MaxAge > 0 {
+		cutoff := uint64(time.Now().Add(-config.MaxAge).UnixMilli())
+		evict := 0
+		for evict < len(b.messages) && b.messages[evict].BroadcastTimestamp != 0 && b.messages[evict].BroadcastTimestamp < cutoff {
+			evict++
+		}
+		if evict > 0 {
+			cacheEvictedAgeCounter.Inc(int64(evict))
+			b.dropFront(evict)
+		}
 	}
 }
 
+// find returns the index of the first cached message with a sequence number
+// of at least seqNum, or the number of cached messages if there is none
+func (b *SequenceNumberCatchupBuffer) find(seqNum arbutil.MessageIndex) int {
+	return sort.Search(len(b.messages), func(i int) bool {
+		return b.messages[i].SequenceNumber >= seqNum
+	})
+}
+
 func (b *SequenceNumberCatchupBuffer) getCacheMessages(requestedSeqNum arbutil.MessageIndex) *BroadcastMessage {
 	if len(b.messages) == 0 {
 		return nil
 	}
-	var startingIndex int32
-	// Ignore messages older than requested sequence number
 	firstCachedSeqNum := b.messages[0].SequenceNumber
-	if firstCachedSeqNum < requestedSeqNum {
-		lastCachedSeqNum := firstCachedSeqNum + arbutil.MessageIndex(len(b.messages)-1)
-		if lastCachedSeqNum < requestedSeqNum {
-			// Past end, nothing to return
-			return nil
-		}
-		startingIndex = int32(requestedSeqNum - firstCachedSeqNum)
-		if startingIndex >= int32(len(b.messages)) {
-			log.Error("unexpected startingIndex", "requestedSeqNum", requestedSeqNum, "firstCachedSeqNum", firstCachedSeqNum, "startingIndex", startingIndex, "lastCachedSeqNum", lastCachedSeqNum, "cacheLength", len(b.messages))
-			return nil
-		}
-		if b.messages[startingIndex].SequenceNumber != requestedSeqNum {
-			log.Error("requestedSeqNum not found where expected", "requestedSeqNum", requestedSeqNum, "firstCachedSeqNum", firstCachedSeqNum, "startingIndex", startingIndex, "foundSeqNum", b.messages[startingIndex].SequenceNumber)
-			return nil
-		}
-	} else if b.limitCatchup() && firstCachedSeqNum > maxRequestedSeqNumOffset && requestedSeqNum < (firstCachedSeqNum-maxRequestedSeqNumOffset) {
+	if firstCachedSeqNum >= requestedSeqNum && b.limitCatchup() && firstCachedSeqNum > maxRequestedSeqNumOffset && requestedSeqNum < (firstCachedSeqNum-maxRequestedSeqNumOffset) {
 		// Requested seqnum is too old, don't send any cache
 		return nil
 	}
 
-	messagesToSend := b.messages[startingIndex:]
+	// Only the messages the client is missing, none if it's past the end
+	messagesToSend := b.messages[b.find(requestedSeqNum):]
 	if len(messagesToSend) > 0 {
 		bm := BroadcastMessage{
-			Version:  1,
+			Version:  wsbroadcastserver.FeedMessageVersion,
 			Messages: messagesToSend,
 		}
 
@@ -78,15 +160,39 @@ func (b *SequenceNumberCatchupBuffer) getCacheMessages(requestedSeqNum arbutil.M
 }
 
 func (b *SequenceNumberCatchupBuffer) OnRegisterClient(clientConnection *wsbroadcastserver.ClientConnection) (error, int, time.Duration) {
+	hello := BroadcastMessage{
+		Version:      wsbroadcastserver.FeedMessageVersion,
+		HelloMessage: &HelloMessage{ChainId: b.chainId},
+	}
+	if err := clientConnection.Write(hello); err != nil {
+		log.Error("error sending client hello", "error", err, "client", clientConnection.Name)
+		return err, 0, 0
+	}
+	return b.sendCacheMessages(clientConnection, clientConnection.RequestedSeqNum())
+}
+
+// OnCatchupRequest resends the cached messages from requestedSeqNum onwards
+// to an already registered client
+func (b *SequenceNumberCatchupBuffer) OnCatchupRequest(clientConnection *wsbroadcastserver.ClientConnection, requestedSeqNum arbutil.MessageIndex) (error, int, time.Duration) {
+	return b.sendCacheMessages(clientConnection, requestedSeqNum)
+}
+
+func (b *SequenceNumberCatchupBuffer) sendCacheMessages(clientConnection *wsbroadcastserver.ClientConnection, requestedSeqNum arbutil.MessageIndex) (error, int, time.Duration) {
 	start := time.Now()
-	bm := b.getCacheMessages(clientConnection.RequestedSeqNum())
+	bm := b.getCacheMessages(requestedSeqNum)
+	if shared := b.sharedCacheMessages(requestedSeqNum); len(shared) > 0 {
+		if bm == nil {
+			bm = &BroadcastMessage{Version: wsbroadcastserver.FeedMessageVersion}
+		}
+		bm.Messages = append(shared, bm.Messages...)
+	}
 	var bmCount int
 	if bm != nil {
 		bmCount = len(bm.Messages)
 	}
 	if bm != nil {
-		// send the newly connected client the requested messages
-		err := clientConnection.Write(bm)
+		// send the client the requested messages
+		err := clientConnection.WriteCatchup(bm, bmCount)
 		if err != nil {
 			log.Error("error sending client cached messages", "error", err, "client", clientConnection.Name, "elapsed", time.Since(start))
 			return err, 0, 0
@@ -110,11 +216,11 @@ func (b *SequenceNumberCatchupBuffer) deleteConfirmed(confirmedSequenceNumber ar
 		return
 	}
 
-	confirmedIndex := uint64(confirmedSequenceNumber - firstSequenceNumber)
+	confirmedIndex := b.find(confirmedSequenceNumber)
 
-	if confirmedIndex >= uint64(len(b.messages)) {
+	if confirmedIndex >= len(b.messages) {
 		log.Error("ConfirmedSequenceNumber is past the end of stored messages", "confirmedSequenceNumber", confirmedSequenceNumber, "firstSequenceNumber", firstSequenceNumber, "cacheLength", len(b.messages))
-		b.messages = nil
+		b.clear()
 		return
 	}
 
@@ -122,15 +228,11 @@ func (b *SequenceNumberCatchupBuffer) deleteConfirmed(confirmedSequenceNumber ar
 		// Log instead of returning error here so that the message will be sent to downstream
 		// relays to also cause them to be cleared.
 		log.Error("Invariant violation: confirmedSequenceNumber is not where expected, clearing buffer", "confirmedSequenceNumber", confirmedSequenceNumber, "firstSequenceNumber", firstSequenceNumber, "cacheLength", len(b.messages), "foundSequenceNumber", b.messages[confirmedIndex].SequenceNumber)
-		b.messages = nil
+		b.clear()
 		return
 	}
 
-	b.messages = b.messages[confirmedIndex+1:]
-	if len(b.messages) > 10 && cap(b.messages) > len(b.messages)*10 {
-		// Too much spare capacity, copy to fresh slice to reset memory usage
-		b.messages = append([]*BroadcastFeedMessage(nil), b.messages[:len(b.messages)]...)
-	}
+	b.dropFront(confirmedIndex + 1)
 }
 
 func (b *SequenceNumberCatchupBuffer) OnDoBroadcast(bmi interface{}) error {
@@ -140,8 +242,26 @@ func (b *SequenceNumberCatchupBuffer) OnDoBroadcast(bmi interface{}) error {
 		log.Error(msg)
 		return errors.New(msg)
 	}
-	defer func() { atomic.StoreInt32(&b.messageCount, int32(len(b.messages))) }()
+	defer b.updated()
 
+	b.apply(&broadcastMessage)
+	if b.store != nil {
+		b.store.record(&broadcastMessage, b.messages)
+	}
+	if b.shared != nil {
+		b.shared.record(&broadcastMessage, b.messages)
+	}
+	return nil
+}
+
+// updated publishes the message count and metrics after the buffer changed
+func (b *SequenceNumberCatchupBuffer) updated() {
+	atomic.StoreInt32(&b.messageCount, int32(len(b.messages)))
+	cachedMessagesGauge.Update(int64(len(b.messages)))
+	cachedBytesGauge.Update(int64(b.bytes))
+}
+
+func (b *SequenceNumberCatchupBuffer) apply(broadcastMessage *BroadcastMessage) {
 	if confirmMsg := broadcastMessage.ConfirmedSequenceNumberMessage; confirmMsg != nil {
 		b.deleteConfirmed(confirmMsg.SequenceNumber)
 		confirmedSequenceNumberGauge.Update(int64(confirmMsg.SequenceNumber))
@@ -150,25 +270,23 @@ func (b *SequenceNumberCatchupBuffer) OnDoBroadcast(bmi interface{}) error {
 	for _, newMsg := range broadcastMessage.Messages {
 		if len(b.messages) == 0 {
 			// Add to empty list
-			b.messages = append(b.messages, newMsg)
+			b.push(newMsg)
 		} else if expectedSequenceNumber := b.messages[len(b.messages)-1].SequenceNumber + 1; newMsg.SequenceNumber == expectedSequenceNumber {
 			// Next sequence number to add to end of list
-			b.messages = append(b.messages, newMsg)
+			b.push(newMsg)
 		} else if newMsg.SequenceNumber > expectedSequenceNumber {
 			log.Warn(
 				"Message requested to be broadcast has unexpected sequence number; discarding to seqNum from catchup buffer",
 				"seqNum", newMsg.SequenceNumber,
 				"expectedSeqNum", expectedSequenceNumber,
 			)
-			b.messages = nil
-			b.messages = append(b.messages, newMsg)
+			b.clear()
+			b.push(newMsg)
 		} else {
 			log.Info("Skipping already seen message", "seqNum", newMsg.SequenceNumber)
 		}
 	}
-
-	return nil
-
+	b.enforceRetention()
 }
 
 func (b *SequenceNumberCatchupBuffer) GetMessageCount() int {
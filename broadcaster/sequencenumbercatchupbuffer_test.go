@@ -17,11 +17,18 @@
 package broadcaster
 
 import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/offchainlabs/nitro/arbos/arbostypes"
 	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/util/redisutil"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
 )
 
 func TestGetEmptyCacheMessages(t *testing.T) {
@@ -105,6 +112,31 @@ func TestGetCacheMessages(t *testing.T) {
 	}
 }
 
+func TestGetCacheMessagesWithGaps(t *testing.T) {
+	indexes := []arbutil.MessageIndex{40, 41, 45, 46, 50}
+	buffer := SequenceNumberCatchupBuffer{
+		messages:     createDummyBroadcastMessages(indexes),
+		messageCount: int32(len(indexes)),
+		limitCatchup: func() bool { return false },
+	}
+
+	for requested, first := range map[arbutil.MessageIndex]arbutil.MessageIndex{0: 40, 41: 41, 42: 45, 46: 46, 47: 50, 50: 50} {
+		bm := buffer.getCacheMessages(requested)
+		if bm == nil {
+			t.Fatalf("nothing returned for %d", requested)
+		}
+		if bm.Messages[0].SequenceNumber != first {
+			t.Errorf("expected messages from %d to start at %d, got %d", requested, first, bm.Messages[0].SequenceNumber)
+		}
+		if last := bm.Messages[len(bm.Messages)-1].SequenceNumber; last != 50 {
+			t.Errorf("expected messages from %d to end at 50, got %d", requested, last)
+		}
+	}
+	if bm := buffer.getCacheMessages(51); bm != nil {
+		t.Error("should not have returned anything")
+	}
+}
+
 func TestDeleteConfirmedNil(t *testing.T) {
 	buffer := SequenceNumberCatchupBuffer{
 		messages:     nil,
@@ -223,3 +255,250 @@ func TestBroadcastFutureSeqNum(t *testing.T) {
 	}
 
 }
+
+func TestCatchupRetention(t *testing.T) {
+	retention := wsbroadcastserver.CatchupRetentionConfig{MaxMessages: 5}
+	buffer := NewSequenceNumberCatchupBuffer(
+		func() bool { return false },
+		func() *wsbroadcastserver.CatchupRetentionConfig { return &retention },
+		0,
+	)
+	broadcast := func(seqNums ...arbutil.MessageIndex) {
+		t.Helper()
+		messages := createDummyBroadcastMessages(seqNums)
+		for _, message := range messages {
+			message.BroadcastTimestamp = uint64(time.Now().UnixMilli())
+		}
+		if err := buffer.OnDoBroadcast(BroadcastMessage{Messages: messages}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectFirst := func(count int, first arbutil.MessageIndex) {
+		t.Helper()
+		if buffer.GetMessageCount() != count {
+			t.Fatalf("expected %d cached messages, got %d", count, buffer.GetMessageCount())
+		}
+		if count > 0 && buffer.messages[0].SequenceNumber != first {
+			t.Fatalf("expected first cached message %d, got %d", first, buffer.messages[0].SequenceNumber)
+		}
+	}
+
+	broadcast(40, 41, 42, 43, 44, 45, 46)
+	expectFirst(5, 42)
+
+	size := messageSize(buffer.messages[0])
+	if buffer.bytes != 5*size {
+		t.Fatalf("expected %d cached bytes, got %d", 5*size, buffer.bytes)
+	}
+	retention.MaxBytes = 3 * size
+	broadcast(47)
+	expectFirst(3, 45)
+
+	buffer.deleteConfirmed(45)
+	if buffer.bytes != 2*size {
+		t.Fatalf("expected %d cached bytes after confirmation, got %d", 2*size, buffer.bytes)
+	}
+
+	retention.MaxAge = time.Millisecond
+	time.Sleep(10 * time.Millisecond)
+	broadcast(48)
+	expectFirst(1, 48)
+}
+
+func TestCatchupStore(t *testing.T) {
+	config := wsbroadcastserver.CatchupStoreConfig{File: filepath.Join(t.TempDir(), "catchup")}
+	open := func() *SequenceNumberCatchupBuffer {
+		t.Helper()
+		buffer := NewSequenceNumberCatchupBuffer(func() bool { return false }, nil, 0)
+		if err := buffer.OpenStore(&config); err != nil {
+			t.Fatal(err)
+		}
+		return buffer
+	}
+	broadcast := func(buffer *SequenceNumberCatchupBuffer, bm BroadcastMessage) {
+		t.Helper()
+		if err := buffer.OnDoBroadcast(bm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectRestored := func(buffer *SequenceNumberCatchupBuffer, count int, first arbutil.MessageIndex, lines int) {
+		t.Helper()
+		if buffer.GetMessageCount() != count || buffer.messages[0].SequenceNumber != first {
+			t.Fatalf("expected %d messages from %d restored, got %d", count, first, buffer.GetMessageCount())
+		}
+		contents, err := os.ReadFile(config.File)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Count(contents, []byte("\n")) != lines {
+			t.Fatalf("expected store of %d lines, got:\n%s", lines, contents)
+		}
+	}
+
+	buffer := open()
+	broadcast(buffer, BroadcastMessage{Messages: createDummyBroadcastMessages([]arbutil.MessageIndex{40, 41, 42})})
+	broadcast(buffer, BroadcastMessage{Messages: createDummyBroadcastMessages([]arbutil.MessageIndex{43, 44, 45, 46})})
+	broadcast(buffer, BroadcastMessage{ConfirmedSequenceNumberMessage: &ConfirmedSequenceNumberMessage{42}})
+	if err := buffer.CloseStore(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A line cut off by a crash is ignored
+	file, err := os.OpenFile(config.File, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteString(`{"version":1,"messages":[{"sequ`); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	buffer = open()
+	expectRestored(buffer, 4, 43, 1)
+	broadcast(buffer, BroadcastMessage{Messages: createDummyBroadcastMessages([]arbutil.MessageIndex{47})})
+	if err := buffer.CloseStore(); err != nil {
+		t.Fatal(err)
+	}
+
+	buffer = open()
+	expectRestored(buffer, 5, 43, 1)
+	if bm := buffer.getCacheMessages(45); len(bm.Messages) != 3 {
+		t.Fatalf("expected 3 restored messages from 45, got %d", len(bm.Messages))
+	}
+
+	// Broadcasts are written in the background
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	buffer.store.Start(ctx)
+	broadcast(buffer, BroadcastMessage{Messages: createDummyBroadcastMessages([]arbutil.MessageIndex{48})})
+	for i := 0; ; i++ {
+		contents, err := os.ReadFile(config.File)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Count(contents, []byte("\n")) == 2 {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("broadcast not written to store:\n%s", contents)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := buffer.CloseStore(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A store missing broadcasts that didn't fit the queue is rewritten
+	buffer = open()
+	expectRestored(buffer, 6, 43, 1)
+	buffer.store.writes = make(chan catchupStoreWrite, 1)
+	broadcast(buffer, BroadcastMessage{Messages: createDummyBroadcastMessages([]arbutil.MessageIndex{49})})
+	broadcast(buffer, BroadcastMessage{Messages: createDummyBroadcastMessages([]arbutil.MessageIndex{50})})
+	if err := buffer.CloseStore(); err != nil {
+		t.Fatal(err)
+	}
+	buffer = open()
+	expectRestored(buffer, 8, 43, 1)
+	if err := buffer.CloseStore(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSharedCatchup(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	config := wsbroadcastserver.DefaultSharedCatchupConfig
+	config.RedisURL = redisutil.CreateTestRedis(ctx, t)
+	client, err := redisutil.RedisClientFromURL(config.RedisURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	open := func() *SequenceNumberCatchupBuffer {
+		t.Helper()
+		buffer := NewSequenceNumberCatchupBuffer(func() bool { return false }, nil, 0)
+		if err := buffer.OpenSharedStore(&config); err != nil {
+			t.Fatal(err)
+		}
+		buffer.shared.Start(ctx)
+		t.Cleanup(buffer.shared.StopAndWait)
+		return buffer
+	}
+	broadcast := func(buffer *SequenceNumberCatchupBuffer, bm BroadcastMessage, shared int64) {
+		t.Helper()
+		if err := buffer.OnDoBroadcast(bm); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; ; i++ {
+			count, err := client.ZCard(ctx, config.Key).Result()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count == shared {
+				return
+			}
+			if i == 100 {
+				t.Fatalf("expected %d shared messages, got %d", shared, count)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	expectCached := func(buffer *SequenceNumberCatchupBuffer, count int, first arbutil.MessageIndex) {
+		t.Helper()
+		if buffer.GetMessageCount() != count || buffer.messages[0].SequenceNumber != first {
+			t.Fatalf("expected %d messages from %d cached, got %d", count, first, buffer.GetMessageCount())
+		}
+	}
+
+	// expectShared waits for the shared messages sent to a client requesting
+	// requestedSeqNum to be fetched in the background
+	expectShared := func(buffer *SequenceNumberCatchupBuffer, requestedSeqNum arbutil.MessageIndex, count int, first arbutil.MessageIndex) {
+		t.Helper()
+		for i := 0; ; i++ {
+			shared := buffer.sharedCacheMessages(requestedSeqNum)
+			if len(shared) == count && (count == 0 || shared[0].SequenceNumber == first) {
+				return
+			}
+			if i == 100 {
+				t.Fatalf("expected %d shared messages from %d, got %d", count, first, len(shared))
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	relay1 := open()
+	relay2 := open()
+	broadcast(relay1, BroadcastMessage{Messages: createDummyBroadcastMessages([]arbutil.MessageIndex{40, 41, 42, 43, 44})}, 5)
+	expectShared(relay1, 0, 0, 0)
+
+	// Relays sharing the same stream write the same messages
+	broadcast(relay2, BroadcastMessage{Messages: createDummyBroadcastMessages([]arbutil.MessageIndex{43, 44})}, 5)
+	expectCached(relay2, 2, 43)
+	expectShared(relay2, 41, 2, 41)
+	expectShared(relay2, 43, 0, 0)
+
+	// Messages the relay stopped caching are fetched as well
+	broadcast(relay2, BroadcastMessage{Messages: createDummyBroadcastMessages([]arbutil.MessageIndex{45, 46, 47})}, 8)
+	relay2.dropFront(2)
+	broadcast(relay2, BroadcastMessage{Messages: createDummyBroadcastMessages([]arbutil.MessageIndex{48})}, 9)
+	expectCached(relay2, 4, 45)
+	expectShared(relay2, 40, 5, 40)
+
+	broadcast(relay1, BroadcastMessage{ConfirmedSequenceNumberMessage: &ConfirmedSequenceNumberMessage{41}}, 7)
+	broadcast(relay2, BroadcastMessage{ConfirmedSequenceNumberMessage: &ConfirmedSequenceNumberMessage{41}}, 7)
+	expectShared(relay2, 40, 3, 42)
+
+	// A relay starting later catches up clients the same
+	relay3 := open()
+	expectCached(relay3, 7, 42)
+	// Sequence number 0 bounds the fetched messages like any other
+	config.Key = "feed.catchup.genesis"
+	relay4 := open()
+	broadcast(relay4, BroadcastMessage{Messages: createDummyBroadcastMessages([]arbutil.MessageIndex{0, 1, 2})}, 3)
+	expectShared(relay4, 0, 0, 0)
+	relay4.dropFront(2)
+	broadcast(relay4, BroadcastMessage{Messages: createDummyBroadcastMessages([]arbutil.MessageIndex{3})}, 4)
+	expectCached(relay4, 2, 2)
+	expectShared(relay4, 0, 2, 0)
+}
@@ -0,0 +1,294 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcaster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/util/redisutil"
+	"github.com/offchainlabs/nitro/util/stopwaiter"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+var (
+	sharedCatchupErrorsCounter  = metrics.NewRegisteredCounter("arb/feed/cache/shared/errors", nil)
+	sharedCatchupDroppedCounter = metrics.NewRegisteredCounter("arb/feed/cache/shared/dropped", nil)
+	sharedCatchupSentHistogram  = metrics.NewRegisteredHistogram("arb/feed/clients/cache/shared/sent", nil, metrics.NewBoundedHistogramSample())
+)
+
+// Broadcasts waiting to be written to redis, more are dropped rather than
+// holding up the broadcast to clients
+const sharedCatchupQueue = 1024
+
+// sharedCatchup keeps the unconfirmed messages of a fleet of relays in a redis
+// sorted set scored by sequence number. Every relay writes the messages it
+// broadcasts, which are the same for all of them, and removes the confirmed
+// ones. A relay seeds its catchup buffer from the set when it starts, and
+// catches up clients from it that are missing messages the relay doesn't have
+// anymore or never had. Those are fetched in the background as the relay's
+// first cached message changes, so catching up never waits for redis.
+type sharedCatchup struct {
+	stopwaiter.StopWaiter
+	config wsbroadcastserver.SharedCatchupConfig
+	client redis.UniversalClient
+	writes chan sharedCatchupWrite
+
+	// The shared messages before olderEnd, the relay's first cached message
+	// when they were fetched. Only written by the writer thread.
+	olderMutex sync.RWMutex
+	older      []*BroadcastFeedMessage
+	olderEnd   arbutil.MessageIndex
+	olderValid bool
+}
+
+// sharedCatchupWrite is a broadcast to write to redis, and the first message
+// the relay had cached after it, if any
+type sharedCatchupWrite struct {
+	bm          *BroadcastMessage
+	firstCached arbutil.MessageIndex
+	cached      bool
+}
+
+// OpenSharedStore connects the catchup buffer to the configured redis and
+// seeds it with the messages shared there. Writing to redis starts with the
+// broadcaster.
+func (b *SequenceNumberCatchupBuffer) OpenSharedStore(config *wsbroadcastserver.SharedCatchupConfig) error {
+	if config.RedisURL == "" {
+		return nil
+	}
+	client, err := redisutil.RedisClientFromURL(config.RedisURL)
+	if err != nil {
+		return fmt.Errorf("invalid shared-catchup redis-url: %w", err)
+	}
+	shared := &sharedCatchup{
+		config: *config,
+		client: client,
+		writes: make(chan sharedCatchupWrite, sharedCatchupQueue),
+	}
+	messages, err := shared.fetch(context.Background(), 0, 0, false)
+	if err != nil {
+		// Redis may well be back by the time clients need it
+		log.Warn("error seeding catchup buffer from redis", "err", err)
+		sharedCatchupErrorsCounter.Inc(1)
+	} else if len(messages) > 0 {
+		b.apply(&BroadcastMessage{Messages: messages})
+		b.updated()
+		log.Info("seeded catchup buffer from redis", "messages", len(b.messages))
+	}
+	if len(b.messages) > 0 {
+		shared.olderEnd = b.messages[0].SequenceNumber
+		shared.olderValid = true
+	}
+	b.shared = shared
+	return nil
+}
+
+func (s *sharedCatchup) Start(ctx context.Context) {
+	s.StopWaiter.Start(ctx, s)
+	s.LaunchThread(func(ctx context.Context) {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case write := <-s.writes:
+				err := s.write(ctx, write.bm)
+				if err != nil {
+					log.Warn("error writing shared catchup messages to redis", "err", err)
+				} else if err = s.updateOlder(ctx, write); err != nil {
+					log.Warn("error fetching shared catchup messages from redis", "err", err)
+				}
+				if err != nil {
+					sharedCatchupErrorsCounter.Inc(1)
+				}
+			}
+		}
+	})
+}
+
+func (s *sharedCatchup) StopAndWait() {
+	s.StopWaiter.StopAndWait()
+	if err := s.client.Close(); err != nil {
+		log.Warn("error closing shared catchup redis client", "err", err)
+	}
+}
+
+// record queues a broadcast to be written to redis, given the messages cached
+// after it
+func (s *sharedCatchup) record(bm *BroadcastMessage, messages []*BroadcastFeedMessage) {
+	if len(bm.Messages) == 0 && bm.ConfirmedSequenceNumberMessage == nil {
+		return
+	}
+	write := sharedCatchupWrite{bm: bm}
+	if len(messages) > 0 {
+		write.firstCached = messages[0].SequenceNumber
+		write.cached = true
+	}
+	select {
+	case s.writes <- write:
+	default:
+		sharedCatchupDroppedCounter.Inc(1)
+	}
+}
+
+func (s *sharedCatchup) write(ctx context.Context, bm *BroadcastMessage) error {
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, message := range bm.Messages {
+			data, err := json.Marshal(message)
+			if err != nil {
+				return err
+			}
+			// Replaces the message of a reorg, or the same one written by
+			// another relay
+			score := strconv.FormatUint(uint64(message.SequenceNumber), 10)
+			pipe.ZRemRangeByScore(ctx, s.config.Key, score, score)
+			pipe.ZAdd(ctx, s.config.Key, &redis.Z{Score: float64(message.SequenceNumber), Member: data})
+		}
+		if confirmMsg := bm.ConfirmedSequenceNumberMessage; confirmMsg != nil {
+			pipe.ZRemRangeByScore(ctx, s.config.Key, "-inf", strconv.FormatUint(uint64(confirmMsg.SequenceNumber), 10))
+		}
+		if s.config.MaxMessages > 0 {
+			pipe.ZRemRangeByRank(ctx, s.config.Key, 0, -int64(s.config.MaxMessages)-1)
+		}
+		return nil
+	})
+	return err
+}
+
+// fetch returns the consecutive shared messages from the first one at or after
+// from, up to before end if bounded
+func (s *sharedCatchup) fetch(ctx context.Context, from, end arbutil.MessageIndex, bounded bool) ([]*BroadcastFeedMessage, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+	query := &redis.ZRangeBy{Min: strconv.FormatUint(uint64(from), 10), Max: "+inf"}
+	if bounded {
+		query.Max = "(" + strconv.FormatUint(uint64(end), 10)
+	}
+	members, err := s.client.ZRangeByScore(ctx, s.config.Key, query).Result()
+	if err != nil {
+		return nil, err
+	}
+	var messages []*BroadcastFeedMessage
+	for _, member := range members {
+		var message BroadcastFeedMessage
+		if err := json.Unmarshal([]byte(member), &message); err != nil {
+			return nil, fmt.Errorf("invalid shared catchup message: %w", err)
+		}
+		if len(messages) > 0 {
+			next := messages[len(messages)-1].SequenceNumber + 1
+			if message.SequenceNumber < next {
+				// Another relay's version of a message being replaced
+				continue
+			}
+			if message.SequenceNumber > next {
+				break
+			}
+		}
+		messages = append(messages, &message)
+	}
+	return messages, nil
+}
+
+// updateOlder brings the shared messages before the relay's cached ones up to
+// date after a broadcast, fetching just the ones it doesn't have yet. They
+// aren't kept while the relay has nothing cached, clients aren't caught up
+// from redis alone.
+func (s *sharedCatchup) updateOlder(ctx context.Context, write sharedCatchupWrite) error {
+	if !write.cached {
+		s.setOlder(nil, 0, false)
+		return nil
+	}
+	end := write.firstCached
+	older := s.older
+	if confirmMsg := write.bm.ConfirmedSequenceNumberMessage; confirmMsg != nil {
+		older = older[sort.Search(len(older), func(i int) bool {
+			return older[i].SequenceNumber > confirmMsg.SequenceNumber
+		}):]
+	}
+	switch {
+	case s.olderValid && end == s.olderEnd:
+		// Still up to date
+	case s.olderValid && end < s.olderEnd:
+		// The relay's cache was cleared, appending mustn't overwrite the
+		// messages being sent
+		keep := sort.Search(len(older), func(i int) bool {
+			return older[i].SequenceNumber >= end
+		})
+		older = older[:keep:keep]
+	default:
+		// Fetch the messages the relay stopped caching, or all of them if
+		// none were fetched yet
+		var from arbutil.MessageIndex
+		if s.olderValid {
+			from = s.olderEnd
+		}
+		fetched, err := s.fetch(ctx, from, end, true)
+		if err != nil {
+			return err
+		}
+		if len(older) > 0 && len(fetched) > 0 && fetched[0].SequenceNumber == s.olderEnd {
+			older = append(older, fetched...)
+		} else {
+			older = fetched
+		}
+	}
+	if s.config.MaxMessages > 0 && len(older) > s.config.MaxMessages {
+		older = older[len(older)-s.config.MaxMessages:]
+	}
+	s.setOlder(older, end, true)
+	return nil
+}
+
+func (s *sharedCatchup) setOlder(older []*BroadcastFeedMessage, end arbutil.MessageIndex, valid bool) {
+	s.olderMutex.Lock()
+	defer s.olderMutex.Unlock()
+	s.older = older
+	s.olderEnd = end
+	s.olderValid = valid
+}
+
+// olderMessages returns the shared messages from requestedSeqNum that come
+// right before end, if it's where the last fetched ones end
+func (s *sharedCatchup) olderMessages(requestedSeqNum, end arbutil.MessageIndex) []*BroadcastFeedMessage {
+	s.olderMutex.RLock()
+	defer s.olderMutex.RUnlock()
+	if !s.olderValid || s.olderEnd != end || len(s.older) == 0 || s.older[len(s.older)-1].SequenceNumber+1 != end {
+		return nil
+	}
+	start := sort.Search(len(s.older), func(i int) bool {
+		return s.older[i].SequenceNumber >= requestedSeqNum
+	})
+	// The writer thread appends to older, callers mustn't append in place
+	return s.older[start:len(s.older):len(s.older)]
+}
+
+// sharedCacheMessages returns the shared messages from requestedSeqNum that
+// come before the cached ones, if they connect to them
+func (b *SequenceNumberCatchupBuffer) sharedCacheMessages(requestedSeqNum arbutil.MessageIndex) []*BroadcastFeedMessage {
+	if b.shared == nil || len(b.messages) == 0 {
+		return nil
+	}
+	end := b.messages[0].SequenceNumber
+	if requestedSeqNum >= end || (b.limitCatchup() && end > maxRequestedSeqNumOffset && requestedSeqNum < end-maxRequestedSeqNumOffset) {
+		return nil
+	}
+	messages := b.shared.olderMessages(requestedSeqNum, end)
+	if len(messages) == 0 {
+		return nil
+	}
+	sharedCatchupSentHistogram.Update(int64(len(messages)))
+	return messages
+}
@@ -0,0 +1,147 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	flag "github.com/spf13/pflag"
+
+	"github.com/ethereum/go-ethereum/log"
+
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcastclient"
+	"github.com/offchainlabs/nitro/broadcastclients"
+	"github.com/offchainlabs/nitro/cmd/genericconf"
+	"github.com/offchainlabs/nitro/cmd/util/confighelpers"
+)
+
+type Config struct {
+	ChainId          uint64                 `koanf:"chain-id"`
+	URL              []string               `koanf:"url"`
+	Start            uint64                 `koanf:"start"`
+	ProgressInterval time.Duration          `koanf:"progress-interval"`
+	LogLevel         int                    `koanf:"log-level"`
+	LogType          string                 `koanf:"log-type"`
+	Feed             broadcastclient.Config `koanf:"feed"`
+}
+
+var ConfigDefault = Config{
+	ChainId:          0,
+	URL:              []string{},
+	Start:            0,
+	ProgressInterval: time.Minute,
+	LogLevel:         int(log.LvlInfo),
+	LogType:          "plaintext",
+	Feed:             broadcastclient.DefaultConfig,
+}
+
+func ConfigAddOptions(f *flag.FlagSet) {
+	f.Uint64("chain-id", ConfigDefault.ChainId, "L2 chain ID of the feeds")
+	f.StringSlice("url", ConfigDefault.URL, "the two feed URLs to compare")
+	f.Uint64("start", ConfigDefault.Start, "sequence number to start comparing at, if the feeds still have it")
+	f.Duration("progress-interval", ConfigDefault.ProgressInterval, "interval to log how many sequence numbers were compared at")
+	f.Int("log-level", ConfigDefault.LogLevel, "log level")
+	f.String("log-type", ConfigDefault.LogType, "log type")
+	broadcastclient.ConfigAddOptions("feed", f)
+}
+
+func parseConfig(args []string) (*Config, error) {
+	f := flag.NewFlagSet("", flag.ContinueOnError)
+	ConfigAddOptions(f)
+	k, err := confighelpers.BeginCommonParse(f, args)
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	if err := confighelpers.EndCommonParse(k, &config); err != nil {
+		return nil, err
+	}
+	if len(config.URL) != 2 {
+		return nil, errors.New("exactly two feed urls must be given")
+	}
+	if config.ChainId == 0 {
+		return nil, errors.New("chain id must be given")
+	}
+	if err := config.Feed.Validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func printSampleUsage(progname string) {
+	fmt.Printf("\n")
+	fmt.Printf("Sample usage:                  %s --chain-id=<L2 chain id> --url=<feed url> --url=<other feed url>\n", progname)
+}
+
+func main() {
+	diverged, err := startup()
+	if err != nil {
+		log.Error("Error comparing feeds", "err", err)
+		os.Exit(1)
+	}
+	if diverged {
+		os.Exit(2)
+	}
+}
+
+// startup compares the feeds until they diverge, which is returned, or until
+// interrupted
+func startup() (bool, error) {
+	config, err := parseConfig(os.Args[1:])
+	if err != nil {
+		confighelpers.PrintErrorAndExit(err, printSampleUsage)
+	}
+
+	logFormat, err := genericconf.ParseLogType(config.LogType)
+	if err != nil {
+		return false, err
+	}
+	glogger := log.NewGlogHandler(log.StreamHandler(os.Stderr, logFormat))
+	glogger.Verbosity(log.Lvl(config.LogLevel))
+	log.Root().SetHandler(glogger)
+
+	sigint := make(chan os.Signal, 1)
+	signal.Notify(sigint, os.Interrupt, syscall.SIGTERM)
+
+	comparison, err := broadcastclients.NewFeedComparison(
+		func() *broadcastclient.Config { return &config.Feed },
+		config.ChainId,
+		[2]string{config.URL[0], config.URL[1]},
+		arbutil.MessageIndex(config.Start),
+	)
+	if err != nil {
+		return false, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	comparison.Start(ctx)
+	defer comparison.StopAndWait()
+	log.Info("comparing sequencer feeds", "url", config.URL[0], "otherUrl", config.URL[1], "start", config.Start)
+
+	progress := time.NewTicker(config.ProgressInterval)
+	defer progress.Stop()
+	for {
+		select {
+		case divergence := <-comparison.Diverged():
+			fmt.Printf("%v\n", divergence)
+			return true, nil
+		case err := <-comparison.Errors():
+			return false, err
+		case <-progress.C:
+			compared, last := comparison.Compared()
+			log.Info("feeds identical so far", "compared", compared, "lastSeqNum", last)
+		case <-sigint:
+			compared, last := comparison.Compared()
+			log.Info("stopping feed comparison", "compared", compared, "lastSeqNum", last)
+			return false, nil
+		}
+	}
+}
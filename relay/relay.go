@@ -112,7 +112,9 @@ func (r *Relay) Start(ctx context.Context) error {
 				}
 				recentFeedItemsNew[msg.SequenceNumber] = time.Now()
 				sharedmetrics.UpdateSequenceNumberGauge(msg.SequenceNumber)
-				r.broadcaster.BroadcastSingleFeedMessage(&msg)
+				if err := r.broadcaster.BroadcastSingleFeedMessage(&msg); err != nil {
+					log.Error("error relaying feed message", "sequenceNumber", msg.SequenceNumber, "err", err)
+				}
 			case cs := <-r.confirmedSequenceNumberChan:
 				if lastConfirmed == cs {
 					continue
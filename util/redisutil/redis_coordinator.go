@@ -17,6 +17,7 @@ const CHOSENSEQ_KEY string = "coordinator.chosen"                 // Never overw
 const MSG_COUNT_KEY string = "coordinator.msgCount"               // Only written by sequencer holding CHOSEN key
 const PRIORITIES_KEY string = "coordinator.priorities"            // Read only
 const WANTS_LOCKOUT_KEY_PREFIX string = "coordinator.liveliness." // Per server. Only written by self
+const FEED_URL_KEY_PREFIX string = "coordinator.feed."            // Per server. Only written by self
 const MESSAGE_KEY_PREFIX string = "coordinator.msg."              // Per Message. Only written by sequencer holding CHOSEN
 const SIGNATURE_KEY_PREFIX string = "coordinator.msg.sig."        // Per Message. Only written by sequencer holding CHOSEN
 const WANTS_LOCKOUT_VAL string = "OK"
@@ -28,6 +29,7 @@ type RedisCoordinator struct {
 }
 
 func WantsLockoutKeyFor(url string) string { return WANTS_LOCKOUT_KEY_PREFIX + url }
+func FeedURLKeyFor(url string) string      { return FEED_URL_KEY_PREFIX + url }
 
 func NewRedisCoordinator(redisUrl string) (*RedisCoordinator, error) {
 	redisClient, err := RedisClientFromURL(redisUrl)
@@ -76,6 +78,22 @@ func (c *RedisCoordinator) CurrentChosenSequencer(ctx context.Context) (string,
 	return current, nil
 }
 
+// ChosenFeedURL retrieves the feed url published by the current chosen sequencer
+func (c *RedisCoordinator) ChosenFeedURL(ctx context.Context) (string, error) {
+	chosen, err := c.CurrentChosenSequencer(ctx)
+	if err != nil || chosen == "" {
+		return "", err
+	}
+	feedURL, err := c.Client.Get(ctx, FeedURLKeyFor(chosen)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return feedURL, nil
+}
+
 func MessageKeyFor(pos arbutil.MessageIndex) string {
 	return fmt.Sprintf("%s%d", MESSAGE_KEY_PREFIX, pos)
 }
@@ -0,0 +1,70 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package wsbroadcastserver
+
+import (
+	"errors"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+var (
+	clientsRejectedFullCounter = metrics.NewRegisteredCounter("arb/feed/clients/failed/full", nil)
+	clientsEvictedFullCounter  = metrics.NewRegisteredCounter("arb/feed/clients/evicted/full", nil)
+
+	errTooManyClients = errors.New("too many feed clients")
+)
+
+const (
+	// AdmissionReject turns new clients away while max-clients are connected
+	AdmissionReject = "reject"
+	// AdmissionEvictLagged disconnects the client furthest behind to admit a
+	// new one while max-clients are connected
+	AdmissionEvictLagged = "evict-lagged"
+)
+
+// full returns whether new clients are turned away before upgrading them
+func (cm *ClientManager) full() bool {
+	config := cm.config()
+	return config.MaxClients > 0 && config.AdmissionPolicy != AdmissionEvictLagged && int(cm.ClientCount()) >= config.MaxClients
+}
+
+// admit makes room for a new client if max-clients are connected, by
+// evicting the most lagged client or failing as configured. It must be called
+// from the main ClientManager thread.
+func (cm *ClientManager) admit() error {
+	config := cm.config()
+	if config.MaxClients <= 0 || len(cm.clientPtrMap) < config.MaxClients {
+		return nil
+	}
+	if config.AdmissionPolicy != AdmissionEvictLagged {
+		clientsRejectedFullCounter.Inc(1)
+		return errTooManyClients
+	}
+	for len(cm.clientPtrMap) >= config.MaxClients {
+		var victim *ClientConnection
+		for client := range cm.clientPtrMap {
+			if victim == nil || lagsBehind(client, victim) {
+				victim = client
+			}
+		}
+		log.Debug("disconnecting most lagged client to admit a new one", "client", victim.Name, "lag", victim.Lag(), "queued", victim.QueueDepth())
+		clientsEvictedFullCounter.Inc(1)
+		cm.removeClient(victim)
+	}
+	return nil
+}
+
+// lagsBehind returns whether a is further behind than b, by lag then queue
+// depth, or connected longer if they are even
+func lagsBehind(a, b *ClientConnection) bool {
+	if aLag, bLag := a.Lag(), b.Lag(); aLag != bLag {
+		return aLag > bLag
+	}
+	if aDepth, bDepth := a.QueueDepth(), b.QueueDepth(); aDepth != bDepth {
+		return aDepth > bDepth
+	}
+	return a.creation.Before(b.creation)
+}
@@ -0,0 +1,122 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package wsbroadcastserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mailru/easygo/netpoll"
+
+	"github.com/offchainlabs/nitro/arbutil"
+)
+
+// emptyCatchupBuffer registers clients without sending them anything
+type emptyCatchupBuffer struct{}
+
+func (emptyCatchupBuffer) OnRegisterClient(*ClientConnection) (error, int, time.Duration) {
+	return nil, 0, 0
+}
+
+func (emptyCatchupBuffer) OnCatchupRequest(*ClientConnection, arbutil.MessageIndex) (error, int, time.Duration) {
+	return nil, 0, 0
+}
+
+func (emptyCatchupBuffer) OnDoBroadcast(interface{}) error { return nil }
+
+func (emptyCatchupBuffer) GetMessageCount() int { return 0 }
+
+func TestAdmissionPolicy(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	config := DefaultTestBroadcasterConfig
+	config.MaxClients = 2
+	Require(t, config.Validate())
+	poller, err := netpoll.New(nil)
+	Require(t, err)
+	cm := NewClientManager(poller, func() *BroadcasterConfig { return &config }, emptyCatchupBuffer{})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Require(t, err)
+	defer listener.Close()
+
+	// newClient connects a client, returning the server's and the client's
+	// side of the connection
+	newClient := func() (*ClientConnection, net.Conn) {
+		t.Helper()
+		clientConn, err := net.Dial("tcp", listener.Addr().String())
+		Require(t, err)
+		t.Cleanup(func() { _ = clientConn.Close() })
+		conn, err := listener.Accept()
+		Require(t, err)
+		desc, err := netpoll.HandleRead(conn)
+		Require(t, err)
+		return NewClientConnection(conn, desc, cm, 0, net.ParseIP("127.0.0.1"), "", false, false, 0), clientConn
+	}
+	// register does what the ClientManager thread does with a new client
+	register := func(cc *ClientConnection) error {
+		err := cm.registerClient(ctx, cc)
+		if err != nil {
+			cm.removeClientImpl(cc)
+		}
+		return err
+	}
+	disconnected := func(clientConn net.Conn) bool {
+		t.Helper()
+		Require(t, clientConn.SetReadDeadline(time.Now().Add(time.Second)))
+		_, err := clientConn.Read(make([]byte, 1))
+		return errors.Is(err, io.EOF)
+	}
+
+	first, _ := newClient()
+	second, secondConn := newClient()
+	Require(t, register(first))
+	Expect(t, !cm.full(), "full with one of two clients")
+	Require(t, register(second))
+	Expect(t, cm.ClientCount() == 2, "client count", cm.ClientCount())
+	Expect(t, cm.full(), "not full with max-clients connected")
+
+	// Rejected clients are counted while registering, and uncounted again
+	rejected, rejectedConn := newClient()
+	err = register(rejected)
+	Expect(t, errors.Is(err, errTooManyClients), "client over max-clients registered:", err)
+	Expect(t, cm.ClientCount() == 2, "client count", cm.ClientCount(), "after rejecting a client")
+	Expect(t, len(cm.clientPtrMap) == 2, "clients", len(cm.clientPtrMap))
+	Expect(t, disconnected(rejectedConn), "rejected client not disconnected")
+
+	// The most lagged client is evicted for a new one, whatever the order
+	// they connected in
+	config.AdmissionPolicy = AdmissionEvictLagged
+	Expect(t, !cm.full(), "full while evicting lagged clients")
+	second.queueMutex.Lock()
+	second.enqueuedUnixNano = []int64{time.Now().Add(-time.Minute).UnixNano()}
+	second.queueMutex.Unlock()
+	third, _ := newClient()
+	Require(t, register(third))
+	Expect(t, cm.ClientCount() == 2, "client count", cm.ClientCount(), "after evicting a client")
+	Expect(t, cm.clientPtrMap[first] && cm.clientPtrMap[third] && !cm.clientPtrMap[second], "lagged client not evicted")
+	Expect(t, disconnected(secondConn), "evicted client not disconnected")
+
+	// Evenly lagged clients are evicted by queue depth, then age
+	young := &ClientConnection{creation: time.Now()}
+	old := &ClientConnection{creation: young.creation.Add(-time.Second)}
+	Expect(t, lagsBehind(old, young) && !lagsBehind(young, old), "older client not evicted first")
+	deep := &ClientConnection{creation: young.creation, out: make(chan []byte, 1)}
+	deep.out <- []byte{1}
+	Expect(t, lagsBehind(deep, old) && !lagsBehind(old, deep), "client with more queued not evicted first")
+
+	// Without max-clients nobody is turned away
+	config.MaxClients = 0
+	fourth, _ := newClient()
+	Require(t, register(fourth))
+	Expect(t, cm.ClientCount() == 3, "client count", cm.ClientCount())
+	for client := range cm.clientPtrMap {
+		cm.removeClient(client)
+	}
+	Expect(t, cm.ClientCount() == 0, "client count", cm.ClientCount(), "after removing all clients")
+}
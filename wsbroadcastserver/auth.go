@@ -0,0 +1,180 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package wsbroadcastserver
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	flag "github.com/spf13/pflag"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+var (
+	clientsTotalFailedAuthCounter = metrics.NewRegisteredCounter("arb/feed/clients/failed/auth", nil)
+	authReloadsCounter            = metrics.NewRegisteredCounter("arb/feed/auth/reloads", nil)
+
+	errMissingAuthToken = errors.New("missing feed auth token")
+	errInvalidAuthToken = errors.New("invalid feed auth token")
+)
+
+type AuthConfig struct {
+	Enable        bool   `koanf:"enable" reload:"hot"`
+	JWTSecretFile string `koanf:"jwt-secret-file" reload:"hot"`
+	KeysFile      string `koanf:"keys-file" reload:"hot"`
+}
+
+var DefaultAuthConfig = AuthConfig{
+	Enable:        false,
+	JWTSecretFile: "",
+	KeysFile:      "",
+}
+
+func AuthConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Bool(prefix+".enable", DefaultAuthConfig.Enable, "only serve clients sending an API key or JWT as bearer token in the Authorization header")
+	f.String(prefix+".jwt-secret-file", DefaultAuthConfig.JWTSecretFile, "file of the hex encoded 32 byte secret HS256 JWTs are signed with, the subject claim names the client and the rateClass claim is its rate class (empty = JWTs not accepted)")
+	f.String(prefix+".keys-file", DefaultAuthConfig.KeysFile, "JSON file of API keys as [{\"name\":...,\"key\":...,\"rateClass\":...}], reloaded when it changes (empty = API keys not accepted)")
+}
+
+func (c *AuthConfig) Validate() error {
+	if c.Enable && c.JWTSecretFile == "" && c.KeysFile == "" {
+		return errors.New("auth needs jwt-secret-file or keys-file")
+	}
+	return nil
+}
+
+// ClientIdentity is who an authenticated client is, from its API key entry or
+// the claims of its JWT
+type ClientIdentity struct {
+	Name      string `json:"name"`
+	RateClass string `json:"rateClass,omitempty"`
+}
+
+type apiKey struct {
+	ClientIdentity
+	Key string `json:"key"`
+}
+
+type feedClaims struct {
+	RateClass string `json:"rateClass,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// authenticator checks the bearer tokens of clients against the configured
+// API keys and JWT secret. The files are checked for changes on every
+// request, if reloading fails the previous keys and secret are kept.
+type authenticator struct {
+	config func() *AuthConfig
+
+	mutex   sync.Mutex
+	loaded  AuthConfig
+	modTime time.Time
+	keys    map[[sha256.Size]byte]*ClientIdentity
+	secret  []byte
+}
+
+func newAuthenticator(config func() *AuthConfig) *authenticator {
+	return &authenticator{config: config}
+}
+
+// authenticate returns the identity of the client sending the Authorization
+// header value, or nil if auth is disabled
+func (a *authenticator) authenticate(authorization string) (*ClientIdentity, error) {
+	config := *a.config()
+	if !config.Enable {
+		return nil, nil
+	}
+	modTime, err := latestModTime(config.JWTSecretFile, config.KeysFile)
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if err == nil && (a.keys == nil || a.loaded != config || modTime.After(a.modTime)) {
+		err = a.load(config)
+		if err == nil {
+			a.modTime = modTime
+		}
+	}
+	if err != nil {
+		if a.keys == nil {
+			return nil, err
+		}
+		log.Warn("error reloading feed auth keys, using the previous ones", "err", err)
+	}
+
+	token := strings.TrimSpace(authorization)
+	if len(token) > 7 && strings.EqualFold(token[:7], "Bearer ") {
+		token = strings.TrimSpace(token[7:])
+	}
+	if token == "" {
+		return nil, errMissingAuthToken
+	}
+	if identity, ok := a.keys[sha256.Sum256([]byte(token))]; ok {
+		return identity, nil
+	}
+	if a.secret == nil || strings.Count(token, ".") != 2 {
+		return nil, errInvalidAuthToken
+	}
+	var claims feedClaims
+	_, err = jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (interface{}, error) {
+		return a.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidAuthToken, err)
+	}
+	name := claims.Subject
+	if name == "" {
+		name = "jwt"
+	}
+	return &ClientIdentity{Name: name, RateClass: claims.RateClass}, nil
+}
+
+// load reads the files of config, the mutex must be held
+func (a *authenticator) load(config AuthConfig) error {
+	keys := make(map[[sha256.Size]byte]*ClientIdentity)
+	if config.KeysFile != "" {
+		contents, err := os.ReadFile(config.KeysFile)
+		if err != nil {
+			return fmt.Errorf("failed to read feed auth keys file: %w", err)
+		}
+		var entries []apiKey
+		if err := json.Unmarshal(contents, &entries); err != nil {
+			return fmt.Errorf("failed to parse feed auth keys file %s: %w", config.KeysFile, err)
+		}
+		for i := range entries {
+			if entries[i].Key == "" {
+				return fmt.Errorf("feed auth key %q in %s is empty", entries[i].Name, config.KeysFile)
+			}
+			identity := entries[i].ClientIdentity
+			keys[sha256.Sum256([]byte(entries[i].Key))] = &identity
+		}
+	}
+	var secret []byte
+	if config.JWTSecretFile != "" {
+		contents, err := os.ReadFile(config.JWTSecretFile)
+		if err != nil {
+			return fmt.Errorf("failed to read feed jwt secret file: %w", err)
+		}
+		secret = common.FromHex(strings.TrimSpace(string(contents)))
+		if len(secret) != 32 {
+			return fmt.Errorf("feed jwt secret in %s is %d bytes, expected 32", config.JWTSecretFile, len(secret))
+		}
+	}
+	if a.keys != nil {
+		log.Info("reloaded feed auth keys", "keys", len(keys), "jwt", secret != nil)
+		authReloadsCounter.Inc(1)
+	}
+	a.keys = keys
+	a.secret = secret
+	a.loaded = config
+	return nil
+}
@@ -0,0 +1,134 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package wsbroadcastserver
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func signTestJWT(t *testing.T, method jwt.SigningMethod, secret []byte, claims feedClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(method, claims).SignedString(secret)
+	Require(t, err)
+	return token
+}
+
+// writeLater writes a file dated later than any previous write, so the change
+// is noticed
+func writeLater(t *testing.T, path string, contents string, after time.Duration) {
+	t.Helper()
+	Require(t, os.WriteFile(path, []byte(contents), 0o600))
+	later := time.Now().Add(after)
+	Require(t, os.Chtimes(path, later, later))
+}
+
+func TestAuthConfigValidate(t *testing.T) {
+	Require(t, (&AuthConfig{}).Validate())
+	Expect(t, (&AuthConfig{Enable: true}).Validate() != nil, "auth enabled without keys or jwt secret")
+	Require(t, (&AuthConfig{Enable: true, KeysFile: "keys.json"}).Validate())
+	Require(t, (&AuthConfig{Enable: true, JWTSecretFile: "jwt.hex"}).Validate())
+}
+
+func TestAuthenticateAPIKeys(t *testing.T) {
+	dir := t.TempDir()
+	config := AuthConfig{KeysFile: filepath.Join(dir, "keys.json")}
+	writeLater(t, config.KeysFile, `[{"name":"relay","key":"secret-key","rateClass":"high"},{"name":"other","key":"other-key"}]`, 0)
+	auth := newAuthenticator(func() *AuthConfig { return &config })
+
+	// Everyone is served while auth is disabled
+	identity, err := auth.authenticate("")
+	Require(t, err)
+	Expect(t, identity == nil, "identity", identity, "with auth disabled")
+
+	config.Enable = true
+	for _, header := range []string{"secret-key", "Bearer secret-key", "bearer  secret-key ", "BEARER secret-key"} {
+		identity, err := auth.authenticate(header)
+		Require(t, err, "authorization", header)
+		Expect(t, identity.Name == "relay" && identity.RateClass == "high", "authorization", header, "identified as", identity)
+	}
+	identity, err = auth.authenticate("Bearer other-key")
+	Require(t, err)
+	Expect(t, identity.Name == "other" && identity.RateClass == "", "identified as", identity)
+	for _, header := range []string{"", "   "} {
+		_, err := auth.authenticate(header)
+		Expect(t, errors.Is(err, errMissingAuthToken), "authorization", header, "got", err)
+	}
+	for _, header := range []string{"Bearer wrong-key", "secret-key2", "Basic secret-key"} {
+		_, err := auth.authenticate(header)
+		Expect(t, errors.Is(err, errInvalidAuthToken), "authorization", header, "got", err)
+	}
+
+	// Changed keys are reloaded, a broken file keeps the previous keys
+	writeLater(t, config.KeysFile, `[{"name":"rotated","key":"new-key"}]`, time.Minute)
+	_, err = auth.authenticate("Bearer secret-key")
+	Expect(t, errors.Is(err, errInvalidAuthToken), "removed key accepted:", err)
+	identity, err = auth.authenticate("Bearer new-key")
+	Require(t, err)
+	Expect(t, identity.Name == "rotated", "identified as", identity)
+	writeLater(t, config.KeysFile, `[{"name":"empty","key":""}]`, 2*time.Minute)
+	identity, err = auth.authenticate("Bearer new-key")
+	Require(t, err)
+	Expect(t, identity.Name == "rotated", "previous keys not kept, identified as", identity)
+
+	// Without loadable keys nobody is served
+	broken := newAuthenticator(func() *AuthConfig { return &config })
+	_, err = broken.authenticate("Bearer new-key")
+	Expect(t, err != nil && !errors.Is(err, errInvalidAuthToken), "empty key loaded:", err)
+	missing := AuthConfig{Enable: true, KeysFile: filepath.Join(dir, "missing.json")}
+	_, err = newAuthenticator(func() *AuthConfig { return &missing }).authenticate("Bearer new-key")
+	Expect(t, err != nil, "missing keys file loaded")
+}
+
+func TestAuthenticateJWT(t *testing.T) {
+	dir := t.TempDir()
+	secret := common.FromHex("0x000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+	config := AuthConfig{Enable: true, JWTSecretFile: filepath.Join(dir, "jwt.hex")}
+	writeLater(t, config.JWTSecretFile, common.Bytes2Hex(secret)+"\n", 0)
+	auth := newAuthenticator(func() *AuthConfig { return &config })
+
+	claims := feedClaims{
+		RateClass: "low",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "indexer",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+	identity, err := auth.authenticate("Bearer " + signTestJWT(t, jwt.SigningMethodHS256, secret, claims))
+	Require(t, err)
+	Expect(t, identity.Name == "indexer" && identity.RateClass == "low", "identified as", identity)
+
+	// Tokens without a subject are still served
+	identity, err = auth.authenticate("Bearer " + signTestJWT(t, jwt.SigningMethodHS256, secret, feedClaims{}))
+	Require(t, err)
+	Expect(t, identity.Name == "jwt", "identified as", identity)
+
+	expired := claims
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+	otherSecret := make([]byte, 32)
+	for _, token := range []string{
+		signTestJWT(t, jwt.SigningMethodHS256, secret, expired),
+		signTestJWT(t, jwt.SigningMethodHS256, otherSecret, claims),
+		signTestJWT(t, jwt.SigningMethodHS512, secret, claims),
+		"not.a.jwt",
+	} {
+		_, err := auth.authenticate("Bearer " + token)
+		Expect(t, errors.Is(err, errInvalidAuthToken), "token", token, "got", err)
+	}
+
+	// Secrets of the wrong length aren't loaded
+	writeLater(t, config.JWTSecretFile, "0x0102", time.Minute)
+	identity, err = auth.authenticate("Bearer " + signTestJWT(t, jwt.SigningMethodHS256, secret, claims))
+	Require(t, err)
+	Expect(t, identity.Name == "indexer", "previous secret not kept, identified as", identity)
+	_, err = newAuthenticator(func() *AuthConfig { return &config }).authenticate("Bearer " + signTestJWT(t, jwt.SigningMethodHS256, secret, claims))
+	Expect(t, err != nil && !errors.Is(err, errInvalidAuthToken), "short jwt secret loaded:", err)
+}
@@ -0,0 +1,31 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package wsbroadcastserver
+
+import (
+	"bytes"
+	"sync"
+)
+
+// Buffers that grew larger than this aren't pooled, so that one large catchup
+// batch doesn't keep its memory alive
+const MAX_POOLED_BUFFER_SIZE = 4 * 1024 * 1024
+
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// GetBuffer returns an empty buffer from the pool shared by the feed read paths
+func GetBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+// PutBuffer returns a buffer to the pool, its contents must not be used afterwards
+func PutBuffer(buf *bytes.Buffer) {
+	if buf == nil || buf.Cap() > MAX_POOLED_BUFFER_SIZE {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
@@ -0,0 +1,80 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package wsbroadcastserver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+var clientsBulkCatchupCounter = metrics.NewRegisteredCounter("arb/feed/clients/catchup/bulk", nil)
+
+// IsBulkFrame tells whether the payload of a binary frame is a bulk catchup,
+// gzip compressed. Neither JSON nor RLP encoded broadcast messages start with
+// the gzip magic number.
+func IsBulkFrame(payload []byte) bool {
+	return len(payload) >= 2 && payload[0] == 0x1f && payload[1] == 0x8b
+}
+
+// WriteCatchup sends cached messages the client asked for. A backlog of at
+// least BulkCatchup messages is sent to clients that accept it as a single
+// gzip compressed binary frame, JSON or RLP encoded inside as the client
+// negotiated, which catches up much faster on slow links than one message
+// deflated at a time.
+func (cc *ClientConnection) WriteCatchup(x interface{}, messages int) error {
+	config := cc.clientManager.config()
+	if !cc.bulkCatchup || config.BulkCatchup <= 0 || messages < config.BulkCatchup {
+		return cc.Write(x)
+	}
+	data, err := serializeBulk(x, cc.binary, config.CompressionLevel)
+	if err != nil {
+		return err
+	}
+	cc.ioMutex.Lock()
+	defer cc.ioMutex.Unlock()
+	if !cc.enqueue(data) {
+		return errSendQueueFull
+	}
+	clientsBulkCatchupCounter.Inc(1)
+	return nil
+}
+
+func serializeBulk(x interface{}, binary bool, level int) ([]byte, error) {
+	var payload bytes.Buffer
+	compressor, err := gzip.NewWriterLevel(&payload, level)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create gzip writer: %w", err)
+	}
+	if binary {
+		marshaler, ok := x.(encoding.BinaryMarshaler)
+		if !ok {
+			return nil, fmt.Errorf("message of type %T has no binary encoding", x)
+		}
+		data, err := marshaler.MarshalBinary()
+		if err != nil {
+			return nil, fmt.Errorf("unable to encode message: %w", err)
+		}
+		if _, err := compressor.Write(data); err != nil {
+			return nil, fmt.Errorf("unable to write message: %w", err)
+		}
+	} else if err := json.NewEncoder(compressor).Encode(x); err != nil {
+		return nil, fmt.Errorf("unable to encode message: %w", err)
+	}
+	if err := compressor.Close(); err != nil {
+		return nil, fmt.Errorf("unable to close gzip writer: %w", err)
+	}
+	var frame bytes.Buffer
+	if err := wsutil.WriteServerMessage(&frame, ws.OpBinary, payload.Bytes()); err != nil {
+		return nil, fmt.Errorf("unable to write frame: %w", err)
+	}
+	return frame.Bytes(), nil
+}
@@ -0,0 +1,23 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package wsbroadcastserver
+
+import (
+	flag "github.com/spf13/pflag"
+)
+
+type CatchupStoreConfig struct {
+	File string `koanf:"file"`
+	Sync bool   `koanf:"sync"`
+}
+
+var DefaultCatchupStoreConfig = CatchupStoreConfig{
+	File: "",
+	Sync: false,
+}
+
+func CatchupStoreConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.String(prefix+".file", DefaultCatchupStoreConfig.File, "append-only file the catchup buffer is persisted to and restored from on startup, so clients can resume after a restart (empty = not persisted)")
+	f.Bool(prefix+".sync", DefaultCatchupStoreConfig.Sync, "fsync the catchup store file after every broadcast, so it survives machine crashes and not just restarts (written in the background, a disk too slow for it makes the store be rewritten)")
+}
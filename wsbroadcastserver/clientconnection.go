@@ -5,6 +5,7 @@ package wsbroadcastserver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/rand"
 	"net"
@@ -14,12 +15,22 @@ import (
 
 	"github.com/offchainlabs/nitro/arbutil"
 
+	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/gobwas/ws"
 	"github.com/gobwas/ws/wsflate"
 	"github.com/mailru/easygo/netpoll"
 	"github.com/offchainlabs/nitro/util/stopwaiter"
 )
 
+var clientsWriteBatchHistogram = metrics.NewRegisteredHistogram("arb/feed/clients/write/batch", nil, metrics.NewBoundedHistogramSample())
+
+// errSendQueueFull is returned by Write and WriteCatchup instead of blocking,
+// the callers disconnect the client then
+var errSendQueueFull = errors.New("client send queue full")
+
+// maxVectoredWrite is the most messages written to a client in one call
+const maxVectoredWrite = 64
+
 // ClientConnection represents client connection.
 type ClientConnection struct {
 	stopwaiter.StopWaiter
@@ -34,12 +45,52 @@ type ClientConnection struct {
 	clientManager   *ClientManager
 	requestedSeqNum arbutil.MessageIndex
 
+	// Sent by the client to tell relay operators which node is behind it,
+	// empty if it didn't send one. Also part of the Name, so it's logged.
+	ClientId string
+
+	// Who the client authenticated as, nil if auth is disabled. The name is
+	// also part of the Name.
+	Identity *ClientIdentity
+
 	lastHeardUnix int64
 	out           chan []byte
 
+	// When each message in out was queued, oldest first, see Lag
+	queueMutex       sync.Mutex
+	enqueuedUnixNano []int64
+
+	// Set once messages queued for the client were dropped by the
+	// drop-oldest slow client policy. Use atomic access.
+	gapped int32
+
 	compression bool
 	flateReader *wsflate.Reader
 
+	// Set if the client negotiated BinaryFeedSubprotocol
+	binary bool
+
+	// Set if the client accepts catchup as a single gzip compressed frame,
+	// see WriteCatchup
+	bulkCatchup bool
+
+	// Set while a catchup request of the client waits for the client manager,
+	// and when the last one was accepted, see RequestCatchup. Use atomic
+	// access.
+	catchupPending      int32
+	lastCatchupUnixNano int64
+
+	// Set if the client requested the feed as server-sent events from
+	// EventStreamPath instead of upgrading to websocket
+	eventStream bool
+
+	// Set if the client polled MessagesPath, the response is sent once
+	// messages were written or pollWait passed. pollReady is set before Start
+	// if registering the client already sent messages.
+	pollHeader []byte
+	pollWait   time.Duration
+	pollReady  bool
+
 	delay time.Duration
 }
 
@@ -49,25 +100,41 @@ func NewClientConnection(
 	clientManager *ClientManager,
 	requestedSeqNum arbutil.MessageIndex,
 	connectingIP net.IP,
+	clientId string,
 	compression bool,
+	binary bool,
 	delay time.Duration,
 ) *ClientConnection {
+	name := fmt.Sprintf("%s@%s-%d", connectingIP, conn.RemoteAddr(), rand.Intn(10))
+	if clientId != "" {
+		name = fmt.Sprintf("%s (%s)", name, clientId)
+	}
 	return &ClientConnection{
 		conn:            conn,
 		clientIp:        connectingIP,
 		desc:            desc,
 		creation:        time.Now(),
-		Name:            fmt.Sprintf("%s@%s-%d", connectingIP, conn.RemoteAddr(), rand.Intn(10)),
+		Name:            name,
+		ClientId:        clientId,
 		clientManager:   clientManager,
 		requestedSeqNum: requestedSeqNum,
 		lastHeardUnix:   time.Now().Unix(),
 		out:             make(chan []byte, clientManager.config().MaxSendQueue),
 		compression:     compression,
+		binary:          binary,
 		flateReader:     NewFlateReader(),
 		delay:           delay,
 	}
 }
 
+func (cc *ClientConnection) setIdentity(identity *ClientIdentity) {
+	if identity == nil {
+		return
+	}
+	cc.Identity = identity
+	cc.Name = fmt.Sprintf("%s [%s]", cc.Name, identity.Name)
+}
+
 func (cc *ClientConnection) Age() time.Duration {
 	return time.Since(cc.creation)
 }
@@ -76,8 +143,24 @@ func (cc *ClientConnection) Compression() bool {
 	return cc.compression
 }
 
+func (cc *ClientConnection) Binary() bool {
+	return cc.binary
+}
+
+func (cc *ClientConnection) EventStream() bool {
+	return cc.eventStream
+}
+
+func (cc *ClientConnection) LongPoll() bool {
+	return cc.pollHeader != nil
+}
+
 func (cc *ClientConnection) Start(parentCtx context.Context) {
 	cc.StopWaiter.Start(parentCtx, cc)
+	if cc.LongPoll() {
+		cc.LaunchThread(cc.answerPoll)
+		return
+	}
 	cc.LaunchThread(func(ctx context.Context) {
 		if cc.delay != 0 {
 			var delayQueue [][]byte
@@ -88,29 +171,51 @@ func (cc *ClientConnection) Start(parentCtx context.Context) {
 				case <-ctx.Done():
 					return
 				case data := <-cc.out:
+					cc.dequeued(1)
+					if cc.reachedGap() {
+						cc.clientManager.Remove(cc)
+						return
+					}
 					delayQueue = append(delayQueue, data)
 				case <-t.C:
-					for _, data := range delayQueue {
-						err := cc.writeRaw(data)
+					for len(delayQueue) > 0 {
+						n := len(delayQueue)
+						if n > maxVectoredWrite {
+							n = maxVectoredWrite
+						}
+						err := cc.writeVectored(delayQueue[:n])
 						if err != nil {
 							logWarn(err, "error writing data to client")
+							clientsDisconnectWriteCounter.Inc(1)
 							cc.clientManager.Remove(cc)
 							return
 						}
+						delayQueue = delayQueue[n:]
 					}
 					done = true
 				}
 			}
 		}
 
+		batch := make([][]byte, 0, maxVectoredWrite)
 		for {
 			select {
 			case <-ctx.Done():
 				return
 			case data := <-cc.out:
-				err := cc.writeRaw(data)
+				batch = cc.drain(append(batch[:0], data))
+				cc.dequeued(len(batch))
+				if cc.reachedGap() {
+					cc.clientManager.Remove(cc)
+					return
+				}
+				err := cc.writeVectored(batch)
+				for i := range batch {
+					batch[i] = nil
+				}
 				if err != nil {
 					logWarn(err, "error writing data to client")
+					clientsDisconnectWriteCounter.Inc(1)
 					cc.clientManager.Remove(cc)
 					return
 				}
@@ -161,36 +266,102 @@ func (cc *ClientConnection) readRequest(ctx context.Context, timeout time.Durati
 	return data, opCode, err
 }
 
+// discardInput reads and drops whatever an event stream client sent, they
+// have nothing to say after the request. Returns an error once the client went
+// away.
+func (cc *ClientConnection) discardInput(timeout time.Duration) error {
+	if err := cc.conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		_ = cc.conn.Close()
+		return err
+	}
+	var buf [512]byte
+	if _, err := cc.conn.Read(buf[:]); err != nil {
+		_ = cc.conn.Close()
+		return err
+	}
+	atomic.StoreInt64(&cc.lastHeardUnix, time.Now().Unix())
+	return nil
+}
+
 func (cc *ClientConnection) Write(x interface{}) error {
 	cc.ioMutex.Lock()
 	defer cc.ioMutex.Unlock()
 
-	notCompressed, compressed, err := serializeMessage(cc.clientManager, x, !cc.compression, cc.compression)
+	data, err := newSerializedMessage(cc.clientManager, x).bytes(cc.encoding())
 	if err != nil {
 		return err
 	}
+	// Once the client is started the writer thread needs ioMutex to drain
+	// the queue, so never block on a full queue while holding it
+	if !cc.enqueue(data) {
+		return errSendQueueFull
+	}
+	return nil
+}
 
-	if cc.compression {
-		cc.out <- compressed.Bytes()
+// drain appends the messages already queued for the client to batch, up to
+// maxVectoredWrite of them, without waiting for more
+func (cc *ClientConnection) drain(batch [][]byte) [][]byte {
+	for len(batch) < maxVectoredWrite {
+		select {
+		case data := <-cc.out:
+			batch = append(batch, data)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// writeVectored writes the messages with a single writev on plain TCP
+// connections, so a client that fell behind catches up in a few syscalls
+// instead of one per message
+func (cc *ClientConnection) writeVectored(batch [][]byte) error {
+	if len(batch) == 1 {
+		return cc.writeRaw(batch[0])
+	}
+	clientsWriteBatchHistogram.Update(int64(len(batch)))
+	cc.ioMutex.Lock()
+	defer cc.ioMutex.Unlock()
+
+	// WriteTo consumes the entries of batch, which is not used again
+	bufs := net.Buffers(batch)
+	var n int64
+	var err error
+	if w, ok := cc.conn.(interface {
+		WriteBuffers(*net.Buffers) (int64, error)
+	}); ok {
+		n, err = w.WriteBuffers(&bufs)
 	} else {
-		cc.out <- notCompressed.Bytes()
+		n, err = bufs.WriteTo(cc.conn)
 	}
-	return nil
+	sent(n)
+	return err
 }
 
 func (cc *ClientConnection) writeRaw(p []byte) error {
 	cc.ioMutex.Lock()
 	defer cc.ioMutex.Unlock()
 
-	_, err := cc.conn.Write(p)
+	n, err := cc.conn.Write(p)
+	sent(int64(n))
 
 	return err
 }
 
 func (cc *ClientConnection) Ping() error {
+	if cc.LongPoll() {
+		// Answered soon anyway
+		return nil
+	}
 	cc.ioMutex.Lock()
 	defer cc.ioMutex.Unlock()
-	_, err := cc.conn.Write(ws.CompiledPing)
+	ping := ws.CompiledPing
+	if cc.eventStream {
+		ping = eventStreamPing
+	}
+	n, err := cc.conn.Write(ping)
+	sent(int64(n))
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,53 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package wsbroadcastserver
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+func TestWriteVectored(t *testing.T) {
+	bytesSent := countMetric[metrics.Counter](t, &bytesSentCounter, &metrics.StandardCounter{})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Require(t, err)
+	defer listener.Close()
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	Require(t, err)
+	defer conn.Close()
+	peer, err := listener.Accept()
+	Require(t, err)
+	defer peer.Close()
+
+	cc := &ClientConnection{
+		conn: writeDeadliner{conn, time.Second},
+		out:  make(chan []byte, 2*maxVectoredWrite),
+	}
+	var expected []byte
+	for i := 0; i < maxVectoredWrite+3; i++ {
+		data := bytes.Repeat([]byte{byte(i)}, i+1)
+		expected = append(expected, data...)
+		Expect(t, cc.enqueue(data))
+	}
+
+	batch := cc.drain(make([][]byte, 0, maxVectoredWrite))
+	Expect(t, len(batch) == maxVectoredWrite, "batch", len(batch))
+	Require(t, cc.writeVectored(batch))
+	batch = cc.drain(batch[:0])
+	Expect(t, len(batch) == 3, "batch", len(batch))
+	Require(t, cc.writeVectored(batch))
+	Expect(t, cc.QueueDepth() == 0)
+
+	received := make([]byte, len(expected))
+	Require(t, peer.SetReadDeadline(time.Now().Add(time.Second)))
+	_, err = io.ReadFull(peer, received)
+	Require(t, err)
+	Expect(t, bytes.Equal(received, expected), "messages written out of order")
+	Expect(t, bytesSent.Count() == int64(len(expected)), "counted", bytesSent.Count(), "bytes sent, wrote", len(expected))
+}
@@ -7,7 +7,6 @@ import (
 	"bytes"
 	"compress/flate"
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
 	"net"
@@ -37,11 +36,15 @@ var (
 	clientsTotalFailedUpgradeCounter  = metrics.NewRegisteredCounter("arb/feed/clients/failed/upgrade", nil)
 	clientsTotalFailedWorkerCounter   = metrics.NewRegisteredCounter("arb/feed/clients/failed/worker", nil)
 	clientsDurationHistogram          = metrics.NewRegisteredHistogram("arb/feed/clients/duration", nil, metrics.NewBoundedHistogramSample())
+	clientsCatchupRequestCounter      = metrics.NewRegisteredCounter("arb/feed/clients/catchup/requests", nil)
+	clientsFailedCatchupCounter       = metrics.NewRegisteredCounter("arb/feed/clients/catchup/failed", nil)
+	clientsCatchupIgnoredCounter      = metrics.NewRegisteredCounter("arb/feed/clients/catchup/ignored", nil)
 )
 
 // CatchupBuffer is a Protocol-specific client catch-up logic can be injected using this interface
 type CatchupBuffer interface {
 	OnRegisterClient(*ClientConnection) (error, int, time.Duration)
+	OnCatchupRequest(*ClientConnection, arbutil.MessageIndex) (error, int, time.Duration)
 	OnDoBroadcast(interface{}) error
 	GetMessageCount() int
 }
@@ -54,11 +57,13 @@ type ClientManager struct {
 	clientCount   int32
 	pool          *gopool.Pool
 	poller        netpoll.Poller
-	broadcastChan chan interface{}
+	broadcastChan chan broadcastRequest
 	clientAction  chan ClientConnectionAction
+	catchupChan   chan catchupRequest
 	config        BroadcasterConfigFetcher
 	catchupBuffer CatchupBuffer
 	flateWriter   *flate.Writer
+	flateLevel    int
 
 	connectionLimiter *ConnectionLimiter
 }
@@ -68,14 +73,25 @@ type ClientConnectionAction struct {
 	create bool
 }
 
+type broadcastRequest struct {
+	bm     interface{}
+	queued time.Time
+}
+
+type catchupRequest struct {
+	cc              *ClientConnection
+	requestedSeqNum arbutil.MessageIndex
+}
+
 func NewClientManager(poller netpoll.Poller, configFetcher BroadcasterConfigFetcher, catchupBuffer CatchupBuffer) *ClientManager {
 	config := configFetcher()
 	return &ClientManager{
 		poller:            poller,
 		pool:              gopool.NewPool(config.Workers, config.Queue, 1),
 		clientPtrMap:      make(map[*ClientConnection]bool),
-		broadcastChan:     make(chan interface{}, 1),
+		broadcastChan:     make(chan broadcastRequest, 1),
 		clientAction:      make(chan ClientConnectionAction, 128),
+		catchupChan:       make(chan catchupRequest, 128),
 		config:            configFetcher,
 		catchupBuffer:     catchupBuffer,
 		connectionLimiter: NewConnectionLimiter(func() *ConnectionLimiterConfig { return &configFetcher().ConnectionLimits }),
@@ -89,14 +105,21 @@ func (cm *ClientManager) registerClient(ctx context.Context, clientConnection *C
 		}
 	}()
 
+	// Counted first, removeClientImpl uncounts clients failing to register
+	clientsCurrentGauge.Inc(1)
+	clientsConnectCount.Inc(1)
+	atomic.AddInt32(&cm.clientCount, 1)
+
 	if cm.config().ConnectionLimits.Enable && !cm.connectionLimiter.Register(clientConnection.clientIp) {
 		return fmt.Errorf("Connection limited %s", clientConnection.clientIp)
 	}
+	if err := cm.admit(); err != nil {
+		if cm.config().ConnectionLimits.Enable {
+			cm.connectionLimiter.Release(clientConnection.clientIp)
+		}
+		return err
+	}
 
-	clientsCurrentGauge.Inc(1)
-	clientsConnectCount.Inc(1)
-
-	atomic.AddInt32(&cm.clientCount, 1)
 	err, sent, elapsed := cm.catchupBuffer.OnRegisterClient(clientConnection)
 	if err != nil {
 		clientsTotalFailedRegisterCounter.Inc(1)
@@ -109,6 +132,7 @@ func (cm *ClientManager) registerClient(ctx context.Context, clientConnection *C
 		log.Info("client registered", "client", clientConnection.Name, "requestedSeqNum", clientConnection.RequestedSeqNum(), "sentCount", sent, "elapsed", elapsed)
 	}
 
+	clientConnection.pollReady = sent > 0
 	clientConnection.Start(ctx)
 	cm.clientPtrMap[clientConnection] = true
 	clientsTotalSuccessCounter.Inc(1)
@@ -122,15 +146,56 @@ func (cm *ClientManager) Register(
 	desc *netpoll.Desc,
 	requestedSeqNum arbutil.MessageIndex,
 	connectingIP net.IP,
+	clientId string,
+	identity *ClientIdentity,
 	compression bool,
+	binary bool,
+	bulkCatchup bool,
 ) *ClientConnection {
-	createClient := ClientConnectionAction{
-		NewClientConnection(conn, desc, cm, requestedSeqNum, connectingIP, compression, cm.config().ClientDelay),
-		true,
-	}
-	cm.clientAction <- createClient
+	cc := NewClientConnection(conn, desc, cm, requestedSeqNum, connectingIP, clientId, compression, binary, cm.config().ClientDelay)
+	cc.setIdentity(identity)
+	cc.bulkCatchup = bulkCatchup
+	cm.clientAction <- ClientConnectionAction{cc, true}
+
+	return cc
+}
+
+// RegisterEventStream registers a new connection as a Client that is sent
+// server-sent events.
+func (cm *ClientManager) RegisterEventStream(
+	conn net.Conn,
+	desc *netpoll.Desc,
+	requestedSeqNum arbutil.MessageIndex,
+	connectingIP net.IP,
+	clientId string,
+	identity *ClientIdentity,
+) *ClientConnection {
+	cc := NewClientConnection(conn, desc, cm, requestedSeqNum, connectingIP, clientId, false, false, cm.config().ClientDelay)
+	cc.setIdentity(identity)
+	cc.eventStream = true
+	cm.clientAction <- ClientConnectionAction{cc, true}
+	return cc
+}
 
-	return createClient.cc
+// RegisterLongPoll registers a new connection as a Client that is answered
+// with the messages written to it, waiting up to wait for them. The response
+// starts with header and has no body before it is sent.
+func (cm *ClientManager) RegisterLongPoll(
+	conn net.Conn,
+	desc *netpoll.Desc,
+	requestedSeqNum arbutil.MessageIndex,
+	connectingIP net.IP,
+	clientId string,
+	identity *ClientIdentity,
+	wait time.Duration,
+	header []byte,
+) *ClientConnection {
+	cc := NewClientConnection(conn, desc, cm, requestedSeqNum, connectingIP, clientId, false, false, 0)
+	cc.setIdentity(identity)
+	cc.pollHeader = header
+	cc.pollWait = wait
+	cm.clientAction <- ClientConnectionAction{cc, true}
+	return cc
 }
 
 // removeAll removes all clients after main ClientManager thread exits
@@ -148,6 +213,12 @@ func (cm *ClientManager) removeClientImpl(clientConnection *ClientConnection) {
 	if err != nil {
 		log.Warn("Failed to stop poller", "err", err)
 	}
+	// The descriptor holds a duplicate of the socket, the client only sees
+	// the disconnect once both are closed
+	err = clientConnection.desc.Close()
+	if err != nil {
+		log.Warn("Failed to close poller descriptor", "err", err)
+	}
 
 	err = clientConnection.conn.Close()
 	if err != nil && !strings.Contains(err.Error(), "use of closed network connection") {
@@ -184,6 +255,54 @@ func (cm *ClientManager) Remove(clientConnection *ClientConnection) {
 	}
 }
 
+// RequestCatchup resends cached messages starting from requestedSeqNum to a
+// registered client. A client has at most one request pending and is served
+// at most one per CatchupInterval, others are ignored, as is any request
+// while the client manager is busy with too many. Returns whether the request
+// was queued.
+func (cm *ClientManager) RequestCatchup(clientConnection *ClientConnection, requestedSeqNum arbutil.MessageIndex) bool {
+	if !atomic.CompareAndSwapInt32(&clientConnection.catchupPending, 0, 1) {
+		clientsCatchupIgnoredCounter.Inc(1)
+		log.Debug("ignoring catchup request while another is pending", "client", clientConnection.Name, "requestedSeqNum", requestedSeqNum)
+		return false
+	}
+	now := time.Now()
+	last := atomic.LoadInt64(&clientConnection.lastCatchupUnixNano)
+	if last != 0 && now.Sub(time.Unix(0, last)) < cm.config().CatchupInterval {
+		atomic.StoreInt32(&clientConnection.catchupPending, 0)
+		clientsCatchupIgnoredCounter.Inc(1)
+		log.Debug("ignoring catchup request within catchup-interval of the last one", "client", clientConnection.Name, "requestedSeqNum", requestedSeqNum)
+		return false
+	}
+	// Called from the client's read handler, which mustn't wait for the
+	// client manager
+	select {
+	case cm.catchupChan <- catchupRequest{clientConnection, requestedSeqNum}:
+		atomic.StoreInt64(&clientConnection.lastCatchupUnixNano, now.UnixNano())
+		return true
+	default:
+		atomic.StoreInt32(&clientConnection.catchupPending, 0)
+		clientsCatchupIgnoredCounter.Inc(1)
+		log.Warn("ignoring catchup request, too many are pending", "client", clientConnection.Name, "requestedSeqNum", requestedSeqNum)
+		return false
+	}
+}
+
+func (cm *ClientManager) catchupClient(clientConnection *ClientConnection, requestedSeqNum arbutil.MessageIndex) error {
+	defer atomic.StoreInt32(&clientConnection.catchupPending, 0)
+	if !cm.clientPtrMap[clientConnection] {
+		return nil
+	}
+	clientsCatchupRequestCounter.Inc(1)
+	err, sent, elapsed := cm.catchupBuffer.OnCatchupRequest(clientConnection, requestedSeqNum)
+	if err != nil {
+		clientsFailedCatchupCounter.Inc(1)
+		return err
+	}
+	log.Debug("client catchup requested", "client", clientConnection.Name, "requestedSeqNum", requestedSeqNum, "sentCount", sent, "elapsed", elapsed)
+	return nil
+}
+
 func (cm *ClientManager) ClientCount() int32 {
 	return atomic.LoadInt32(&cm.clientCount)
 }
@@ -196,7 +315,7 @@ func (cm *ClientManager) Broadcast(bm interface{}) {
 		// In this case we should proceed without broadcasting the message.
 		return
 	}
-	cm.broadcastChan <- bm
+	cm.broadcastChan <- broadcastRequest{bm, time.Now()}
 }
 
 func (cm *ClientManager) doBroadcast(bm interface{}) ([]*ClientConnection, error) {
@@ -204,75 +323,94 @@ func (cm *ClientManager) doBroadcast(bm interface{}) ([]*ClientConnection, error
 		return nil, err
 	}
 	config := cm.config()
-	//                                        /-> wsutil.Writer -> not compressed msg buffer
-	// bm -> json.Encoder -> io.MultiWriter -|
-	//                                        \-> cm.flateWriter -> wsutil.Writer -> compressed msg buffer
-
-	notCompressed, compressed, err := serializeMessage(cm, bm, !config.RequireCompression, config.EnableCompression)
-	if err != nil {
-		return nil, err
-	}
+	// Each encoding is serialized once, when the first client using it is
+	// sent the message
+	serialized := newSerializedMessage(cm, bm)
 
+	var encodingFailed [encodingCount]bool
 	sendQueueTooLargeCount := 0
+	var sendQueueTooLargeNames []string
 	clientDeleteList := make([]*ClientConnection, 0, len(cm.clientPtrMap))
 	for client := range cm.clientPtrMap {
-		var data []byte
-		if client.Compression() {
-			if config.EnableCompression {
-				data = compressed.Bytes()
-			} else {
+		if !client.EventStream() && !client.LongPoll() {
+			if client.Compression() && !config.EnableCompression {
 				log.Warn("disconnecting because client has enabled compression, but compression support is disabled", "client", client.Name)
+				clientsDisconnectCompressionCounter.Inc(1)
 				clientDeleteList = append(clientDeleteList, client)
 				continue
 			}
-		} else {
-			if !config.RequireCompression {
-				data = notCompressed.Bytes()
-			} else {
+			if !client.Compression() && config.RequireCompression {
 				log.Warn("disconnecting because client has disabled compression, but compression support is required", "client", client.Name)
+				clientsDisconnectCompressionCounter.Inc(1)
 				clientDeleteList = append(clientDeleteList, client)
 				continue
 			}
 		}
-		select {
-		case client.out <- data:
-		default:
+		encoding := client.encoding()
+		data, err := serialized.bytes(encoding)
+		if err != nil {
+			// Only the clients using this encoding miss the message, they
+			// are disconnected rather than skipping it and catch up after
+			// reconnecting
+			if !encodingFailed[encoding] {
+				log.Error("unable to serialize broadcast message, disconnecting clients using the encoding", "encoding", encoding, "err", err)
+				encodingFailed[encoding] = true
+			}
+			clientDeleteList = append(clientDeleteList, client)
+			continue
+		}
+		if !cm.send(client, data) {
 			// Queue for client too backed up, disconnect instead of blocking on channel send
 			sendQueueTooLargeCount++
+			if len(sendQueueTooLargeNames) < 10 {
+				sendQueueTooLargeNames = append(sendQueueTooLargeNames, client.Name)
+			}
 			clientDeleteList = append(clientDeleteList, client)
 		}
 	}
 
 	if sendQueueTooLargeCount > 0 {
 		if sendQueueTooLargeCount < 10 {
-			log.Warn("disconnecting clients because send queue too large", "count", sendQueueTooLargeCount)
+			log.Warn("disconnecting clients because send queue too large", "count", sendQueueTooLargeCount, "clients", sendQueueTooLargeNames)
 		} else {
-			log.Error("disconnecting clients because send queue too large", "count", sendQueueTooLargeCount)
+			log.Error("disconnecting clients because send queue too large", "count", sendQueueTooLargeCount, "clients", sendQueueTooLargeNames)
 		}
 	}
 
 	return clientDeleteList, nil
 }
 
-func serializeMessage(cm *ClientManager, bm interface{}, enableNonCompressedOutput, enableCompressedOutput bool) (bytes.Buffer, bytes.Buffer, error) {
+// serializeMessage writes the payload of an encoded message as websocket
+// frames, deflated or not
+func serializeMessage(cm *ClientManager, payload []byte, enableNonCompressedOutput, enableCompressedOutput bool, binary bool) (bytes.Buffer, bytes.Buffer, error) {
+	//                       /-> wsutil.Writer -> not compressed msg buffer
+	// payload -> io.MultiWriter -|
+	//                       \-> cm.flateWriter -> wsutil.Writer -> compressed msg buffer
+
+	opCode := ws.OpText
+	if binary {
+		opCode = ws.OpBinary
+	}
 	var notCompressed bytes.Buffer
 	var compressed bytes.Buffer
 	writers := []io.Writer{}
 	var notCompressedWriter *wsutil.Writer
 	var compressedWriter *wsutil.Writer
 	if enableNonCompressedOutput {
-		notCompressedWriter = wsutil.NewWriter(&notCompressed, ws.StateServerSide, ws.OpText)
+		notCompressedWriter = wsutil.NewWriter(&notCompressed, ws.StateServerSide, opCode)
 		writers = append(writers, notCompressedWriter)
 	}
 	if enableCompressedOutput {
-		if cm.flateWriter == nil {
+		level := cm.config().CompressionLevel
+		if cm.flateWriter == nil || cm.flateLevel != level {
 			var err error
-			cm.flateWriter, err = flate.NewWriterDict(nil, DeflateCompressionLevel, GetStaticCompressorDictionary())
+			cm.flateWriter, err = flate.NewWriterDict(nil, level, GetStaticCompressorDictionary())
 			if err != nil {
 				return bytes.Buffer{}, bytes.Buffer{}, fmt.Errorf("unable to create flate writer: %w", err)
 			}
+			cm.flateLevel = level
 		}
-		compressedWriter = wsutil.NewWriter(&compressed, ws.StateServerSide|ws.StateExtended, ws.OpText)
+		compressedWriter = wsutil.NewWriter(&compressed, ws.StateServerSide|ws.StateExtended, opCode)
 		var msg wsflate.MessageState
 		msg.SetCompressed(true)
 		compressedWriter.SetExtensions(&msg)
@@ -280,10 +418,8 @@ func serializeMessage(cm *ClientManager, bm interface{}, enableNonCompressedOutp
 		writers = append(writers, cm.flateWriter)
 	}
 
-	multiWriter := io.MultiWriter(writers...)
-	encoder := json.NewEncoder(multiWriter)
-	if err := encoder.Encode(bm); err != nil {
-		return bytes.Buffer{}, bytes.Buffer{}, fmt.Errorf("unable to encode message: %w", err)
+	if _, err := io.MultiWriter(writers...).Write(payload); err != nil {
+		return bytes.Buffer{}, bytes.Buffer{}, fmt.Errorf("unable to write message: %w", err)
 	}
 	if notCompressedWriter != nil {
 		if err := notCompressedWriter.Flush(); err != nil {
@@ -310,19 +446,49 @@ func (cm *ClientManager) verifyClients() []*ClientConnection {
 
 	// Send ping to all connected clients
 	log.Debug("pinging clients", "count", len(cm.clientPtrMap))
+	slowClients := &cm.config().SlowClients
+	var maxQueueDepth int
+	var maxLag time.Duration
 	for client := range cm.clientPtrMap {
+		// Long-poll clients are answered with everything queued soon anyway
+		if !client.LongPoll() {
+			depth, lag := client.QueueDepth(), client.Lag()
+			clientsQueueHistogram.Update(int64(depth))
+			clientsLagHistogram.Update(lag.Milliseconds())
+			if depth > maxQueueDepth {
+				maxQueueDepth = depth
+			}
+			if lag > maxLag {
+				maxLag = lag
+			}
+			if slowClients.slow(client) {
+				if slowClients.Policy != SlowClientDropOldest {
+					log.Debug("disconnecting because client is too slow", "client", client.Name, "queued", depth, "lag", lag)
+					clientsSlowEvictedCounter.Inc(1)
+					clientDeleteList = append(clientDeleteList, client)
+					continue
+				}
+				slowClients.dropOldest(client)
+			}
+		}
 		diff := time.Since(client.GetLastHeard())
-		if diff > cm.config().ClientTimeout {
+		// Event stream and long-poll clients never send anything, a dead one
+		// is noticed when writing to it fails
+		if !client.EventStream() && !client.LongPoll() && diff > cm.config().ClientTimeout {
 			log.Debug("disconnecting because connection timed out", "client", client.Name)
+			clientsDisconnectTimeoutCounter.Inc(1)
 			clientDeleteList = append(clientDeleteList, client)
 		} else {
 			err := client.Ping()
 			if err != nil {
 				log.Debug("disconnecting because error pinging client", "client", client.Name)
+				clientsDisconnectPingCounter.Inc(1)
 				clientDeleteList = append(clientDeleteList, client)
 			}
 		}
 	}
+	clientsQueueDepthGauge.Update(int64(maxQueueDepth))
+	clientsLagGauge.Update(maxLag.Milliseconds())
 
 	return clientDeleteList
 }
@@ -351,10 +517,19 @@ func (cm *ClientManager) Start(parentCtx context.Context) {
 				} else {
 					cm.removeClient(clientAction.cc)
 				}
-			case bm := <-cm.broadcastChan:
+			case request := <-cm.catchupChan:
+				if err := cm.catchupClient(request.cc, request.requestedSeqNum); err != nil {
+					log.Warn("disconnecting because of error sending requested catchup", "client", request.cc.Name, "err", err)
+					clientsDisconnectCatchupCounter.Inc(1)
+					clientDeleteList = append(clientDeleteList, request.cc)
+				}
+			case request := <-cm.broadcastChan:
 				var err error
-				clientDeleteList, err = cm.doBroadcast(bm)
+				clientDeleteList, err = cm.doBroadcast(request.bm)
 				logError(err, "failed to do broadcast")
+				broadcastMessagesCounter.Inc(1)
+				// From Broadcast being called to the message being queued for all clients
+				broadcastLatencyHistogram.Update(time.Since(request.queued).Microseconds())
 			case <-pingTimer.C:
 				clientDeleteList = cm.verifyClients()
 				pingTimer.Reset(cm.config().Ping)
@@ -0,0 +1,230 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package wsbroadcastserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mailru/easygo/netpoll"
+
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/offchainlabs/nitro/arbutil"
+)
+
+func TestRequestCatchupFlood(t *testing.T) {
+	config := DefaultTestBroadcasterConfig
+	config.CatchupInterval = time.Hour
+	Require(t, config.Validate())
+	// The client manager isn't running, requests stay queued until read here
+	cm := &ClientManager{
+		config:      func() *BroadcasterConfig { return &config },
+		catchupChan: make(chan catchupRequest, 4),
+	}
+	cc := &ClientConnection{}
+
+	Expect(t, cm.RequestCatchup(cc, 0), "first catchup request not queued")
+	for i := 0; i < 1000; i++ {
+		Expect(t, !cm.RequestCatchup(cc, 0), "catchup request", i, "queued while another is pending")
+	}
+	Expect(t, len(cm.catchupChan) == 1, "queued", len(cm.catchupChan))
+	request := <-cm.catchupChan
+	Require(t, cm.catchupClient(request.cc, request.requestedSeqNum))
+	Expect(t, !cm.RequestCatchup(cc, 0), "catchup request within catchup-interval queued")
+
+	config.CatchupInterval = 0
+	Expect(t, cm.RequestCatchup(cc, 0), "catchup request after catchup-interval not queued")
+	request = <-cm.catchupChan
+	Require(t, cm.catchupClient(request.cc, request.requestedSeqNum))
+
+	// Requests of many clients don't block the read handlers once the queue is full
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			cm.RequestCatchup(&ClientConnection{}, 0)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("catchup requests blocked on a full queue")
+	}
+	Expect(t, len(cm.catchupChan) == cap(cm.catchupChan), "queued", len(cm.catchupChan))
+}
+
+// failingConn fails writes once failing is set
+type failingConn struct {
+	net.Conn
+	failing int32
+}
+
+func (c *failingConn) Write(p []byte) (int, error) {
+	if atomic.LoadInt32(&c.failing) != 0 {
+		return 0, errors.New("write failed")
+	}
+	return c.Conn.Write(p)
+}
+
+// failingCatchupBuffer fails all catchup requests, and tells when a client is
+// registered
+type failingCatchupBuffer struct {
+	emptyCatchupBuffer
+	registered chan *ClientConnection
+}
+
+func (b *failingCatchupBuffer) OnRegisterClient(cc *ClientConnection) (error, int, time.Duration) {
+	b.registered <- cc
+	return nil, 0, 0
+}
+
+func (b *failingCatchupBuffer) OnCatchupRequest(*ClientConnection, arbutil.MessageIndex) (error, int, time.Duration) {
+	return errors.New("catchup failed"), 0, 0
+}
+
+// floodingCatchupBuffer sends clients more messages on registration and
+// catchup than fit their send queue
+type floodingCatchupBuffer struct {
+	emptyCatchupBuffer
+}
+
+func (floodingCatchupBuffer) flood(cc *ClientConnection) (error, int, time.Duration) {
+	for i := 0; i <= cap(cc.out); i++ {
+		if err := cc.Write(countedMessage{jsonEncodings: new(int)}); err != nil {
+			return err, i, 0
+		}
+	}
+	return nil, cap(cc.out) + 1, 0
+}
+
+func (b floodingCatchupBuffer) OnRegisterClient(cc *ClientConnection) (error, int, time.Duration) {
+	return b.flood(cc)
+}
+
+func (b floodingCatchupBuffer) OnCatchupRequest(cc *ClientConnection, _ arbutil.MessageIndex) (error, int, time.Duration) {
+	return b.flood(cc)
+}
+
+func TestSendQueueFullOnCatchup(t *testing.T) {
+	config := DefaultTestBroadcasterConfig
+	config.MaxSendQueue = 2
+	Require(t, config.Validate())
+	poller, err := netpoll.New(nil)
+	Require(t, err)
+	cm := NewClientManager(poller, func() *BroadcasterConfig { return &config }, floodingCatchupBuffer{})
+
+	// Catchup not fitting the queue of a new client fails its registration,
+	// it is removed by the client manager then
+	cc := &ClientConnection{clientManager: cm, out: make(chan []byte, config.MaxSendQueue)}
+	err = cm.registerClient(context.Background(), cc)
+	Expect(t, errors.Is(err, errSendQueueFull), "registered client with full send queue, err", err)
+	Expect(t, !cm.clientPtrMap[cc], "client with full send queue registered")
+
+	// Requested catchup not fitting the queue disconnects the client
+	cc = &ClientConnection{clientManager: cm, out: make(chan []byte, config.MaxSendQueue)}
+	cm.clientPtrMap[cc] = true
+	err = cm.catchupClient(cc, 0)
+	Expect(t, errors.Is(err, errSendQueueFull), "catchup sent to client with full send queue, err", err)
+}
+
+func TestDisconnectReasons(t *testing.T) {
+	timeouts := countMetric[metrics.Counter](t, &clientsDisconnectTimeoutCounter, &metrics.StandardCounter{})
+	pings := countMetric[metrics.Counter](t, &clientsDisconnectPingCounter, &metrics.StandardCounter{})
+	writes := countMetric[metrics.Counter](t, &clientsDisconnectWriteCounter, &metrics.StandardCounter{})
+	compression := countMetric[metrics.Counter](t, &clientsDisconnectCompressionCounter, &metrics.StandardCounter{})
+	catchups := countMetric[metrics.Counter](t, &clientsDisconnectCatchupCounter, &metrics.StandardCounter{})
+	reasons := map[string]metrics.Counter{"timeout": timeouts, "ping": pings, "write": writes, "compression": compression, "catchup": catchups}
+	expectReasons := func(expected map[string]int64) {
+		t.Helper()
+		for reason, counter := range reasons {
+			Expect(t, counter.Count() == expected[reason], reason, "disconnects", counter.Count(), "expected", expected[reason])
+		}
+	}
+
+	// The ping round disconnects clients that timed out or can't be pinged
+	config := DefaultTestBroadcasterConfig
+	config.Ping = time.Hour
+	config.EnableCompression = false
+	Require(t, config.Validate())
+	cm := &ClientManager{config: func() *BroadcasterConfig { return &config }, clientPtrMap: make(map[*ClientConnection]bool)}
+	timedOut := &ClientConnection{lastHeardUnix: time.Now().Add(-time.Hour).Unix()}
+	unpingable := &ClientConnection{conn: &failingConn{failing: 1}, lastHeardUnix: time.Now().Unix()}
+	cm.clientPtrMap[timedOut] = true
+	cm.clientPtrMap[unpingable] = true
+	deleteList := cm.verifyClients()
+	Expect(t, len(deleteList) == 2, "clients disconnected", len(deleteList))
+	expectReasons(map[string]int64{"timeout": 1, "ping": 1})
+
+	// Broadcasts disconnect compressing clients with compression disabled,
+	// and plain clients with compression required
+	cm.clientPtrMap = map[*ClientConnection]bool{{compression: true, out: make(chan []byte, 1)}: true}
+	cm.catchupBuffer = emptyCatchupBuffer{}
+	deleteList, err := cm.doBroadcast(countedMessage{jsonEncodings: new(int)})
+	Require(t, err)
+	Expect(t, len(deleteList) == 1, "clients disconnected", len(deleteList))
+	expectReasons(map[string]int64{"timeout": 1, "ping": 1, "compression": 1})
+	config.EnableCompression = true
+	config.RequireCompression = true
+	cm.clientPtrMap = map[*ClientConnection]bool{{out: make(chan []byte, 1)}: true}
+	deleteList, err = cm.doBroadcast(countedMessage{jsonEncodings: new(int)})
+	Require(t, err)
+	Expect(t, len(deleteList) == 1, "clients disconnected", len(deleteList))
+	expectReasons(map[string]int64{"timeout": 1, "ping": 1, "compression": 2})
+	config.EnableCompression = false
+	config.RequireCompression = false
+
+	// Failed writes and catchups disconnect registered clients
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	poller, err := netpoll.New(nil)
+	Require(t, err)
+	catchupBuffer := &failingCatchupBuffer{registered: make(chan *ClientConnection, 1)}
+	cm = NewClientManager(poller, func() *BroadcasterConfig { return &config }, catchupBuffer)
+	cm.Start(ctx)
+	defer cm.StopAndWait()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Require(t, err)
+	defer listener.Close()
+	register := func() (*ClientConnection, *failingConn, net.Conn) {
+		t.Helper()
+		clientConn, err := net.Dial("tcp", listener.Addr().String())
+		Require(t, err)
+		t.Cleanup(func() { _ = clientConn.Close() })
+		conn, err := listener.Accept()
+		Require(t, err)
+		desc, err := netpoll.HandleRead(conn)
+		Require(t, err)
+		failing := &failingConn{Conn: conn}
+		cc := cm.Register(failing, desc, 0, net.ParseIP("127.0.0.1"), "", nil, false, false, false)
+		select {
+		case <-catchupBuffer.registered:
+		case <-time.After(5 * time.Second):
+			t.Fatal("client not registered")
+		}
+		return cc, failing, clientConn
+	}
+	expectDisconnected := func(clientConn net.Conn) {
+		t.Helper()
+		Require(t, clientConn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		_, err := io.ReadAll(clientConn)
+		Require(t, err, "client not disconnected")
+	}
+
+	cc, _, clientConn := register()
+	Expect(t, cm.RequestCatchup(cc, 0), "catchup request not queued")
+	expectDisconnected(clientConn)
+	expectReasons(map[string]int64{"timeout": 1, "ping": 1, "compression": 2, "catchup": 1})
+
+	_, failing, clientConn := register()
+	atomic.StoreInt32(&failing.failing, 1)
+	cm.Broadcast(countedMessage{jsonEncodings: new(int)})
+	expectDisconnected(clientConn)
+	expectReasons(map[string]int64{"timeout": 1, "ping": 1, "compression": 2, "catchup": 1, "write": 1})
+}
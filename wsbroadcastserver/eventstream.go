@@ -0,0 +1,217 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package wsbroadcastserver
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/mailru/easygo/netpoll"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/offchainlabs/nitro/arbutil"
+)
+
+// EventStreamPath is where the feed is served as server-sent events, for
+// clients behind proxies that strip websocket upgrades. Events carry the same
+// JSON messages as the websocket feed.
+const EventStreamPath = "/events"
+
+var clientsEventStreamCounter = metrics.NewRegisteredCounter("arb/feed/clients/event-stream", nil)
+
+// eventStreamPing is a comment line, ignored by clients but keeping proxies
+// from timing out the stream
+var eventStreamPing = []byte(":ping\n\n")
+
+// readWriter lets the websocket upgrade read the bytes consumed while telling
+// the request apart
+type readWriter struct {
+	io.Reader
+	io.Writer
+}
+
+// peekRequestPath reads just enough of the request from conn to tell whether
+// it is a GET of one of paths, and returns that path. The returned reader
+// yields the whole request including the bytes already read.
+func peekRequestPath(conn net.Conn, paths ...string) (string, io.Reader) {
+	size := 0
+	for _, path := range paths {
+		if len("GET "+path)+1 > size {
+			size = len("GET "+path) + 1
+		}
+	}
+	prefix := make([]byte, size)
+	n, err := io.ReadFull(conn, prefix)
+	request := io.MultiReader(bytes.NewReader(prefix[:n]), conn)
+	if err != nil {
+		return "", request
+	}
+	for _, path := range paths {
+		method := []byte("GET " + path)
+		if !bytes.HasPrefix(prefix, method) {
+			continue
+		}
+		if next := prefix[len(method)]; next == ' ' || next == '?' {
+			return path, request
+		}
+	}
+	return "", request
+}
+
+// encodeEvent makes a server-sent event of a message encoded as a JSON line
+func encodeEvent(line []byte) []byte {
+	data := bytes.TrimSuffix(line, []byte("\n"))
+	event := make([]byte, 0, len(data)+len("data: \n\n"))
+	event = append(event, "data: "...)
+	event = append(event, data...)
+	return append(event, "\n\n"...)
+}
+
+// writeHTTPError answers a plain HTTP request for the feed with an error and
+// closes the connection
+func writeHTTPError(conn net.Conn, status int, reason string) {
+	_, _ = fmt.Fprintf(conn, "HTTP/1.1 %d %s\r\nContent-Type: text/plain\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s", status, http.StatusText(status), len(reason), reason)
+	_ = conn.Close()
+}
+
+// readFeedRequest reads a plain HTTP request for the feed, checking the
+// client version, address, auth token and connection limits like the
+// websocket upgrade. The error response has already been sent if it fails.
+func (s *WSBroadcastServer) readFeedRequest(conn net.Conn, request io.Reader) (*http.Request, net.IP, *ClientIdentity, bool) {
+	config := s.config()
+	req, err := http.ReadRequest(bufio.NewReader(request))
+	if err != nil {
+		log.Debug("error reading feed request", "remoteAddr", conn.RemoteAddr(), "err", err)
+		clientsTotalFailedUpgradeCounter.Inc(1)
+		_ = conn.Close()
+		return nil, nil, nil, false
+	}
+	if version := req.Header.Get(HTTPHeaderFeedClientVersion); version != "" {
+		feedClientVersion, err := strconv.ParseUint(version, 0, 64)
+		if err != nil || feedClientVersion < FeedClientVersion {
+			writeHTTPError(conn, http.StatusBadRequest, fmt.Sprintf("Feed Client version %s not supported, expected %d", version, FeedClientVersion))
+			return nil, nil, nil, false
+		}
+	} else if config.RequireVersion {
+		writeHTTPError(conn, http.StatusBadRequest, fmt.Sprintf("Missing HTTP header %s", HTTPHeaderFeedClientVersion))
+		return nil, nil, nil, false
+	}
+	var connectingIP net.IP
+	if peerIP := remoteIP(conn); peerIP != nil {
+		connectingIP = config.IPFilter.ClientIP(peerIP, req.Header.Get(HTTPHeaderCloudflareConnectingIP), req.Header.Values(HTTPHeaderForwardedFor))
+	}
+	if !config.IPFilter.Allowed(connectingIP) {
+		clientsFilteredCounter.Inc(1)
+		writeHTTPError(conn, http.StatusForbidden, "Feed not served to this address.")
+		return nil, nil, nil, false
+	}
+	identity, err := s.authenticator.authenticate(req.Header.Get(HTTPHeaderAuthorization))
+	if err != nil {
+		log.Debug("feed client not authenticated", "connectingIP", connectingIP, "err", err)
+		clientsTotalFailedAuthCounter.Inc(1)
+		writeHTTPError(conn, http.StatusUnauthorized, "Missing or invalid feed auth token.")
+		return nil, nil, nil, false
+	}
+	if config.ConnectionLimits.Enable && !s.clientManager.connectionLimiter.IsAllowed(connectingIP) {
+		writeHTTPError(conn, http.StatusTooManyRequests, "Too many open feed connections.")
+		return nil, nil, nil, false
+	}
+	if s.clientManager.full() {
+		clientsRejectedFullCounter.Inc(1)
+		writeHTTPError(conn, http.StatusServiceUnavailable, "Too many feed clients.")
+		return nil, nil, nil, false
+	}
+	return req, connectingIP, identity, true
+}
+
+// parseSeqNum parses a sequence number sent by a client, value may be empty
+func parseSeqNum(conn net.Conn, value string) (arbutil.MessageIndex, bool) {
+	if value == "" {
+		return 0, true
+	}
+	num, err := strconv.ParseUint(value, 0, 64)
+	if err != nil {
+		writeHTTPError(conn, http.StatusBadRequest, "Malformed sequence number")
+		return 0, false
+	}
+	return arbutil.MessageIndex(num), true
+}
+
+// startHTTPClient watches a client registered from a plain HTTP request for
+// disconnects, they have nothing to send after the request
+func (s *WSBroadcastServer) startHTTPClient(client *ClientConnection) {
+	err := s.poller.Start(client.desc, func(ev netpoll.Event) {
+		if ev&(netpoll.EventReadHup|netpoll.EventHup) != 0 {
+			log.Debug("Hup received", "age", client.Age(), "client", client.Name)
+			s.clientManager.Remove(client)
+			return
+		}
+		s.clientManager.pool.Schedule(func() {
+			if err := client.discardInput(s.config().ReadTimeout); err != nil {
+				s.clientManager.Remove(client)
+			}
+		})
+	})
+	if err != nil {
+		log.Warn("error starting client connection poller", "err", err)
+	}
+}
+
+// serveEventStream answers a request for the event stream and registers the
+// connection as a client that is sent events instead of websocket frames
+func (s *WSBroadcastServer) serveEventStream(conn net.Conn, request io.Reader, header ws.HandshakeHeader) {
+	req, connectingIP, identity, ok := s.readFeedRequest(conn, request)
+	if !ok {
+		return
+	}
+	value := req.URL.Query().Get(RequestedSequenceNumberQueryParameter)
+	if value == "" {
+		value = req.Header.Get(HTTPHeaderRequestedSequenceNumber)
+	}
+	requestedSeqNum, ok := parseSeqNum(conn, value)
+	if !ok {
+		return
+	}
+
+	// No content length, the body lasts until the connection is closed
+	var response bytes.Buffer
+	response.WriteString("HTTP/1.1 200 OK\r\nContent-Type: text/event-stream\r\nCache-Control: no-cache\r\nConnection: close\r\n")
+	if header != nil {
+		if _, err := header.WriteTo(&response); err != nil {
+			log.Warn("error writing event stream response header", "err", err)
+			_ = conn.Close()
+			return
+		}
+	}
+	response.WriteString("\r\n")
+	if _, err := conn.Write(response.Bytes()); err != nil {
+		log.Debug("error writing event stream response", "connectingIP", connectingIP, "err", err)
+		_ = conn.Close()
+		return
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		log.Warn("error unsetting event stream deadline", "connectingIP", connectingIP, "err", err)
+		_ = conn.Close()
+		return
+	}
+
+	desc, err := netpoll.HandleRead(pollable(conn))
+	if err != nil {
+		log.Warn("error in HandleRead", "connectingIP", connectingIP, "err", err)
+		_ = conn.Close()
+		return
+	}
+	clientsEventStreamCounter.Inc(1)
+	client := s.clientManager.RegisterEventStream(writeDeadliner{conn, s.config().WriteTimeout}, desc, requestedSeqNum, connectingIP, SanitizeClientId(req.Header.Get(HTTPHeaderFeedClientId)), identity)
+	s.startHTTPClient(client)
+}
@@ -0,0 +1,141 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: feed.proto
+
+package feedpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// FeedClient is the client API for Feed service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type FeedClient interface {
+	// Subscribe streams the frames of the feed. The handshake headers are sent
+	// as metadata in both directions.
+	Subscribe(ctx context.Context, opts ...grpc.CallOption) (Feed_SubscribeClient, error)
+}
+
+type feedClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewFeedClient(cc grpc.ClientConnInterface) FeedClient {
+	return &feedClient{cc}
+}
+
+func (c *feedClient) Subscribe(ctx context.Context, opts ...grpc.CallOption) (Feed_SubscribeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Feed_ServiceDesc.Streams[0], "/arbitrum.feed.v1.Feed/Subscribe", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &feedSubscribeClient{stream}
+	return x, nil
+}
+
+type Feed_SubscribeClient interface {
+	Send(*CatchupRequest) error
+	Recv() (*Frame, error)
+	grpc.ClientStream
+}
+
+type feedSubscribeClient struct {
+	grpc.ClientStream
+}
+
+func (x *feedSubscribeClient) Send(m *CatchupRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *feedSubscribeClient) Recv() (*Frame, error) {
+	m := new(Frame)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// FeedServer is the server API for Feed service.
+// All implementations must embed UnimplementedFeedServer
+// for forward compatibility
+type FeedServer interface {
+	// Subscribe streams the frames of the feed. The handshake headers are sent
+	// as metadata in both directions.
+	Subscribe(Feed_SubscribeServer) error
+	mustEmbedUnimplementedFeedServer()
+}
+
+// UnimplementedFeedServer must be embedded to have forward compatible implementations.
+type UnimplementedFeedServer struct {
+}
+
+func (UnimplementedFeedServer) Subscribe(Feed_SubscribeServer) error {
+	return status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+func (UnimplementedFeedServer) mustEmbedUnimplementedFeedServer() {}
+
+// UnsafeFeedServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to FeedServer will
+// result in compilation errors.
+type UnsafeFeedServer interface {
+	mustEmbedUnimplementedFeedServer()
+}
+
+func RegisterFeedServer(s grpc.ServiceRegistrar, srv FeedServer) {
+	s.RegisterService(&Feed_ServiceDesc, srv)
+}
+
+func _Feed_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(FeedServer).Subscribe(&feedSubscribeServer{stream})
+}
+
+type Feed_SubscribeServer interface {
+	Send(*Frame) error
+	Recv() (*CatchupRequest, error)
+	grpc.ServerStream
+}
+
+type feedSubscribeServer struct {
+	grpc.ServerStream
+}
+
+func (x *feedSubscribeServer) Send(m *Frame) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *feedSubscribeServer) Recv() (*CatchupRequest, error) {
+	m := new(CatchupRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Feed_ServiceDesc is the grpc.ServiceDesc for Feed service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Feed_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "arbitrum.feed.v1.Feed",
+	HandlerType: (*FeedServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       _Feed_Subscribe_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "feed.proto",
+}
@@ -0,0 +1,290 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package wsbroadcastserver
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+	flag "github.com/spf13/pflag"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/wsbroadcastserver/feedpb"
+)
+
+var grpcStreamsCounter = metrics.NewRegisteredCounter("arb/feed/grpc/streams", nil)
+
+type GRPCConfig struct {
+	Enable bool   `koanf:"enable"`
+	Port   string `koanf:"port"`
+}
+
+var DefaultGRPCConfig = GRPCConfig{
+	Enable: false,
+	Port:   "9645",
+}
+
+var DefaultTestGRPCConfig = GRPCConfig{
+	Enable: false,
+	Port:   "0",
+}
+
+func GRPCConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Bool(prefix+".enable", DefaultGRPCConfig.Enable, "also serve the feed as a gRPC stream, for clients connecting with grpc:// or grpcs:// urls")
+	f.String(prefix+".port", DefaultGRPCConfig.Port, "port to bind the gRPC feed output to, on the broadcaster addr")
+}
+
+// startGRPC serves the feed over gRPC. Each stream is bridged to a websocket
+// connection to the server itself, so it goes through the same handshake and
+// is served like any other client.
+func (s *WSBroadcastServer) startGRPC(config *BroadcasterConfig) error {
+	ln, err := net.Listen("tcp", config.Addr+":"+config.GRPC.Port)
+	if err != nil {
+		log.Error("error listening for gRPC feed clients", "err", err)
+		return err
+	}
+	var options []grpc.ServerOption
+	if s.certReloader != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(&tls.Config{
+			MinVersion:         tls.VersionTLS12,
+			GetConfigForClient: s.grpcTLSConfigForClient,
+		})))
+	}
+	server := grpc.NewServer(options...)
+	feedpb.RegisterFeedServer(server, &grpcFeedServer{server: s})
+	s.grpcListener = ln
+	s.grpcServer = server
+	go func() {
+		if err := server.Serve(ln); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			log.Error("error serving gRPC feed", "err", err)
+		}
+	}()
+	log.Info("arbitrum grpc broadcast server is listening", "address", ln.Addr().String(), "tls", s.certReloader != nil)
+	return nil
+}
+
+// grpcFeedServer serves the Subscribe streams of feedpb.FeedServer
+type grpcFeedServer struct {
+	feedpb.UnimplementedFeedServer
+	server *WSBroadcastServer
+}
+
+func (f *grpcFeedServer) Subscribe(stream feedpb.Feed_SubscribeServer) error {
+	f.server.grpcStreams.Add(1)
+	defer f.server.grpcStreams.Done()
+	return f.server.serveGRPC(stream)
+}
+
+// grpcTLSConfigForClient is configForClient negotiating HTTP/2
+func (s *WSBroadcastServer) grpcTLSConfigForClient(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+	config, err := s.certReloader.configForClient(hello)
+	if err != nil {
+		return nil, err
+	}
+	config.NextProtos = []string{"h2"}
+	return config, nil
+}
+
+// GRPCListenerAddr returns the address gRPC feed clients connect to, nil if
+// the feed isn't served over gRPC
+func (s *WSBroadcastServer) GRPCListenerAddr() net.Addr {
+	if s.grpcListener == nil {
+		return nil
+	}
+	return s.grpcListener.Addr()
+}
+
+// serveGRPC bridges a Subscribe stream to a loopback websocket connection
+func (s *WSBroadcastServer) serveGRPC(stream feedpb.Feed_SubscribeServer) error {
+	ctx := stream.Context()
+	config := s.config()
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	var peerIP net.IP
+	if p, ok := peer.FromContext(ctx); ok {
+		if addr, ok := p.Addr.(*net.TCPAddr); ok {
+			peerIP = addr.IP
+		}
+	}
+	var cfConnectingIP string
+	if values := md.Get(HTTPHeaderCloudflareConnectingIP); len(values) > 0 {
+		cfConnectingIP = values[0]
+	}
+	connectingIP := config.IPFilter.ClientIP(peerIP, cfConnectingIP, md.Get(HTTPHeaderForwardedFor))
+	if !config.IPFilter.Allowed(connectingIP) {
+		clientsFilteredCounter.Inc(1)
+		return status.Error(codes.PermissionDenied, "Feed not served to this address.")
+	}
+	header := http.Header{}
+	for key, values := range md {
+		// Only the feed's own headers are forwarded, not the HTTP/2 and
+		// gRPC ones or addresses set by the client
+		if key == "authorization" || strings.HasPrefix(key, "arbitrum-") {
+			for _, value := range values {
+				header.Add(textproto.CanonicalMIMEHeaderKey(key), value)
+			}
+		}
+	}
+	// The server sees the client's address on the loopback connection
+	var relayed net.Addr
+	if connectingIP != nil {
+		relayed = &net.TCPAddr{IP: connectingIP}
+	}
+
+	response := metadata.MD{}
+	dialer := ws.Dialer{
+		Header: ws.HandshakeHeaderHTTP(header),
+		OnHeader: func(key, value []byte) error {
+			name := strings.ToLower(string(key))
+			if strings.HasPrefix(name, "arbitrum-") {
+				response.Append(name, string(value))
+			}
+			return nil
+		},
+		Timeout: config.HandshakeTimeout,
+		NetDial: func(context.Context, string, string) (net.Conn, error) {
+			return s.dialLoopback(relayed)
+		},
+	}
+	conn, br, _, err := dialer.Dial(ctx, "ws://localhost/")
+	if err != nil {
+		return grpcHandshakeError(err)
+	}
+	defer conn.Close()
+	var earlyFrameData io.Reader
+	if br != nil {
+		earlyFrameData = io.LimitReader(br, int64(br.Buffered()))
+	}
+	if err := stream.SendHeader(response); err != nil {
+		return err
+	}
+	grpcStreamsCounter.Inc(1)
+
+	// Pongs and catchup requests are written by different threads, each
+	// frame with a single write
+	var writeMutex sync.Mutex
+	write := func(frame ws.Frame) error {
+		data, err := ws.CompileFrame(ws.MaskFrameInPlace(frame))
+		if err != nil {
+			return err
+		}
+		writeMutex.Lock()
+		defer writeMutex.Unlock()
+		if err := conn.SetWriteDeadline(time.Now().Add(config.WriteTimeout)); err != nil {
+			return err
+		}
+		_, err = conn.Write(data)
+		return err
+	}
+	// Receiving only ends with the stream, once the client went away or
+	// after Subscribe returned, so the thread is joined when the gRPC server
+	// stops instead
+	s.grpcStreams.Add(1)
+	go func() {
+		defer s.grpcStreams.Done()
+		// The server notices the closed connection once the client is gone
+		defer conn.Close()
+		for {
+			request, err := stream.Recv()
+			if err != nil {
+				return
+			}
+			data, err := json.Marshal(CatchupRequest{RequestedSequenceNumber: arbutil.MessageIndex(request.RequestedSequenceNumber)})
+			if err != nil {
+				log.Error("error encoding gRPC feed catchup request", "err", err)
+				return
+			}
+			if err := write(ws.NewTextFrame(data)); err != nil {
+				return
+			}
+		}
+	}()
+
+	reader := wsutil.Reader{
+		Source:    (&chainedReader{}).add(earlyFrameData).add(conn),
+		State:     ws.StateClientSide,
+		CheckUTF8: true,
+	}
+	for {
+		// The server pings more often than its client timeout
+		if err := conn.SetReadDeadline(time.Now().Add(s.config().ClientTimeout)); err != nil {
+			return status.Error(codes.Unavailable, err.Error())
+		}
+		frameHeader, err := reader.NextFrame()
+		if err != nil {
+			return grpcStreamError(ctx, err)
+		}
+		payload, err := io.ReadAll(&reader)
+		if err != nil {
+			return grpcStreamError(ctx, err)
+		}
+		var frame feedpb.Frame
+		switch frameHeader.OpCode {
+		case ws.OpText, ws.OpBinary:
+			frame.Data = payload
+		case ws.OpPing:
+			if err := write(ws.NewPongFrame(payload)); err != nil {
+				return grpcStreamError(ctx, err)
+			}
+		case ws.OpClose:
+			code, reason := ws.ParseCloseFrameData(payload)
+			return status.Error(codes.Unavailable, fmt.Sprintf("feed closed the connection with status %d: %s", code, reason))
+		default:
+			continue
+		}
+		if err := stream.Send(&frame); err != nil {
+			return err
+		}
+	}
+}
+
+// grpcHandshakeError translates the refusal of a websocket upgrade into the
+// status the gRPC stream ends with
+func grpcHandshakeError(err error) error {
+	var statusErr ws.StatusError
+	if !errors.As(err, &statusErr) {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	code := codes.Unavailable
+	switch int(statusErr) {
+	case http.StatusBadRequest:
+		code = codes.InvalidArgument
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusTooManyRequests:
+		code = codes.ResourceExhausted
+	}
+	return status.Error(code, http.StatusText(int(statusErr)))
+}
+
+// grpcStreamError is the status a stream ends with after the loopback
+// connection failed, nothing is reported if the client went away
+func grpcStreamError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return nil
+	}
+	return status.Error(codes.Unavailable, err.Error())
+}
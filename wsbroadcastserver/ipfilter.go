@@ -0,0 +1,171 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package wsbroadcastserver
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	clientsFilteredCounter = metrics.NewRegisteredCounter("arb/feed/clients/filtered", nil)
+)
+
+type IPFilterConfig struct {
+	Allow          []string `koanf:"allow" reload:"hot"`
+	Deny           []string `koanf:"deny" reload:"hot"`
+	TrustedProxies []string `koanf:"trusted-proxies" reload:"hot"`
+
+	// Parsed by Validate, also when the config is hot reloaded
+	allow          []*net.IPNet
+	deny           []*net.IPNet
+	trustedProxies []*net.IPNet
+}
+
+var DefaultIPFilterConfig = IPFilterConfig{
+	Allow:          []string{},
+	Deny:           []string{},
+	TrustedProxies: []string{},
+}
+
+func IPFilterConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.StringSlice(prefix+".allow", DefaultIPFilterConfig.Allow, "only serve clients with addresses in these CIDRs or IPs (empty = all clients not denied)")
+	f.StringSlice(prefix+".deny", DefaultIPFilterConfig.Deny, "don't serve clients with addresses in these CIDRs or IPs, takes precedence over allow")
+	f.StringSlice(prefix+".trusted-proxies", DefaultIPFilterConfig.TrustedProxies, "CIDRs or IPs of load balancers whose X-Forwarded-For and CF-Connecting-IP headers are trusted to carry the client address, if this or a filter is set the headers of other peers are ignored")
+}
+
+func (c *IPFilterConfig) Validate() error {
+	var err error
+	if c.allow, err = parseCIDRs(c.Allow); err != nil {
+		return fmt.Errorf("invalid feed ip-filter allow list: %w", err)
+	}
+	if c.deny, err = parseCIDRs(c.Deny); err != nil {
+		return fmt.Errorf("invalid feed ip-filter deny list: %w", err)
+	}
+	if c.trustedProxies, err = parseCIDRs(c.TrustedProxies); err != nil {
+		return fmt.Errorf("invalid feed ip-filter trusted proxies: %w", err)
+	}
+	return nil
+}
+
+// parseCIDRs parses CIDRs, taking plain IPs as a network of just that address
+func parseCIDRs(values []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if ip := net.ParseIP(value); ip != nil {
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR or IP %q", value)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// matchCIDRs returns whether ip is in one of the networks
+func matchCIDRs(nets []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *IPFilterConfig) filters() bool {
+	return len(c.allow) > 0 || len(c.deny) > 0
+}
+
+// Allowed returns whether a client with address ip may be served, by the
+// lists parsed when the config was validated
+func (c *IPFilterConfig) Allowed(ip net.IP) bool {
+	if matchCIDRs(c.deny, ip) {
+		return false
+	}
+	return len(c.allow) == 0 || matchCIDRs(c.allow, ip)
+}
+
+// ClientIP returns the address of the client behind peer. The forwarding
+// headers are used if peer is a trusted proxy, then the last address in
+// X-Forwarded-For that isn't a trusted proxy itself is the client. Without
+// trusted proxies or filters CF-Connecting-IP is trusted from any peer, as
+// before filtering was supported.
+func (c *IPFilterConfig) ClientIP(peer net.IP, cfConnectingIP string, forwardedFor []string) net.IP {
+	if matchCIDRs(c.trustedProxies, peer) {
+		var hops []string
+		for _, value := range forwardedFor {
+			hops = append(hops, strings.Split(value, ",")...)
+		}
+		var client net.IP
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				break
+			}
+			client = ip
+			if !matchCIDRs(c.trustedProxies, ip) {
+				break
+			}
+		}
+		if client != nil {
+			return client
+		}
+		if ip := net.ParseIP(cfConnectingIP); ip != nil {
+			return ip
+		}
+	} else if len(c.trustedProxies) == 0 && !c.filters() {
+		if ip := net.ParseIP(cfConnectingIP); ip != nil {
+			return ip
+		}
+	}
+	return peer
+}
+
+// remoteIP returns the address of the peer of conn, nil if it has none. Unix
+// socket and loopback connections are from this host, except the ones the
+// server relays other clients over, see relayedConn, which have the address
+// of the client.
+func remoteIP(conn net.Conn) net.IP {
+	switch addr := conn.RemoteAddr().(type) {
+	case *net.TCPAddr:
+		return addr.IP
+	case *net.UDPAddr:
+		return addr.IP
+	}
+	if _, ok := conn.LocalAddr().(*net.UnixAddr); ok {
+		return net.IPv4(127, 0, 0, 1)
+	}
+	return nil
+}
+
+// allowPeer closes TCP connections from peers that are filtered and can't
+// forward for other clients before anything is read from them
+func (s *WSBroadcastServer) allowPeer(conn net.Conn) bool {
+	config := &s.config().IPFilter
+	addr, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok || !config.filters() || matchCIDRs(config.trustedProxies, addr.IP) || config.Allowed(addr.IP) {
+		return true
+	}
+	log.Debug("feed client filtered", "remoteAddr", conn.RemoteAddr())
+	clientsFilteredCounter.Inc(1)
+	_ = conn.Close()
+	return false
+}
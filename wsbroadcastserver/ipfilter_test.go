@@ -0,0 +1,98 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package wsbroadcastserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/gobwas/ws"
+)
+
+func TestIPFilter(t *testing.T) {
+	config := IPFilterConfig{
+		Allow:          []string{"10.0.0.0/8", "2001:db8::/32"},
+		Deny:           []string{"10.0.0.66"},
+		TrustedProxies: []string{"192.168.0.0/16"},
+	}
+	Require(t, config.Validate())
+
+	Expect(t, config.Allowed(net.ParseIP("10.1.2.3")))
+	Expect(t, config.Allowed(net.ParseIP("2001:db8::1")))
+	Expect(t, !config.Allowed(net.ParseIP("10.0.0.66")))
+	Expect(t, !config.Allowed(net.ParseIP("11.0.0.1")))
+	Expect(t, !config.Allowed(nil))
+
+	proxy := net.ParseIP("192.168.1.1")
+	client := config.ClientIP(proxy, "", []string{"10.9.9.9, 10.1.2.3", "192.168.7.7"})
+	Expect(t, client.Equal(net.ParseIP("10.1.2.3")), "client behind proxies", client)
+	client = config.ClientIP(proxy, "10.4.4.4", nil)
+	Expect(t, client.Equal(net.ParseIP("10.4.4.4")), "client from CF-Connecting-IP", client)
+	client = config.ClientIP(proxy, "", nil)
+	Expect(t, client.Equal(proxy), "proxy without forwarding headers", client)
+
+	// Headers of untrusted peers are ignored
+	peer := net.ParseIP("11.0.0.1")
+	client = config.ClientIP(peer, "10.4.4.4", []string{"10.1.2.3"})
+	Expect(t, client.Equal(peer), "untrusted peer", client)
+
+	// Without trusted proxies or filters CF-Connecting-IP is trusted
+	client = (&DefaultIPFilterConfig).ClientIP(peer, "10.4.4.4", []string{"10.1.2.3"})
+	Expect(t, client.Equal(net.ParseIP("10.4.4.4")), "legacy CF-Connecting-IP", client)
+
+	// The lists are parsed again when a reloaded config is validated
+	config.Deny = []string{"10.1.0.0/16"}
+	Require(t, config.Validate())
+	Expect(t, config.Allowed(net.ParseIP("10.0.0.66")))
+	Expect(t, !config.Allowed(net.ParseIP("10.1.2.3")))
+
+	for _, invalid := range []IPFilterConfig{
+		{Allow: []string{"not an address"}},
+		{Deny: []string{"10.0.0.0/33"}},
+		{TrustedProxies: []string{"192.168.0.0/16", ""}},
+	} {
+		Expect(t, invalid.Validate() != nil, "invalid filter", invalid, "accepted")
+	}
+}
+
+func TestLoopbackClientIP(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	config := DefaultTestBroadcasterConfig
+	config.IPFilter.Allow = []string{"10.0.0.0/8"}
+	Require(t, config.Validate())
+	server := NewWSBroadcastServer(func() *BroadcasterConfig { return &config }, nil, 8742, make(chan error, 10))
+	Require(t, server.Initialize())
+	Require(t, server.Start(ctx))
+	defer server.StopAndWait()
+
+	expectFiltered := func(dialer ws.Dialer, client string) {
+		t.Helper()
+		conn, _, _, err := dialer.Dial(ctx, "ws://localhost/")
+		if err == nil {
+			_ = conn.Close()
+		}
+		var statusErr ws.StatusError
+		Expect(t, errors.As(err, &statusErr) && int(statusErr) == http.StatusForbidden, client, "not filtered, err", err)
+	}
+
+	// Loopback clients are on this host, whatever address they send
+	dialer := ws.Dialer{
+		Header:  ws.HandshakeHeaderHTTP(http.Header{HTTPHeaderCloudflareConnectingIP: []string{"10.1.2.3"}}),
+		NetDial: server.DialLoopback,
+	}
+	expectFiltered(dialer, "loopback client")
+
+	// Clients the server relays have their own address
+	relayed := &net.TCPAddr{IP: net.ParseIP("11.0.0.1")}
+	dialer.NetDial = func(context.Context, string, string) (net.Conn, error) {
+		return server.dialLoopback(relayed)
+	}
+	expectFiltered(dialer, "relayed client")
+	Expect(t, remoteIP(relayedConn{remote: relayed}).Equal(relayed.IP), "relayed client address")
+}
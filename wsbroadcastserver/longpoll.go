@@ -0,0 +1,153 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package wsbroadcastserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/mailru/easygo/netpoll"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/offchainlabs/nitro/arbutil"
+)
+
+const (
+	// MessagesPath is polled for the feed by clients that can't keep a
+	// connection open. A GET answers with the JSON messages after the sequence
+	// number in the AfterQueryParameter, one per line, waiting up to the
+	// duration in the WaitQueryParameter for new ones if there are none yet.
+	MessagesPath = "/messages"
+
+	AfterQueryParameter = "after"
+	WaitQueryParameter  = "wait"
+)
+
+var clientsLongPollCounter = metrics.NewRegisteredCounter("arb/feed/clients/long-poll", nil)
+
+// encodeLine encodes a broadcast message as a line of JSON, as sent to
+// long-poll clients and in the other JSON encodings
+func encodeLine(bm interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(bm); err != nil {
+		return nil, fmt.Errorf("unable to encode message: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// parseWait parses the time a poll may wait for new messages, as a duration
+// or a number of seconds
+func parseWait(value string) (time.Duration, error) {
+	if seconds, err := strconv.ParseUint(value, 10, 32); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// serveLongPoll answers a poll of MessagesPath, registering the connection as
+// a client until the response is sent
+func (s *WSBroadcastServer) serveLongPoll(conn net.Conn, request io.Reader, header ws.HandshakeHeader) {
+	config := s.config()
+	req, connectingIP, identity, ok := s.readFeedRequest(conn, request)
+	if !ok {
+		return
+	}
+	query := req.URL.Query()
+	// Without a sequence number the client gets all cached messages
+	var requestedSeqNum arbutil.MessageIndex
+	if value := query.Get(AfterQueryParameter); value != "" {
+		after, ok := parseSeqNum(conn, value)
+		if !ok {
+			return
+		}
+		requestedSeqNum = after + 1
+	}
+	var wait time.Duration
+	if value := query.Get(WaitQueryParameter); value != "" {
+		var err error
+		wait, err = parseWait(value)
+		if err != nil || wait < 0 {
+			writeHTTPError(conn, http.StatusBadRequest, fmt.Sprintf("Malformed query parameter %s", WaitQueryParameter))
+			return
+		}
+	}
+	if wait > config.LongPollMaxWait {
+		wait = config.LongPollMaxWait
+	}
+
+	var responseHeader bytes.Buffer
+	responseHeader.WriteString("HTTP/1.1 200 OK\r\nContent-Type: application/x-ndjson\r\nCache-Control: no-cache\r\nConnection: close\r\n")
+	if header != nil {
+		if _, err := header.WriteTo(&responseHeader); err != nil {
+			log.Warn("error writing long poll response header", "err", err)
+			_ = conn.Close()
+			return
+		}
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		log.Warn("error unsetting long poll deadline", "connectingIP", connectingIP, "err", err)
+		_ = conn.Close()
+		return
+	}
+
+	desc, err := netpoll.HandleRead(pollable(conn))
+	if err != nil {
+		log.Warn("error in HandleRead", "connectingIP", connectingIP, "err", err)
+		_ = conn.Close()
+		return
+	}
+	clientsLongPollCounter.Inc(1)
+	client := s.clientManager.RegisterLongPoll(writeDeadliner{conn, config.WriteTimeout}, desc, requestedSeqNum, connectingIP, SanitizeClientId(req.Header.Get(HTTPHeaderFeedClientId)), identity, wait, responseHeader.Bytes())
+	s.startHTTPClient(client)
+}
+
+// answerPoll collects the messages for a long-poll client, waiting up to the
+// requested time if registering it sent none, and sends them as the response
+func (cc *ClientConnection) answerPoll(ctx context.Context) {
+	var body bytes.Buffer
+	drain := func() {
+		for {
+			select {
+			case data := <-cc.out:
+				cc.dequeued(1)
+				body.Write(data)
+			default:
+				return
+			}
+		}
+	}
+	drain()
+	if !cc.pollReady && cc.pollWait > 0 {
+		timer := time.NewTimer(cc.pollWait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case data := <-cc.out:
+			cc.dequeued(1)
+			timer.Stop()
+			body.Write(data)
+			drain()
+		case <-timer.C:
+		}
+	}
+	response := make([]byte, 0, len(cc.pollHeader)+body.Len()+64)
+	response = append(response, cc.pollHeader...)
+	response = append(response, fmt.Sprintf("Content-Length: %d\r\n\r\n", body.Len())...)
+	response = append(response, body.Bytes()...)
+	if err := cc.writeRaw(response); err != nil {
+		logWarn(err, "error answering long poll")
+	}
+	cc.clientManager.Remove(cc)
+}
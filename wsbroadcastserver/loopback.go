@@ -0,0 +1,76 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package wsbroadcastserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+// DialLoopback connects to the server within the process through a socket
+// pair instead of over the network, e.g. so tests of the feed don't depend on
+// TCP. It has the signature of a dial function, network and addr are ignored.
+// The connection is served like any other, so the server must be started.
+func (s *WSBroadcastServer) DialLoopback(_ context.Context, _, _ string) (net.Conn, error) {
+	return s.dialLoopback(nil)
+}
+
+// dialLoopback connects to the server within the process, the server sees
+// remote as the address of the client if set
+func (s *WSBroadcastServer) dialLoopback(remote net.Addr) (net.Conn, error) {
+	s.startMutex.Lock()
+	handle := s.handle
+	s.startMutex.Unlock()
+	if handle == nil {
+		return nil, errors.New("broadcast server not started")
+	}
+	// The server needs a file descriptor to poll, so net.Pipe won't do
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error creating loopback socket pair: %w", err)
+	}
+	serverConn, err := fileConn(fds[0], "loopback-server")
+	if err != nil {
+		_ = syscall.Close(fds[1])
+		return nil, err
+	}
+	clientConn, err := fileConn(fds[1], "loopback-client")
+	if err != nil {
+		_ = serverConn.Close()
+		return nil, err
+	}
+	var served net.Conn = serverConn
+	if remote != nil {
+		served = relayedConn{serverConn, remote}
+	}
+	s.clientManager.pool.Schedule(func() { handle(served) })
+	return clientConn, nil
+}
+
+// relayedConn is the server side of a loopback connection that relays a
+// client connected some other way, over gRPC or WebTransport
+type relayedConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+func (c relayedConn) RemoteAddr() net.Addr { return c.remote }
+
+// NetConn returns the socket to poll
+func (c relayedConn) NetConn() net.Conn { return c.Conn }
+
+// fileConn wraps one end of a socket pair, taking ownership of fd
+func fileConn(fd int, name string) (net.Conn, error) {
+	file := os.NewFile(uintptr(fd), name)
+	defer file.Close()
+	conn, err := net.FileConn(file)
+	if err != nil {
+		return nil, fmt.Errorf("error wrapping loopback socket: %w", err)
+	}
+	return conn, nil
+}
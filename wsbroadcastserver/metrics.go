@@ -0,0 +1,34 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package wsbroadcastserver
+
+import (
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// Metrics of the feed as a whole, the metrics of single features are next to
+// them. Disconnects are counted by reason under arb/feed/clients/disconnect,
+// evictions by policy under arb/feed/clients/slow and arb/feed/clients/evicted.
+var (
+	broadcastMessagesCounter  = metrics.NewRegisteredCounter("arb/feed/broadcast/messages", nil)
+	broadcastLatencyHistogram = metrics.NewRegisteredHistogram("arb/feed/broadcast/latency", nil, metrics.NewBoundedHistogramSample())
+	bytesSentCounter          = metrics.NewRegisteredCounter("arb/feed/bytes/sent", nil)
+	bytesSentMeter            = metrics.NewRegisteredMeter("arb/feed/bytes/sent/rate", nil)
+	clientsLagHistogram       = metrics.NewRegisteredHistogram("arb/feed/clients/lag", nil, metrics.NewBoundedHistogramSample())
+	clientsQueueHistogram     = metrics.NewRegisteredHistogram("arb/feed/clients/queue", nil, metrics.NewBoundedHistogramSample())
+
+	clientsDisconnectTimeoutCounter     = metrics.NewRegisteredCounter("arb/feed/clients/disconnect/timeout", nil)
+	clientsDisconnectPingCounter        = metrics.NewRegisteredCounter("arb/feed/clients/disconnect/ping", nil)
+	clientsDisconnectWriteCounter       = metrics.NewRegisteredCounter("arb/feed/clients/disconnect/write", nil)
+	clientsDisconnectCompressionCounter = metrics.NewRegisteredCounter("arb/feed/clients/disconnect/compression", nil)
+	clientsDisconnectCatchupCounter     = metrics.NewRegisteredCounter("arb/feed/clients/disconnect/catchup", nil)
+)
+
+// sent accounts for n bytes written to a client
+func sent(n int64) {
+	if n > 0 {
+		bytesSentCounter.Inc(n)
+		bytesSentMeter.Mark(n)
+	}
+}
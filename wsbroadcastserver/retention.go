@@ -0,0 +1,36 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package wsbroadcastserver
+
+import (
+	"errors"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+type CatchupRetentionConfig struct {
+	MaxMessages int           `koanf:"max-messages" reload:"hot"`
+	MaxBytes    int           `koanf:"max-bytes" reload:"hot"`
+	MaxAge      time.Duration `koanf:"max-age" reload:"hot"`
+}
+
+var DefaultCatchupRetentionConfig = CatchupRetentionConfig{
+	MaxMessages: 0,
+	MaxBytes:    0,
+	MaxAge:      0,
+}
+
+func CatchupRetentionConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Int(prefix+".max-messages", DefaultCatchupRetentionConfig.MaxMessages, "maximum number of unconfirmed messages kept to catch up clients, the oldest are evicted first (0 = unlimited)")
+	f.Int(prefix+".max-bytes", DefaultCatchupRetentionConfig.MaxBytes, "approximate maximum size in bytes of the unconfirmed messages kept to catch up clients (0 = unlimited)")
+	f.Duration(prefix+".max-age", DefaultCatchupRetentionConfig.MaxAge, "maximum time since they were first broadcast unconfirmed messages are kept to catch up clients, checked on every broadcast (0 = unlimited)")
+}
+
+func (c *CatchupRetentionConfig) Validate() error {
+	if c.MaxMessages < 0 || c.MaxBytes < 0 || c.MaxAge < 0 {
+		return errors.New("catchup-retention limits must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package wsbroadcastserver
+
+import (
+	"encoding"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+var (
+	messagesSerializedCounter = metrics.NewRegisteredCounter("arb/feed/serialized", nil)
+)
+
+// feedEncoding is the format a client negotiated to receive messages in, the
+// websocket ones through the subprotocol and the deflate extension
+type feedEncoding int
+
+const (
+	encodingJSON feedEncoding = iota
+	encodingJSONCompressed
+	encodingBinary
+	encodingBinaryCompressed
+	encodingEventStream
+	encodingLongPoll
+	encodingCount
+)
+
+func (e feedEncoding) String() string {
+	switch e {
+	case encodingJSON:
+		return "json"
+	case encodingJSONCompressed:
+		return "json-deflate"
+	case encodingBinary:
+		return "binary"
+	case encodingBinaryCompressed:
+		return "binary-deflate"
+	case encodingEventStream:
+		return "event-stream"
+	case encodingLongPoll:
+		return "long-poll"
+	default:
+		return fmt.Sprintf("encoding %d", int(e))
+	}
+}
+
+func (cc *ClientConnection) encoding() feedEncoding {
+	switch {
+	case cc.eventStream:
+		return encodingEventStream
+	case cc.LongPoll():
+		return encodingLongPoll
+	case cc.binary && cc.compression:
+		return encodingBinaryCompressed
+	case cc.binary:
+		return encodingBinary
+	case cc.compression:
+		return encodingJSONCompressed
+	default:
+		return encodingJSON
+	}
+}
+
+// serializedMessage holds a message serialized in the encodings of the
+// clients it is sent to. The message is encoded as JSON or binary once, and
+// each encoding is built from that when first needed. The bytes are shared by
+// all clients using an encoding, so they must not be modified.
+type serializedMessage struct {
+	cm       *ClientManager
+	bm       interface{}
+	payloads [2]encodedPayload
+	variants [encodingCount][]byte
+}
+
+// encodedPayload is the message encoded as JSON or binary, or why it can't be
+type encodedPayload struct {
+	done bool
+	data []byte
+	err  error
+}
+
+func newSerializedMessage(cm *ClientManager, bm interface{}) *serializedMessage {
+	return &serializedMessage{cm: cm, bm: bm}
+}
+
+// payload returns the message encoded as a JSON line, or binary if set
+func (m *serializedMessage) payload(binary bool) ([]byte, error) {
+	payload := &m.payloads[0]
+	if binary {
+		payload = &m.payloads[1]
+	}
+	if payload.done {
+		return payload.data, payload.err
+	}
+	payload.done = true
+	if !binary {
+		payload.data, payload.err = encodeLine(m.bm)
+		return payload.data, payload.err
+	}
+	marshaler, ok := m.bm.(encoding.BinaryMarshaler)
+	if !ok {
+		payload.err = fmt.Errorf("message of type %T has no binary encoding", m.bm)
+		return nil, payload.err
+	}
+	payload.data, payload.err = marshaler.MarshalBinary()
+	if payload.err != nil {
+		payload.err = fmt.Errorf("unable to encode message: %w", payload.err)
+	}
+	return payload.data, payload.err
+}
+
+func (m *serializedMessage) bytes(encoding feedEncoding) ([]byte, error) {
+	if data := m.variants[encoding]; data != nil {
+		return data, nil
+	}
+	binary := encoding == encodingBinary || encoding == encodingBinaryCompressed
+	payload, err := m.payload(binary)
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	switch encoding {
+	case encodingEventStream:
+		data = encodeEvent(payload)
+	case encodingLongPoll:
+		data = payload
+	default:
+		compressed := encoding == encodingJSONCompressed || encoding == encodingBinaryCompressed
+		notCompressedData, compressedData, err := serializeMessage(m.cm, payload, !compressed, compressed, binary)
+		if err != nil {
+			return nil, err
+		}
+		data = notCompressedData.Bytes()
+		if compressed {
+			data = compressedData.Bytes()
+		}
+	}
+	messagesSerializedCounter.Inc(1)
+	m.variants[encoding] = data
+	return data, nil
+}
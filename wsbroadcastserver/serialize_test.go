@@ -0,0 +1,107 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package wsbroadcastserver
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/gobwas/ws"
+
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// countMetric replaces *metric with counting until the test ends. Metrics
+// are global, so tests using it must not run in parallel.
+func countMetric[T any](t *testing.T, metric *T, counting T) T {
+	t.Helper()
+	previous := *metric
+	*metric = counting
+	t.Cleanup(func() { *metric = previous })
+	return counting
+}
+
+// countedMessage counts how often it is encoded
+type countedMessage struct {
+	SequenceNumber uint64 `json:"sequenceNumber"`
+	jsonEncodings  *int
+	binaryErr      error
+}
+
+func (m countedMessage) MarshalJSON() ([]byte, error) {
+	*m.jsonEncodings++
+	return []byte(`{"sequenceNumber":7}`), nil
+}
+
+func (m countedMessage) MarshalBinary() ([]byte, error) {
+	if m.binaryErr != nil {
+		return nil, m.binaryErr
+	}
+	return []byte{7}, nil
+}
+
+func TestSerializedMessageShared(t *testing.T) {
+	serializations := countMetric[metrics.Counter](t, &messagesSerializedCounter, &metrics.StandardCounter{})
+	config := DefaultTestBroadcasterConfig
+	cm := &ClientManager{config: func() *BroadcasterConfig { return &config }}
+	clients := []*ClientConnection{
+		{},
+		{compression: true},
+		{eventStream: true},
+		{pollHeader: []byte{}},
+		{},
+	}
+	var jsonEncodings int
+	serialized := newSerializedMessage(cm, countedMessage{jsonEncodings: &jsonEncodings})
+	var sent [][]byte
+	for _, client := range clients {
+		data, err := serialized.bytes(client.encoding())
+		Require(t, err)
+		sent = append(sent, data)
+	}
+	if serializations.Count() != 4 {
+		t.Fatalf("expected 4 serializations, got %d", serializations.Count())
+	}
+	Expect(t, jsonEncodings == 1, "message encoded as JSON", jsonEncodings, "times")
+	Expect(t, &sent[0][0] == &sent[4][0], "clients with the same encoding not sent the same bytes")
+	Expect(t, bytes.Equal(sent[2], []byte("data: {\"sequenceNumber\":7}\n\n")), "unexpected event", string(sent[2]))
+	Expect(t, bytes.Equal(sent[3], []byte("{\"sequenceNumber\":7}\n")), "unexpected line", string(sent[3]))
+
+	// The websocket frames carry the same JSON line, deflated or not
+	frame, err := ws.ReadFrame(bytes.NewReader(sent[0]))
+	Require(t, err)
+	Expect(t, bytes.Equal(frame.Payload, sent[3]), "unexpected frame payload", string(frame.Payload))
+	frame, err = ws.ReadFrame(bytes.NewReader(sent[1]))
+	Require(t, err)
+	Expect(t, frame.Header.Rsv1(), "compressed frame not marked compressed")
+	inflated, err := io.ReadAll(flate.NewReaderDict(io.MultiReader(bytes.NewReader(frame.Payload), bytes.NewReader([]byte{0, 0, 0xff, 0xff, 1, 0, 0, 0xff, 0xff})), GetStaticCompressorDictionary()))
+	Require(t, err)
+	Expect(t, bytes.Equal(inflated, sent[3]), "unexpected inflated payload", string(inflated))
+}
+
+func TestBroadcastDisconnectsFailedEncodings(t *testing.T) {
+	config := DefaultTestBroadcasterConfig
+	cm := &ClientManager{
+		config:        func() *BroadcasterConfig { return &config },
+		catchupBuffer: emptyCatchupBuffer{},
+		clientPtrMap:  make(map[*ClientConnection]bool),
+	}
+	jsonClient := &ClientConnection{out: make(chan []byte, 1)}
+	binaryClient := &ClientConnection{out: make(chan []byte, 1), binary: true}
+	cm.clientPtrMap[jsonClient] = true
+	cm.clientPtrMap[binaryClient] = true
+
+	var jsonEncodings int
+	deleteList, err := cm.doBroadcast(countedMessage{jsonEncodings: &jsonEncodings, binaryErr: errors.New("no binary encoding")})
+	Require(t, err)
+	Expect(t, len(deleteList) == 1 && deleteList[0] == binaryClient, "binary client not disconnected", len(deleteList))
+	Expect(t, jsonClient.QueueDepth() == 1, "message not sent to the json client")
+	Expect(t, binaryClient.QueueDepth() == 0, "message sent to the binary client")
+	frame, err := ws.ReadFrame(bytes.NewReader(<-jsonClient.out))
+	Require(t, err)
+	Expect(t, bytes.Equal(frame.Payload, []byte("{\"sequenceNumber\":7}\n")), "unexpected message", string(frame.Payload))
+}
@@ -0,0 +1,48 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package wsbroadcastserver
+
+import (
+	"errors"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+type SharedCatchupConfig struct {
+	RedisURL    string        `koanf:"redis-url"`
+	Key         string        `koanf:"key"`
+	MaxMessages int           `koanf:"max-messages"`
+	Timeout     time.Duration `koanf:"timeout"`
+}
+
+var DefaultSharedCatchupConfig = SharedCatchupConfig{
+	RedisURL:    "",
+	Key:         "feed.catchup",
+	MaxMessages: 100_000,
+	Timeout:     time.Second,
+}
+
+func SharedCatchupConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.String(prefix+".redis-url", DefaultSharedCatchupConfig.RedisURL, "url of a redis server relays behind the same load balancer share their catchup messages in, so clients resume the same whichever relay they reconnect to (empty = not shared)")
+	f.String(prefix+".key", DefaultSharedCatchupConfig.Key, "redis key of the shared catchup messages, relays of different feeds must use different keys")
+	f.Int(prefix+".max-messages", DefaultSharedCatchupConfig.MaxMessages, "maximum number of unconfirmed messages kept in redis, the oldest are removed first (0 = unlimited)")
+	f.Duration(prefix+".timeout", DefaultSharedCatchupConfig.Timeout, "timeout of redis requests")
+}
+
+func (c *SharedCatchupConfig) Validate() error {
+	if c.RedisURL == "" {
+		return nil
+	}
+	if c.Key == "" {
+		return errors.New("shared-catchup needs a key")
+	}
+	if c.MaxMessages < 0 {
+		return errors.New("shared-catchup max-messages must not be negative")
+	}
+	if c.Timeout <= 0 {
+		return errors.New("shared-catchup timeout must be positive")
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package wsbroadcastserver
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	clientsSlowEvictedCounter = metrics.NewRegisteredCounter("arb/feed/clients/slow/evicted", nil)
+	clientsSlowDroppedCounter = metrics.NewRegisteredCounter("arb/feed/clients/slow/dropped", nil)
+	clientsQueueDepthGauge    = metrics.NewRegisteredGauge("arb/feed/clients/queue/max", nil)
+	clientsLagGauge           = metrics.NewRegisteredGauge("arb/feed/clients/lag/max", nil)
+)
+
+const (
+	// SlowClientDisconnect disconnects slow clients, they reconnect and catch
+	// up from the catchup buffer
+	SlowClientDisconnect = "disconnect"
+	// SlowClientDropOldest drops the oldest messages queued for slow clients.
+	// Clients are never sent messages past the gap, they are disconnected
+	// when reaching it and catch up from the catchup buffer after
+	// reconnecting.
+	SlowClientDropOldest = "drop-oldest"
+)
+
+type SlowClientConfig struct {
+	Policy   string        `koanf:"policy" reload:"hot"`
+	MaxQueue int           `koanf:"max-queue" reload:"hot"`
+	MaxLag   time.Duration `koanf:"max-lag" reload:"hot"`
+}
+
+var DefaultSlowClientConfig = SlowClientConfig{
+	Policy:   SlowClientDisconnect,
+	MaxQueue: 0,
+	MaxLag:   0,
+}
+
+func SlowClientConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.String(prefix+".policy", DefaultSlowClientConfig.Policy, "what to do with clients falling behind, \""+SlowClientDisconnect+"\" them or \""+SlowClientDropOldest+"\" of the messages queued for them, disconnecting them once they reach the gap (requires max-send-queue)")
+	f.Int(prefix+".max-queue", DefaultSlowClientConfig.MaxQueue, "number of messages queued for a client above which it is slow (0 = only once max-send-queue is full)")
+	f.Duration(prefix+".max-lag", DefaultSlowClientConfig.MaxLag, "how long a message may wait in the queue of a client before the client is slow (0 = unlimited)")
+}
+
+func (c *SlowClientConfig) Validate() error {
+	if c.Policy != SlowClientDisconnect && c.Policy != SlowClientDropOldest {
+		return fmt.Errorf("invalid slow client policy %q, must be %q or %q", c.Policy, SlowClientDisconnect, SlowClientDropOldest)
+	}
+	if c.MaxQueue < 0 {
+		return fmt.Errorf("slow client max-queue must not be negative")
+	}
+	return nil
+}
+
+// enqueue queues data to be written to the client, returning false if the
+// queue is full
+func (cc *ClientConnection) enqueue(data []byte) bool {
+	cc.queueMutex.Lock()
+	defer cc.queueMutex.Unlock()
+	// Recorded before sending, so whoever takes data from the queue finds
+	// its time when calling dequeued
+	cc.enqueuedUnixNano = append(cc.enqueuedUnixNano, time.Now().UnixNano())
+	select {
+	case cc.out <- data:
+		return true
+	default:
+		cc.enqueuedUnixNano = cc.enqueuedUnixNano[:len(cc.enqueuedUnixNano)-1]
+		return false
+	}
+}
+
+// dequeued must be called after taking n messages from the queue
+func (cc *ClientConnection) dequeued(n int) {
+	cc.queueMutex.Lock()
+	defer cc.queueMutex.Unlock()
+	if n > len(cc.enqueuedUnixNano) {
+		n = len(cc.enqueuedUnixNano)
+	}
+	cc.enqueuedUnixNano = cc.enqueuedUnixNano[n:]
+}
+
+// QueueDepth returns the number of messages queued for the client
+func (cc *ClientConnection) QueueDepth() int {
+	return len(cc.out)
+}
+
+// Lag returns how long the oldest message queued for the client has waited
+func (cc *ClientConnection) Lag() time.Duration {
+	cc.queueMutex.Lock()
+	defer cc.queueMutex.Unlock()
+	if len(cc.enqueuedUnixNano) == 0 {
+		return 0
+	}
+	return time.Since(time.Unix(0, cc.enqueuedUnixNano[0]))
+}
+
+func (c *SlowClientConfig) slow(cc *ClientConnection) bool {
+	return (c.MaxQueue > 0 && cc.QueueDepth() > c.MaxQueue) || (c.MaxLag > 0 && cc.Lag() > c.MaxLag)
+}
+
+// dropQueued drops the oldest message queued for the client, returning false
+// if the queue was empty. The client is disconnected once its writer reaches
+// the gap, see reachedGap.
+func (cc *ClientConnection) dropQueued() bool {
+	select {
+	case <-cc.out:
+		cc.dequeued(1)
+		atomic.StoreInt32(&cc.gapped, 1)
+		clientsSlowDroppedCounter.Inc(1)
+		return true
+	default:
+		return false
+	}
+}
+
+// reachedGap returns true if messages queued for the client were dropped,
+// nothing taken from the queue after that may be written to it
+func (cc *ClientConnection) reachedGap() bool {
+	if atomic.LoadInt32(&cc.gapped) == 0 {
+		return false
+	}
+	log.Debug("disconnecting client because messages queued for it were dropped", "client", cc.Name)
+	clientsSlowEvictedCounter.Inc(1)
+	return true
+}
+
+// dropOldest drops the oldest messages queued for the client until it isn't
+// slow anymore, for lag until the oldest one left was queued within max-lag
+func (c *SlowClientConfig) dropOldest(cc *ClientConnection) {
+	for c.slow(cc) {
+		if !cc.dropQueued() {
+			return
+		}
+	}
+}
+
+// send queues data for a client according to the slow client policy,
+// returning false if the client has to be disconnected. Long-poll clients are
+// answered with all queued messages, so they are never dropped from.
+func (cm *ClientManager) send(client *ClientConnection, data []byte) bool {
+	config := &cm.config().SlowClients
+	if client.LongPoll() {
+		return client.enqueue(data)
+	}
+	if config.slow(client) {
+		if config.Policy != SlowClientDropOldest {
+			clientsSlowEvictedCounter.Inc(1)
+			return false
+		}
+		config.dropOldest(client)
+	}
+	if client.enqueue(data) {
+		return true
+	}
+	// Make room once, if the queue fills again before data is queued the
+	// client is evicted
+	if config.Policy != SlowClientDropOldest || !client.dropQueued() || !client.enqueue(data) {
+		clientsSlowEvictedCounter.Inc(1)
+		return false
+	}
+	return true
+}
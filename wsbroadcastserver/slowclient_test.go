@@ -0,0 +1,75 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package wsbroadcastserver
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSlowClientPolicy(t *testing.T) {
+	config := DefaultTestBroadcasterConfig
+	config.SlowClients = SlowClientConfig{Policy: SlowClientDisconnect, MaxQueue: 2}
+	Require(t, config.Validate())
+	cm := &ClientManager{config: func() *BroadcasterConfig { return &config }}
+	cc := &ClientConnection{clientManager: cm, out: make(chan []byte, 4)}
+
+	for i := 0; i < 3; i++ {
+		Expect(t, cm.send(cc, []byte{byte(i)}), "message", i)
+	}
+	Expect(t, !cm.send(cc, []byte{3}), "slow client not disconnected")
+	Expect(t, !cc.reachedGap(), "gap without dropped messages")
+
+	config.SlowClients.Policy = SlowClientDropOldest
+	Expect(t, cm.send(cc, []byte{3}))
+	Expect(t, cc.reachedGap(), "client not disconnected at the gap")
+	Expect(t, cc.QueueDepth() == 3, "queued", cc.QueueDepth())
+	Expect(t, (<-cc.out)[0] == 1, "oldest message not dropped")
+	cc.dequeued(1)
+
+	// Without max-queue only a full queue is slow
+	config.SlowClients.MaxQueue = 0
+	for i := 4; i < 10; i++ {
+		Expect(t, cm.send(cc, []byte{byte(i)}))
+	}
+	Expect(t, cc.QueueDepth() == 4, "queued", cc.QueueDepth())
+	Expect(t, (<-cc.out)[0] == 6, "oldest messages not dropped")
+	cc.dequeued(1)
+
+	// Lag is how long the oldest queued message waited, lagging clients
+	// are dropped the messages queued too long ago
+	config.SlowClients.MaxLag = 50 * time.Millisecond
+	time.Sleep(60 * time.Millisecond)
+	Expect(t, cc.Lag() > config.SlowClients.MaxLag, "lag", cc.Lag())
+	Expect(t, cm.send(cc, []byte{10}))
+	Expect(t, cc.QueueDepth() == 1, "queued", cc.QueueDepth())
+	Expect(t, cc.Lag() < config.SlowClients.MaxLag, "lag", cc.Lag(), "after dropping")
+	Expect(t, (<-cc.out)[0] == 10, "new message dropped")
+	cc.dequeued(1)
+	Expect(t, cc.Lag() == 0, "lag", cc.Lag(), "without queued messages")
+
+	// Taking a message from the queue doesn't reset the lag of the rest
+	Expect(t, cm.send(cc, []byte{11}))
+	time.Sleep(30 * time.Millisecond)
+	Expect(t, cm.send(cc, []byte{12}))
+	<-cc.out
+	cc.dequeued(1)
+	Expect(t, cc.Lag() < 30*time.Millisecond, "lag", cc.Lag(), "measured from the message taken")
+	time.Sleep(30 * time.Millisecond)
+	Expect(t, cc.Lag() >= 30*time.Millisecond, "lag", cc.Lag(), "not measured from the oldest queued message")
+
+	// Without room to queue anything every message would be dropped
+	config.SlowClients.MaxLag = 0
+	Require(t, config.Validate())
+	config.MaxSendQueue = 0
+	Expect(t, config.Validate() != nil, "drop-oldest accepted without max-send-queue")
+
+	// Nothing to drop from an empty queue, the client is evicted instead of
+	// spinning
+	cc = &ClientConnection{clientManager: cm, out: make(chan []byte)}
+	Expect(t, !cm.send(cc, []byte{13}), "client without send queue not disconnected")
+
+	config.SlowClients.Policy = "other"
+	Expect(t, config.Validate() != nil)
+}
@@ -0,0 +1,216 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package wsbroadcastserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	tlsHandshakeFailedCounter = metrics.NewRegisteredCounter("arb/feed/clients/failed/tls", nil)
+	tlsReloadsCounter         = metrics.NewRegisteredCounter("arb/feed/tls/reloads", nil)
+)
+
+type TLSConfig struct {
+	CertFile          string `koanf:"cert-file" reload:"hot"`
+	KeyFile           string `koanf:"key-file" reload:"hot"`
+	ClientCAFile      string `koanf:"client-ca-file" reload:"hot"`
+	RequireClientCert bool   `koanf:"require-client-cert" reload:"hot"`
+}
+
+var DefaultTLSConfig = TLSConfig{
+	CertFile:          "",
+	KeyFile:           "",
+	ClientCAFile:      "",
+	RequireClientCert: false,
+}
+
+func TLSConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.String(prefix+".cert-file", DefaultTLSConfig.CertFile, "PEM file of the certificate to serve the feed over TLS with, reloaded when the file changes or on SIGHUP (empty = plain TCP, enabling TLS requires a restart)")
+	f.String(prefix+".key-file", DefaultTLSConfig.KeyFile, "PEM file of the private key for the certificate")
+	f.String(prefix+".client-ca-file", DefaultTLSConfig.ClientCAFile, "PEM file of root certificates to verify client certificates with, clients without one are still served unless require-client-cert is set")
+	f.Bool(prefix+".require-client-cert", DefaultTLSConfig.RequireClientCert, "only serve clients presenting a certificate issued by the client CAs")
+}
+
+func (c *TLSConfig) Enabled() bool {
+	return c.CertFile != ""
+}
+
+func (c *TLSConfig) Validate() error {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return errors.New("tls cert-file and key-file must be set together")
+	}
+	if c.RequireClientCert && c.ClientCAFile == "" {
+		return errors.New("tls require-client-cert needs client-ca-file")
+	}
+	if c.ClientCAFile != "" && !c.Enabled() {
+		return errors.New("tls client-ca-file needs cert-file")
+	}
+	return nil
+}
+
+// certReloader serves the certificate and client CAs in the configured files.
+// The files are checked for changes on every handshake, and reloaded
+// regardless on SIGHUP. If reloading fails the previous certificate is kept.
+type certReloader struct {
+	config func() *TLSConfig
+
+	mutex     sync.Mutex
+	loaded    TLSConfig
+	modTime   time.Time
+	force     bool
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+func newCertReloader(config func() *TLSConfig) (*certReloader, error) {
+	r := &certReloader{config: config}
+	if _, err := r.configForClient(nil); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// reloadOnSignal reloads the files on SIGHUP until ctx is done
+func (r *certReloader) reloadOnSignal(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-signals:
+				r.mutex.Lock()
+				r.force = true
+				r.mutex.Unlock()
+				if _, err := r.configForClient(nil); err != nil {
+					log.Error("error reloading feed tls certificate", "err", err)
+				}
+			}
+		}
+	}()
+}
+
+// configForClient is the tls.Config GetConfigForClient callback
+func (r *certReloader) configForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	config := *r.config()
+	modTime, err := latestModTime(config.CertFile, config.KeyFile, config.ClientCAFile)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err == nil && (r.cert == nil || r.force || r.loaded != config || modTime.After(r.modTime)) {
+		err = r.load(config)
+		if err == nil {
+			r.modTime = modTime
+			r.force = false
+		}
+	}
+	if err != nil {
+		if r.cert == nil {
+			return nil, err
+		}
+		log.Warn("error reloading feed tls certificate, serving the previous one", "err", err)
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{*r.cert},
+	}
+	if r.clientCAs != nil {
+		tlsConfig.ClientCAs = r.clientCAs
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if r.loaded.RequireClientCert {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return tlsConfig, nil
+}
+
+// load reads the files of config, the mutex must be held
+func (r *certReloader) load(config TLSConfig) error {
+	cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load feed tls certificate: %w", err)
+	}
+	var clientCAs *x509.CertPool
+	if config.ClientCAFile != "" {
+		pem, err := os.ReadFile(config.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read feed client CA file: %w", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in feed client CA file %s", config.ClientCAFile)
+		}
+	}
+	if r.cert != nil {
+		log.Info("reloaded feed tls certificate", "certFile", config.CertFile)
+		tlsReloadsCounter.Inc(1)
+	}
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.loaded = config
+	return nil
+}
+
+func latestModTime(paths ...string) (time.Time, error) {
+	var latest time.Time
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// handshakeTLS performs the TLS handshake with a client within the handshake
+// timeout, closing the connection if it fails
+func (s *WSBroadcastServer) handshakeTLS(conn net.Conn) (net.Conn, bool) {
+	if err := conn.SetDeadline(time.Now().Add(s.config().HandshakeTimeout)); err != nil {
+		log.Warn("error setting tls handshake deadline", "err", err)
+		_ = conn.Close()
+		return nil, false
+	}
+	tlsConn := tls.Server(conn, &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		GetConfigForClient: s.certReloader.configForClient,
+	})
+	if err := tlsConn.Handshake(); err != nil {
+		log.Debug("feed tls handshake failed", "remoteAddr", conn.RemoteAddr(), "err", err)
+		tlsHandshakeFailedCounter.Inc(1)
+		_ = conn.Close()
+		return nil, false
+	}
+	return tlsConn, true
+}
+
+// pollable returns the connection whose file descriptor is polled for reads,
+// the TCP connection under a TLS one
+func pollable(conn net.Conn) net.Conn {
+	if wrapped, ok := conn.(interface{ NetConn() net.Conn }); ok {
+		return wrapped.NetConn()
+	}
+	return conn
+}
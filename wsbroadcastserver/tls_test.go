@@ -0,0 +1,197 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package wsbroadcastserver
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a self-signed certificate for 127.0.0.1, which is also
+// its own CA, and its key to dir
+func writeTestCert(t *testing.T, dir string, name string) (string, string, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Require(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Require(t, err)
+	cert, err := x509.ParseCertificate(der)
+	Require(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	Require(t, err)
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	Require(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	Require(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600))
+	return certFile, keyFile, cert
+}
+
+// replaceCert copies the certificate and key from one pair of files over
+// another, dated later so the change is noticed
+func replaceCert(t *testing.T, fromCert, fromKey, toCert, toKey string) {
+	t.Helper()
+	for from, to := range map[string]string{fromCert: toCert, fromKey: toKey} {
+		data, err := os.ReadFile(from)
+		Require(t, err)
+		Require(t, os.WriteFile(to, data, 0o600))
+		later := time.Now().Add(time.Minute)
+		Require(t, os.Chtimes(to, later, later))
+	}
+}
+
+func servedCert(t *testing.T, config *tls.Config) *x509.Certificate {
+	t.Helper()
+	Expect(t, len(config.Certificates) == 1, "serving", len(config.Certificates), "certificates")
+	cert, err := x509.ParseCertificate(config.Certificates[0].Certificate[0])
+	Require(t, err)
+	return cert
+}
+
+func TestTLSConfigValidate(t *testing.T) {
+	for _, config := range []TLSConfig{
+		{CertFile: "server.crt"},
+		{KeyFile: "server.key"},
+		{CertFile: "server.crt", KeyFile: "server.key", RequireClientCert: true},
+		{ClientCAFile: "ca.crt"},
+	} {
+		Expect(t, config.Validate() != nil, "tls config", config, "accepted")
+	}
+	Require(t, (&TLSConfig{}).Validate())
+	Require(t, (&TLSConfig{CertFile: "server.crt", KeyFile: "server.key", ClientCAFile: "ca.crt", RequireClientCert: true}).Validate())
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, cert := writeTestCert(t, dir, "server")
+	caFile, _, _ := writeTestCert(t, dir, "ca")
+	config := TLSConfig{CertFile: certFile, KeyFile: keyFile}
+
+	// Missing files fail creating the reloader
+	if _, err := newCertReloader(func() *TLSConfig { return &TLSConfig{CertFile: filepath.Join(dir, "missing.crt"), KeyFile: keyFile} }); err == nil {
+		t.Fatal("reloader created without a certificate")
+	}
+	reloader, err := newCertReloader(func() *TLSConfig { return &config })
+	Require(t, err)
+	tlsConfig, err := reloader.configForClient(nil)
+	Require(t, err)
+	Expect(t, servedCert(t, tlsConfig).Equal(cert), "configured certificate not served")
+	Expect(t, tlsConfig.MinVersion == tls.VersionTLS12, "min version", tlsConfig.MinVersion)
+	Expect(t, tlsConfig.ClientAuth == tls.NoClientCert, "client auth", tlsConfig.ClientAuth, "without client CAs")
+
+	// Changed files are reloaded on the next handshake
+	newCertFile, newKeyFile, reloaded := writeTestCert(t, dir, "reloaded")
+	replaceCert(t, newCertFile, newKeyFile, certFile, keyFile)
+	tlsConfig, err = reloader.configForClient(nil)
+	Require(t, err)
+	Expect(t, servedCert(t, tlsConfig).Equal(reloaded), "changed certificate not reloaded")
+
+	// Broken files keep the previous certificate
+	Require(t, os.WriteFile(keyFile, []byte("not a key"), 0o600))
+	later := time.Now().Add(2 * time.Minute)
+	Require(t, os.Chtimes(keyFile, later, later))
+	tlsConfig, err = reloader.configForClient(nil)
+	Require(t, err)
+	Expect(t, servedCert(t, tlsConfig).Equal(reloaded), "previous certificate not kept after a failed reload")
+
+	// Hot reloaded config is applied, client certificates are verified if
+	// given and required once configured so
+	replaceCert(t, newCertFile, newKeyFile, certFile, keyFile)
+	config.ClientCAFile = caFile
+	tlsConfig, err = reloader.configForClient(nil)
+	Require(t, err)
+	Expect(t, tlsConfig.ClientCAs != nil && tlsConfig.ClientAuth == tls.VerifyClientCertIfGiven, "client auth", tlsConfig.ClientAuth, "with client CAs")
+	config.RequireClientCert = true
+	tlsConfig, err = reloader.configForClient(nil)
+	Require(t, err)
+	Expect(t, tlsConfig.ClientAuth == tls.RequireAndVerifyClientCert, "client auth", tlsConfig.ClientAuth, "requiring client certificates")
+
+	// A reload can be forced without the files changing, as on SIGHUP
+	reloader.mutex.Lock()
+	reloader.force = true
+	reloader.mutex.Unlock()
+	_, err = reloader.configForClient(nil)
+	Require(t, err)
+	reloader.mutex.Lock()
+	forced := reloader.force
+	reloader.mutex.Unlock()
+	Expect(t, !forced, "forced reload not done")
+}
+
+func TestBroadcastServerTLS(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	serverCert, serverKey, served := writeTestCert(t, dir, "server")
+	clientCert, clientKey, _ := writeTestCert(t, dir, "client")
+	config := DefaultTestBroadcasterConfig
+	config.Addr = "127.0.0.1"
+	config.TLS = TLSConfig{
+		CertFile:          serverCert,
+		KeyFile:           serverKey,
+		ClientCAFile:      clientCert,
+		RequireClientCert: true,
+	}
+	Require(t, config.Validate())
+	server := NewWSBroadcastServer(func() *BroadcasterConfig { return &config }, nil, 8742, make(chan error, 10))
+	Require(t, server.Initialize())
+	Require(t, server.Start(ctx))
+	defer server.StopAndWait()
+	addr := server.ListenerAddr().String()
+
+	keyPair, err := tls.LoadX509KeyPair(clientCert, clientKey)
+	Require(t, err)
+	dial := func() *tls.Conn {
+		t.Helper()
+		conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true, Certificates: []tls.Certificate{keyPair}}) // #nosec G402
+		Require(t, err)
+		return conn
+	}
+	conn := dial()
+	Expect(t, conn.ConnectionState().PeerCertificates[0].Equal(served), "configured certificate not served")
+	_ = conn.Close()
+
+	// Clients without a certificate are turned away
+	conn, err = tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true}) // #nosec G402
+	if err == nil {
+		Require(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		_, err = conn.Read(make([]byte, 1))
+		_ = conn.Close()
+	}
+	var netErr net.Error
+	if err == nil || (errors.As(err, &netErr) && netErr.Timeout()) {
+		t.Fatalf("client without certificate served: %v", err)
+	}
+
+	// A replaced certificate is served to new connections
+	newCert, newKey, reloaded := writeTestCert(t, dir, "reloaded")
+	replaceCert(t, newCert, newKey, serverCert, serverKey)
+	conn = dial()
+	defer conn.Close()
+	Expect(t, conn.ConnectionState().PeerCertificates[0].Equal(reloaded), "reloaded certificate not served")
+}
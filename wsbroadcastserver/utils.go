@@ -4,13 +4,17 @@
 package wsbroadcastserver
 
 import (
+	"bytes"
 	"compress/flate"
 	"context"
 	"errors"
 	"io"
 	"net"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/gobwas/ws"
@@ -68,17 +72,123 @@ func (cr *chainedReader) add(r io.Reader) *chainedReader {
 	return cr
 }
 
+// FormatFeedMessageVersions encodes versions for the HTTPHeaderFeedMessageVersions header
+func FormatFeedMessageVersions(versions []int) string {
+	formatted := make([]string, 0, len(versions))
+	for _, version := range versions {
+		formatted = append(formatted, strconv.Itoa(version))
+	}
+	return strings.Join(formatted, ",")
+}
+
+// ParseFeedMessageVersions decodes a HTTPHeaderFeedMessageVersions header
+func ParseFeedMessageVersions(value string) ([]int, error) {
+	var versions []int
+	for _, field := range strings.Split(value, ",") {
+		version, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
+
+// NegotiateFeedMessageVersion returns the newest version supported by both sides
+func NegotiateFeedMessageVersion(ours, theirs []int) (int, bool) {
+	negotiated, found := 0, false
+	for _, version := range ours {
+		for _, other := range theirs {
+			if version == other && (!found || version > negotiated) {
+				negotiated, found = version, true
+			}
+		}
+	}
+	return negotiated, found
+}
+
 func NewFlateReader() *wsflate.Reader {
 	return wsflate.NewReader(nil, func(r io.Reader) wsflate.Decompressor {
 		return flate.NewReaderDict(r, GetStaticCompressorDictionary())
 	})
 }
 
+// SanitizeClientId makes a client id sent in the HTTPHeaderFeedClientId
+// header safe to log, dropping non-printable characters and truncating it to
+// MaxClientIdLength
+func SanitizeClientId(value string) string {
+	var sanitized strings.Builder
+	for _, r := range strings.TrimSpace(value) {
+		if sanitized.Len()+utf8.RuneLen(r) > MaxClientIdLength {
+			break
+		}
+		if unicode.IsPrint(r) {
+			sanitized.WriteRune(r)
+		}
+	}
+	return sanitized.String()
+}
+
+// Close codes registered after RFC 6455, which gobwas/ws rejects as unknown
+const (
+	StatusServiceRestart ws.StatusCode = 1012
+	StatusTryAgainLater  ws.StatusCode = 1013
+)
+
+// controlFrameHandler handles control frames like wsutil.ControlFrameHandler,
+// but also accepts the service restart and try again later close codes, so
+// the reader gets them in a wsutil.ClosedError rather than a protocol error
+func controlFrameHandler(w io.Writer, state ws.State) wsutil.FrameHandlerFunc {
+	handle := wsutil.ControlFrameHandler(w, state)
+	return func(h ws.Header, r io.Reader) error {
+		if h.OpCode != ws.OpClose || h.Length < 2 || h.Length > ws.MaxControlFramePayloadSize {
+			return handle(h, r)
+		}
+		payload := make([]byte, h.Length)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return err
+		}
+		code, reason := ws.ParseCloseFrameData(payload)
+		if code != StatusServiceRestart && code != StatusTryAgainLater {
+			return handle(h, bytes.NewReader(payload))
+		}
+		frame := ws.NewCloseFrame(ws.NewCloseFrameBody(code, ""))
+		if state.ClientSide() {
+			frame = ws.MaskFrameInPlace(frame)
+		}
+		if err := ws.WriteFrame(w, frame); err != nil {
+			return err
+		}
+		return wsutil.ClosedError{Code: code, Reason: reason}
+	}
+}
+
+// ReadData reads the next frame and returns the payload of a data frame. The
+// frame is read into a pooled buffer and copied out once its size is known,
+// ReadDataFunc with GetBuffer avoids the copy for callers done with the data
+// before reading the next frame.
 func ReadData(ctx context.Context, conn net.Conn, earlyFrameData io.Reader, timeout time.Duration, state ws.State, compression bool, flateReader *wsflate.Reader) ([]byte, ws.OpCode, error) {
+	var data []byte
+	buf := GetBuffer()
+	defer PutBuffer(buf)
+	op, err := ReadDataFunc(ctx, conn, earlyFrameData, timeout, state, compression, flateReader, func(_ ws.OpCode, frame io.Reader) error {
+		_, err := buf.ReadFrom(frame)
+		data = make([]byte, buf.Len())
+		copy(data, buf.Bytes())
+		return err
+	})
+	return data, op, err
+}
+
+// ReadDataFunc is like ReadData, but hands the payload of a data frame to
+// consume instead of reading it into memory. The read deadline applies while
+// consume runs, and whatever consume leaves unread is discarded. consume is
+// not called for control frames.
+func ReadDataFunc(ctx context.Context, conn net.Conn, earlyFrameData io.Reader, timeout time.Duration, state ws.State, compression bool, flateReader *wsflate.Reader, consume func(op ws.OpCode, frame io.Reader) error) (ws.OpCode, error) {
 	if compression {
 		state |= ws.StateExtended
 	}
-	controlHandler := wsutil.ControlFrameHandler(conn, state)
+	controlHandler := controlFrameHandler(conn, state)
 	var msg wsflate.MessageState
 	reader := wsutil.Reader{
 		Source:          (&chainedReader{}).add(earlyFrameData).add(conn),
@@ -91,7 +201,7 @@ func ReadData(ctx context.Context, conn net.Conn, earlyFrameData io.Reader, time
 
 	err := conn.SetReadDeadline(time.Now().Add(timeout))
 	if err != nil {
-		return nil, 0, err
+		return 0, err
 	}
 
 	// Remove timeout when leaving this function
@@ -103,7 +213,7 @@ func ReadData(ctx context.Context, conn net.Conn, earlyFrameData io.Reader, time
 	for {
 		select {
 		case <-ctx.Done():
-			return nil, 0, nil
+			return 0, nil
 		default:
 		}
 
@@ -112,38 +222,38 @@ func ReadData(ctx context.Context, conn net.Conn, earlyFrameData io.Reader, time
 		if header.OpCode.IsControl() {
 			// Control packet may be returned even if err set
 			if err2 := controlHandler(header, &reader); err2 != nil {
-				return nil, 0, err2
+				return 0, err2
 			}
 
 			// Discard any data after control packet
 			if err2 := reader.Discard(); err2 != nil {
-				return nil, 0, err2
+				return 0, err2
 			}
 
-			return nil, 0, nil
+			return header.OpCode, nil
 		}
 		if err != nil {
-			return nil, 0, err
+			return 0, err
 		}
 
 		if header.OpCode != ws.OpText &&
 			header.OpCode != ws.OpBinary {
 			if err := reader.Discard(); err != nil {
-				return nil, 0, err
+				return 0, err
 			}
 			continue
 		}
-		var data []byte
+		var frame io.Reader = &reader
 		if msg.IsCompressed() {
 			if !compression {
-				return nil, 0, errors.New("Received compressed frame even though compression is disabled")
+				return 0, errors.New("Received compressed frame even though compression is disabled")
 			}
 			flateReader.Reset(&reader)
-			data, err = io.ReadAll(flateReader)
-		} else {
-			data, err = io.ReadAll(&reader)
+			frame = flateReader
 		}
-
-		return data, header.OpCode, err
+		if err := consume(header.OpCode, frame); err != nil {
+			return header.OpCode, err
+		}
+		return header.OpCode, reader.Discard()
 	}
 }
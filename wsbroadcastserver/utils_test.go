@@ -0,0 +1,108 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package wsbroadcastserver
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gobwas/ws"
+)
+
+// repeatingConn endlessly serves the same frame
+type repeatingConn struct {
+	net.Conn
+	frame  []byte
+	offset int
+}
+
+func newRepeatingConn(t testing.TB, payload []byte) *repeatingConn {
+	var frame bytes.Buffer
+	if err := ws.WriteFrame(&frame, ws.NewTextFrame(payload)); err != nil {
+		t.Fatal(err)
+	}
+	return &repeatingConn{frame: frame.Bytes()}
+}
+
+func (c *repeatingConn) Read(p []byte) (int, error) {
+	n := copy(p, c.frame[c.offset:])
+	c.offset = (c.offset + n) % len(c.frame)
+	return n, nil
+}
+
+func (c *repeatingConn) SetReadDeadline(time.Time) error {
+	return nil
+}
+
+func TestReadData(t *testing.T) {
+	payload := bytes.Repeat([]byte("feed"), 1000)
+	conn := newRepeatingConn(t, payload)
+	for i := 0; i < 3; i++ {
+		data, op, err := ReadData(context.Background(), conn, nil, time.Second, ws.StateClientSide, false, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if op != ws.OpText || !bytes.Equal(data, payload) {
+			t.Fatalf("unexpected frame %v of %d bytes", op, len(data))
+		}
+	}
+}
+
+func benchmarkPayload() []byte {
+	return bytes.Repeat([]byte(`{"sequenceNumber":1,"message":{}}`), 4096)
+}
+
+func BenchmarkReadData(b *testing.B) {
+	payload := benchmarkPayload()
+	conn := newRepeatingConn(b, payload)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(payload)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := ReadData(context.Background(), conn, nil, time.Second, ws.StateClientSide, false, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadDataPooled(b *testing.B) {
+	payload := benchmarkPayload()
+	conn := newRepeatingConn(b, payload)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(payload)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf := GetBuffer()
+		_, err := ReadDataFunc(context.Background(), conn, nil, time.Second, ws.StateClientSide, false, nil, func(_ ws.OpCode, frame io.Reader) error {
+			_, err := buf.ReadFrom(frame)
+			return err
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		PutBuffer(buf)
+	}
+}
+
+// BenchmarkReadAll is how frames were read before buffers were pooled
+func BenchmarkReadAll(b *testing.B) {
+	payload := benchmarkPayload()
+	conn := newRepeatingConn(b, payload)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(payload)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := ReadDataFunc(context.Background(), conn, nil, time.Second, ws.StateClientSide, false, nil, func(_ ws.OpCode, frame io.Reader) error {
+			_, err := io.ReadAll(frame)
+			return err
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
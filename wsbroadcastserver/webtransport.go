@@ -0,0 +1,119 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package wsbroadcastserver
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/quic-go/quic-go/http3"
+	"github.com/quic-go/webtransport-go"
+	flag "github.com/spf13/pflag"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+var webTransportSessionsCounter = metrics.NewRegisteredCounter("arb/feed/webtransport/sessions", nil)
+
+type WebTransportConfig struct {
+	Enable bool   `koanf:"enable"`
+	Port   string `koanf:"port"`
+}
+
+var DefaultWebTransportConfig = WebTransportConfig{
+	Enable: false,
+	Port:   "9644",
+}
+
+var DefaultTestWebTransportConfig = WebTransportConfig{
+	Enable: false,
+	Port:   "0",
+}
+
+func WebTransportConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Bool(prefix+".enable", DefaultWebTransportConfig.Enable, "experimental: also serve the feed over WebTransport (HTTP/3 over QUIC) to clients connecting with https:// or quic:// urls, requires tls")
+	f.String(prefix+".port", DefaultWebTransportConfig.Port, "UDP port to bind the WebTransport feed output to, on the broadcaster addr")
+}
+
+// startWebTransport serves the feed over WebTransport. A client opens a
+// single bidirectional stream in its session, and speaks websocket over it
+// to the server itself, so it is served like any other client.
+func (s *WSBroadcastServer) startWebTransport(config *BroadcasterConfig) error {
+	conn, err := net.ListenPacket("udp", config.Addr+":"+config.WebTransport.Port)
+	if err != nil {
+		log.Error("error listening for webtransport feed clients", "err", err)
+		return err
+	}
+	server := &webtransport.Server{
+		H3: http3.Server{
+			TLSConfig: &tls.Config{
+				MinVersion:         tls.VersionTLS13,
+				GetConfigForClient: s.certReloader.configForClient,
+			},
+		},
+		// Feed clients aren't browsers, any origin may subscribe
+		CheckOrigin: func(*http.Request) bool { return true },
+	}
+	server.H3.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.serveWebTransport(server, w, r)
+	})
+	s.quicConn = conn
+	s.webTransport = server
+	go func() {
+		if err := server.Serve(conn); err != nil && !errors.Is(err, http.ErrServerClosed) && !errors.Is(err, net.ErrClosed) {
+			log.Error("error serving webtransport feed", "err", err)
+		}
+	}()
+	log.Info("arbitrum webtransport broadcast server is listening", "address", conn.LocalAddr().String())
+	return nil
+}
+
+// WebTransportListenerAddr returns the UDP address WebTransport feed clients
+// connect to, nil if the feed isn't served over WebTransport
+func (s *WSBroadcastServer) WebTransportListenerAddr() net.Addr {
+	if s.quicConn == nil {
+		return nil
+	}
+	return s.quicConn.LocalAddr()
+}
+
+// serveWebTransport relays the stream of a session to a loopback connection
+// until either side closes
+func (s *WSBroadcastServer) serveWebTransport(server *webtransport.Server, w http.ResponseWriter, r *http.Request) {
+	session, err := server.Upgrade(w, r)
+	if err != nil {
+		log.Debug("webtransport upgrade error", "remoteAddr", r.RemoteAddr, "err", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	defer func() {
+		_ = session.CloseWithError(0, "")
+	}()
+	acceptCtx, cancelAccept := context.WithTimeout(session.Context(), s.config().HandshakeTimeout)
+	stream, err := session.AcceptStream(acceptCtx)
+	cancelAccept()
+	if err != nil {
+		log.Debug("webtransport client opened no stream", "remoteAddr", session.RemoteAddr(), "err", err)
+		return
+	}
+	defer stream.Close()
+	conn, err := s.dialLoopback(session.RemoteAddr())
+	if err != nil {
+		log.Warn("error relaying webtransport client", "remoteAddr", session.RemoteAddr(), "err", err)
+		return
+	}
+	defer conn.Close()
+	webTransportSessionsCounter.Inc(1)
+	go func() {
+		// The server notices the closed connection once the client is gone
+		_, _ = io.Copy(conn, stream)
+		_ = conn.Close()
+	}()
+	_, _ = io.Copy(stream, conn)
+}
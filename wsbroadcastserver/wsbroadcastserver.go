@@ -4,12 +4,17 @@
 package wsbroadcastserver
 
 import (
+	"compress/flate"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/textproto"
+	"net/url"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
@@ -20,7 +25,9 @@ import (
 	"github.com/gobwas/ws-examples/src/gopool"
 	"github.com/gobwas/ws/wsflate"
 	"github.com/mailru/easygo/netpoll"
+	"github.com/quic-go/webtransport-go"
 	flag "github.com/spf13/pflag"
+	"google.golang.org/grpc"
 
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/offchainlabs/nitro/arbutil"
@@ -32,14 +39,50 @@ var (
 	HTTPHeaderFeedClientVersion       = textproto.CanonicalMIMEHeaderKey("Arbitrum-Feed-Client-Version")
 	HTTPHeaderRequestedSequenceNumber = textproto.CanonicalMIMEHeaderKey("Arbitrum-Requested-Sequence-Number")
 	HTTPHeaderChainId                 = textproto.CanonicalMIMEHeaderKey("Arbitrum-Chain-Id")
+	HTTPHeaderFeedMessageVersions     = textproto.CanonicalMIMEHeaderKey("Arbitrum-Feed-Message-Versions")
+	HTTPHeaderFeedClientId            = textproto.CanonicalMIMEHeaderKey("Arbitrum-Feed-Client-Id")
+	HTTPHeaderFeedBulkCatchup         = textproto.CanonicalMIMEHeaderKey("Arbitrum-Feed-Bulk-Catchup")
+	HTTPHeaderAuthorization           = textproto.CanonicalMIMEHeaderKey("Authorization")
+	HTTPHeaderForwardedFor            = textproto.CanonicalMIMEHeaderKey("X-Forwarded-For")
 )
 
+// SupportedFeedMessageVersions lists the broadcast message versions this build
+// can decode. Clients send them in the HTTPHeaderFeedMessageVersions request
+// header, and servers answer with the versions they send in the response
+// header of the same name. Servers that predate the header only send version 1.
+var SupportedFeedMessageVersions = []int{FeedMessageVersion}
+
 const (
 	FeedServerVersion = 2
 	FeedClientVersion = 2
-	LivenessProbeURI  = "livenessprobe"
+	// FeedMessageVersion is the version of the broadcast messages sent by the server
+	FeedMessageVersion = 1
+	LivenessProbeURI   = "livenessprobe"
+
+	// BinaryFeedSubprotocol is the websocket subprotocol for receiving
+	// broadcast messages RLP encoded in binary frames instead of as JSON
+	BinaryFeedSubprotocol = "arbitrum-feed-rlp"
+
+	// RequestedSequenceNumberQueryParameter may be used instead of the
+	// HTTPHeaderRequestedSequenceNumber header by clients that can't set headers
+	RequestedSequenceNumberQueryParameter = "requestedSequenceNumber"
+
+	// MaxClientIdLength is the length client ids sent in the
+	// HTTPHeaderFeedClientId header are truncated to
+	MaxClientIdLength = 128
+
+	// BulkCatchupGzip is sent in the HTTPHeaderFeedBulkCatchup header by
+	// clients that accept catchup as a single gzip compressed frame
+	BulkCatchupGzip = "gzip"
 )
 
+// CatchupRequest is sent by a connected client in a text frame to have the
+// server resend cached messages starting from RequestedSequenceNumber, for
+// example after the client noticed a gap in the sequence numbers it received.
+type CatchupRequest struct {
+	RequestedSequenceNumber arbutil.MessageIndex `json:"requestedSequenceNumber"`
+}
+
 type BroadcasterConfig struct {
 	Enable             bool                    `koanf:"enable"`
 	Signed             bool                    `koanf:"signed"`
@@ -48,6 +91,7 @@ type BroadcasterConfig struct {
 	WriteTimeout       time.Duration           `koanf:"write-timeout" reload:"hot"`     // reloading will affect only new connections
 	HandshakeTimeout   time.Duration           `koanf:"handshake-timeout" reload:"hot"` // reloading will affect only new connections
 	Port               string                  `koanf:"port"`
+	UnixSocket         string                  `koanf:"unix-socket"`
 	Ping               time.Duration           `koanf:"ping" reload:"hot"`           // reloaded value will change future ping intervals
 	ClientTimeout      time.Duration           `koanf:"client-timeout" reload:"hot"` // reloaded value will affect all clients (next time the timeout is checked)
 	Queue              int                     `koanf:"queue"`
@@ -59,16 +103,71 @@ type BroadcasterConfig struct {
 	LogDisconnect      bool                    `koanf:"log-disconnect"`
 	EnableCompression  bool                    `koanf:"enable-compression" reload:"hot"`  // if reloaded to false will cause disconnection of clients with enabled compression on next broadcast
 	RequireCompression bool                    `koanf:"require-compression" reload:"hot"` // if reloaded to true will cause disconnection of clients with disabled compression on next broadcast
+	CompressionLevel   int                     `koanf:"compression-level" reload:"hot"`   // reloaded value will affect the next broadcast
+	EnableBinary       bool                    `koanf:"enable-binary" reload:"hot"`       // reloaded value will affect only future upgrades to websocket
+	EnableEventStream  bool                    `koanf:"enable-event-stream" reload:"hot"` // reloaded value will affect only new connections
+	EnableLongPoll     bool                    `koanf:"enable-long-poll" reload:"hot"`    // reloaded value will affect only new connections
+	LongPollMaxWait    time.Duration           `koanf:"long-poll-max-wait" reload:"hot"`
 	LimitCatchup       bool                    `koanf:"limit-catchup" reload:"hot"`
+	CatchupInterval    time.Duration           `koanf:"catchup-interval" reload:"hot"`
 	ConnectionLimits   ConnectionLimiterConfig `koanf:"connection-limits" reload:"hot"`
 	ClientDelay        time.Duration           `koanf:"client-delay" reload:"hot"`
+	ContentHash        bool                    `koanf:"content-hash" reload:"hot"`
+	BulkCatchup        int                     `koanf:"bulk-catchup" reload:"hot"`
+	TLS                TLSConfig               `koanf:"tls" reload:"hot"`
+	Auth               AuthConfig              `koanf:"auth" reload:"hot"`
+	IPFilter           IPFilterConfig          `koanf:"ip-filter" reload:"hot"`
+	SlowClients        SlowClientConfig        `koanf:"slow-clients" reload:"hot"`
+	MaxClients         int                     `koanf:"max-clients" reload:"hot"`
+	AdmissionPolicy    string                  `koanf:"admission-policy" reload:"hot"`
+	CatchupRetention   CatchupRetentionConfig  `koanf:"catchup-retention" reload:"hot"`
+	CatchupStore       CatchupStoreConfig      `koanf:"catchup-store"`
+	SharedCatchup      SharedCatchupConfig     `koanf:"shared-catchup"`
+	GRPC               GRPCConfig              `koanf:"grpc"`
+	WebTransport       WebTransportConfig      `koanf:"webtransport"`
 }
 
 func (bc *BroadcasterConfig) Validate() error {
 	if !bc.EnableCompression && bc.RequireCompression {
 		return errors.New("require-compression cannot be true while enable-compression is false")
 	}
-	return nil
+	if bc.CompressionLevel < flate.HuffmanOnly || bc.CompressionLevel > flate.BestCompression {
+		return fmt.Errorf("invalid compression-level %d, must be between %d and %d", bc.CompressionLevel, flate.HuffmanOnly, flate.BestCompression)
+	}
+	if bc.BulkCatchup < 0 {
+		return errors.New("bulk-catchup must not be negative")
+	}
+	if bc.CatchupInterval < 0 {
+		return errors.New("catchup-interval must not be negative")
+	}
+	if bc.MaxClients < 0 {
+		return errors.New("max-clients must not be negative")
+	}
+	if bc.AdmissionPolicy != AdmissionReject && bc.AdmissionPolicy != AdmissionEvictLagged {
+		return fmt.Errorf("invalid admission-policy %q, must be %q or %q", bc.AdmissionPolicy, AdmissionReject, AdmissionEvictLagged)
+	}
+	if err := bc.TLS.Validate(); err != nil {
+		return err
+	}
+	if bc.WebTransport.Enable && !bc.TLS.Enabled() {
+		return errors.New("webtransport requires tls, QUIC is always encrypted")
+	}
+	if err := bc.Auth.Validate(); err != nil {
+		return err
+	}
+	if err := bc.IPFilter.Validate(); err != nil {
+		return err
+	}
+	if err := bc.SlowClients.Validate(); err != nil {
+		return err
+	}
+	if bc.SlowClients.Policy == SlowClientDropOldest && bc.MaxSendQueue <= 0 {
+		return errors.New("slow client policy drop-oldest requires max-send-queue")
+	}
+	if err := bc.CatchupRetention.Validate(); err != nil {
+		return err
+	}
+	return bc.SharedCatchup.Validate()
 }
 
 type BroadcasterConfigFetcher func() *BroadcasterConfig
@@ -81,20 +180,40 @@ func BroadcasterConfigAddOptions(prefix string, f *flag.FlagSet) {
 	f.Duration(prefix+".write-timeout", DefaultBroadcasterConfig.WriteTimeout, "duration to wait before timing out writing data to clients")
 	f.Duration(prefix+".handshake-timeout", DefaultBroadcasterConfig.HandshakeTimeout, "duration to wait before timing out HTTP to WS upgrade")
 	f.String(prefix+".port", DefaultBroadcasterConfig.Port, "port to bind the relay feed output to")
+	f.String(prefix+".unix-socket", DefaultBroadcasterConfig.UnixSocket, "path of a unix socket to also serve the relay feed output on, for nodes on the same host connecting with ws+unix:// urls (empty = disabled)")
 	f.Duration(prefix+".ping", DefaultBroadcasterConfig.Ping, "duration for ping interval")
 	f.Duration(prefix+".client-timeout", DefaultBroadcasterConfig.ClientTimeout, "duration to wait before timing out connections to client")
 	f.Int(prefix+".queue", DefaultBroadcasterConfig.Queue, "queue size for HTTP to WS upgrade")
 	f.Int(prefix+".workers", DefaultBroadcasterConfig.Workers, "number of threads to reserve for HTTP to WS upgrade")
-	f.Int(prefix+".max-send-queue", DefaultBroadcasterConfig.MaxSendQueue, "maximum number of messages allowed to accumulate before client is disconnected")
+	f.Int(prefix+".max-send-queue", DefaultBroadcasterConfig.MaxSendQueue, "maximum number of messages allowed to accumulate before client is disconnected, or its oldest messages dropped with the drop-oldest slow client policy")
 	f.Bool(prefix+".require-version", DefaultBroadcasterConfig.RequireVersion, "don't connect if client version not present")
 	f.Bool(prefix+".disable-signing", DefaultBroadcasterConfig.DisableSigning, "don't sign feed messages")
 	f.Bool(prefix+".log-connect", DefaultBroadcasterConfig.LogConnect, "log every client connect")
 	f.Bool(prefix+".log-disconnect", DefaultBroadcasterConfig.LogDisconnect, "log every client disconnect")
 	f.Bool(prefix+".enable-compression", DefaultBroadcasterConfig.EnableCompression, "enable per message deflate compression support")
 	f.Bool(prefix+".require-compression", DefaultBroadcasterConfig.RequireCompression, "require clients to use compression")
+	f.Bool(prefix+".enable-binary", DefaultBroadcasterConfig.EnableBinary, "allow clients to negotiate the binary RLP encoding of feed messages instead of JSON")
+	f.Bool(prefix+".enable-event-stream", DefaultBroadcasterConfig.EnableEventStream, "also serve the feed as server-sent events at "+EventStreamPath+", for clients behind proxies that strip websocket upgrades")
+	f.Bool(prefix+".enable-long-poll", DefaultBroadcasterConfig.EnableLongPoll, "also serve the feed to clients polling "+MessagesPath+"?"+AfterQueryParameter+"=SEQ&"+WaitQueryParameter+"=DURATION, for clients behind middleboxes that break long-lived connections")
+	f.Duration(prefix+".long-poll-max-wait", DefaultBroadcasterConfig.LongPollMaxWait, "maximum time a poll waits for new messages before it is answered without any")
+	f.Int(prefix+".compression-level", DefaultBroadcasterConfig.CompressionLevel, "deflate compression level used for clients with compression enabled, from -2 (huffman only) to 9 (best compression)")
 	f.Bool(prefix+".limit-catchup", DefaultBroadcasterConfig.LimitCatchup, "only supply catchup buffer if requested sequence number is reasonable")
+	f.Duration(prefix+".catchup-interval", DefaultBroadcasterConfig.CatchupInterval, "minimum time between catchup requests served to a connected client, more frequent ones are ignored (0 = only one pending at a time)")
 	ConnectionLimiterConfigAddOptions(prefix+".connection-limits", f)
 	f.Duration(prefix+".client-delay", DefaultBroadcasterConfig.ClientDelay, "delay the first messages sent to each client by this amount")
+	f.Bool(prefix+".content-hash", DefaultBroadcasterConfig.ContentHash, "include the hash of each message so that clients can detect messages corrupted in transit")
+	f.Int(prefix+".bulk-catchup", DefaultBroadcasterConfig.BulkCatchup, "minimum number of messages a client catching up is sent as a single gzip compressed frame, if the client accepts it (0 = disabled)")
+	TLSConfigAddOptions(prefix+".tls", f)
+	AuthConfigAddOptions(prefix+".auth", f)
+	IPFilterConfigAddOptions(prefix+".ip-filter", f)
+	SlowClientConfigAddOptions(prefix+".slow-clients", f)
+	f.Int(prefix+".max-clients", DefaultBroadcasterConfig.MaxClients, "maximum number of clients served at once, per IP limits are set with connection-limits (0 = unlimited)")
+	f.String(prefix+".admission-policy", DefaultBroadcasterConfig.AdmissionPolicy, "what to do with new clients while max-clients are connected, \""+AdmissionReject+"\" them or \""+AdmissionEvictLagged+"\" to disconnect the client furthest behind")
+	CatchupRetentionConfigAddOptions(prefix+".catchup-retention", f)
+	CatchupStoreConfigAddOptions(prefix+".catchup-store", f)
+	SharedCatchupConfigAddOptions(prefix+".shared-catchup", f)
+	GRPCConfigAddOptions(prefix+".grpc", f)
+	WebTransportConfigAddOptions(prefix+".webtransport", f)
 }
 
 var DefaultBroadcasterConfig = BroadcasterConfig{
@@ -105,6 +224,7 @@ var DefaultBroadcasterConfig = BroadcasterConfig{
 	WriteTimeout:       2 * time.Second,
 	HandshakeTimeout:   time.Second,
 	Port:               "9642",
+	UnixSocket:         "",
 	Ping:               5 * time.Second,
 	ClientTimeout:      15 * time.Second,
 	Queue:              100,
@@ -116,9 +236,28 @@ var DefaultBroadcasterConfig = BroadcasterConfig{
 	LogDisconnect:      false,
 	EnableCompression:  true,
 	RequireCompression: false,
+	CompressionLevel:   DeflateCompressionLevel,
+	EnableBinary:       true,
+	EnableEventStream:  false,
+	EnableLongPoll:     false,
+	LongPollMaxWait:    30 * time.Second,
 	LimitCatchup:       false,
+	CatchupInterval:    time.Second,
 	ConnectionLimits:   DefaultConnectionLimiterConfig,
 	ClientDelay:        0,
+	ContentHash:        false,
+	BulkCatchup:        0,
+	TLS:                DefaultTLSConfig,
+	Auth:               DefaultAuthConfig,
+	IPFilter:           DefaultIPFilterConfig,
+	SlowClients:        DefaultSlowClientConfig,
+	MaxClients:         0,
+	AdmissionPolicy:    AdmissionReject,
+	CatchupRetention:   DefaultCatchupRetentionConfig,
+	CatchupStore:       DefaultCatchupStoreConfig,
+	SharedCatchup:      DefaultSharedCatchupConfig,
+	GRPC:               DefaultGRPCConfig,
+	WebTransport:       DefaultWebTransportConfig,
 }
 
 var DefaultTestBroadcasterConfig = BroadcasterConfig{
@@ -129,6 +268,7 @@ var DefaultTestBroadcasterConfig = BroadcasterConfig{
 	WriteTimeout:       2 * time.Second,
 	HandshakeTimeout:   2 * time.Second,
 	Port:               "0",
+	UnixSocket:         "",
 	Ping:               5 * time.Second,
 	ClientTimeout:      15 * time.Second,
 	Queue:              1,
@@ -140,21 +280,53 @@ var DefaultTestBroadcasterConfig = BroadcasterConfig{
 	LogDisconnect:      false,
 	EnableCompression:  true,
 	RequireCompression: false,
+	CompressionLevel:   DeflateCompressionLevel,
+	EnableBinary:       true,
+	EnableEventStream:  true,
+	EnableLongPoll:     true,
+	LongPollMaxWait:    30 * time.Second,
 	LimitCatchup:       false,
+	CatchupInterval:    0,
 	ConnectionLimits:   DefaultConnectionLimiterConfig,
 	ClientDelay:        0,
+	ContentHash:        false,
+	BulkCatchup:        0,
+	TLS:                DefaultTLSConfig,
+	Auth:               DefaultAuthConfig,
+	IPFilter:           DefaultIPFilterConfig,
+	SlowClients:        DefaultSlowClientConfig,
+	MaxClients:         0,
+	AdmissionPolicy:    AdmissionReject,
+	CatchupRetention:   DefaultCatchupRetentionConfig,
+	CatchupStore:       DefaultCatchupStoreConfig,
+	SharedCatchup:      DefaultSharedCatchupConfig,
+	GRPC:               DefaultTestGRPCConfig,
+	WebTransport:       DefaultTestWebTransportConfig,
 }
 
 type WSBroadcastServer struct {
 	startMutex sync.Mutex
 	poller     netpoll.Poller
 
+	// Protects acceptDesc and unixAcceptDesc
 	acceptDescMutex sync.Mutex
 	acceptDesc      *netpoll.Desc
-
-	listener      net.Listener
-	config        BroadcasterConfigFetcher
-	started       bool
+	unixAcceptDesc  *netpoll.Desc
+
+	listener     net.Listener
+	unixListener net.Listener
+	grpcListener net.Listener
+	grpcServer   *grpc.Server
+	// Threads serving gRPC streams, see serveGRPC
+	grpcStreams  sync.WaitGroup
+	quicConn     net.PacketConn
+	webTransport *webtransport.Server
+	config       BroadcasterConfigFetcher
+	started      bool
+	// Serves a connection, set while started, protected by startMutex
+	handle        func(net.Conn)
+	certReloader  *certReloader
+	authenticator *authenticator
 	clientManager *ClientManager
 	catchupBuffer CatchupBuffer
 	chainId       uint64
@@ -165,6 +337,7 @@ func NewWSBroadcastServer(config BroadcasterConfigFetcher, catchupBuffer Catchup
 	return &WSBroadcastServer{
 		config:        config,
 		started:       false,
+		authenticator: newAuthenticator(func() *AuthConfig { return &config().Auth }),
 		catchupBuffer: catchupBuffer,
 		chainId:       chainId,
 		fatalErrChan:  fatalErrChan,
@@ -193,8 +366,9 @@ func (s *WSBroadcastServer) Initialize() error {
 func (s *WSBroadcastServer) Start(ctx context.Context) error {
 	// Prepare handshake header writer from http.Header mapping.
 	header := ws.HandshakeHeaderHTTP(http.Header{
-		HTTPHeaderFeedServerVersion: []string{strconv.Itoa(FeedServerVersion)},
-		HTTPHeaderChainId:           []string{strconv.FormatUint(s.chainId, 10)},
+		HTTPHeaderFeedServerVersion:   []string{strconv.Itoa(FeedServerVersion)},
+		HTTPHeaderChainId:             []string{strconv.FormatUint(s.chainId, 10)},
+		HTTPHeaderFeedMessageVersions: []string{FormatFeedMessageVersions([]int{FeedMessageVersion})},
 	})
 
 	return s.StartWithHeader(ctx, header)
@@ -230,6 +404,27 @@ func (s *WSBroadcastServer) StartWithHeader(ctx context.Context, header ws.Hands
 			return
 		}
 
+		var request io.ReadWriter = conn
+		var paths []string
+		if config.EnableEventStream {
+			paths = append(paths, EventStreamPath)
+		}
+		if config.EnableLongPoll {
+			paths = append(paths, MessagesPath)
+		}
+		if len(paths) > 0 {
+			path, reader := peekRequestPath(conn, paths...)
+			switch path {
+			case EventStreamPath:
+				s.serveEventStream(conn, reader, header)
+				return
+			case MessagesPath:
+				s.serveLongPoll(conn, reader, header)
+				return
+			}
+			request = readWriter{reader, conn}
+		}
+
 		var compress *wsflate.Extension
 		var negotiate func(httphead.Option) (httphead.Option, error)
 		if config.EnableCompression {
@@ -240,7 +435,13 @@ func (s *WSBroadcastServer) StartWithHeader(ctx context.Context, header ws.Hands
 		}
 		var feedClientVersionSeen bool
 		var connectingIP net.IP
+		var cfConnectingIP string
+		var forwardedFor []string
 		var requestedSeqNum arbutil.MessageIndex
+		var clientId string
+		var bulkCatchup bool
+		var authorization string
+		var identity *ClientIdentity
 		upgrader := ws.Upgrader{
 			OnRequest: func(uri []byte) error {
 				if strings.Contains(string(uri), LivenessProbeURI) {
@@ -248,6 +449,20 @@ func (s *WSBroadcastServer) StartWithHeader(ctx context.Context, header ws.Hands
 						ws.RejectionStatus(http.StatusOK),
 					)
 				}
+				parsedURI, err := url.ParseRequestURI(string(uri))
+				if err != nil {
+					return nil
+				}
+				if value := parsedURI.Query().Get(RequestedSequenceNumberQueryParameter); value != "" {
+					num, err := strconv.ParseUint(value, 0, 64)
+					if err != nil {
+						return ws.RejectConnectionError(
+							ws.RejectionStatus(http.StatusBadRequest),
+							ws.RejectionReason(fmt.Sprintf("Malformed query parameter %s", RequestedSequenceNumberQueryParameter)),
+						)
+					}
+					requestedSeqNum = arbutil.MessageIndex(num)
+				}
 				return nil
 			},
 			OnHeader: func(key []byte, value []byte) error {
@@ -276,9 +491,30 @@ func (s *WSBroadcastServer) StartWithHeader(ctx context.Context, header ws.Hands
 						)
 					}
 					requestedSeqNum = arbutil.MessageIndex(num)
+				} else if headerName == HTTPHeaderFeedMessageVersions {
+					versions, err := ParseFeedMessageVersions(string(value))
+					if err != nil {
+						return ws.RejectConnectionError(
+							ws.RejectionStatus(http.StatusBadRequest),
+							ws.RejectionReason(fmt.Sprintf("Malformed HTTP header %s", HTTPHeaderFeedMessageVersions)),
+						)
+					}
+					if _, ok := NegotiateFeedMessageVersion([]int{FeedMessageVersion}, versions); !ok {
+						return ws.RejectConnectionError(
+							ws.RejectionStatus(http.StatusBadRequest),
+							ws.RejectionReason(fmt.Sprintf("Feed message versions %s not supported, server sends version %d", string(value), FeedMessageVersion)),
+						)
+					}
+				} else if headerName == HTTPHeaderFeedClientId {
+					clientId = SanitizeClientId(string(value))
+				} else if headerName == HTTPHeaderFeedBulkCatchup {
+					bulkCatchup = strings.EqualFold(strings.TrimSpace(string(value)), BulkCatchupGzip)
+				} else if headerName == HTTPHeaderAuthorization {
+					authorization = string(value)
 				} else if headerName == HTTPHeaderCloudflareConnectingIP {
-					connectingIP = net.ParseIP(string(value))
-					log.Trace("Client IP parsed from header", "ip", connectingIP, "header", headerName, "value", string(value))
+					cfConnectingIP = string(value)
+				} else if headerName == HTTPHeaderForwardedFor {
+					forwardedFor = append(forwardedFor, string(value))
 				}
 
 				return nil
@@ -290,13 +526,29 @@ func (s *WSBroadcastServer) StartWithHeader(ctx context.Context, header ws.Hands
 						ws.RejectionReason(fmt.Sprintf("Missing HTTP header %s", HTTPHeaderFeedClientVersion)),
 					)
 				}
-				if connectingIP == nil {
-					if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
-						connectingIP = addr.IP
-						log.Trace("Client IP taken from socket", "ip", connectingIP, "remoteAddr", conn.RemoteAddr())
-					} else {
-						log.Warn("No client IP could be determined from socket", "remoteAddr", conn.RemoteAddr())
-					}
+				if peerIP := remoteIP(conn); peerIP != nil {
+					connectingIP = config.IPFilter.ClientIP(peerIP, cfConnectingIP, forwardedFor)
+					log.Trace("Client IP determined", "ip", connectingIP, "remoteAddr", conn.RemoteAddr(), "cfConnectingIP", cfConnectingIP, "forwardedFor", forwardedFor)
+				} else {
+					log.Warn("No client IP could be determined from socket", "remoteAddr", conn.RemoteAddr())
+				}
+				if !config.IPFilter.Allowed(connectingIP) {
+					clientsFilteredCounter.Inc(1)
+					return nil, ws.RejectConnectionError(
+						ws.RejectionStatus(http.StatusForbidden),
+						ws.RejectionReason("Feed not served to this address."),
+					)
+				}
+
+				var err error
+				identity, err = s.authenticator.authenticate(authorization)
+				if err != nil {
+					log.Debug("feed client not authenticated", "connectingIP", connectingIP, "err", err)
+					clientsTotalFailedAuthCounter.Inc(1)
+					return nil, ws.RejectConnectionError(
+						ws.RejectionStatus(http.StatusUnauthorized),
+						ws.RejectionReason("Missing or invalid feed auth token."),
+					)
 				}
 
 				if config.ConnectionLimits.Enable && !s.clientManager.connectionLimiter.IsAllowed(connectingIP) {
@@ -305,14 +557,24 @@ func (s *WSBroadcastServer) StartWithHeader(ctx context.Context, header ws.Hands
 						ws.RejectionReason("Too many open feed connections."),
 					)
 				}
+				if s.clientManager.full() {
+					clientsRejectedFullCounter.Inc(1)
+					return nil, ws.RejectConnectionError(
+						ws.RejectionStatus(http.StatusServiceUnavailable),
+						ws.RejectionReason("Too many feed clients."),
+					)
+				}
 
 				return header, nil
 			},
+			Protocol: func(protocol []byte) bool {
+				return config.EnableBinary && string(protocol) == BinaryFeedSubprotocol
+			},
 			Negotiate: negotiate,
 		}
 
 		// Zero-copy upgrade to WebSocket connection.
-		_, err = upgrader.Upgrade(conn)
+		handshake, err := upgrader.Upgrade(request)
 
 		if err != nil {
 			if err.Error() != "" {
@@ -348,7 +610,7 @@ func (s *WSBroadcastServer) StartWithHeader(ctx context.Context, header ws.Hands
 		}
 
 		// Create netpoll event descriptor to handle only read events.
-		desc, err := netpoll.HandleRead(conn)
+		desc, err := netpoll.HandleRead(pollable(conn))
 		if err != nil {
 			log.Warn("error in HandleRead", "connectingIP", connectingIP, "err", err)
 			_ = conn.Close()
@@ -358,7 +620,8 @@ func (s *WSBroadcastServer) StartWithHeader(ctx context.Context, header ws.Hands
 		// Register incoming client in clientManager.
 		safeConn := writeDeadliner{conn, config.WriteTimeout}
 
-		client := s.clientManager.Register(safeConn, desc, requestedSeqNum, connectingIP, compressionAccepted)
+		binary := handshake.Protocol == BinaryFeedSubprotocol
+		client := s.clientManager.Register(safeConn, desc, requestedSeqNum, connectingIP, clientId, identity, compressionAccepted, binary, bulkCatchup)
 
 		// Subscribe to events about conn.
 		err = s.poller.Start(desc, func(ev netpoll.Event) {
@@ -376,11 +639,21 @@ func (s *WSBroadcastServer) StartWithHeader(ctx context.Context, header ws.Hands
 
 			// receive client messages, close on error
 			s.clientManager.pool.Schedule(func() {
-				// Ignore any messages sent from client, close on any error
-				if _, _, err := client.Receive(ctx, s.config().ReadTimeout); err != nil {
+				// Ignore any messages sent from client other than catchup requests, close on any error
+				msg, op, err := client.Receive(ctx, s.config().ReadTimeout)
+				if err != nil {
 					s.clientManager.Remove(client)
 					return
 				}
+				if len(msg) == 0 || op != ws.OpText {
+					return
+				}
+				var request CatchupRequest
+				if err := json.Unmarshal(msg, &request); err != nil {
+					log.Debug("ignoring unrecognized message from client", "client", client.Name, "err", err)
+					return
+				}
+				s.clientManager.RequestCatchup(client, request.RequestedSequenceNumber)
 			})
 		})
 
@@ -399,8 +672,69 @@ func (s *WSBroadcastServer) StartWithHeader(ctx context.Context, header ws.Hands
 
 	s.listener = ln
 
-	log.Info("arbitrum websocket broadcast server is listening", "address", ln.Addr().String())
+	serveTCP := func(conn net.Conn) {
+		if s.allowPeer(conn) {
+			handle(conn)
+		}
+	}
+	if config.TLS.Enabled() {
+		s.certReloader, err = newCertReloader(func() *TLSConfig { return &s.config().TLS })
+		if err != nil {
+			_ = ln.Close()
+			return err
+		}
+		s.certReloader.reloadOnSignal(ctx)
+		serveTCP = func(conn net.Conn) {
+			if !s.allowPeer(conn) {
+				return
+			}
+			if tlsConn, ok := s.handshakeTLS(conn); ok {
+				handle(tlsConn)
+			}
+		}
+	}
+
+	log.Info("arbitrum websocket broadcast server is listening", "address", ln.Addr().String(), "tls", config.TLS.Enabled())
+
+	if err := s.serve(ctx, ln, &s.acceptDesc, serveTCP); err != nil {
+		return err
+	}
+
+	if config.UnixSocket != "" {
+		unixLn, err := listenUnix(config.UnixSocket)
+		if err != nil {
+			log.Error("error listening on unix socket", "path", config.UnixSocket, "err", err)
+			return err
+		}
+		s.unixListener = unixLn
+		log.Info("arbitrum websocket broadcast server is listening", "unixSocket", config.UnixSocket)
+		if err := s.serve(ctx, unixLn, &s.unixAcceptDesc, handle); err != nil {
+			return err
+		}
+	}
+
+	if config.GRPC.Enable {
+		if err := s.startGRPC(config); err != nil {
+			return err
+		}
+	}
+
+	if config.WebTransport.Enable {
+		if err := s.startWebTransport(config); err != nil {
+			return err
+		}
+	}
+
+	s.started = true
+	s.handle = handle
 
+	return nil
+}
+
+// serve accepts connections on ln and hands them to handle until the listener
+// is closed. desc is set to the netpoll descriptor of the listener, and
+// cleared under acceptDescMutex on shutdown.
+func (s *WSBroadcastServer) serve(ctx context.Context, ln net.Listener, desc **netpoll.Desc, handle func(net.Conn)) error {
 	// Create netpoll descriptor for the listener.
 	// We use OneShot here to synchronously manage the rate that new connections are accepted
 	acceptDesc, err := netpoll.HandleListener(ln, netpoll.EventRead|netpoll.EventOneShot)
@@ -408,7 +742,9 @@ func (s *WSBroadcastServer) StartWithHeader(ctx context.Context, header ws.Hands
 		log.Error("error calling HandleListener", "err", err)
 		return err
 	}
-	s.acceptDesc = acceptDesc
+	s.acceptDescMutex.Lock()
+	*desc = acceptDesc
+	s.acceptDescMutex.Unlock()
 
 	// acceptErrChan blocks until connection accepted or error occurred
 	// OneShot is used, so reusing a single channel is fine
@@ -459,12 +795,12 @@ func (s *WSBroadcastServer) StartWithHeader(ctx context.Context, header ws.Hands
 		}
 
 		s.acceptDescMutex.Lock()
-		if s.acceptDesc == nil {
+		if *desc == nil {
 			// Already shutting down
 			s.acceptDescMutex.Unlock()
 			return
 		}
-		err = s.poller.Resume(s.acceptDesc)
+		err = s.poller.Resume(*desc)
 		s.acceptDescMutex.Unlock()
 		if err != nil {
 			log.Warn("error in poller.Resume", "err", err)
@@ -476,12 +812,20 @@ func (s *WSBroadcastServer) StartWithHeader(ctx context.Context, header ws.Hands
 		log.Warn("error in starting broadcaster poller", "err", err)
 		return err
 	}
-
-	s.started = true
-
 	return nil
 }
 
+// listenUnix listens on the unix socket at path, replacing the socket file
+// left behind by a previous run
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", path)
+}
+
 func (s *WSBroadcastServer) ListenerAddr() net.Addr {
 	return s.listener.Addr()
 }
@@ -505,6 +849,48 @@ func (s *WSBroadcastServer) StopAndWait() {
 		log.Warn("error in acceptDesc.Close", "err", err)
 	}
 
+	if s.unixListener != nil {
+		if err := s.unixListener.Close(); err != nil {
+			log.Warn("error closing unix socket listener", "err", err)
+		}
+		s.acceptDescMutex.Lock()
+		unixAcceptDesc := s.unixAcceptDesc
+		s.unixAcceptDesc = nil
+		s.acceptDescMutex.Unlock()
+		if unixAcceptDesc != nil {
+			if err := s.poller.Stop(unixAcceptDesc); err != nil {
+				log.Warn("error in poller.Stop", "err", err)
+			}
+			if err := unixAcceptDesc.Close(); err != nil {
+				log.Warn("error in acceptDesc.Close", "err", err)
+			}
+		}
+		s.unixListener = nil
+	}
+
+	if s.grpcServer != nil {
+		// Ends the streams, their loopback connections are closed with them
+		s.grpcServer.Stop()
+		s.grpcStreams.Wait()
+		s.grpcServer = nil
+		s.grpcListener = nil
+	}
+
+	if s.webTransport != nil {
+		if err := s.webTransport.Close(); err != nil {
+			log.Warn("error closing webtransport server", "err", err)
+		}
+		if err := s.quicConn.Close(); err != nil {
+			log.Warn("error closing webtransport socket", "err", err)
+		}
+		s.webTransport = nil
+		s.quicConn = nil
+	}
+
+	s.startMutex.Lock()
+	s.handle = nil
+	s.startMutex.Unlock()
+
 	s.clientManager.StopAndWait()
 	s.started = false
 }
@@ -535,3 +921,12 @@ func (d writeDeadliner) Write(p []byte) (int, error) {
 	}
 	return d.Conn.Write(p)
 }
+
+// WriteBuffers writes bufs with a single deadline, using writev if the
+// connection supports it.
+func (d writeDeadliner) WriteBuffers(bufs *net.Buffers) (int64, error) {
+	if err := d.Conn.SetWriteDeadline(time.Now().Add(d.t)); err != nil {
+		return 0, err
+	}
+	return bufs.WriteTo(d.Conn)
+}